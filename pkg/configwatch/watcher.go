@@ -0,0 +1,247 @@
+// Package configwatch watches config file or directory for content changes.
+//
+// The parent directory of the file is watched with fsnotify instead of the
+// file itself so that atomic updates done by replacing the file or a symlink
+// are detected. This includes Kubernetes ConfigMap volume mounts, where the
+// file is a symlink into the `..data` directory symlink which is atomically
+// swapped to the new timestamped data directory on every update.
+//
+// If the path is a directory, the directory itself is watched and all the
+// `*.yaml` and `*.yml` files in it are treated as fragments of the config.
+// Callback is invoked when any fragment is added, removed or changed. It is
+// passed all fragments in lexical order joined as a multi-document YAML
+// stream, callers needing per file errors should re-read the directory with
+// mirror.LoadConfig.
+//
+// Bursts of events are debounced and callback is only invoked if the sha256
+// hash of the file content has actually changed. If fsnotify is not available
+// watcher falls back to polling the file.
+package configwatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// DefaultDebounce is the time watcher waits after last event before
+	// reading the file
+	DefaultDebounce = 500 * time.Millisecond
+
+	// DefaultPollInterval is the interval between reads of the file when
+	// fsnotify is not available
+	DefaultPollInterval = 10 * time.Second
+
+	// k8sDataDir is the symlink to the current data dir of ConfigMap and
+	// Secret volumes, it is replaced on every update
+	k8sDataDir = "..data"
+)
+
+// Watcher invokes callback with the content of the file when it changes
+type Watcher struct {
+	path     string
+	dir      bool
+	onChange func(data []byte)
+	log      *slog.Logger
+
+	// Debounce is the time to wait for more events before reading the file
+	Debounce time.Duration
+	// PollInterval is the interval between reads if fsnotify is not available
+	PollInterval time.Duration
+
+	lastHash [sha256.Size]byte
+	loaded   bool
+}
+
+// New returns watcher of the file or directory of config fragments at the
+// given path. onChange is called from the watcher's goroutine with the
+// content of the file once when watcher starts and every time content changes
+// after that.
+func New(path string, onChange func(data []byte), log *slog.Logger) (*Watcher, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get absolute path err:%w", err)
+	}
+	if onChange == nil {
+		return nil, fmt.Errorf("onChange callback is required")
+	}
+	if log == nil {
+		log = slog.Default()
+	}
+	// path which doesn't exist yet is watched as file
+	var dir bool
+	if info, err := os.Stat(path); err == nil {
+		dir = info.IsDir()
+	}
+	return &Watcher{
+		path:         path,
+		dir:          dir,
+		onChange:     onChange,
+		log:          log.With("config", path),
+		Debounce:     DefaultDebounce,
+		PollInterval: DefaultPollInterval,
+	}, nil
+}
+
+// Run reads the file and watches it for changes until context is cancelled.
+// if fsnotify watcher can't be created watcher falls back to polling.
+func (w *Watcher) Run(ctx context.Context) {
+	w.check()
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.log.Warn("unable to create fsnotify watcher, falling back to polling", "interval", w.PollInterval, "err", err)
+		w.poll(ctx)
+		return
+	}
+	defer fw.Close()
+
+	watchDir := filepath.Dir(w.path)
+	if w.dir {
+		watchDir = w.path
+	}
+	if err := fw.Add(watchDir); err != nil {
+		w.log.Warn("unable to watch config dir, falling back to polling", "interval", w.PollInterval, "err", err)
+		w.poll(ctx)
+		return
+	}
+
+	if !w.watch(ctx, fw) {
+		w.log.Warn("fsnotify watcher closed, falling back to polling", "interval", w.PollInterval)
+		w.poll(ctx)
+	}
+}
+
+// watch processes fsnotify events until context is cancelled, it returns
+// false if fsnotify watcher was closed
+func (w *Watcher) watch(ctx context.Context, fw *fsnotify.Watcher) bool {
+	debounce := time.NewTimer(w.Debounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case e, ok := <-fw.Events:
+			if !ok {
+				return false
+			}
+			if w.relevant(e) {
+				w.log.Log(ctx, -8, "config event", "event", e)
+				debounce.Reset(w.Debounce)
+			}
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return false
+			}
+			w.log.Error("config watcher error", "err", err)
+		case <-debounce.C:
+			w.check()
+		}
+	}
+}
+
+// relevant returns true if event might have changed content of the file
+func (w *Watcher) relevant(e fsnotify.Event) bool {
+	if !e.Has(fsnotify.Create) && !e.Has(fsnotify.Write) &&
+		!e.Has(fsnotify.Rename) && !e.Has(fsnotify.Remove) {
+		return false
+	}
+	// config file is replaced or written or Kubernetes data dir
+	// symlink is swapped
+	name := filepath.Clean(e.Name)
+	if filepath.Base(name) == k8sDataDir {
+		return true
+	}
+	if w.dir {
+		return filepath.Dir(name) == w.path && isFragment(filepath.Base(name))
+	}
+	return name == w.path
+}
+
+// poll reads the file every poll interval until context is cancelled
+func (w *Watcher) poll(ctx context.Context) {
+	t := time.NewTicker(w.PollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			w.check()
+		}
+	}
+}
+
+// check reads the file and invokes callback if its content has changed since
+// last check. read errors are logged and last content is kept as file might
+// be temporarily missing during updates.
+func (w *Watcher) check() {
+	read := os.ReadFile
+	if w.dir {
+		read = readFragments
+	}
+	data, err := read(w.path)
+	if err != nil {
+		w.log.Error("unable to read config file", "err", err)
+		return
+	}
+
+	hash := sha256.Sum256(data)
+	if w.loaded && hash == w.lastHash {
+		w.log.Debug("config file content not changed")
+		return
+	}
+	w.lastHash = hash
+	w.loaded = true
+
+	w.log.Info("config file changed", "sha256", fmt.Sprintf("%x", hash))
+	w.onChange(data)
+}
+
+// readFragments returns content of all the config fragments in the dir joined
+// as multi-document YAML stream, every document starts with comment naming
+// the file so adding, removing or renaming a fragment changes the content
+func readFragments(dir string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	// entries are sorted by filename
+	for _, e := range entries {
+		if !isFragment(e.Name()) || e.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		data = fmt.Appendf(data, "---\n# %s\n", e.Name())
+		data = append(data, content...)
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			data = append(data, '\n')
+		}
+	}
+	return data, nil
+}
+
+// isFragment returns true if file with the given name in the config dir is
+// a config fragment, hidden files like editor swap files are ignored
+func isFragment(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
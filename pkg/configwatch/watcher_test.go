@@ -0,0 +1,264 @@
+package configwatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testDebounce = 100 * time.Millisecond
+
+// recorder collects content passed to the onChange callback
+type recorder struct {
+	mu      sync.Mutex
+	changes []string
+}
+
+func (r *recorder) onChange(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes = append(r.changes, string(data))
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.changes...)
+}
+
+// waitFor waits until recorder has the wanted changes or fails after timeout
+func (r *recorder) waitFor(t *testing.T, want []string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cmp.Equal(want, r.get()) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if diff := cmp.Diff(want, r.get()); diff != "" {
+		t.Fatalf("changes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// startWatcher runs the watcher in the background until test ends
+func startWatcher(t *testing.T, path string, poll bool) *recorder {
+	t.Helper()
+
+	rec := &recorder{}
+	w, err := New(path, rec.onChange, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.Debounce = testDebounce
+	w.PollInterval = testDebounce
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if poll {
+			w.check()
+			w.poll(ctx)
+		} else {
+			w.Run(ctx)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return rec
+}
+
+func mustWriteFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mustUpdateConfigMap simulates kubelet's atomic writer update of the
+// ConfigMap volume, new data dir is created and `..data` symlink is swapped
+// to it by renaming temp symlink, old data dir is removed after that
+func mustUpdateConfigMap(t *testing.T, dir, dataDir, content string) {
+	t.Helper()
+
+	old, _ := os.Readlink(filepath.Join(dir, k8sDataDir))
+
+	mustWriteFile(t, filepath.Join(dir, dataDir, "config.yaml"), content)
+	if err := os.Symlink(dataDir, filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, k8sDataDir)); err != nil {
+		t.Fatal(err)
+	}
+	if old != "" {
+		if err := os.RemoveAll(filepath.Join(dir, old)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// user visible file only created once
+	if _, err := os.Lstat(filepath.Join(dir, "config.yaml")); os.IsNotExist(err) {
+		if err := os.Symlink(filepath.Join(k8sDataDir, "config.yaml"), filepath.Join(dir, "config.yaml")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWatcher_configMap(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	mustUpdateConfigMap(t, dir, "..2024_01_01_00_00_00.1", "v1")
+	rec := startWatcher(t, path, false)
+	rec.waitFor(t, []string{"v1"})
+
+	mustUpdateConfigMap(t, dir, "..2024_01_01_00_00_00.2", "v2")
+	rec.waitFor(t, []string{"v1", "v2"})
+
+	// update with same content should not trigger callback
+	mustUpdateConfigMap(t, dir, "..2024_01_01_00_00_00.3", "v2")
+	time.Sleep(3 * testDebounce)
+	mustUpdateConfigMap(t, dir, "..2024_01_01_00_00_00.4", "v3")
+	rec.waitFor(t, []string{"v1", "v2", "v3"})
+}
+
+func TestWatcher_regularFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	mustWriteFile(t, path, "v1")
+
+	rec := startWatcher(t, path, false)
+	rec.waitFor(t, []string{"v1"})
+
+	// burst of writes should be debounced
+	for _, c := range []string{"v2-1", "v2-2", "v2"} {
+		mustWriteFile(t, path, c)
+	}
+	rec.waitFor(t, []string{"v1", "v2"})
+
+	// atomic replace by rename
+	mustWriteFile(t, filepath.Join(dir, "config.yaml.tmp"), "v3")
+	if err := os.Rename(filepath.Join(dir, "config.yaml.tmp"), path); err != nil {
+		t.Fatal(err)
+	}
+	rec.waitFor(t, []string{"v1", "v2", "v3"})
+
+	// changes to other files in the dir are ignored
+	mustWriteFile(t, filepath.Join(dir, "other.yaml"), "other")
+	time.Sleep(3 * testDebounce)
+	if diff := cmp.Diff([]string{"v1", "v2", "v3"}, rec.get()); diff != "" {
+		t.Errorf("changes mismatch (-want +got):\n%s", diff)
+	}
+
+	// file removed and re-created
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * testDebounce)
+	mustWriteFile(t, path, "v4")
+	rec.waitFor(t, []string{"v1", "v2", "v3", "v4"})
+}
+
+func TestWatcher_poll(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	mustUpdateConfigMap(t, dir, "..2024_01_01_00_00_00.1", "v1")
+	rec := startWatcher(t, path, true)
+	rec.waitFor(t, []string{"v1"})
+
+	mustUpdateConfigMap(t, dir, "..2024_01_01_00_00_00.2", "v2")
+	rec.waitFor(t, []string{"v1", "v2"})
+
+	mustUpdateConfigMap(t, dir, "..2024_01_01_00_00_00.3", "v2")
+	time.Sleep(3 * testDebounce)
+	if diff := cmp.Diff([]string{"v1", "v2"}, rec.get()); diff != "" {
+		t.Errorf("changes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("config.yaml", nil, nil); err == nil {
+		t.Errorf("expected error for missing callback")
+	}
+	w, err := New("config.yaml", func([]byte) {}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !filepath.IsAbs(w.path) {
+		t.Errorf("expected absolute path got %s", w.path)
+	}
+}
+
+func TestWatcher_dir(t *testing.T) {
+	dir := t.TempDir()
+	mustWriteFile(t, filepath.Join(dir, "a.yaml"), "a1")
+
+	rec := startWatcher(t, dir, false)
+	rec.waitFor(t, []string{"---\n# a.yaml\na1\n"})
+
+	// fragment added
+	mustWriteFile(t, filepath.Join(dir, "b.yml"), "b1\n")
+	rec.waitFor(t, []string{
+		"---\n# a.yaml\na1\n",
+		"---\n# a.yaml\na1\n---\n# b.yml\nb1\n",
+	})
+
+	// other files are ignored
+	mustWriteFile(t, filepath.Join(dir, "readme.md"), "readme")
+	mustWriteFile(t, filepath.Join(dir, ".c.yaml.swp"), "swap")
+	time.Sleep(3 * testDebounce)
+
+	// fragment changed
+	mustWriteFile(t, filepath.Join(dir, "a.yaml"), "a2")
+	rec.waitFor(t, []string{
+		"---\n# a.yaml\na1\n",
+		"---\n# a.yaml\na1\n---\n# b.yml\nb1\n",
+		"---\n# a.yaml\na2\n---\n# b.yml\nb1\n",
+	})
+
+	// fragment removed
+	if err := os.Remove(filepath.Join(dir, "a.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	rec.waitFor(t, []string{
+		"---\n# a.yaml\na1\n",
+		"---\n# a.yaml\na1\n---\n# b.yml\nb1\n",
+		"---\n# a.yaml\na2\n---\n# b.yml\nb1\n",
+		"---\n# b.yml\nb1\n",
+	})
+}
+
+func TestWatcher_dirPoll(t *testing.T) {
+	dir := t.TempDir()
+	mustWriteFile(t, filepath.Join(dir, "a.yaml"), "a1\n")
+
+	rec := startWatcher(t, dir, true)
+	rec.waitFor(t, []string{"---\n# a.yaml\na1\n"})
+
+	mustWriteFile(t, filepath.Join(dir, "b.yaml"), "b1\n")
+	rec.waitFor(t, []string{
+		"---\n# a.yaml\na1\n",
+		"---\n# a.yaml\na1\n---\n# b.yaml\nb1\n",
+	})
+
+	if err := os.Remove(filepath.Join(dir, "b.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	rec.waitFor(t, []string{
+		"---\n# a.yaml\na1\n",
+		"---\n# a.yaml\na1\n---\n# b.yaml\nb1\n",
+		"---\n# a.yaml\na1\n",
+	})
+}
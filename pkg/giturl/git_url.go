@@ -2,6 +2,7 @@ package giturl
 
 import (
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
 )
@@ -16,35 +17,156 @@ var (
 	// ssh://user@host.xz[:port]/path/to/repo.git
 	sshURLRgx = regexp.MustCompile(`^ssh://(?P<user>[\w\-\.]+)@(?P<host>([\w\-]+\.?[\w\-]+)+(\:\d+)??)/(?P<path>([\w\-\.]+\/)*)(?P<repo>[\w\-\.]+(\.git)?)$`)
 
-	// https://host.xz[:port]/path/to/repo.git
-	httpsURLRgx = regexp.MustCompile(`^https://(?P<host>([\w\-]+\.?[\w\-]+)+(\:\d+)?)/(?P<path>([\w\-\.]+\/)*)(?P<repo>[\w\-\.]+(\.git)?)$`)
+	// https://[user[:password]@]host.xz[:port]/path/to/repo.git
+	httpsURLRgx = regexp.MustCompile(`^https://((?P<user>[^@/:\s]+)(:(?P<password>[^@/\s]+))?@)?(?P<host>([\w\-]+\.?[\w\-]+)+(\:\d+)?)/(?P<path>([\w\-\.]+\/)*)(?P<repo>[\w\-\.]+(\.git)?)$`)
 
-	// file:///path/to/repo.git
-	localURLRgx = regexp.MustCompile(`^file:///(?P<path>([\w\-\.]+\/)*)(?P<repo>[\w\-\.]+(\.git)?)$`)
+	// file:///path/to/repo.git or file://localhost/path/to/repo.git
+	localURLRgx = regexp.MustCompile(`^file://(localhost)?/(?P<path>([\w\-\.]+\/)*)(?P<repo>[\w\-\.]+(\.git)?)$`)
+
+	// /path/to/repo.git
+	localPathRgx = regexp.MustCompile(`^/(?P<path>([\w\-\.]+\/)*)(?P<repo>[\w\-\.]+(\.git)?)$`)
+
+	// scheme://userinfo@, userinfo of the url might contain credentials so
+	// its case sensitive and masked by Redact
+	userinfoRgx = regexp.MustCompile(`(?P<scheme>[a-zA-Z][a-zA-Z0-9+.\-]*://)(?P<userinfo>[^@/\s]+)@`)
 )
 
+// redactedPassword replaces password or token of the url in the redacted form
+const redactedPassword = "xxxxx"
+
 // URL represents parsed git url
 type URL struct {
-	Scheme string // value will be either 'scp', 'ssh', 'https' or 'local'
-	User   string // might be empty for http and local urls
-	Host   string // host or host:port
-	Path   string // path to the repo
-	Repo   string // repository name from the path includes .git
+	Scheme   string // value will be either 'scp', 'ssh', 'https' or 'local'
+	User     string // might be empty for http and local urls
+	Password string // password embedded in https url, might be empty
+	Host     string // host or host:port, always empty for local urls
+	Path     string // path to the repo
+	Repo     string // repository name from the path includes .git
+}
+
+// String returns the url in the form of its scheme with the credentials of
+// https url masked (see Redact) so that it's safe to log. local urls are
+// always returned as 'file:///path/to/repo.git'
+func (u *URL) String() string {
+	return u.string(true)
+}
+
+// StringWithCredentials returns the url same as String but with the user
+// and password of https url kept, it must not be used in logs and errors
+func (u *URL) StringWithCredentials() string {
+	return u.string(false)
+}
+
+func (u *URL) string(redact bool) string {
+	repoPath := path.Join(u.Path, u.Repo)
+	switch u.Scheme {
+	case "scp":
+		return u.User + "@" + u.Host + ":" + repoPath
+	case "ssh":
+		return "ssh://" + u.User + "@" + u.Host + "/" + repoPath
+	case "https":
+		userinfo := u.User
+		if u.Password != "" {
+			userinfo += ":" + u.Password
+		}
+		if userinfo != "" && redact {
+			userinfo = redactUserinfo("https://", userinfo)
+		}
+		if userinfo != "" {
+			userinfo += "@"
+		}
+		return "https://" + userinfo + u.Host + "/" + repoPath
+	case "local":
+		return "file:///" + repoPath
+	}
+	return ""
+}
+
+// Redact returns given string with the credentials of all the urls in it
+// masked, so it can be used for raw urls as well as for command args and
+// output. password of the userinfo is masked, userinfo without password is
+// masked entirely as it might be a token (eg. 'https://<token>@host.xz')
+// except for ssh urls whose user is never a credential.
+func Redact(s string) string {
+	return userinfoRgx.ReplaceAllStringFunc(s, func(m string) string {
+		sm := userinfoRgx.FindStringSubmatch(m)
+		scheme, userinfo := sm[userinfoRgx.SubexpIndex("scheme")], sm[userinfoRgx.SubexpIndex("userinfo")]
+		return scheme + redactUserinfo(scheme, userinfo) + "@"
+	})
+}
+
+// redactUserinfo returns userinfo of the url with given scheme with its
+// credentials masked, see Redact
+func redactUserinfo(scheme, userinfo string) string {
+	if user, _, ok := strings.Cut(userinfo, ":"); ok {
+		return user + ":" + redactedPassword
+	}
+	if isSSHScheme(scheme) {
+		return userinfo
+	}
+	return redactedPassword
 }
 
-// NormaliseURL will return normalised url
+// isSSHScheme returns true if given 'scheme://' prefix is of the ssh url
+func isSSHScheme(scheme string) bool {
+	switch strings.ToLower(strings.TrimSuffix(scheme, "://")) {
+	case "ssh", "git+ssh", "ssh+git":
+		return true
+	}
+	return false
+}
+
+// NormaliseURL will return normalised url. local paths are case sensitive
+// so they are only cleaned and 'file://localhost/' is replaced with 'file:///'
+// userinfo of the non ssh urls is also case sensitive as it might contain
+// credentials, so its kept as is.
 func NormaliseURL(rawURL string) string {
-	nURL := strings.ToLower(strings.TrimSpace(rawURL))
+	nURL := strings.TrimSpace(rawURL)
+
+	if isLocal(nURL) {
+		return normaliseLocal(nURL)
+	}
+
 	nURL = strings.TrimRight(nURL, "/")
+	if m := userinfoRgx.FindStringSubmatchIndex(nURL); m != nil && m[0] == 0 {
+		scheme := nURL[:m[2*userinfoRgx.SubexpIndex("scheme")+1]]
+		if !isSSHScheme(scheme) {
+			userinfo := nURL[len(scheme):m[1]]
+			return strings.ToLower(scheme) + userinfo + strings.ToLower(nURL[m[1]:])
+		}
+	}
 
-	return nURL
+	return strings.ToLower(nURL)
+}
+
+// isLocal returns true if url is a file url or an absolute path
+func isLocal(rawURL string) bool {
+	return strings.HasPrefix(strings.ToLower(rawURL), "file://") ||
+		strings.HasPrefix(rawURL, "/")
+}
+
+func normaliseLocal(rawURL string) string {
+	if !strings.HasPrefix(rawURL, "/") {
+		p := rawURL[len("file://"):]
+		if len(p) >= len("localhost") && strings.EqualFold(p[:len("localhost")], "localhost") {
+			p = p[len("localhost"):]
+		}
+		// path.Clean would turn invalid empty path into "."
+		if p == "" {
+			return "file://"
+		}
+		return "file://" + path.Clean(p)
+	}
+	return path.Clean(rawURL)
 }
 
 // Parse parses a raw url into a GitURL structure.
 // valid git urls are...
 //   - user@host.xz:path/to/repo.git
 //   - ssh://user@host.xz[:port]/path/to/repo.git
-//   - https://host.xz[:port]/path/to/repo.git
+//   - https://[user[:password]@]host.xz[:port]/path/to/repo.git
+//   - file:///path/to/repo.git
+//   - /path/to/repo.git
 func Parse(rawURL string) (*URL, error) {
 	gURL := &URL{}
 
@@ -70,6 +192,8 @@ func Parse(rawURL string) (*URL, error) {
 	case IsHTTPSURL(rawURL):
 		sections = httpsURLRgx.FindStringSubmatch(rawURL)
 		gURL.Scheme = "https"
+		gURL.User = sections[httpsURLRgx.SubexpIndex("user")]
+		gURL.Password = sections[httpsURLRgx.SubexpIndex("password")]
 		gURL.Host = sections[httpsURLRgx.SubexpIndex("host")]
 		gURL.Path = sections[httpsURLRgx.SubexpIndex("path")]
 		gURL.Repo = sections[httpsURLRgx.SubexpIndex("repo")]
@@ -78,17 +202,23 @@ func Parse(rawURL string) (*URL, error) {
 		gURL.Scheme = "local"
 		gURL.Path = sections[localURLRgx.SubexpIndex("path")]
 		gURL.Repo = sections[localURLRgx.SubexpIndex("repo")]
+	case IsLocalPath(rawURL):
+		sections = localPathRgx.FindStringSubmatch(rawURL)
+		gURL.Scheme = "local"
+		gURL.Path = sections[localPathRgx.SubexpIndex("path")]
+		gURL.Repo = sections[localPathRgx.SubexpIndex("repo")]
 	default:
 		return nil, fmt.Errorf(
-			"provided '%s' remote url is invalid, supported urls are 'user@host.xz:path/to/repo.git','ssh://user@host.xz/path/to/repo.git' or 'https://host.xz/path/to/repo.git'",
-			rawURL)
+			"provided '%s' remote url is invalid, supported urls are 'user@host.xz:path/to/repo.git','ssh://user@host.xz/path/to/repo.git', 'https://host.xz/path/to/repo.git', 'file:///path/to/repo.git' or '/path/to/repo.git'",
+			Redact(rawURL))
 	}
 
 	// scp path doesn't have leading "/"
 	// also removing training "/" for consistency
 	gURL.Path = strings.Trim(gURL.Path, "/")
 
-	if gURL.Path == "" {
+	// local repositories can be at the root of the file system
+	if gURL.Path == "" && gURL.Scheme != "local" {
 		return nil, fmt.Errorf("repo path (org) cannot be empty")
 	}
 	if gURL.Repo == "" || gURL.Repo == ".git" {
@@ -100,7 +230,8 @@ func Parse(rawURL string) (*URL, error) {
 
 // SameURL returns whether or not the two parsed git URLs are equivalent.
 // git URLs can be represented in multiple schemes so if host, path and repo name
-// of URLs are same then those URLs are for the same remote repository
+// of URLs are same then those URLs are for the same remote repository.
+// 'file:///path/to/repo.git' and '/path/to/repo.git' are the same repository.
 func SameURL(lURL, rURL *URL) bool {
 	return lURL.Host == rURL.Host &&
 		lURL.Path == rURL.Path &&
@@ -137,7 +268,12 @@ func IsHTTPSURL(rawURL string) bool {
 	return httpsURLRgx.MatchString(rawURL)
 }
 
-// IsLocalURL returns true if supplied URL is HTTPS URL
+// IsLocalURL returns true if supplied URL is file URL
 func IsLocalURL(rawURL string) bool {
 	return localURLRgx.MatchString(rawURL)
 }
+
+// IsLocalPath returns true if supplied URL is an absolute local path
+func IsLocalPath(rawURL string) bool {
+	return localPathRgx.MatchString(rawURL)
+}
@@ -2,9 +2,41 @@
 
 package lock
 
-import "github.com/sasha-s/go-deadlock"
+import (
+	"context"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
 
 // this type is used only in test for deadlock detection
 type RWMutex struct {
 	deadlock.RWMutex
 }
+
+// pollInterval is the time between lock attempts of the context aware
+// lock methods, deadlock.RWMutex can't be waited on with context
+const pollInterval = time.Millisecond
+
+// LockContext locks rw for writing or returns context error once context is done
+func (rw *RWMutex) LockContext(ctx context.Context) error {
+	return tryWithContext(ctx, rw.TryLock)
+}
+
+// RLockContext locks rw for reading or returns context error once context is done
+func (rw *RWMutex) RLockContext(ctx context.Context) error {
+	return tryWithContext(ctx, rw.TryRLock)
+}
+
+func tryWithContext(ctx context.Context, try func() bool) error {
+	for {
+		if try() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -2,8 +2,152 @@
 
 package lock
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
+// RWMutex is a reader/writer mutual exclusion lock which, unlike
+// sync.RWMutex, can be acquired with context. waiters are woken as soon as
+// the lock is released or their context is done.
+// similar to sync.RWMutex, once writer is waiting new readers are blocked
+// until writer acquires and releases the lock. zero value is an unlocked mutex.
 type RWMutex struct {
-	sync.RWMutex
+	mu             sync.Mutex
+	readers        int           // number of active readers, -1 if writer holds the lock
+	writersWaiting int           // number of writers waiting for the lock
+	released       chan struct{} // closed and replaced when lock state changes
+}
+
+// Lock locks rw for writing
+func (rw *RWMutex) Lock() {
+	rw.LockContext(context.Background())
+}
+
+// LockContext locks rw for writing, it blocks until lock is acquired or
+// given context is done in which case context error is returned
+func (rw *RWMutex) LockContext(ctx context.Context) error {
+	rw.mu.Lock()
+	if rw.readers == 0 {
+		rw.readers = -1
+		rw.mu.Unlock()
+		return nil
+	}
+	rw.writersWaiting++
+	for {
+		wait := rw.waitCh()
+		rw.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			rw.mu.Lock()
+			rw.writersWaiting--
+			// readers blocked by this writer can proceed
+			rw.notify()
+			rw.mu.Unlock()
+			return ctx.Err()
+		}
+
+		rw.mu.Lock()
+		if rw.readers == 0 {
+			rw.readers = -1
+			rw.writersWaiting--
+			rw.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// TryLock tries to lock rw for writing and reports whether it succeeded
+func (rw *RWMutex) TryLock() bool {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.readers != 0 {
+		return false
+	}
+	rw.readers = -1
+	return true
+}
+
+// Unlock unlocks rw for writing
+func (rw *RWMutex) Unlock() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.readers != -1 {
+		panic("lock: Unlock of unlocked RWMutex")
+	}
+	rw.readers = 0
+	rw.notify()
+}
+
+// RLock locks rw for reading
+func (rw *RWMutex) RLock() {
+	rw.RLockContext(context.Background())
+}
+
+// RLockContext locks rw for reading, it blocks until lock is acquired or
+// given context is done in which case context error is returned
+func (rw *RWMutex) RLockContext(ctx context.Context) error {
+	rw.mu.Lock()
+	for rw.readers == -1 || rw.writersWaiting > 0 {
+		wait := rw.waitCh()
+		rw.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		rw.mu.Lock()
+	}
+	rw.readers++
+	rw.mu.Unlock()
+	return nil
+}
+
+// TryRLock tries to lock rw for reading and reports whether it succeeded
+func (rw *RWMutex) TryRLock() bool {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.readers == -1 || rw.writersWaiting > 0 {
+		return false
+	}
+	rw.readers++
+	return true
+}
+
+// RUnlock undoes a single RLock call
+func (rw *RWMutex) RUnlock() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.readers <= 0 {
+		panic("lock: RUnlock of unlocked RWMutex")
+	}
+	rw.readers--
+	if rw.readers == 0 {
+		rw.notify()
+	}
+}
+
+// waitCh returns channel which is closed on next lock state change.
+// it must be called with mu held
+func (rw *RWMutex) waitCh() chan struct{} {
+	if rw.released == nil {
+		rw.released = make(chan struct{})
+	}
+	return rw.released
+}
+
+// notify wakes up all the waiters. it must be called with mu held
+func (rw *RWMutex) notify() {
+	if rw.released != nil {
+		close(rw.released)
+		rw.released = nil
+	}
 }
@@ -0,0 +1,201 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRWMutex_RLockContext(t *testing.T) {
+	var rw RWMutex
+
+	// multiple readers can hold the lock
+	if err := rw.RLockContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := rw.RLockContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rw.TryLock() {
+		t.Fatalf("expected TryLock to fail while read locked")
+	}
+	rw.RUnlock()
+	rw.RUnlock()
+
+	rw.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rw.RLockContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded got: %v", err)
+	}
+	rw.Unlock()
+
+	// lock must be usable after cancelled wait
+	if !rw.TryRLock() {
+		t.Fatalf("expected TryRLock to succeed")
+	}
+	rw.RUnlock()
+}
+
+func TestRWMutex_LockContext(t *testing.T) {
+	var rw RWMutex
+
+	rw.RLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rw.LockContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded got: %v", err)
+	}
+
+	// cancelled writer must not block new readers
+	if !rw.TryRLock() {
+		t.Fatalf("expected TryRLock to succeed after writer gave up")
+	}
+	rw.RUnlock()
+	rw.RUnlock()
+
+	if err := rw.LockContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rw.TryRLock() {
+		t.Fatalf("expected TryRLock to fail while write locked")
+	}
+	rw.Unlock()
+}
+
+func TestRWMutex_cancelWhileWaiting(t *testing.T) {
+	var rw RWMutex
+	rw.Lock()
+	defer rw.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { errs <- rw.RLockContext(ctx) }()
+	go func() { errs <- rw.LockContext(ctx) }()
+
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	cancel()
+	for range 2 {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("expected Canceled got: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("waiter not woken up after cancel")
+		}
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("waiters took %s to notice cancellation", d)
+	}
+}
+
+func TestRWMutex_wakeOnRelease(t *testing.T) {
+	var rw RWMutex
+	rw.Lock()
+
+	acquired := make(chan struct{})
+	go func() {
+		if err := rw.RLockContext(context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		close(acquired)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	rw.Unlock()
+	select {
+	case <-acquired:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("reader not woken up after unlock")
+	}
+	rw.RUnlock()
+}
+
+func TestRWMutex_writerBlocksNewReaders(t *testing.T) {
+	var rw RWMutex
+	rw.RLock()
+
+	locked := make(chan struct{})
+	go func() {
+		rw.Lock()
+		close(locked)
+	}()
+
+	// wait for the writer to queue
+	time.Sleep(10 * time.Millisecond)
+	if rw.TryRLock() {
+		t.Fatalf("expected new reader to be blocked by waiting writer")
+	}
+	rw.RUnlock()
+	<-locked
+	rw.Unlock()
+}
+
+func TestRWMutex_concurrent(t *testing.T) {
+	var (
+		rw      RWMutex
+		wg      sync.WaitGroup
+		counter int
+	)
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if i%5 == 0 {
+					rw.Lock()
+					counter++
+					rw.Unlock()
+				} else {
+					rw.RLock()
+					_ = counter
+					rw.RUnlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if counter != 1000 {
+		t.Errorf("expected counter 1000 got %d", counter)
+	}
+}
+
+// benchmarkAcquireAfterRelease measures time between writer releasing the
+// lock and waiting reader acquiring it
+func benchmarkAcquireAfterRelease(b *testing.B, rLock func(*RWMutex)) {
+	var total time.Duration
+	for range b.N {
+		var rw RWMutex
+		rw.Lock()
+		acquired := make(chan time.Time)
+		go func() {
+			rLock(&rw)
+			acquired <- time.Now()
+		}()
+		time.Sleep(100 * time.Microsecond)
+		released := time.Now()
+		rw.Unlock()
+		total += (<-acquired).Sub(released)
+		rw.RUnlock()
+	}
+	b.ReportMetric(float64(total.Microseconds())/float64(b.N), "µs-latency/op")
+}
+
+func BenchmarkRLockContext(b *testing.B) {
+	benchmarkAcquireAfterRelease(b, func(rw *RWMutex) {
+		rw.RLockContext(context.Background())
+	})
+}
+
+// BenchmarkRLockPolling is the previous TryRLock polling approach
+func BenchmarkRLockPolling(b *testing.B) {
+	benchmarkAcquireAfterRelease(b, func(rw *RWMutex) {
+		for !rw.TryRLock() {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/giturl"
+)
+
+// ErrAdoptRefused is returned if existing repository dir can't be adopted
+// without risking data of the other repository, see RepositoryConfig.AdoptExisting
+var ErrAdoptRefused = errors.New("existing repository can't be adopted")
+
+// AdoptChange is the change made to the existing repository to adopt it as
+// the mirror of the configured remote
+type AdoptChange struct {
+	// Config is the git config or ref (eg. 'remote.origin.url') changed to adopt the repository
+	Config string `json:"config"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+func (c AdoptChange) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Config, c.Old, c.New)
+}
+
+// PlanAdoption reports changes which would be made to the existing
+// repository dir to adopt it without changing anything (dry-run).
+// ErrAdoptRefused is returned if it can't be adopted, empty plan means
+// repository already matches the config.
+func (r *Repository) PlanAdoption(ctx context.Context) ([]AdoptChange, error) {
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer r.lock.RUnlock()
+
+	return r.adoptionPlan(ctx)
+}
+
+// adoptRepo applies adoption plan to the existing repository, each change
+// is logged before its applied.
+// it must be called with repository write lock held.
+func (r *Repository) adoptRepo(ctx context.Context) error {
+	changes, err := r.adoptionPlan(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		r.log.Info("adopting existing repo", "config", c.Config, "old", c.Old, "new", c.New)
+		if err := r.applyAdoptChange(ctx, c); err != nil {
+			return fmt.Errorf("unable to adopt existing repo change:%s err:%w", c, err)
+		}
+	}
+	return nil
+}
+
+// adoptionPlan returns changes required to adopt existing repository dir
+func (r *Repository) adoptionPlan(ctx context.Context) ([]AdoptChange, error) {
+	if _, err := os.Stat(r.dir); err != nil {
+		return nil, fmt.Errorf("unable to verify repo dir err:%w", err)
+	}
+
+	// git rev-parse --is-bare-repository
+	if ok, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "rev-parse", "--is-bare-repository"); err != nil || ok != "true" {
+		return nil, fmt.Errorf("%w: %s is not a bare repository", ErrAdoptRefused, r.dir)
+	}
+	// git rev-parse --absolute-git-dir
+	if root, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "rev-parse", "--absolute-git-dir"); err != nil || root != r.dir {
+		return nil, fmt.Errorf("%w: %s is not the root of the repository", ErrAdoptRefused, r.dir)
+	}
+
+	var changes []AdoptChange
+
+	// missing config is treated as empty value
+	// git config --get remote.origin.url
+	url, _ := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--get", "remote.origin.url")
+	if url != r.remoteURL {
+		// origin of the different repository is never overwritten
+		if url != "" && giturl.NormaliseURL(url) != r.remoteURL {
+			return nil, fmt.Errorf("%w: remote.origin.url:%s is not the configured remote:%s", ErrAdoptRefused, giturl.Redact(url), r.remote)
+		}
+		changes = append(changes, AdoptChange{"remote.origin.url", giturl.Redact(url), r.remote})
+	}
+
+	// git config --get-all remote.origin.fetch
+	fetch, _ := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--get-all", "remote.origin.fetch")
+	if fetch == "" || !sameRefSpecs(strings.Split(fetch, "\n"), r.refSpecs) {
+		changes = append(changes, AdoptChange{"remote.origin.fetch", strings.ReplaceAll(fetch, "\n", " "), strings.Join(r.refSpecs, " ")})
+	}
+
+	// git config --get gitmirror.depth
+	depth, _ := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--get", "gitmirror.depth")
+	switch {
+	case depth != "" && depth != strconv.Itoa(r.depth):
+		return nil, fmt.Errorf("%w: repo was mirrored with different depth gitmirror.depth:%s", ErrAdoptRefused, depth)
+	case depth == "" && r.depth == 0:
+		// git rev-parse --is-shallow-repository
+		if shallow, _ := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "rev-parse", "--is-shallow-repository"); shallow == "true" {
+			return nil, fmt.Errorf("%w: shallow repository can only be adopted with depth", ErrAdoptRefused)
+		}
+	case depth == "":
+		changes = append(changes, AdoptChange{"gitmirror.depth", "", strconv.Itoa(r.depth)})
+	}
+
+	// git symbolic-ref HEAD
+	head, _ := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "symbolic-ref", "HEAD")
+	wantHead := "refs/heads/" + r.singleBranch
+	if r.singleBranch == "" {
+		// origin might not be adopted yet so remote is queried by url
+		var err error
+		if wantHead, err = r.remoteDefaultBranch(ctx, r.remoteURL); err != nil {
+			if head == "" {
+				return nil, fmt.Errorf("unable to get remote default branch err:%w", err)
+			}
+			r.log.Warn("unable to get remote default branch, keeping existing HEAD", "head", head, "err", err)
+			wantHead = head
+		}
+	}
+	if head != wantHead {
+		changes = append(changes, AdoptChange{"HEAD", head, wantHead})
+	}
+
+	return changes, nil
+}
+
+// applyAdoptChange applies single change of the adoption plan
+func (r *Repository) applyAdoptChange(ctx context.Context, c AdoptChange) error {
+	var err error
+	switch c.Config {
+	case "remote.origin.url":
+		if c.Old == "" {
+			// git remote add origin <remote>
+			_, err = runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "remote", "add", "origin", r.remoteURL)
+		} else {
+			// git remote set-url origin <remote>
+			_, err = runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "remote", "set-url", "origin", r.remoteURL)
+		}
+	case "remote.origin.fetch":
+		// git config --unset-all remote.origin.fetch
+		// it fails if there is no refspec to unset
+		runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--unset-all", "remote.origin.fetch")
+		for _, rs := range r.refSpecs {
+			// git config --add remote.origin.fetch <refspec>
+			if _, err = runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--add", "remote.origin.fetch", rs); err != nil {
+				break
+			}
+		}
+	case "gitmirror.depth":
+		// git config gitmirror.depth <depth>
+		_, err = runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "gitmirror.depth", c.New)
+	case "HEAD":
+		// git symbolic-ref HEAD <ref>
+		_, err = runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "symbolic-ref", "HEAD", c.New)
+	default:
+		err = fmt.Errorf("unknown adopt change")
+	}
+	return err
+}
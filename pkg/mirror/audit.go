@@ -0,0 +1,225 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// auditBufferSize is the number of audit events buffered before new
+	// events are dropped
+	auditBufferSize = 1000
+
+	// auditMaxCommits is the max number of commits between old and new hash
+	// whose changed files are included in the audit event
+	auditMaxCommits = 100
+)
+
+// AuditEvent is the record of the content change published on the worktree
+// link or of the authorization decision of the pool's http request, it is
+// written to the audit log as a JSON line
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	Remote  string    `json:"remote"`
+	Link    string    `json:"link"`
+	Ref     string    `json:"ref"`
+	OldHash string    `json:"oldHash"`
+	NewHash string    `json:"newHash"`
+	// ChangedFiles is the sorted list of files in the link's pathspec changed
+	// by the commits reachable from only one of old and new hash, so it also
+	// includes files of the commits undone by rollback or force push. empty
+	// if either hash is empty.
+	ChangedFiles []string `json:"changedFiles,omitempty"`
+	// Truncated is set if there were more than 100 commits on either side
+	// and changed files only include latest 100 commits of that side
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Caller, Method, Path, Role and Outcome are only set on the events of
+	// the http requests, content change fields are empty on such events.
+	// Outcome is one of allowed, unauthenticated, forbidden, no-authorizer
+	// or method-not-allowed, see Authorizer.
+	Caller  string `json:"caller,omitempty"`
+	Method  string `json:"method,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Role    string `json:"role,omitempty"`
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// auditLog appends audit events to the file in the background so that slow
+// disk doesn't hold up mirror cycles. events are dropped if buffer is full.
+// file is re-opened if it is removed or replaced by log rotation.
+type auditLog struct {
+	path   string
+	file   *os.File
+	info   os.FileInfo // info of the open file, used to detect rotation
+	events chan AuditEvent
+	done   chan struct{} // closed once writer has written all the events
+	log    *slog.Logger
+
+	lock   sync.RWMutex // protects closed
+	closed bool
+}
+
+// newAuditLog opens the audit log file and starts the writer
+func newAuditLog(path string, log *slog.Logger) (*auditLog, error) {
+	a := &auditLog{
+		path:   path,
+		events: make(chan AuditEvent, auditBufferSize),
+		done:   make(chan struct{}),
+		log:    log.With("audit-log", path),
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	go a.run()
+	return a, nil
+}
+
+func (a *auditLog) open() error {
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log err:%w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to stat audit log err:%w", err)
+	}
+	a.file, a.info = file, info
+	return nil
+}
+
+func (a *auditLog) run() {
+	defer close(a.done)
+	for e := range a.events {
+		if err := a.write(e); err != nil {
+			recordAuditWriteError()
+			a.log.Error("unable to write audit event", "link", e.Link, "err", err)
+		}
+	}
+	if a.file != nil {
+		if err := a.file.Close(); err != nil {
+			a.log.Error("unable to close audit log", "err", err)
+		}
+		a.file = nil
+	}
+}
+
+func (a *auditLog) write(e AuditEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// file was moved, removed or replaced by log rotation
+	if info, err := os.Stat(a.path); a.file != nil && (err != nil || !os.SameFile(info, a.info)) {
+		a.file.Close()
+		a.file = nil
+	}
+	if a.file == nil {
+		if err := a.open(); err != nil {
+			return err
+		}
+	}
+
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+// record queues event to be written without blocking, event is dropped if
+// buffer is full
+func (a *auditLog) record(e AuditEvent) {
+	if a == nil {
+		return
+	}
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	if a.closed {
+		recordAuditDropped()
+		a.log.Warn("audit log is closed, dropping event", "link", e.Link, "newHash", e.NewHash, "path", e.Path)
+		return
+	}
+	select {
+	case a.events <- e:
+	default:
+		recordAuditDropped()
+		a.log.Warn("audit log buffer is full, dropping event", "link", e.Link, "newHash", e.NewHash, "path", e.Path)
+	}
+}
+
+// close stops accepting new events and waits for the writer to write the
+// buffered events and close the file or for the context to be done
+func (a *auditLog) close(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.events)
+	}
+	a.lock.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("unable to write buffered audit events err:%w", ctx.Err())
+	}
+}
+
+// setAuditLog sets the audit log of the pool
+func (r *Repository) setAuditLog(a *auditLog) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.audit = a
+}
+
+// auditLinkUpdate records content change published on the worktree link
+// into the audit log if its enabled. it must be called with write lock held.
+func (r *Repository) auditLinkUpdate(ctx context.Context, wl *WorkTreeLink, ref, oldHash, newHash string) {
+	if r.audit == nil {
+		return
+	}
+
+	e := AuditEvent{
+		Time:    r.now().UTC(),
+		Remote:  r.remote,
+		Link:    wl.link,
+		Ref:     ref,
+		OldHash: oldHash,
+		NewHash: newHash,
+	}
+	if oldHash != "" && newHash != "" {
+		opts := ListCommitsOptions{MaxCount: auditMaxCommits + 1}
+		if wl.pathspec != "" {
+			opts.Pathspecs = []string{wl.pathspec}
+		}
+		// new hash is behind old hash on rollback and force push, commits
+		// of both sides are listed so undone changes are also recorded
+		for _, hashes := range [][2]string{{oldHash, newHash}, {newHash, oldHash}} {
+			commits, err := r.listCommits(ctx, hashes[0], hashes[1], opts)
+			if err != nil {
+				wl.log.Error("unable to list changed files for audit log", "err", err)
+			}
+			if len(commits) > auditMaxCommits {
+				commits = commits[:auditMaxCommits]
+				e.Truncated = true
+			}
+			for _, c := range commits {
+				e.ChangedFiles = append(e.ChangedFiles, c.ChangedFiles...)
+			}
+		}
+		slices.Sort(e.ChangedFiles)
+		e.ChangedFiles = slices.Compact(e.ChangedFiles)
+	}
+	r.audit.record(e)
+}
@@ -0,0 +1,138 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/mirror/repotest"
+)
+
+func TestAuditLog_record(t *testing.T) {
+	// writer is not started so buffer is never drained
+	a := &auditLog{events: make(chan AuditEvent, 2), log: slog.Default()}
+
+	for _, link := range []string{"/link1", "/link2", "/link3"} {
+		a.record(AuditEvent{Link: link})
+	}
+	if got := len(a.events); got != 2 {
+		t.Fatalf("expected 2 buffered events got:%d", got)
+	}
+	if e := <-a.events; e.Link != "/link1" {
+		t.Errorf("unexpected first event link:%s", e.Link)
+	}
+
+	// disabled audit log is no-op
+	var disabled *auditLog
+	disabled.record(AuditEvent{Link: "/link1"})
+}
+
+// readAuditLinks returns links of the audit events written to the file
+func readAuditLinks(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read audit log err:%v", err)
+	}
+	var links []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e AuditEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("unable to decode audit event %q err:%v", line, err)
+		}
+		links = append(links, e.Link)
+	}
+	return links
+}
+
+func TestAuditLog_rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a := &auditLog{path: path, log: slog.Default()}
+	if err := a.open(); err != nil {
+		t.Fatalf("unable to open audit log err:%v", err)
+	}
+	if err := a.write(AuditEvent{Link: "/link1"}); err != nil {
+		t.Fatalf("unable to write event err:%v", err)
+	}
+
+	// file is renamed and new file is created at the path before next write
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("unable to rotate audit log err:%v", err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("unable to create audit log err:%v", err)
+	}
+	if err := a.write(AuditEvent{Link: "/link2"}); err != nil {
+		t.Fatalf("unable to write event err:%v", err)
+	}
+
+	if got := readAuditLinks(t, path+".1"); !slices.Equal(got, []string{"/link1"}) {
+		t.Errorf("unexpected rotated audit log links got:%v", got)
+	}
+	if got := readAuditLinks(t, path); !slices.Equal(got, []string{"/link2"}) {
+		t.Errorf("unexpected audit log links got:%v", got)
+	}
+}
+
+func TestAuditLog_close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := newAuditLog(path, slog.Default())
+	if err != nil {
+		t.Fatalf("unable to create audit log err:%v", err)
+	}
+	a.record(AuditEvent{Link: "/link1"})
+	a.record(AuditEvent{Link: "/link2"})
+
+	if err := a.close(context.Background()); err != nil {
+		t.Fatalf("unable to close audit log err:%v", err)
+	}
+	if a.file != nil {
+		t.Errorf("audit log file should be closed")
+	}
+	if got := readAuditLinks(t, path); !slices.Equal(got, []string{"/link1", "/link2"}) {
+		t.Errorf("buffered events should be written on close got:%v", got)
+	}
+
+	// events recorded after close are dropped
+	a.record(AuditEvent{Link: "/link3"})
+	if err := a.close(context.Background()); err != nil {
+		t.Errorf("unexpected error on second close err:%v", err)
+	}
+}
+
+func TestRepository_auditLinkUpdate_rollback(t *testing.T) {
+	args, err := ListCommitsOptions{MaxCount: auditMaxCommits + 1}.gitArgs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runner := repotest.NewFakeRunner()
+	runner.Expect(append(args, "new..old")...).Return("72ea9c9de6963e97ac472d9ea996e384c6923cca\nb.txt\na.txt")
+	runner.Expect(append(args, "old..new")...).Return("")
+
+	repo, err := NewRepositoryWithRunner(RepositoryConfig{
+		Remote:        "https://github.com/org/repo.git",
+		Root:          t.TempDir(),
+		Interval:      testInterval,
+		MirrorTimeout: testTimeout,
+		GitGC:         "always",
+	}, nil, runner, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+	repo.audit = &auditLog{events: make(chan AuditEvent, 1), log: testLog}
+
+	// link is rolled back from 'old' to its parent 'new'
+	wl := &WorkTreeLink{link: "/link", log: testLog}
+	repo.auditLinkUpdate(txtCtx, wl, "main", "old", "new")
+
+	e := <-repo.audit.events
+	if !slices.Equal(e.ChangedFiles, []string{"a.txt", "b.txt"}) {
+		t.Errorf("unexpected changed files of rolled back link got:%v", e.ChangedFiles)
+	}
+	runner.AssertExpectations(t)
+}
@@ -0,0 +1,186 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// defaultMaxAutoWorktrees is the max number of worktree links created by the
+// auto worktree rules of the repository if not configured
+const defaultMaxAutoWorktrees = 50
+
+// shortRefPlaceholder is replaced by the short name of the matching ref in
+// the link template of the auto worktree rule
+const shortRefPlaceholder = "{short_ref}"
+
+// unsafeLinkCharsRgx matches characters which are replaced in the short ref
+// name used in the auto worktree link
+var unsafeLinkCharsRgx = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func (awc AutoWorktreeConfig) validate() error {
+	if !strings.HasPrefix(awc.RefGlob, "refs/") || strings.Count(awc.RefGlob, "*") != 1 {
+		return fmt.Errorf("auto worktree ref glob must be fully-qualified ref with single '*' glob:%s", awc.RefGlob)
+	}
+	dir, file := filepath.Split(awc.LinkTemplate)
+	if strings.Count(awc.LinkTemplate, shortRefPlaceholder) != 1 || !strings.Contains(file, shortRefPlaceholder) {
+		return fmt.Errorf("auto worktree link template must contain %s in the last path element template:%s",
+			shortRefPlaceholder, awc.LinkTemplate)
+	}
+	if strings.ContainsAny(dir, "{}") || filepath.Clean(dir) == "." {
+		return fmt.Errorf("auto worktree link template must have static dir template:%s", awc.LinkTemplate)
+	}
+	return nil
+}
+
+// linkDir returns the dir of the links created by the rule
+func (awc AutoWorktreeConfig) linkDir() string {
+	dir, _ := filepath.Split(awc.LinkTemplate)
+	return filepath.Clean(dir)
+}
+
+// link returns the worktree link of the given ref, false is returned if
+// ref doesn't match the rule or its short name is not usable as link name
+func (awc AutoWorktreeConfig) link(ref string) (string, bool) {
+	if !matchRefPattern(awc.RefGlob, ref) {
+		return "", false
+	}
+	name, ok := autoLinkName(ref)
+	if !ok {
+		return "", false
+	}
+	return strings.Replace(awc.LinkTemplate, shortRefPlaceholder, name, 1), true
+}
+
+// autoLinkName returns short name of the ref with unsafe characters replaced
+// so that it can be used as link file name, false is returned if nothing
+// usable is left
+func autoLinkName(ref string) (string, bool) {
+	name := strings.Trim(unsafeLinkCharsRgx.ReplaceAllString(shortRefName(ref), "-"), ".-")
+	return name, name != ""
+}
+
+// shortRefName returns the name of the ref without its namespace prefix,
+// eg. refs/heads/release/1.2 -> release/1.2
+func shortRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if name, ok := strings.CutPrefix(ref, prefix); ok {
+			return name
+		}
+	}
+	return ref
+}
+
+// autoWorktreeConfigs returns worktree config of all the refs matching the
+// auto worktree rules keyed by the link. first matching rule is used if ref
+// matches more than one rule.
+func (r *Repository) autoWorktreeConfigs(refs map[string]string) map[string]WorktreeConfig {
+	wanted := make(map[string]WorktreeConfig)
+	for _, ref := range slices.Sorted(maps.Keys(refs)) {
+		// refs not pointing to a commit can't be checked out
+		if refs[ref] == "" {
+			continue
+		}
+		for _, awc := range r.autoRules {
+			link, ok := awc.link(ref)
+			if !ok {
+				continue
+			}
+			if other, ok := wanted[link]; ok {
+				r.log.Warn("auto worktree link of the ref is already used by other ref", "link", link, "ref", ref, "other", other.Ref)
+				break
+			}
+			wanted[link] = WorktreeConfig{Link: link, Ref: ref, Pathspec: awc.Pathspec}
+			break
+		}
+	}
+	return wanted
+}
+
+// syncAutoWorktrees adds worktree links for the new refs matching the auto
+// and tag worktree rules and removes links whose refs no longer exists or fell
+// out of the tag retention window. existing links are kept if refs can't be
+// listed. links of the new refs are not added once max number of auto links
+// is reached.
+// it must be called with repository write lock held.
+func (r *Repository) syncAutoWorktrees(ctx context.Context, rh *refHashes) {
+	autoLinks := 0
+	for _, wl := range r.workTreeLinks {
+		if wl.auto {
+			autoLinks++
+		}
+	}
+	if len(r.autoRules) == 0 && len(r.tagRules) == 0 && autoLinks == 0 {
+		return
+	}
+
+	refs := r.listedRefs(ctx, rh)
+	if refs == nil {
+		return
+	}
+	wanted := r.autoWorktreeConfigs(refs)
+	if err := r.addTagWorktreeConfigs(ctx, refs, wanted); err != nil {
+		r.log.Error("unable to list tags of the tag worktree rules, keeping existing links", "err", err)
+		return
+	}
+
+	// links are removed if ref is deleted or rule has changed
+	for link, wl := range r.workTreeLinks {
+		if !wl.auto {
+			continue
+		}
+		if wtc, ok := wanted[link]; ok && wtc.Ref == wl.ref && wtc.Pathspec == wl.pathspec {
+			delete(wanted, link)
+			continue
+		}
+		delete(r.workTreeLinks, link)
+		autoLinks--
+		wl.log.Info("removing auto worktree link", "ref", wl.ref)
+		if err := r.removeWorktreeLink(ctx, wl); err != nil {
+			wl.log.Error("unable to remove auto worktree link", "err", err)
+		}
+	}
+
+	var skipped []string
+	for _, link := range slices.Sorted(maps.Keys(wanted)) {
+		wtc := wanted[link]
+		if autoLinks >= r.maxAutoLinks {
+			skipped = append(skipped, wtc.Ref)
+			continue
+		}
+		if other, ok := r.overlappingLink(absLink(r.root, link)); ok {
+			r.log.Warn("auto worktree link overlaps existing link, link is not created",
+				"link", link, "ref", wtc.Ref, "other", other)
+			continue
+		}
+		if err := r.addWorktreeLink(wtc); err != nil {
+			r.log.Error("unable to add auto worktree link", "link", link, "ref", wtc.Ref, "err", err)
+			continue
+		}
+		wl := r.workTreeLinks[link]
+		wl.auto = true
+		autoLinks++
+		wl.log.Info("auto worktree link added", "ref", wtc.Ref)
+	}
+	if len(skipped) > 0 {
+		r.log.Warn("max number of auto worktree links reached, links of the matching refs are not created",
+			"max", r.maxAutoLinks, "skipped", skipped)
+	}
+	recordAutoWorktrees(r.gitURL.Repo, autoLinks)
+}
+
+// overlappingLink returns abs path of the existing worktree link which is
+// same as, inside or parent of the given link.
+// it must be called with repository lock held.
+func (r *Repository) overlappingLink(absL string) (string, bool) {
+	for _, wl := range r.workTreeLinks {
+		if isSubPath(wl.link, absL) || isSubPath(absL, wl.link) {
+			return wl.link, true
+		}
+	}
+	return "", false
+}
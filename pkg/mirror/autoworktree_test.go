@@ -0,0 +1,56 @@
+package mirror
+
+import "testing"
+
+func TestAutoWorktreeConfig_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		awc     AutoWorktreeConfig
+		wantErr bool
+	}{
+		{"valid", AutoWorktreeConfig{RefGlob: "refs/heads/release/*", LinkTemplate: "releases/{short_ref}"}, false},
+		{"valid-suffix", AutoWorktreeConfig{RefGlob: "refs/tags/v*", LinkTemplate: "/abs/tags/tag-{short_ref}"}, false},
+		{"short-glob", AutoWorktreeConfig{RefGlob: "release/*", LinkTemplate: "releases/{short_ref}"}, true},
+		{"no-glob", AutoWorktreeConfig{RefGlob: "refs/heads/main", LinkTemplate: "releases/{short_ref}"}, true},
+		{"multi-glob", AutoWorktreeConfig{RefGlob: "refs/heads/*/*", LinkTemplate: "releases/{short_ref}"}, true},
+		{"no-placeholder", AutoWorktreeConfig{RefGlob: "refs/heads/release/*", LinkTemplate: "releases/link"}, true},
+		{"placeholder-in-dir", AutoWorktreeConfig{RefGlob: "refs/heads/release/*", LinkTemplate: "{short_ref}/link"}, true},
+		{"multi-placeholder", AutoWorktreeConfig{RefGlob: "refs/heads/release/*", LinkTemplate: "releases/{short_ref}-{short_ref}"}, true},
+		{"no-dir", AutoWorktreeConfig{RefGlob: "refs/heads/release/*", LinkTemplate: "{short_ref}"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.awc.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAutoWorktreeConfig_link(t *testing.T) {
+	awc := AutoWorktreeConfig{RefGlob: "refs/heads/release/*", LinkTemplate: "releases/{short_ref}"}
+	tests := []struct {
+		ref    string
+		want   string
+		wantOk bool
+	}{
+		{"refs/heads/release/1.2", "releases/release-1.2", true},
+		{"refs/heads/release/feature/x y", "releases/release-feature-x-y", true},
+		{"refs/heads/release/1.x-", "releases/release-1.x", true},
+		{"refs/heads/main", "", false},
+		{"refs/tags/release/1.2", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, ok := awc.link(tt.ref)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("link() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+
+	tags := AutoWorktreeConfig{RefGlob: "refs/tags/*", LinkTemplate: "tags/{short_ref}"}
+	if got, ok := tags.link("refs/tags/.."); ok {
+		t.Errorf("link() of unsafe name should fail got:%s", got)
+	}
+}
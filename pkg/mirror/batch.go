@@ -0,0 +1,105 @@
+package mirror
+
+import (
+	"context"
+	"sync"
+)
+
+// CloneRequest is a single clone of the CloneMany batch, fields are same as
+// the args of the Clone method
+type CloneRequest struct {
+	Remote  string
+	Dst     string
+	Ref     string
+	Options CloneOptions
+}
+
+// CloneResult is the outcome of the CloneRequest
+type CloneResult struct {
+	Remote string
+	// Hash is the commit hash of the clone, empty if clone failed
+	Hash string
+	Err  error
+}
+
+// MirrorManyResult is the outcome of the single remote of the MirrorMany batch
+type MirrorManyResult struct {
+	Remote string
+	Result MirrorResult
+	Err    error
+}
+
+// CloneMany runs all given clone requests with at most 'concurrency' clones
+// running at the same time, mirror concurrency of the pool is used if its not
+// positive (see DefaultConfig.MirrorConcurrency). results are returned in the order of the requests. failure of
+// one request doesn't stop the others, unknown remote fails with ErrNotExist.
+// requests which were not started before ctx is done fail with ctx error.
+func (rp *RepoPool) CloneMany(ctx context.Context, requests []CloneRequest, concurrency int) []CloneResult {
+	results := make([]CloneResult, len(requests))
+	runBatch(ctx, len(requests), rp.concurrency(concurrency), func(i int) {
+		req := requests[i]
+		results[i].Remote = req.Remote
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			return
+		}
+		results[i].Hash, results[i].Err = rp.Clone(ctx, req.Remote, req.Dst, req.Ref, req.Options)
+	})
+	return results
+}
+
+// MirrorMany mirrors given remotes same as CloneMany runs clones, results are
+// returned in the order of the remotes.
+func (rp *RepoPool) MirrorMany(ctx context.Context, remotes []string, concurrency int) []MirrorManyResult {
+	results := make([]MirrorManyResult, len(remotes))
+	runBatch(ctx, len(remotes), rp.concurrency(concurrency), func(i int) {
+		results[i].Remote = remotes[i]
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			return
+		}
+		results[i].Result, results[i].Err = rp.MirrorWithResult(ctx, remotes[i])
+	})
+	return results
+}
+
+// concurrency returns given concurrency if its positive otherwise mirror
+// concurrency of the pool or the default if that's not set either
+func (rp *RepoPool) concurrency(n int) int {
+	if n > 0 {
+		return n
+	}
+	if rp.mirrorConcurrency > 0 {
+		return rp.mirrorConcurrency
+	}
+	return defaultMirrorConcurrency
+}
+
+// runBatch calls fn for each index from 0 to n with at most concurrency calls
+// running at the same time and waits for all calls to return. fn is still
+// called for every index after ctx is done so that it can record the error.
+func runBatch(ctx context.Context, n, concurrency int, fn func(i int)) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+	for i := range n {
+		wg.Add(1)
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			// skip waiting for a slot, fn will only record ctx error
+			fn(i)
+			wg.Done()
+			continue
+		}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
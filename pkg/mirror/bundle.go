@@ -0,0 +1,156 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ErrRepoInitialised is returned if bundle is restored into repository
+// which is already initialised
+var ErrRepoInitialised = fmt.Errorf("repository is already initialised")
+
+// CreateBundle writes git bundle of the mirrored repository to the given
+// writer, bundle contains all the refs of the mirror or only given refs if
+// specified. bundle can be used to seed new mirror with RestoreFromBundle.
+// bundle is streamed to the writer while holding read lock so it's
+// consistent with the last mirror cycle.
+func (r *Repository) CreateBundle(ctx context.Context, w io.Writer, refs ...string) error {
+	for _, ref := range refs {
+		if ref == "" || strings.HasPrefix(ref, "-") {
+			return fmt.Errorf("invalid bundle ref '%s'", ref)
+		}
+	}
+	if len(refs) == 0 {
+		refs = []string{"--all"}
+	}
+
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return err
+	}
+	defer r.lock.RUnlock()
+
+	// git bundle create -q - [--all|<refs>...]
+	args := append([]string{"bundle", "create", "-q", "-"}, refs...)
+	if err := runGitCommandStream(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, nil, w, args...); err != nil {
+		return fmt.Errorf("unable to create bundle err:%w", err)
+	}
+	return nil
+}
+
+// RestoreFromBundle initialises the mirror from the bundle created by
+// CreateBundle so that new mirror host can be seeded without fetching full
+// history from the remote. it must be called before first mirror cycle and
+// ErrRepoInitialised is returned if repository dir is not empty.
+// refs are fetched from the bundle with the mirror refspecs and local HEAD is
+// set to the remote default branch, if remote is unreachable branch of the
+// bundle HEAD is used and repository is marked as degraded. next mirror
+// cycle reconciles the mirror with the remote fetching only missing objects.
+func (r *Repository) RestoreFromBundle(ctx context.Context, rd io.Reader) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	defer r.hashCache.reset()
+
+	if _, err := os.Stat(r.dir); err == nil {
+		if empty, err := dirIsEmpty(r.dir); err != nil {
+			return fmt.Errorf("unable to read repo dir err:%w", err)
+		} else if !empty {
+			return fmt.Errorf("%w path:%s", ErrRepoInitialised, r.dir)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("unable to verify repo dir err:%w", err)
+	}
+
+	if err := os.MkdirAll(r.dir, defaultDirMode); err != nil {
+		return fmt.Errorf("unable to create repo dir err:%w", err)
+	}
+
+	// git needs seekable file to read bundle
+	bundle, err := writeTempBundle(r.root, rd)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(bundle)
+
+	if err := r.restoreBundle(ctx, bundle); err != nil {
+		// leave repo dir uninitialised so init re-creates it
+		if cErr := r.clearRepoDir(); cErr != nil {
+			r.log.Error("unable to clear repo dir", "err", cErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// restoreBundle initialises bare repository and fetches refs from the given
+// bundle file
+func (r *Repository) restoreBundle(ctx context.Context, bundle string) error {
+	// git bundle list-heads <file>
+	out, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "bundle", "list-heads", bundle)
+	if err != nil {
+		return fmt.Errorf("unable to read bundle err:%w", err)
+	}
+
+	if err := r.initBare(ctx, bundleHeadBranch(out)); err != nil {
+		return fmt.Errorf("unable to init repo err:%w", err)
+	}
+
+	// git fetch --no-auto-gc <file> <refspecs>...
+	args := append([]string{"fetch", "--no-auto-gc", bundle}, r.refSpecs...)
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, args...); err != nil {
+		return fmt.Errorf("unable to fetch bundle err:%w", err)
+	}
+
+	r.log.Info("repository restored from bundle", "path", r.dir)
+	return nil
+}
+
+// bundleHeadBranch returns the branch pointing to the same commit as HEAD
+// in the given 'git bundle list-heads' output, empty string is returned if
+// bundle doesn't have HEAD or no branch matches it
+func bundleHeadBranch(heads string) string {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(heads, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			refs[fields[1]] = fields[0]
+		}
+	}
+	head, ok := refs["HEAD"]
+	if !ok {
+		return ""
+	}
+	var branches []string
+	for ref, hash := range refs {
+		if hash == head && strings.HasPrefix(ref, "refs/heads/") {
+			branches = append(branches, ref)
+		}
+	}
+	if len(branches) == 0 {
+		return ""
+	}
+	slices.Sort(branches)
+	return branches[0]
+}
+
+// writeTempBundle writes bundle from the reader to the temp file in the
+// given dir and returns its path
+func writeTempBundle(dir string, rd io.Reader) (string, error) {
+	f, err := os.CreateTemp(dir, ".bundle-*")
+	if err != nil {
+		return "", fmt.Errorf("unable to create bundle file err:%w", err)
+	}
+	if _, err := io.Copy(f, rd); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("unable to write bundle file err:%w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("unable to write bundle file err:%w", err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,295 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaxCloneFSBytes is the default max total size of the files of the
+// filesystem returned by CloneFS
+const defaultMaxCloneFSBytes = 128 << 20
+
+// ErrFSTooLarge is returned by CloneFS if total size of the files of the
+// ref is over the limit of the repository
+var ErrFSTooLarge = errors.New("tree is too large for clone filesystem")
+
+// CloneFS returns content of the given ref as read only filesystem without
+// writing anything to the disk. if pathspecs are provided only those paths
+// are included, paths are matched as by `git ls-tree`. only the tree of the
+// ref is kept in memory, content of the files is streamed from the mirror
+// by `git cat-file` as they are read so opened files must be closed.
+// ErrFSTooLarge is returned if total size of the files is over
+// MaxCloneFSBytes of the repository.
+// On success, it returns the resolved commit hash of the ref.
+func (r *Repository) CloneFS(ctx context.Context, ref string, pathspecs []string) (fs.FS, string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return nil, "", err
+	}
+	defer r.lock.RUnlock()
+
+	hash, err := r.resolveCommit(ctx, ref)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// git log -1 --format=%ct <hash>
+	ct, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "log", "-1", "--format=%ct", hash)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read commit time err:%w", err)
+	}
+	sec, err := strconv.ParseInt(ct, 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to parse commit time %q err:%w", ct, err)
+	}
+
+	args := []string{"ls-tree", "-r", "-t", "-l", "-z", hash}
+	if len(pathspecs) > 0 {
+		args = append(args, "--")
+		args = append(args, pathspecs...)
+	}
+	// output of runGitCommand is trimmed hence stream raw output to buffer
+	// git ls-tree -r -t -l -z <hash> [-- <pathspecs>...]
+	buf := &bytes.Buffer{}
+	if err := runGitCommandStream(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, nil, buf, args...); err != nil {
+		return nil, "", fmt.Errorf("unable to list tree err:%w", err)
+	}
+
+	fsys := &gitFS{
+		log:     r.log,
+		gitOps:  r.gitOps,
+		runner:  r.runner,
+		envs:    r.envs,
+		dir:     r.dir,
+		modTime: time.Unix(sec, 0),
+		entries: make(map[string]*gitFSEntry),
+	}
+	if err := fsys.parseTree(buf.String(), r.maxFSBytes); err != nil {
+		return nil, "", err
+	}
+	return fsys, hash, nil
+}
+
+// cloneFSLimit returns configured limit or default if its not set
+func cloneFSLimit(maxBytes int64) int64 {
+	if maxBytes == 0 {
+		return defaultMaxCloneFSBytes
+	}
+	return maxBytes
+}
+
+// gitFS is the read only filesystem of the tree listed by CloneFS, content
+// of the files is read from the mirror by the object id when file is read
+type gitFS struct {
+	log     *slog.Logger
+	gitOps  *gitOpsLimiter
+	runner  GitRunner
+	envs    []string
+	dir     string
+	modTime time.Time              // commit time used as mod time of all the entries
+	entries map[string]*gitFSEntry // entries keyed by the path, root is "."
+}
+
+// gitFSEntry is the file or dir of the gitFS, it implements both
+// fs.FileInfo and fs.DirEntry
+type gitFSEntry struct {
+	name     string
+	oid      string // object id of the file, empty for dirs
+	mode     fs.FileMode
+	size     int64
+	modTime  time.Time
+	children []*gitFSEntry // sorted by name, only set for dirs
+}
+
+func (e *gitFSEntry) Name() string               { return e.name }
+func (e *gitFSEntry) Size() int64                { return e.size }
+func (e *gitFSEntry) Mode() fs.FileMode          { return e.mode }
+func (e *gitFSEntry) ModTime() time.Time         { return e.modTime }
+func (e *gitFSEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *gitFSEntry) Sys() any                   { return nil }
+func (e *gitFSEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *gitFSEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+// parseTree adds entries of the `ls-tree -r -t -l -z` output to the
+// filesystem, ErrFSTooLarge is returned if total size of the files is over
+// maxBytes
+func (g *gitFS) parseTree(out string, maxBytes int64) error {
+	g.entries["."] = &gitFSEntry{name: ".", mode: fs.ModeDir | 0755, modTime: g.modTime}
+
+	var total int64
+	for _, line := range strings.Split(out, "\x00") {
+		if line == "" {
+			continue
+		}
+		// <mode> SP <type> SP <object> SP <object size> TAB <file>
+		meta, name, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 4 || !fs.ValidPath(name) {
+			return fmt.Errorf("unable to parse tree entry %q", line)
+		}
+
+		e := &gitFSEntry{name: path.Base(name), modTime: g.modTime}
+		switch fields[1] {
+		case "tree", "commit":
+			// submodules are included as empty dirs
+			e.mode = fs.ModeDir | 0755
+		case "blob":
+			size, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				return fmt.Errorf("unable to parse size of tree entry %q err:%w", line, err)
+			}
+			total += size
+			if total > maxBytes {
+				return fmt.Errorf("%w limit:%d bytes", ErrFSTooLarge, maxBytes)
+			}
+			e.oid, e.size = fields[2], size
+			switch fields[0] {
+			case "120000":
+				e.mode = fs.ModeSymlink | 0777
+			case "100755":
+				e.mode = 0755
+			default:
+				e.mode = 0644
+			}
+		default:
+			continue
+		}
+		g.add(name, e)
+	}
+
+	for _, e := range g.entries {
+		slices.SortFunc(e.children, func(a, b *gitFSEntry) int { return strings.Compare(a.name, b.name) })
+	}
+	return nil
+}
+
+// add adds entry to the filesystem along with its parent dirs if they were
+// not listed
+func (g *gitFS) add(name string, e *gitFSEntry) {
+	if _, ok := g.entries[name]; ok {
+		return
+	}
+	g.entries[name] = e
+
+	dir := path.Dir(name)
+	parent, ok := g.entries[dir]
+	if !ok {
+		parent = &gitFSEntry{name: path.Base(dir), mode: fs.ModeDir | 0755, modTime: g.modTime}
+		g.add(dir, parent)
+	}
+	parent.children = append(parent.children, e)
+}
+
+// Open opens the named file, content of the file is only read from the
+// mirror once file is read
+func (g *gitFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := g.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.IsDir() {
+		return &gitFSDir{entry: e}, nil
+	}
+	return &gitFSFile{fsys: g, path: name, entry: e}, nil
+}
+
+// gitFSDir is the open dir of the gitFS
+type gitFSDir struct {
+	entry  *gitFSEntry
+	offset int
+}
+
+func (d *gitFSDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+func (d *gitFSDir) Close() error               { return nil }
+
+func (d *gitFSDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+func (d *gitFSDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	left := d.entry.children[d.offset:]
+	if count > 0 && len(left) == 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && count < len(left) {
+		left = left[:count]
+	}
+	d.offset += len(left)
+
+	entries := make([]fs.DirEntry, len(left))
+	for i, e := range left {
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// gitFSFile is the open file of the gitFS, `git cat-file` is started on the
+// first read and its stdout is streamed to the reader
+type gitFSFile struct {
+	fsys  *gitFS
+	path  string
+	entry *gitFSEntry
+
+	once   sync.Once
+	rd     *io.PipeReader
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (f *gitFSFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+
+func (f *gitFSFile) Read(b []byte) (int, error) {
+	f.once.Do(f.start)
+	if f.rd == nil {
+		return 0, fs.ErrClosed
+	}
+	return f.rd.Read(b)
+}
+
+// start starts streaming content of the file from the mirror
+func (f *gitFSFile) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	f.rd, f.cancel, f.done = pr, cancel, make(chan struct{})
+
+	go func() {
+		defer close(f.done)
+		g := f.fsys
+		// git cat-file blob <oid>
+		err := runGitCommandStream(ctx, g.log, g.gitOps, g.runner, g.envs, g.dir, nil, pw, "cat-file", "blob", f.entry.oid)
+		if err != nil {
+			err = &fs.PathError{Op: "read", Path: f.path, Err: err}
+		}
+		pw.CloseWithError(err)
+	}()
+}
+
+// Close stops reading content of the file if it was started
+func (f *gitFSFile) Close() error {
+	// file which wasn't read can't be read after close
+	f.once.Do(func() {})
+	if f.rd == nil {
+		return nil
+	}
+	f.cancel()
+	f.rd.Close()
+	<-f.done
+	return nil
+}
@@ -0,0 +1,83 @@
+package mirror
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/mirror/repotest"
+)
+
+func TestRepository_CloneFS(t *testing.T) {
+	hash := "72ea9c9de6963e97ac472d9ea996e384c6923cca"
+	tree := strings.Join([]string{
+		"100644 blob aaa     5\tREADME",
+		"040000 tree ddd       -\tdir",
+		"100755 blob bbb    12\tdir/run.sh",
+		"120000 blob ccc     6\tdir/link",
+		"160000 commit eee     -\tmodule",
+		"",
+	}, "\x00")
+
+	runner := repotest.NewFakeRunner()
+	runner.Expect("rev-parse", "--verify", "main^{commit}").Return(hash)
+	runner.Expect("log", "-1", "--format=%ct", hash).Return("1700000000")
+	runner.Expect("ls-tree", "-r", "-t", "-l", "-z", hash).Return(tree)
+	runner.Expect("cat-file", "blob", "aaa").Return("hello")
+	runner.Expect("cat-file", "blob", "bbb").Return("#!/bin/sh\necho")
+	runner.Expect("cat-file", "blob", "ccc").Return("README")
+
+	repo, err := NewRepositoryWithRunner(RepositoryConfig{
+		Remote:        "https://github.com/org/repo.git",
+		Root:          t.TempDir(),
+		Interval:      testInterval,
+		MirrorTimeout: testTimeout,
+		GitGC:         "always",
+	}, nil, runner, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+
+	fsys, got, err := repo.CloneFS(txtCtx, "main", nil)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if got != hash {
+		t.Errorf("fs hash mismatch got:%s want:%s", got, hash)
+	}
+	if err := fstest.TestFS(fsys, "README", "dir/run.sh", "dir/link", "module"); err != nil {
+		t.Errorf("invalid fs err:%v", err)
+	}
+
+	data, err := fs.ReadFile(fsys, "dir/run.sh")
+	if err != nil || string(data) != "#!/bin/sh\necho" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+	info, err := fs.Stat(fsys, "dir/link")
+	if err != nil || info.Mode().Type() != fs.ModeSymlink {
+		t.Errorf("Stat() = %v, %v", info, err)
+	}
+	if got := runner.CallsWithPrefix("cat-file"); len(got) == 0 {
+		t.Errorf("file content should be read by cat-file")
+	}
+
+	// content is not read until file is read
+	runner.Reset()
+	f, err := fsys.Open("README")
+	if err != nil {
+		t.Fatalf("unable to open file err:%v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("unable to close file err:%v", err)
+	}
+	if got := runner.CallsWithPrefix("cat-file"); len(got) != 0 {
+		t.Errorf("unexpected cat-file calls got:%v", got)
+	}
+
+	repo.maxFSBytes = 16
+	if _, _, err := repo.CloneFS(txtCtx, "main", nil); !errors.Is(err, ErrFSTooLarge) {
+		t.Errorf("expected ErrFSTooLarge got: %v", err)
+	}
+}
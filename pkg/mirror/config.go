@@ -1,9 +1,39 @@
 package mirror
 
 import (
+	"encoding/base64"
 	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/giturl"
+)
+
+var (
+	// ErrInvalidRemote is returned if remote is not a valid git URL
+	ErrInvalidRemote = fmt.Errorf("invalid remote")
+	// ErrInvalidRoot is returned if root is not an absolute path
+	ErrInvalidRoot = fmt.Errorf("invalid root")
+	// ErrInvalidInterval is returned if mirror interval is too short
+	ErrInvalidInterval = fmt.Errorf("invalid interval")
+	// ErrInvalidSchedule is returned if mirror schedule is not a valid cron
+	// expression or is set together with interval
+	ErrInvalidSchedule = fmt.Errorf("invalid schedule")
+	// ErrInvalidGCMode is returned if gc mode is not one of the supported modes
+	ErrInvalidGCMode = fmt.Errorf("invalid gc mode")
+	// ErrInvalidAuth is returned if auth config can't be used with the remote
+	ErrInvalidAuth = fmt.Errorf("invalid auth")
+	// ErrInvalidWorktree is returned if worktree config is not valid
+	ErrInvalidWorktree = fmt.Errorf("invalid worktree")
+	// ErrInvalidConfig is returned for rest of the invalid repository config
+	ErrInvalidConfig = fmt.Errorf("invalid config")
 )
 
 // RepoPoolConfig is the configuration to create repoPool
@@ -12,6 +42,19 @@ type RepoPoolConfig struct {
 	Defaults DefaultConfig `yaml:"defaults"`
 	// List of mirrored repositories.
 	Repositories []RepositoryConfig `yaml:"repositories"`
+
+	// Include is the list of remote URL globs (eg. 'https://github.com/org/team-*'),
+	// if set only repositories with remote matching any of the patterns are
+	// mirrored. patterns use path.Match syntax so '*' doesn't match '/'
+	Include []string `yaml:"include"`
+
+	// Exclude is the list of remote URL globs, repositories with remote
+	// matching any of the patterns are not mirrored
+	Exclude []string `yaml:"exclude"`
+
+	// AllowUnmatchedPatterns disables validation error for include and
+	// exclude patterns which don't match any repository
+	AllowUnmatchedPatterns bool `yaml:"allow_unmatched_patterns"`
 }
 
 // DefaultConfig is the default config for repositories if not set at repo level
@@ -24,15 +67,166 @@ type DefaultConfig struct {
 	// Interval is time duration for how long to wait between mirrors
 	Interval time.Duration `yaml:"interval"`
 
+	// Jitter is the max random delay added to the interval of every mirror
+	// cycle as a fraction of the interval (eg. 0.2 adds up to 20%) so that
+	// repositories with same interval drift apart. 0 disables jitter.
+	// default is 0.2
+	Jitter *float64 `yaml:"jitter"`
+
+	// StartupStagger is the window over which first mirror cycles of the
+	// repositories started by RepoPool.StartLoop are spread evenly (eg. with
+	// 60 repositories and 1m window loops are started 1s apart) so that
+	// remote is not hit by all repositories at once after restart. explicit
+	// mirror runs (MirrorAll, QueueMirrorRun) are not delayed.
+	// default is 0 which starts all loops at once
+	StartupStagger time.Duration `yaml:"startup_stagger"`
+
+	// Schedule is the standard 5 field cron expression (eg. '*/15 9-17 * * 1-5')
+	// of the mirror cycles, it can be used instead of Interval. expression is
+	// evaluated in UTC unless prefixed with 'CRON_TZ=<IANA name> '. up to 30s
+	// of random delay is added to each run so that repositories with same
+	// schedule are not mirrored at once.
+	Schedule string `yaml:"schedule"`
+
 	// MirrorTimeout represents the total time allowed for the complete mirror loop
 	MirrorTimeout time.Duration `yaml:"mirror_timeout"`
 
+	// GitTimeout represents the time allowed for a single git command which
+	// talks to the remote (eg. fetch), default is 0 which means commands are
+	// only bounded by MirrorTimeout
+	GitTimeout time.Duration `yaml:"git_timeout"`
+
 	// GitGC garbage collection string. valid values are
 	// 'auto', 'always', 'aggressive' or 'off'
 	GitGC string `yaml:"git_gc"`
 
+	// GCInterval is the time between scheduled gc runs. gc is run by the
+	// mirror loop outside of the mirror cycle so it doesn't count towards
+	// MirrorTimeout, see Repository.RunScheduledGC if mirror loop is not
+	// used. default is 24h
+	GCInterval time.Duration `yaml:"gc_interval"`
+
 	// Auth config to fetch remote repos
 	Auth Auth `yaml:"auth"`
+
+	// AuthProviders is the auth config keyed by the remote host (eg.
+	// 'github.com' or 'gitea.internal:2222'). it is used for repositories
+	// without their own auth config, in preference to default Auth. host
+	// with port is matched first and then host without port. ssh key config
+	// is only used for ssh remotes and username/password only for https
+	// remotes so same provider can be used for both.
+	AuthProviders map[string]Auth `yaml:"auth_providers"`
+
+	// RefSpecs is the list of fetch refspecs used to mirror subset of refs
+	// from the remote. default is '+refs/*:refs/*'
+	RefSpecs []string `yaml:"refspecs"`
+
+	// TrackDefaultBranch enables checking default branch of the remote on
+	// every fetch, if it has changed local HEAD is updated so that worktrees
+	// on HEAD follow the new default branch. default is false
+	TrackDefaultBranch bool `yaml:"track_default_branch"`
+
+	// SkipFetchIfUnchanged enables listing remote refs with 'ls-remote' before
+	// fetch, if refs are same as on last fetch then fetch is skipped. fetch is
+	// never skipped after failed mirror cycle and at least every 10th cycle.
+	// default is false
+	SkipFetchIfUnchanged bool `yaml:"skip_fetch_if_unchanged"`
+
+	// FetchWindow restricts the time of the day when remote can be fetched
+	FetchWindow FetchWindow `yaml:"fetch_window"`
+
+	// EnableHashCache enables caching of the Hash results by ref and path,
+	// cache is cleared by the mirror cycle whenever refs of the mirror
+	// change so Hash never returns stale value. default is false
+	EnableHashCache bool `yaml:"enable_hash_cache"`
+
+	// DisableCloneRevision forces Clone to clone the branch and reset it to
+	// the commit instead of using 'git clone --revision' even if installed
+	// git supports it. default is false
+	DisableCloneRevision bool `yaml:"disable_clone_revision"`
+
+	// Depth limits fetching to the specified number of commits from the tip of
+	// each remote ref. default is 0 which fetches full history
+	Depth int `yaml:"depth"`
+
+	// ReinitThreshold is the number of consecutive mirror cycles in which
+	// fetch or worktree creation fails due to corrupted objects after which
+	// the bare mirror is re-initialised. default is 3
+	ReinitThreshold int `yaml:"reinit_threshold"`
+
+	// MaxFailureBackoff is the max time mirror loop waits before retrying
+	// after consecutive failed mirror cycles. wait time is doubled on every
+	// failure starting from the interval. default is 10 times the interval
+	MaxFailureBackoff time.Duration `yaml:"max_failure_backoff"`
+
+	// FetchRetries is the number of times fetch and ls-remote of the remote
+	// default branch are retried within the same mirror cycle if they fail
+	// with transient (network or timeout) error. retries use exponential
+	// backoff starting at 1s and are bounded by MirrorTimeout, other errors
+	// (eg. auth) are not retried. default is 2, set 0 to disable retries
+	FetchRetries *int `yaml:"fetch_retries"`
+
+	// ProxyURL is the proxy (eg. 'http://proxy:3128') used by git commands
+	// which talks to the remote. it is passed to git as 'http.proxy' config
+	// via GIT_CONFIG_* envs so that it doesn't appear in the command args
+	// and for ssh remotes 'nc' is used as ssh ProxyCommand, credentials in
+	// the url are only supported for http(s) remotes
+	ProxyURL string `yaml:"proxy_url"`
+
+	// GitConfig is the git config (eg. 'fetch.negotiationAlgorithm: skipping'
+	// or 'pack.threads: 4') passed as '-c key=value' args to the git commands
+	// which fetch, clone, checkout or gc the mirror. keys which can run
+	// commands or change remote of the mirror (eg. 'core.hooksPath',
+	// 'alias.*' or 'url.*') are not allowed. repository config is merged
+	// with the defaults and its values take precedence
+	GitConfig map[string]string `yaml:"git_config"`
+
+	// FetchJobs is the number of parallel jobs used by fetch, its passed to
+	// git fetch as '--jobs'. default is 0 ie git default
+	FetchJobs int `yaml:"fetch_jobs"`
+
+	// KeepPrevious is the number of previously published worktrees retained
+	// per link so that link can be rolled back with
+	// Repository.RollbackWorktree. default is 1, set 0 to remove old
+	// worktrees as soon as new one is published
+	KeepPrevious *int `yaml:"keep_previous"`
+
+	// WorktreePermissions is the default ownership and modes applied to the
+	// worktree files, each field is only used if not set on the worktree
+	WorktreePermissions Permissions `yaml:"worktree_permissions"`
+
+	// AllowLinksOutsideRoot allows absolute worktree links outside of the
+	// root of the repository (eg. '/var/www/site'). default is false
+	AllowLinksOutsideRoot bool `yaml:"allow_links_outside_root"`
+
+	// MirrorConcurrency is the max number of repositories mirrored concurrently
+	// by MirrorAll. default is 5
+	MirrorConcurrency int `yaml:"mirror_concurrency"`
+
+	// MaxConcurrentGitOps is the max number of git commands run concurrently
+	// by all repositories of the pool, commands wait for a free slot within
+	// their MirrorTimeout. default is 0 which means unlimited
+	MaxConcurrentGitOps int `yaml:"max_concurrent_git_ops"`
+
+	// AuditLogPath is the absolute path of the file to which a JSON line is
+	// appended every time content published on a worktree link changes and
+	// for every authorization decision of the pool's http handlers.
+	// events are written in the background and dropped if writes can't keep
+	// up. file is re-opened if it's removed or renamed by log rotation.
+	// default is empty which disables audit log
+	AuditLogPath string `yaml:"audit_log_path"`
+
+	// ManifestPath is the absolute path of the JSON file listing all the
+	// published worktree links of the pool (see RepoPool.Manifest). file is
+	// atomically rewritten whenever published links change.
+	// default is '.git-mirror-manifest.json' in the root dir if root is set
+	ManifestPath string `yaml:"manifest_path"`
+
+	// MetricLabels is the list of repository label keys (eg. 'team') added
+	// as labels to the mirror cycle metrics, repositories without the label
+	// get empty value. keep the list short as every distinct value creates
+	// new series. default is empty
+	MetricLabels []string `yaml:"metric_labels"`
 }
 
 // RepositoryConfig represents the config for the mirrored repository
@@ -41,6 +235,13 @@ type RepositoryConfig struct {
 	// git URL of the remote repo to mirror
 	Remote string `yaml:"remote"`
 
+	// PreviousRemotes is the list of git URLs the repository was mirrored
+	// from before (eg. after moving the repository to another host). if
+	// repository dir of the remote doesn't exist yet but the dir of any of the
+	// previous remotes does, existing mirror and its worktrees are reused
+	// instead of cloning from scratch. see RepoPool.MigrateRepository
+	PreviousRemotes []string `yaml:"previous_remotes"`
+
 	// Root is the absolute path to the root dir where repo dir
 	// will be created. Worktree links will be created here if
 	// absolute path is not provided
@@ -49,19 +250,207 @@ type RepositoryConfig struct {
 	// Interval is time duration for how long to wait between mirrors
 	Interval time.Duration `yaml:"interval"`
 
+	// Schedule is the standard 5 field cron expression (eg. '*/15 9-17 * * 1-5')
+	// of the mirror cycles, it can be used instead of Interval. expression is
+	// evaluated in UTC unless prefixed with 'CRON_TZ=<IANA name> '. up to 30s
+	// of random delay is added to each run so that repositories with same
+	// schedule are not mirrored at once.
+	Schedule string `yaml:"schedule"`
+
 	// MirrorTimeout represents the total time allowed for the complete mirror loop
 	MirrorTimeout time.Duration `yaml:"mirror_timeout"`
 
+	// GitTimeout represents the time allowed for a single git command which
+	// talks to the remote (eg. fetch), default is 0 which means commands are
+	// only bounded by MirrorTimeout
+	GitTimeout time.Duration `yaml:"git_timeout"`
+
 	// GitGC garbage collection string. valid values are
 	// 'auto', 'always', 'aggressive' or 'off'
 	GitGC string `yaml:"git_gc"`
 
+	// GCInterval is the time between scheduled gc runs. gc is run by the
+	// mirror loop outside of the mirror cycle so it doesn't count towards
+	// MirrorTimeout, see Repository.RunScheduledGC if mirror loop is not
+	// used. default is 24h
+	GCInterval time.Duration `yaml:"gc_interval"`
+
 	// Auth config to fetch remote repos
 	Auth Auth `yaml:"auth"`
 
+	// RefSpecs is the list of fetch refspecs used to mirror subset of refs
+	// from the remote. default is '+refs/*:refs/*'
+	RefSpecs []string `yaml:"refspecs"`
+
+	// SingleBranch mirrors only the given branch of the remote (eg. 'main')
+	// instead of all the refs. it's a shorthand for the refspec
+	// '+refs/heads/<branch>:refs/heads/<branch>' and local HEAD is always
+	// set to the branch. it can't be set along with RefSpecs
+	SingleBranch string `yaml:"single_branch"`
+
+	// TrackDefaultBranch enables checking default branch of the remote on
+	// every fetch, if it has changed local HEAD is updated so that worktrees
+	// on HEAD follow the new default branch. default is false
+	TrackDefaultBranch bool `yaml:"track_default_branch"`
+
+	// SkipFetchIfUnchanged enables listing remote refs with 'ls-remote' before
+	// fetch, if refs are same as on last fetch then fetch is skipped. fetch is
+	// never skipped after failed mirror cycle and at least every 10th cycle.
+	// default is false
+	SkipFetchIfUnchanged bool `yaml:"skip_fetch_if_unchanged"`
+
+	// FetchWindow restricts the time of the day when remote can be fetched
+	FetchWindow FetchWindow `yaml:"fetch_window"`
+
+	// EnableHashCache enables caching of the Hash results by ref and path,
+	// cache is cleared by the mirror cycle whenever refs of the mirror
+	// change so Hash never returns stale value. default is false
+	EnableHashCache bool `yaml:"enable_hash_cache"`
+
+	// DisableCloneRevision forces Clone to clone the branch and reset it to
+	// the commit instead of using 'git clone --revision' even if installed
+	// git supports it. default is false
+	DisableCloneRevision bool `yaml:"disable_clone_revision"`
+
+	// Depth limits fetching to the specified number of commits from the tip of
+	// each remote ref. default is 0 which fetches full history
+	Depth int `yaml:"depth"`
+
+	// Prune controls whether remote-tracking refs which no longer exist on the
+	// remote are removed on fetch. default is true, if disabled refs deleted
+	// on the remote are retained in the mirror
+	Prune *bool `yaml:"prune"`
+
+	// PruneTags also removes local tags which no longer exist on the remote.
+	// it requires Prune to be enabled. default is false
+	PruneTags bool `yaml:"prune_tags"`
+
+	// Envs are additional envs (eg. 'HTTPS_PROXY=...') passed to git commands of
+	// this repository. they are added after the pool level envs hence
+	// repository envs take precedence
+	Envs []string `yaml:"envs"`
+
+	// GitExecPath is the absolute path of the git executable used for this
+	// repository. default is git found in the PATH
+	GitExecPath string `yaml:"git_exec_path"`
+
+	// ReinitThreshold is the number of consecutive mirror cycles in which
+	// fetch or worktree creation fails due to corrupted objects after which
+	// the bare mirror is re-initialised. default is 3
+	ReinitThreshold int `yaml:"reinit_threshold"`
+
+	// MaxFailureBackoff is the max time mirror loop waits before retrying
+	// after consecutive failed mirror cycles. wait time is doubled on every
+	// failure starting from the interval. default is 10 times the interval
+	MaxFailureBackoff time.Duration `yaml:"max_failure_backoff"`
+
+	// FetchRetries is the number of times fetch and ls-remote of the remote
+	// default branch are retried within the same mirror cycle if they fail
+	// with transient (network or timeout) error. retries use exponential
+	// backoff starting at 1s and are bounded by MirrorTimeout, other errors
+	// (eg. auth) are not retried. default is 2, set 0 to disable retries
+	FetchRetries *int `yaml:"fetch_retries"`
+
+	// ProxyURL is the proxy (eg. 'http://proxy:3128') used by git commands
+	// which talks to the remote. it is passed to git as 'http.proxy' config
+	// via GIT_CONFIG_* envs so that it doesn't appear in the command args
+	// and for ssh remotes 'nc' is used as ssh ProxyCommand, credentials in
+	// the url are only supported for http(s) remotes
+	ProxyURL string `yaml:"proxy_url"`
+
+	// GitConfig is the git config (eg. 'fetch.negotiationAlgorithm: skipping'
+	// or 'pack.threads: 4') passed as '-c key=value' args to the git commands
+	// which fetch, clone, checkout or gc the mirror. keys which can run
+	// commands or change remote of the mirror (eg. 'core.hooksPath',
+	// 'alias.*' or 'url.*') are not allowed. repository config is merged
+	// with the defaults and its values take precedence
+	GitConfig map[string]string `yaml:"git_config"`
+
+	// FetchJobs is the number of parallel jobs used by fetch, its passed to
+	// git fetch as '--jobs'. default is 0 ie git default
+	FetchJobs int `yaml:"fetch_jobs"`
+
+	// ReplicaRoots is the list of absolute paths of additional root dirs where
+	// published worktrees are copied after every successful mirror cycle.
+	// worktree links under the Root are published at the same relative path
+	// in each replica root
+	ReplicaRoots []string `yaml:"replica_roots"`
+
+	// MaxDiskUsageBytes is the disk quota of the repository including its
+	// worktrees. when exceeded aggressive gc is run and if usage is still
+	// over quota error is logged and metric is set. default is 0 (no quota)
+	MaxDiskUsageBytes int64 `yaml:"max_disk_usage_bytes"`
+
+	// MaxCloneFSBytes is the max total size of the files of the filesystem
+	// returned by CloneFS. default is 128MiB
+	MaxCloneFSBytes int64 `yaml:"max_clone_fs_bytes"`
+
+	// RemoteRefsCacheTTL is the time for which results of ListRemoteRefs and
+	// RemoteHash are cached. default is 0 which means remote is queried on
+	// every call, concurrent calls with same patterns are always deduplicated
+	RemoteRefsCacheTTL time.Duration `yaml:"remote_refs_cache_ttl"`
+
+	// Critical marks repository as required for readiness of the pool. if
+	// none of the repositories are critical all of them are required.
+	// see RepoPool.Ready
+	Critical bool `yaml:"critical"`
+
+	// LFS enables Git LFS, objects of the files in worktree pathspec are
+	// fetched into the mirror and checked out in worktrees and clones instead
+	// of the pointer files. git-lfs must be installed
+	LFS bool `yaml:"lfs"`
+
+	// PreserveFileModes makes worktree checkout create symlinks and keep
+	// executable bit of files regardless of core.symlinks and core.fileMode
+	// config of the mirror, modes of the checked out files are verified
+	// before worktree is published. default is true, disable it only if file
+	// system of the root doesn't support symlinks or file modes
+	PreserveFileModes *bool `yaml:"preserve_file_modes"`
+
+	// AdoptExisting makes git-mirror adopt existing bare repository in the
+	// repository dir (eg. created by 'git clone --bare' or other tool)
+	// instead of re-creating it if it doesn't match the config. remote url
+	// is updated if it only differs in normalisation, fetch refspecs, depth
+	// and HEAD are set and every change is logged, repository is only
+	// re-created if its objects are corrupt. see Repository.PlanAdoption
+	AdoptExisting bool `yaml:"adopt_existing"`
+
+	// AllowLinksOutsideRoot allows absolute worktree links outside of the
+	// Root (eg. '/var/www/site'), such links are still rejected if they are
+	// '/', parent of the root or inside any of the repository dirs.
+	// default is false
+	AllowLinksOutsideRoot bool `yaml:"allow_links_outside_root"`
+
+	// Labels are arbitrary key/value metadata of the repository (eg.
+	// 'team: payments'). they are attached to all log lines of the
+	// repository and included in status and manifest, keys listed in
+	// defaults MetricLabels are also added to the mirror metrics
+	Labels map[string]string `yaml:"labels"`
+
 	// Worktrees contains list of worktrees links which will be maintained.
 	// worktrees are optional repo can be mirrored without worktree
 	Worktrees []WorktreeConfig `yaml:"worktrees"`
+
+	// AutoWorktrees contains rules of the worktree links which are created
+	// for every mirrored ref matching the rule and removed once the ref is
+	// deleted from the remote, eg. a link per release branch.
+	AutoWorktrees []AutoWorktreeConfig `yaml:"auto_worktrees"`
+
+	// TagWorktrees contains rules of the worktree links which are published
+	// for the latest tags matching the rule, links of the tags which fall out
+	// of the retention window or are deleted from the remote are removed.
+	TagWorktrees []TagWorktreeConfig `yaml:"tag_worktrees"`
+
+	// MaxAutoWorktrees is the max number of worktree links created by the
+	// AutoWorktrees and TagWorktrees rules, links of the new refs are not
+	// created once limit is reached. default is 50
+	MaxAutoWorktrees int `yaml:"max_auto_worktrees"`
+
+	// KeepPrevious is the number of previously published worktrees retained
+	// per link so that link can be rolled back with
+	// Repository.RollbackWorktree. default is 1, set 0 to remove old
+	// worktrees as soon as new one is published
+	KeepPrevious *int `yaml:"keep_previous"`
 }
 
 // Worktree represents maintained worktree on given link.
@@ -72,8 +461,110 @@ type WorktreeConfig struct {
 
 	// Ref represents the git reference of the worktree branch, tags or hash
 	// are supported. default is HEAD
+	// worktree of the commit hash is pinned, its commit is kept in the
+	// mirror even if its removed from the remote as long as link exists.
 	Ref string `yaml:"ref"`
 
+	// RefPrecedence decides what short Ref name (ie without 'refs/' prefix)
+	// resolves to if both branch and tag with the same name exist.
+	// supported values are 'heads' and 'tags' (same as git).
+	// default is heads. fully-qualified ref names are never expanded.
+	RefPrecedence RefPrecedence `yaml:"ref_precedence"`
+
+	// RefPattern is the glob pattern of the tags (eg. 'v1.*') to track instead
+	// of the fixed Ref. highest matching tag is checked out on every mirror
+	// cycle. it is mutually exclusive with Ref and tags matching the pattern
+	// must be mirrored by the refspecs. link is pending while no tag matches.
+	RefPattern string `yaml:"ref_pattern"`
+
+	// RefSort is the order used to pick highest tag matching the RefPattern.
+	// supported values are 'version' and 'creatordate'. default is version
+	RefSort RefSortMode `yaml:"ref_sort"`
+
+	// Pathspec of the dirs to checkout if required
+	Pathspec string `yaml:"pathspec"`
+
+	// Sparse enables sparse-checkout in cone mode, only the Pathspec dir is
+	// materialised on disk. Pathspec must be a plain directory path.
+	Sparse bool `yaml:"sparse"`
+
+	// Submodules controls checkout of the submodules in the worktree.
+	// supported values are 'false', 'true' and 'recursive'. default is false
+	Submodules SubmoduleMode `yaml:"submodules"`
+
+	// FailOnEmptyPathspec fails worktree update if Pathspec doesn't match any
+	// file on the ref, by default only warning is logged and empty worktree
+	// is published
+	FailOnEmptyPathspec bool `yaml:"fail_on_empty_pathspec"`
+
+	// RespectExportIgnore removes paths with 'export-ignore' attribute set in
+	// .gitattributes from the worktree after checkout, same as `git archive`.
+	// attributes are read from the checked out commit, for pathspec worktrees
+	// its the last commit which updated the pathspec
+	RespectExportIgnore bool `yaml:"respect_export_ignore"`
+
+	// PublishMode controls how worktree is published on the link. supported
+	// values are 'symlink' and 'copy'. in copy mode worktree is copied into
+	// a versioned dir next to the link and link points to the copy.
+	// default is symlink
+	PublishMode PublishMode `yaml:"publish_mode"`
+
+	// ProtectAgainstForcePush blocks update of the published worktree if new
+	// hash is not a descendant of the published one (eg. ref was rewound by
+	// force-push). old content is kept until ref becomes a descendant again
+	// or update is approved with Repository.ApproveWorktreeUpdate.
+	// fast-forward updates and first publish are not affected
+	ProtectAgainstForcePush bool `yaml:"protect_against_force_push"`
+
+	// Permissions controls ownership and modes of the checked out files,
+	// by default files are left as checked out by git
+	Permissions `yaml:",inline"`
+}
+
+// TagWorktreeConfig represents rule of the worktree links maintained for
+// the latest Keep tags matching the pattern.
+type TagWorktreeConfig struct {
+	// Pattern is the glob pattern of the tag names (eg. 'v*') to publish
+	Pattern string `yaml:"pattern"`
+
+	// LinkPrefix is the path prefix of the links, it must end with '/'.
+	// link of the tag is the prefix followed by the tag name with '/' and
+	// other unsafe characters replaced by '-' (eg. 'releases/' ->
+	// 'releases/v1.2.3'). links of the rule are placed in its own dir which
+	// can't contain any other link, if path is not absolute it will be
+	// created under repository root
+	LinkPrefix string `yaml:"link_prefix"`
+
+	// Keep is the number of the latest matching tags published. default is 5
+	Keep int `yaml:"keep"`
+
+	// Sort is the order used to pick the latest tags. supported values are
+	// 'version' and 'creatordate'. version sort follows semver precedence,
+	// pre-release tags (eg. 'v1.0.0-rc.1') are lower than the release.
+	// default is version
+	Sort RefSortMode `yaml:"sort"`
+
+	// Pathspec of the dirs to checkout if required
+	Pathspec string `yaml:"pathspec"`
+}
+
+// AutoWorktreeConfig represents rule of the worktree links maintained for
+// all the refs matching the ref glob.
+type AutoWorktreeConfig struct {
+	// RefGlob is the fully-qualified pattern of the refs (eg.
+	// 'refs/heads/release/*') to create worktree links for. pattern may
+	// contain single '*' matching any part of the ref same as refspecs
+	RefGlob string `yaml:"ref_glob"`
+
+	// LinkTemplate is the path of the worktree link, '{short_ref}' in the
+	// last element is replaced by the short name of the matching ref with
+	// '/' and other unsafe characters replaced by '-'
+	// (eg. 'releases/{short_ref}' -> 'releases/release-1.2').
+	// links of the rule are placed in its own dir which can't contain
+	// any other link, if path is not absolute it will be created under
+	// repository root
+	LinkTemplate string `yaml:"link_template"`
+
 	// Pathspec of the dirs to checkout if required
 	Pathspec string `yaml:"pathspec"`
 }
@@ -85,8 +576,167 @@ type Auth struct {
 
 	// path to the known hosts of the remote host
 	SSHKnownHostsPath string `yaml:"ssh_known_hosts_path"`
+
+	// StrictHostKeyChecking makes ssh verify remote host key against
+	// SSHKnownHostsPath even if ssh key is not set. host key checking is
+	// never disabled so known hosts path is required. if set on the pool
+	// defaults it's enforced for all ssh remotes of the pool
+	StrictHostKeyChecking bool `yaml:"strict_host_key_checking"`
+
+	// SSHKnownHostsBootstrap treats SSHKnownHostsPath as managed file, if
+	// remote host is not in the file its keys are added by ssh on first use
+	// (StrictHostKeyChecking=accept-new) via the git runner and the proxy.
+	// keys are pinned thereafter and fetch fails if they change. it implies
+	// StrictHostKeyChecking
+	SSHKnownHostsBootstrap bool `yaml:"ssh_known_hosts_bootstrap"`
+
+	// username used along with password/token to fetch https remote
+	Username string `yaml:"username"`
+
+	// path to the file containing password or token used to fetch https remote
+	// file is read on every fetch so rotated secret is picked up without restart
+	PasswordFilePath string `yaml:"password_file_path"`
+
+	// CredentialCommand is the command (eg. ['vault', 'kv', 'get', ...])
+	// which prints short-lived password or token of the https remote to
+	// stdout. output is either the credential itself or 'username=<name>' and
+	// 'password=<secret>' lines of the git credential helper format. command
+	// is run before remote operations if cached credential has expired or was
+	// rejected by the remote. credential is passed to git via env and is
+	// never written to disk or logged. Username is used if output doesn't
+	// include it. it can't be combined with ssh key or password file auth
+	CredentialCommand []string `yaml:"credential_command"`
+
+	// CredentialTTL is the time output of the CredentialCommand is cached.
+	// default is 5m
+	CredentialTTL time.Duration `yaml:"credential_ttl"`
+}
+
+// isZero returns true if auth is not configured
+func (a Auth) isZero() bool {
+	return a.SSHKeyPath == "" && a.SSHKnownHostsPath == "" && !a.StrictHostKeyChecking &&
+		!a.SSHKnownHostsBootstrap && a.Username == "" && a.PasswordFilePath == "" &&
+		len(a.CredentialCommand) == 0 && a.CredentialTTL == 0
+}
+
+// strictHostKeys returns true if host key must always be verified
+func (a Auth) strictHostKeys() bool {
+	return a.StrictHostKeyChecking || a.SSHKnownHostsBootstrap
+}
+
+// validateHostKeys makes sure known hosts file is provided if strict host
+// key checking is enabled
+func (a Auth) validateHostKeys() error {
+	if a.strictHostKeys() && a.SSHKnownHostsPath == "" {
+		return fmt.Errorf("%w: ssh known hosts path is required with strict host key checking", ErrInvalidAuth)
+	}
+	if a.SSHKnownHostsBootstrap && !filepath.IsAbs(a.SSHKnownHostsPath) {
+		return fmt.Errorf("%w: managed ssh known hosts path '%s' must be absolute", ErrInvalidAuth, a.SSHKnownHostsPath)
+	}
+	return nil
 }
 
+// hasHTTPAuth returns true if basic auth is configured for https remotes
+func (a Auth) hasHTTPAuth() bool {
+	return a.Username != "" || a.PasswordFilePath != "" || len(a.CredentialCommand) > 0
+}
+
+// validateCredentialCommand makes sure credential command is not combined
+// with other credentials
+func (a Auth) validateCredentialCommand() error {
+	if a.CredentialTTL < 0 {
+		return fmt.Errorf("%w: credential ttl (%s) must not be negative", ErrInvalidAuth, a.CredentialTTL)
+	}
+	if len(a.CredentialCommand) == 0 {
+		return nil
+	}
+	if a.CredentialCommand[0] == "" {
+		return fmt.Errorf("%w: credential command must not be empty", ErrInvalidAuth)
+	}
+	if a.SSHKeyPath != "" {
+		return fmt.Errorf("%w: credential command can't be combined with ssh key auth", ErrInvalidAuth)
+	}
+	if a.PasswordFilePath != "" {
+		return fmt.Errorf("%w: credential command can't be combined with password file auth", ErrInvalidAuth)
+	}
+	return nil
+}
+
+// gitHTTPAuthEnvs returns the environment variables to be used for
+// authenticating git over https. credentials are passed as 'http.extraHeader'
+// config via env so they are never written to the repo config or logged with
+// the command arguments.
+func (a Auth) gitHTTPAuthEnvs() ([]string, error) {
+	if a.PasswordFilePath == "" {
+		return nil, fmt.Errorf("password file path is required for https auth")
+	}
+	password, err := os.ReadFile(a.PasswordFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read password file err:%w", err)
+	}
+	return basicAuthEnvs(a.Username, strings.TrimSpace(string(password))), nil
+}
+
+// basicAuthEnvs returns the environment variables which set basic auth
+// header of the git http requests
+func basicAuthEnvs(username, password string) []string {
+	cred := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return appendGitConfigEnv(nil, "http.extraHeader", "Authorization: Basic "+cred)
+}
+
+// appendGitConfigEnv adds git config key and value to the GIT_CONFIG_*
+// environment variables, existing GIT_CONFIG_COUNT of the envs is updated
+// so config passed via env by other sources is kept
+func appendGitConfigEnv(envs []string, key, value string) []string {
+	count, idx := 0, -1
+	for i, e := range envs {
+		if v, ok := strings.CutPrefix(e, "GIT_CONFIG_COUNT="); ok {
+			count, _ = strconv.Atoi(v)
+			idx = i
+		}
+	}
+
+	countEnv := "GIT_CONFIG_COUNT=" + strconv.Itoa(count+1)
+	envs = slices.Clone(envs)
+	if idx >= 0 {
+		envs[idx] = countEnv
+	} else {
+		envs = append(envs, countEnv)
+	}
+	return append(envs,
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", count, key),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, value),
+	)
+}
+
+// FetchWindow represents the time of the day when remote traffic is allowed.
+// outside of the window mirror cycle skips fetch but still validates and
+// maintains existing worktrees. window can span midnight (eg. 22:00-04:00).
+// empty window means remote can be fetched at any time.
+type FetchWindow struct {
+	// Start of the window in 'HH:MM' format
+	Start string `yaml:"start"`
+
+	// End of the window in 'HH:MM' format
+	End string `yaml:"end"`
+
+	// Timezone is the IANA name of the location (eg. 'Europe/London') in which
+	// start and end are specified. default is 'UTC'
+	Timezone string `yaml:"timezone"`
+
+	// Triggers controls mirror runs queued via QueueMirrorRun (eg. by the
+	// webhook) outside of the window. 'queue' (default) defers the run
+	// until the window opens, 'allow' fetches immediately.
+	Triggers string `yaml:"triggers"`
+}
+
+const (
+	// FetchWindowTriggersQueue defers triggered runs until window opens
+	FetchWindowTriggersQueue = "queue"
+	// FetchWindowTriggersAllow lets triggered runs fetch outside of window
+	FetchWindowTriggersAllow = "allow"
+)
+
 // ValidateDefaults will verify default config
 func (rpc *RepoPoolConfig) ValidateDefaults() error {
 	dc := rpc.Defaults
@@ -105,6 +755,15 @@ func (rpc *RepoPoolConfig) ValidateDefaults() error {
 		}
 	}
 
+	if dc.Schedule != "" {
+		if dc.Interval != 0 {
+			errs = append(errs, fmt.Errorf("only one of interval or schedule can be set"))
+		}
+		if err := validateSchedule(dc.Schedule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if dc.MirrorTimeout != 0 {
 		if dc.MirrorTimeout < minAllowedInterval {
 			errs = append(errs, fmt.Errorf("provided mirroring timeout is too sort (%s), must be > %s", dc.Interval, minAllowedInterval))
@@ -118,6 +777,103 @@ func (rpc *RepoPoolConfig) ValidateDefaults() error {
 			gcAuto, gcAlways, gcAggressive, gcOff))
 	}
 
+	for _, rs := range dc.RefSpecs {
+		if err := validateRefSpec(rs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := dc.Auth.validateHostKeys(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := dc.Auth.validateCredentialCommand(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for host, auth := range dc.AuthProviders {
+		if host == "" || strings.ContainsAny(host, "/@ ") {
+			errs = append(errs, fmt.Errorf("%w: auth provider host %q must be a host name with optional port", ErrInvalidAuth, host))
+		}
+		if err := auth.validateHostKeys(); err != nil {
+			errs = append(errs, fmt.Errorf("auth provider host %q err:%w", host, err))
+		}
+		if err := auth.validateCredentialCommand(); err != nil {
+			errs = append(errs, fmt.Errorf("auth provider host %q err:%w", host, err))
+		}
+	}
+
+	if err := dc.FetchWindow.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if dc.Depth < 0 {
+		errs = append(errs, fmt.Errorf("provided depth (%d) must not be negative", dc.Depth))
+	}
+
+	if dc.GitTimeout < 0 {
+		errs = append(errs, fmt.Errorf("provided git timeout (%s) must not be negative", dc.GitTimeout))
+	}
+
+	if dc.ReinitThreshold < 0 {
+		errs = append(errs, fmt.Errorf("provided reinit threshold (%d) must not be negative", dc.ReinitThreshold))
+	}
+
+	if dc.MaxFailureBackoff < 0 {
+		errs = append(errs, fmt.Errorf("provided max failure backoff (%s) must not be negative", dc.MaxFailureBackoff))
+	}
+
+	if err := validateFetchRetries(dc.FetchRetries); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateKeepPrevious(dc.KeepPrevious); err != nil {
+		errs = append(errs, err)
+	}
+
+	if dc.GCInterval < 0 {
+		errs = append(errs, fmt.Errorf("provided gc interval (%s) must not be negative", dc.GCInterval))
+	}
+
+	if dc.Jitter != nil && (*dc.Jitter < 0 || *dc.Jitter > 1) {
+		errs = append(errs, fmt.Errorf("provided jitter (%g) must be between 0 and 1", *dc.Jitter))
+	}
+
+	if dc.StartupStagger < 0 {
+		errs = append(errs, fmt.Errorf("provided startup stagger (%s) must not be negative", dc.StartupStagger))
+	}
+
+	if _, err := dc.WorktreePermissions.parse(); err != nil {
+		errs = append(errs, fmt.Errorf("invalid worktree permissions err:%w", err))
+	}
+
+	if err := validateProxyURL(dc.ProxyURL); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateGitConfig(dc.GitConfig); err != nil {
+		errs = append(errs, err)
+	}
+
+	if dc.FetchJobs < 0 {
+		errs = append(errs, fmt.Errorf("provided fetch jobs (%d) must not be negative", dc.FetchJobs))
+	}
+
+	if dc.MirrorConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("provided mirror concurrency (%d) must not be negative", dc.MirrorConcurrency))
+	}
+	if dc.AuditLogPath != "" && !filepath.IsAbs(dc.AuditLogPath) {
+		errs = append(errs, fmt.Errorf("audit log path '%s' must be absolute", dc.AuditLogPath))
+	}
+	if dc.ManifestPath != "" && !filepath.IsAbs(dc.ManifestPath) {
+		errs = append(errs, fmt.Errorf("manifest path '%s' must be absolute", dc.ManifestPath))
+	}
+	if dc.MaxConcurrentGitOps < 0 {
+		errs = append(errs, fmt.Errorf("provided max concurrent git ops (%d) must not be negative", dc.MaxConcurrentGitOps))
+	}
+	if err := validateMetricLabels(dc.MetricLabels); err != nil {
+		errs = append(errs, err)
+	}
+
 	if len(errs) > 0 {
 		return fmt.Errorf("%s", errs)
 	}
@@ -133,28 +889,196 @@ func (rpc *RepoPoolConfig) ApplyDefaults() {
 			repo.Root = rpc.Defaults.Root
 		}
 
-		if repo.Interval == 0 {
+		// interval and schedule are mutually exclusive so defaults are only
+		// applied if neither is set
+		if repo.Interval == 0 && repo.Schedule == "" {
 			repo.Interval = rpc.Defaults.Interval
+			repo.Schedule = rpc.Defaults.Schedule
 		}
 
 		if repo.MirrorTimeout == 0 {
 			repo.MirrorTimeout = rpc.Defaults.MirrorTimeout
 		}
 
+		if repo.GitTimeout == 0 {
+			repo.GitTimeout = rpc.Defaults.GitTimeout
+		}
+
 		if repo.GitGC == "" {
 			repo.GitGC = rpc.Defaults.GitGC
 		}
 
-		if (repo.Auth == Auth{}) {
-			repo.Auth = rpc.Defaults.Auth
+		if repo.GCInterval == 0 {
+			repo.GCInterval = rpc.Defaults.GCInterval
+		}
+
+		if repo.Auth.isZero() {
+			if auth, ok := rpc.Defaults.providerAuth(repo.Remote); ok {
+				repo.Auth = auth
+			} else {
+				repo.Auth = rpc.Defaults.Auth
+			}
+		}
+
+		// strict host key checking of the pool can't be disabled by the
+		// repository's own auth config
+		if rpc.Defaults.Auth.StrictHostKeyChecking && isSSHRemote(repo.Remote) {
+			repo.Auth.StrictHostKeyChecking = true
+		}
+
+		if len(repo.RefSpecs) == 0 && repo.SingleBranch == "" {
+			repo.RefSpecs = rpc.Defaults.RefSpecs
+		}
+
+		if !repo.TrackDefaultBranch {
+			repo.TrackDefaultBranch = rpc.Defaults.TrackDefaultBranch
+		}
+
+		if !repo.SkipFetchIfUnchanged {
+			repo.SkipFetchIfUnchanged = rpc.Defaults.SkipFetchIfUnchanged
+		}
+
+		if !repo.EnableHashCache {
+			repo.EnableHashCache = rpc.Defaults.EnableHashCache
+		}
+
+		if !repo.DisableCloneRevision {
+			repo.DisableCloneRevision = rpc.Defaults.DisableCloneRevision
+		}
+
+		if !repo.AllowLinksOutsideRoot {
+			repo.AllowLinksOutsideRoot = rpc.Defaults.AllowLinksOutsideRoot
+		}
+
+		if (repo.FetchWindow == FetchWindow{}) {
+			repo.FetchWindow = rpc.Defaults.FetchWindow
+		}
+
+		if repo.Depth == 0 {
+			repo.Depth = rpc.Defaults.Depth
+		}
+
+		if repo.ReinitThreshold == 0 {
+			repo.ReinitThreshold = rpc.Defaults.ReinitThreshold
+		}
+
+		if repo.MaxFailureBackoff == 0 {
+			repo.MaxFailureBackoff = rpc.Defaults.MaxFailureBackoff
+		}
+
+		if repo.FetchRetries == nil {
+			repo.FetchRetries = rpc.Defaults.FetchRetries
+		}
+
+		if repo.KeepPrevious == nil {
+			repo.KeepPrevious = rpc.Defaults.KeepPrevious
+		}
+
+		if repo.ProxyURL == "" {
+			repo.ProxyURL = rpc.Defaults.ProxyURL
+		}
+
+		if len(rpc.Defaults.GitConfig) > 0 {
+			gitConfig := maps.Clone(rpc.Defaults.GitConfig)
+			maps.Copy(gitConfig, repo.GitConfig)
+			repo.GitConfig = gitConfig
+		}
+
+		if repo.FetchJobs == 0 {
+			repo.FetchJobs = rpc.Defaults.FetchJobs
+		}
+
+		for j := range repo.Worktrees {
+			perms := &repo.Worktrees[j].Permissions
+			if perms.Owner == "" {
+				perms.Owner = rpc.Defaults.WorktreePermissions.Owner
+			}
+			if perms.Group == "" {
+				perms.Group = rpc.Defaults.WorktreePermissions.Group
+			}
+			if perms.DirMode == "" {
+				perms.DirMode = rpc.Defaults.WorktreePermissions.DirMode
+			}
+			if perms.FileMode == "" {
+				perms.FileMode = rpc.Defaults.WorktreePermissions.FileMode
+			}
+		}
+	}
+}
+
+// FilterRepositories removes duplicate repositories and applies include and
+// exclude patterns to the repositories list. remotes and patterns are
+// compared after normalisation and first config of the duplicate remote is
+// kept. error is returned if pattern is invalid or doesn't match any
+// repository unless AllowUnmatchedPatterns is set.
+func (rpc *RepoPoolConfig) FilterRepositories() error {
+	var errs []error
+
+	for _, pattern := range slices.Concat(rpc.Include, rpc.Exclude) {
+		if _, err := path.Match(giturl.NormaliseURL(pattern), ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid remote pattern '%s' err:%w", pattern, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", errs)
+	}
+
+	seen := make(map[string]bool)
+	matched := make(map[string]bool)
+	var repos []RepositoryConfig
+
+	for _, repo := range rpc.Repositories {
+		remote := giturl.NormaliseURL(repo.Remote)
+		if seen[remote] {
+			continue
+		}
+		seen[remote] = true
+
+		included := len(rpc.Include) == 0
+		for _, pattern := range rpc.Include {
+			if remoteMatches(pattern, remote) {
+				matched[pattern] = true
+				included = true
+			}
+		}
+		excluded := false
+		for _, pattern := range rpc.Exclude {
+			if remoteMatches(pattern, remote) {
+				matched[pattern] = true
+				excluded = true
+			}
+		}
+		if included && !excluded {
+			repos = append(repos, repo)
+		}
+	}
+
+	if !rpc.AllowUnmatchedPatterns {
+		for _, pattern := range slices.Concat(rpc.Include, rpc.Exclude) {
+			if !matched[pattern] {
+				errs = append(errs, fmt.Errorf("remote pattern '%s' doesn't match any repository", pattern))
+			}
 		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", errs)
+	}
+
+	rpc.Repositories = repos
+	return nil
+}
+
+// remoteMatches returns true if given normalised remote matches the pattern
+func remoteMatches(pattern, remote string) bool {
+	ok, _ := path.Match(giturl.NormaliseURL(pattern), remote)
+	return ok
 }
 
 // It is possible that same root is used for multiple repositories
 // since Links are placed at the root, we need to make sure that all link's
 // name (path) are diff.
 // ValidateLinkPaths makes sures all link's absolute paths are different.
+// links can be outside of the root but not inside any of the repository dirs.
 func (rpc *RepoPoolConfig) ValidateLinkPaths() error {
 	var errs []error
 
@@ -162,10 +1086,23 @@ func (rpc *RepoPoolConfig) ValidateLinkPaths() error {
 
 	rpc.ApplyDefaults()
 
+	// links can't be published inside any of the repository dirs
+	var repoDirs []string
+	for _, repo := range rpc.Repositories {
+		if gURL, err := giturl.Parse(giturl.NormaliseURL(repo.Remote)); err == nil {
+			repoDirs = append(repoDirs, repoDirPath(repo.Root, gURL))
+		}
+	}
+
 	// add defaults before checking abs link paths
 	for _, repo := range rpc.Repositories {
 		for _, l := range repo.Worktrees {
 			absL := absLink(repo.Root, l.Link)
+			if i := slices.IndexFunc(repoDirs, func(dir string) bool { return isSubPath(dir, absL) }); i >= 0 {
+				errs = append(errs, fmt.Errorf("link path is inside repository dir name:%s path:%s dir:%s",
+					l.Link, absL, repoDirs[i]))
+				continue
+			}
 			if ok := absLinks[absL]; ok {
 				errs = append(errs, fmt.Errorf("links with overlapping abs path found name:%s path:%s",
 					l.Link, absL))
@@ -173,6 +1110,46 @@ func (rpc *RepoPoolConfig) ValidateLinkPaths() error {
 			}
 			absLinks[absL] = true
 		}
+		// dir of the auto and tag worktree links is checked same as the link
+		// so that static links can't collide with the auto links
+		for _, awc := range repo.AutoWorktrees {
+			absL := absLink(repo.Root, awc.linkDir())
+			if i := slices.IndexFunc(repoDirs, func(dir string) bool { return isSubPath(dir, absL) }); i >= 0 {
+				errs = append(errs, fmt.Errorf("auto worktree link dir is inside repository dir template:%s path:%s dir:%s",
+					awc.LinkTemplate, absL, repoDirs[i]))
+				continue
+			}
+			if ok := absLinks[absL]; ok {
+				errs = append(errs, fmt.Errorf("auto worktree link dir overlaps other link template:%s path:%s",
+					awc.LinkTemplate, absL))
+				continue
+			}
+			absLinks[absL] = true
+		}
+		for _, twc := range repo.TagWorktrees {
+			absL := absLink(repo.Root, twc.linkDir())
+			if i := slices.IndexFunc(repoDirs, func(dir string) bool { return isSubPath(dir, absL) }); i >= 0 {
+				errs = append(errs, fmt.Errorf("tag worktree link dir is inside repository dir prefix:%s path:%s dir:%s",
+					twc.LinkPrefix, absL, repoDirs[i]))
+				continue
+			}
+			if ok := absLinks[absL]; ok {
+				errs = append(errs, fmt.Errorf("tag worktree link dir overlaps other link prefix:%s path:%s",
+					twc.LinkPrefix, absL))
+				continue
+			}
+			absLinks[absL] = true
+		}
+	}
+
+	// link can't be published inside the dir of the other link
+	sortedLinks := slices.Sorted(maps.Keys(absLinks))
+	for i, l := range sortedLinks {
+		for _, other := range sortedLinks[i+1:] {
+			if isSubPath(l, other) {
+				errs = append(errs, fmt.Errorf("link path is inside other link path:%s link:%s", other, l))
+			}
+		}
 	}
 
 	if len(errs) > 0 {
@@ -183,16 +1160,475 @@ func (rpc *RepoPoolConfig) ValidateLinkPaths() error {
 
 }
 
+// providerAuth returns auth of the provider matching host of the given
+// remote. only the part of the auth config supported by the remote's scheme
+// is returned.
+func (dc DefaultConfig) providerAuth(remote string) (Auth, bool) {
+	gURL, err := giturl.Parse(remote)
+	if err != nil || gURL.Host == "" {
+		return Auth{}, false
+	}
+
+	auth, ok := dc.authProvider(gURL.Host)
+	if !ok {
+		hostname, _, found := strings.Cut(gURL.Host, ":")
+		if !found {
+			return Auth{}, false
+		}
+		if auth, ok = dc.authProvider(hostname); !ok {
+			return Auth{}, false
+		}
+	}
+
+	if gURL.Scheme == "https" {
+		return Auth{
+			Username:          auth.Username,
+			PasswordFilePath:  auth.PasswordFilePath,
+			CredentialCommand: auth.CredentialCommand,
+			CredentialTTL:     auth.CredentialTTL,
+		}, true
+	}
+	return Auth{
+		SSHKeyPath:             auth.SSHKeyPath,
+		SSHKnownHostsPath:      auth.SSHKnownHostsPath,
+		StrictHostKeyChecking:  auth.StrictHostKeyChecking,
+		SSHKnownHostsBootstrap: auth.SSHKnownHostsBootstrap,
+	}, true
+}
+
+// authProvider returns provider of the given host, hosts are case insensitive
+func (dc DefaultConfig) authProvider(host string) (Auth, bool) {
+	for h, auth := range dc.AuthProviders {
+		if strings.EqualFold(h, host) {
+			return auth, true
+		}
+	}
+	return Auth{}, false
+}
+
+// RemotesWithoutAuth returns remotes of the repositories which have neither
+// their own auth config nor matching auth provider or default auth. such
+// remotes can only be mirrored if they allow unauthenticated access.
+// local remotes are never returned.
+func (rpc *RepoPoolConfig) RemotesWithoutAuth() []string {
+	var remotes []string
+	for _, repo := range rpc.Repositories {
+		if !repo.Auth.isZero() {
+			continue
+		}
+		gURL, err := giturl.Parse(repo.Remote)
+		if err != nil || gURL.Scheme == "local" || gURL.Password != "" {
+			continue
+		}
+		if _, ok := rpc.Defaults.providerAuth(repo.Remote); ok {
+			continue
+		}
+		if !rpc.Defaults.Auth.isZero() {
+			continue
+		}
+		remotes = append(remotes, repo.Remote)
+	}
+	return remotes
+}
+
 // gitSSHCommand returns the environment variable to be used for configuring
-// git over ssh.
+// git over ssh. in strict mode host key is always verified against known
+// hosts file, otherwise its only verified if both ssh key and known hosts
+// are set.
 func (a Auth) gitSSHCommand() string {
+	return a.sshCommandEnv("yes")
+}
+
+// sshCommandEnv returns GIT_SSH_COMMAND env same as gitSSHCommand with the
+// given StrictHostKeyChecking value used in strict mode
+func (a Auth) sshCommandEnv(strict string) string {
 	sshKeyPath := a.SSHKeyPath
 	if sshKeyPath == "" {
 		sshKeyPath = "/dev/null"
 	}
 	knownHostsOptions := "-o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no"
-	if a.SSHKeyPath != "" && a.SSHKnownHostsPath != "" {
+	switch {
+	case a.strictHostKeys():
+		knownHostsOptions = fmt.Sprintf("-o UserKnownHostsFile=%s -o StrictHostKeyChecking=%s", a.SSHKnownHostsPath, strict)
+	case a.SSHKeyPath != "" && a.SSHKnownHostsPath != "":
 		knownHostsOptions = fmt.Sprintf("-o UserKnownHostsFile=%s", a.SSHKnownHostsPath)
 	}
 	return fmt.Sprintf(`GIT_SSH_COMMAND=ssh -q -F none -o IdentitiesOnly=yes -o IdentityFile=%s %s`, sshKeyPath, knownHostsOptions)
 }
+
+// validate makes sure fetch window has valid start, end and timezone
+func (fw FetchWindow) validate() error {
+	if (fw == FetchWindow{}) {
+		return nil
+	}
+	start, err := time.Parse("15:04", fw.Start)
+	if err != nil {
+		return fmt.Errorf("invalid fetch window start '%s', must be in HH:MM format", fw.Start)
+	}
+	end, err := time.Parse("15:04", fw.End)
+	if err != nil {
+		return fmt.Errorf("invalid fetch window end '%s', must be in HH:MM format", fw.End)
+	}
+	if start.Equal(end) {
+		return fmt.Errorf("fetch window start and end must be different")
+	}
+	if _, err := time.LoadLocation(fw.Timezone); err != nil {
+		return fmt.Errorf("invalid fetch window timezone '%s' err:%w", fw.Timezone, err)
+	}
+	switch fw.Triggers {
+	case "", FetchWindowTriggersQueue, FetchWindowTriggersAllow:
+	default:
+		return fmt.Errorf("invalid fetch window triggers '%s', must be one of 'queue' or 'allow'", fw.Triggers)
+	}
+	return nil
+}
+
+// nextOpen returns the next start of the window after given time.
+// window must be validated and not empty.
+func (fw FetchWindow) nextOpen(t time.Time) time.Time {
+	// empty timezone loads UTC
+	loc, err := time.LoadLocation(fw.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	start, _ := time.Parse("15:04", fw.Start)
+
+	t = t.In(loc)
+	open := time.Date(t.Year(), t.Month(), t.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+	if !open.After(t) {
+		open = open.AddDate(0, 0, 1)
+	}
+	return open
+}
+
+// contains returns true if given time is inside the fetch window.
+// window must be validated before calling contains.
+func (fw FetchWindow) contains(t time.Time) bool {
+	if (fw == FetchWindow{}) {
+		return true
+	}
+	// empty timezone loads UTC
+	loc, err := time.LoadLocation(fw.Timezone)
+	if err != nil {
+		return true
+	}
+	start, _ := time.Parse("15:04", fw.Start)
+	end, _ := time.Parse("15:04", fw.End)
+
+	t = t.In(loc)
+	minutes := t.Hour()*60 + t.Minute()
+	startMinutes := start.Hour()*60 + start.Minute()
+	endMinutes := end.Hour()*60 + end.Minute()
+
+	if startMinutes < endMinutes {
+		return minutes >= startMinutes && minutes < endMinutes
+	}
+	// window spans midnight
+	return minutes >= startMinutes || minutes < endMinutes
+}
+
+// validate verifies repository config, errors wrap one of the ErrInvalid*
+// errors so they can be matched with errors.Is
+func (rc RepositoryConfig) validate() error {
+	remoteURL := giturl.NormaliseURL(rc.Remote)
+	if _, err := giturl.Parse(remoteURL); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRemote, err)
+	}
+
+	if err := validateRoot(rc.Root); err != nil {
+		return err
+	}
+
+	for _, prev := range rc.PreviousRemotes {
+		if _, err := giturl.Parse(giturl.NormaliseURL(prev)); err != nil {
+			return fmt.Errorf("%w: invalid previous remote %s err:%w", ErrInvalidRemote, giturl.Redact(prev), err)
+		}
+	}
+
+	if rc.Schedule != "" {
+		if rc.Interval != 0 {
+			return fmt.Errorf("%w: only one of interval (%s) or schedule (%s) can be set", ErrInvalidSchedule, rc.Interval, rc.Schedule)
+		}
+		if err := validateSchedule(rc.Schedule); err != nil {
+			return err
+		}
+	} else if err := validateInterval(rc.Interval); err != nil {
+		return err
+	}
+
+	if err := validateGCMode(rc.GitGC); err != nil {
+		return err
+	}
+
+	if err := rc.FetchWindow.validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	if err := rc.Auth.validateCredentialCommand(); err != nil {
+		return err
+	}
+
+	if rc.Auth.hasHTTPAuth() && !giturl.IsHTTPSURL(remoteURL) {
+		return fmt.Errorf("%w: username/password auth is only supported for https remotes", ErrInvalidAuth)
+	}
+
+	if isSSHRemote(remoteURL) {
+		if err := rc.Auth.validateHostKeys(); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	if rc.Depth < 0 {
+		errs = append(errs, fmt.Errorf("provided depth (%d) must not be negative", rc.Depth))
+	}
+	if rc.GitTimeout < 0 {
+		errs = append(errs, fmt.Errorf("provided git timeout (%s) must not be negative", rc.GitTimeout))
+	}
+	errs = append(errs,
+		validatePrune(rc.Prune, rc.PruneTags),
+		validateGitExecPath(rc.GitExecPath),
+		validateReplicaRoots(rc.Root, rc.ReplicaRoots),
+		validateProxyURL(rc.ProxyURL),
+		validateLabels(rc.Labels),
+		validateGitConfig(rc.GitConfig),
+	)
+	if rc.ReinitThreshold < 0 {
+		errs = append(errs, fmt.Errorf("provided reinit threshold (%d) must not be negative", rc.ReinitThreshold))
+	}
+	if rc.MaxFailureBackoff < 0 {
+		errs = append(errs, fmt.Errorf("provided max failure backoff (%s) must not be negative", rc.MaxFailureBackoff))
+	}
+	errs = append(errs, validateFetchRetries(rc.FetchRetries))
+	errs = append(errs, validateKeepPrevious(rc.KeepPrevious))
+	if rc.FetchJobs < 0 {
+		errs = append(errs, fmt.Errorf("provided fetch jobs (%d) must not be negative", rc.FetchJobs))
+	}
+	if rc.GCInterval < 0 {
+		errs = append(errs, fmt.Errorf("provided gc interval (%s) must not be negative", rc.GCInterval))
+	}
+	if rc.MaxDiskUsageBytes < 0 {
+		errs = append(errs, fmt.Errorf("provided max disk usage (%d) must not be negative", rc.MaxDiskUsageBytes))
+	}
+	if rc.RemoteRefsCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("provided remote refs cache ttl (%s) must not be negative", rc.RemoteRefsCacheTTL))
+	}
+	if rc.MaxCloneFSBytes < 0 {
+		errs = append(errs, fmt.Errorf("provided max clone fs size (%d) must not be negative", rc.MaxCloneFSBytes))
+	}
+	for _, rs := range rc.RefSpecs {
+		errs = append(errs, validateRefSpec(rs))
+	}
+	if rc.SingleBranch != "" {
+		if len(rc.RefSpecs) > 0 {
+			errs = append(errs, fmt.Errorf("only one of single branch (%s) or refspecs can be set", rc.SingleBranch))
+		}
+		errs = append(errs, validateBranchName(rc.SingleBranch))
+	}
+	for _, wt := range rc.Worktrees {
+		if wt.Ref != "" && !refMatchesRefSpecs(wt.Ref, rc.refSpecs()) {
+			errs = append(errs, fmt.Errorf("%w link:%s ref:%s refspecs:%s", ErrRefNotMirrored, wt.Link, wt.Ref, rc.refSpecs()))
+		}
+	}
+	for _, awc := range rc.AutoWorktrees {
+		errs = append(errs, awc.validate())
+	}
+	for _, twc := range rc.TagWorktrees {
+		errs = append(errs, twc.validate())
+		if !refMatchesRefSpecs("refs/tags/"+twc.Pattern, rc.refSpecs()) {
+			errs = append(errs, fmt.Errorf("%w tag worktree pattern:%s refspecs:%s", ErrRefNotMirrored, twc.Pattern, rc.refSpecs()))
+		}
+	}
+	if rc.MaxAutoWorktrees < 0 {
+		errs = append(errs, fmt.Errorf("provided max auto worktrees (%d) must not be negative", rc.MaxAutoWorktrees))
+	}
+	// only first error is returned to keep messages same as before
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+	return nil
+}
+
+// fetchRetries returns number of retries of the transient fetch failures
+func (rc RepositoryConfig) fetchRetries() int {
+	if rc.FetchRetries == nil {
+		return defaultFetchRetries
+	}
+	return *rc.FetchRetries
+}
+
+// keepPrevious returns number of previously published worktrees retained
+// per link
+func (rc RepositoryConfig) keepPrevious() int {
+	if rc.KeepPrevious == nil {
+		return defaultKeepPrevious
+	}
+	return *rc.KeepPrevious
+}
+
+// maxAutoWorktrees returns max number of worktree links created by the auto
+// worktree rules
+func (rc RepositoryConfig) maxAutoWorktrees() int {
+	if rc.MaxAutoWorktrees == 0 {
+		return defaultMaxAutoWorktrees
+	}
+	return rc.MaxAutoWorktrees
+}
+
+// refSpecs returns fetch refspecs used to mirror the repository
+func (rc RepositoryConfig) refSpecs() []string {
+	switch {
+	case rc.SingleBranch != "":
+		branch := strings.TrimPrefix(rc.SingleBranch, "refs/heads/")
+		return []string{"+refs/heads/" + branch + ":refs/heads/" + branch}
+	case len(rc.RefSpecs) > 0:
+		return rc.RefSpecs
+	default:
+		return []string{defaultRefSpec}
+	}
+}
+
+// validateBranchName makes sure given branch name can be used in refspec,
+// it can be short name or full ref under 'refs/heads/'
+func validateBranchName(branch string) error {
+	name := strings.TrimPrefix(branch, "refs/heads/")
+	if name == "" || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "refs/") ||
+		strings.Contains(name, "..") || strings.ContainsAny(name, "*:^~?[\\ \t") {
+		return fmt.Errorf("invalid branch name '%s'", branch)
+	}
+	return nil
+}
+
+// validateRoot makes sure root is an absolute path
+func validateRoot(root string) error {
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("%w: repository root '%s' must be absolute", ErrInvalidRoot, root)
+	}
+	return nil
+}
+
+// validateInterval makes sure interval is not too short
+func validateInterval(interval time.Duration) error {
+	if interval < minAllowedInterval {
+		return fmt.Errorf("%w: provided interval between mirroring is too sort (%s), must be > %s", ErrInvalidInterval, interval, minAllowedInterval)
+	}
+	return nil
+}
+
+// validateSchedule makes sure schedule is a valid cron expression which
+// matches at least once
+func validateSchedule(spec string) error {
+	s, err := parseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSchedule, err)
+	}
+	if s.next(time.Now()).IsZero() {
+		return fmt.Errorf("%w: schedule '%s' never matches", ErrInvalidSchedule, spec)
+	}
+	return nil
+}
+
+// validateGCMode makes sure gc mode is one of the supported modes
+func validateGCMode(mode string) error {
+	switch mode {
+	case gcAuto, gcAlways, gcAggressive, gcOff:
+		return nil
+	}
+	return fmt.Errorf("%w: wrong gc value provided, must be one of %s, %s, %s, %s",
+		ErrInvalidGCMode, gcAuto, gcAlways, gcAggressive, gcOff)
+}
+
+// validateGitExecPath makes sure given path is an absolute path of an
+// existing executable file
+func validateGitExecPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("git exec path '%s' must be absolute", path)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unable to stat git exec path '%s' err:%w", path, err)
+	}
+	if fi.IsDir() || fi.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("git exec path '%s' is not an executable file", path)
+	}
+	return nil
+}
+
+// validatePrune makes sure tags are only pruned if prune is enabled
+func validatePrune(prune *bool, pruneTags bool) error {
+	if pruneTags && prune != nil && !*prune {
+		return fmt.Errorf("prune_tags requires prune to be enabled")
+	}
+	return nil
+}
+
+// validateFetchRetries makes sure number of retries is within allowed range
+func validateFetchRetries(retries *int) error {
+	if retries != nil && (*retries < 0 || *retries > maxFetchRetries) {
+		return fmt.Errorf("provided fetch retries (%d) must be between 0 and %d", *retries, maxFetchRetries)
+	}
+	return nil
+}
+
+// validateKeepPrevious makes sure number of retained worktrees is within
+// allowed range
+func validateKeepPrevious(keep *int) error {
+	if keep != nil && (*keep < 0 || *keep > maxKeepPrevious) {
+		return fmt.Errorf("provided keep previous (%d) must be between 0 and %d", *keep, maxKeepPrevious)
+	}
+	return nil
+}
+
+// validateProxyURL makes sure given proxy url has supported scheme and host.
+// parse error is not wrapped as it contains the url which might have credentials
+func validateProxyURL(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("unable to parse proxy url")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks4", "socks4a", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported proxy url scheme '%s', must be one of http, https, socks4, socks4a, socks5 or socks5h", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("proxy url '%s' must have host", u.Redacted())
+	}
+	return nil
+}
+
+// sshProxyOption returns ssh option to connect to the remote via given proxy
+// using 'nc' as ProxyCommand. proxy url must be valid.
+func sshProxyOption(proxy string) string {
+	u, _ := url.Parse(proxy)
+	version := "connect"
+	switch {
+	case strings.HasPrefix(u.Scheme, "socks5"):
+		version = "5"
+	case strings.HasPrefix(u.Scheme, "socks4"):
+		version = "4"
+	}
+	return fmt.Sprintf(`-o "ProxyCommand=nc -X %s -x %s %%h %%p"`, version, u.Host)
+}
+
+// validateReplicaRoots makes sure replica roots are absolute and different
+// from the repository root
+func validateReplicaRoots(root string, replicaRoots []string) error {
+	for _, rr := range replicaRoots {
+		if !filepath.IsAbs(rr) {
+			return fmt.Errorf("replica root '%s' must be absolute", rr)
+		}
+		if filepath.Clean(rr) == filepath.Clean(root) {
+			return fmt.Errorf("replica root '%s' must be different from the repository root", rr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCredentialTTL is the time credential returned by the credential
+	// command is cached if ttl is not configured
+	defaultCredentialTTL = 5 * time.Minute
+
+	// credentialCommandTimeout is the max time credential command can run
+	credentialCommandTimeout = 30 * time.Second
+
+	// defaultCredentialUsername is used with the token if neither credential
+	// command output nor auth config has username
+	defaultCredentialUsername = "x-access-token"
+)
+
+// credentialCache caches the credential returned by the credential command
+// of the repository until ttl expires or remote rejects it. credential is
+// only kept in memory and passed to git via env.
+type credentialCache struct {
+	lock     sync.Mutex
+	command  string // command which returned the cached credential
+	username string
+	password string
+	expiry   time.Time
+}
+
+// envs returns the environment variables to authenticate with the https
+// remote using the credential of the given auth's command. cached credential
+// is used until it expires.
+func (c *credentialCache) envs(ctx context.Context, log *slog.Logger, auth *Auth, now time.Time) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	command := strings.Join(auth.CredentialCommand, "\x00")
+	if c.command != command || c.password == "" || !now.Before(c.expiry) {
+		username, password, err := runCredentialCommand(ctx, auth.CredentialCommand)
+		if err != nil {
+			return nil, err
+		}
+		if username == "" {
+			username = auth.Username
+		}
+		if username == "" {
+			username = defaultCredentialUsername
+		}
+		ttl := auth.CredentialTTL
+		if ttl == 0 {
+			ttl = defaultCredentialTTL
+		}
+		c.command, c.username, c.password, c.expiry = command, username, password, now.Add(ttl)
+		log.Debug("credential refreshed", "expiry", c.expiry)
+	}
+
+	envs := basicAuthEnvs(c.username, c.password)
+	// remote must not fall back to interactive prompt if credential is rejected
+	return append(envs, "GIT_TERMINAL_PROMPT=0"), nil
+}
+
+// invalidate drops cached credential so that it's refreshed on next use, it
+// returns true if credential was cached
+func (c *credentialCache) invalidate() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cached := c.password != ""
+	c.username, c.password, c.expiry = "", "", time.Time{}
+	return cached
+}
+
+// runCredentialCommand runs the command and parses the credential from its
+// output. output is never included in errors or logs.
+func runCredentialCommand(ctx context.Context, command []string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, credentialCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	outbuf := bytes.NewBuffer(nil)
+	errbuf := bytes.NewBuffer(nil)
+	cmd.Stdout = outbuf
+	cmd.Stderr = errbuf
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ctx.Err()
+		}
+		return "", "", fmt.Errorf("%w: credential command %s failed err:%w stderr:%q",
+			ErrAuthFailed, command[0], err, strings.TrimSpace(errbuf.String()))
+	}
+
+	username, password := parseCredential(outbuf.String())
+	if password == "" {
+		return "", "", fmt.Errorf("%w: credential command %s returned empty credential", ErrAuthFailed, command[0])
+	}
+	return username, password, nil
+}
+
+// parseCredential parses output of the credential command. output is either
+// the token/password (same as GIT_ASKPASS) or 'key=value' lines of the git
+// credential helper format with username and password keys.
+func parseCredential(out string) (string, string) {
+	var username, password string
+	var helperFormat bool
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if v, ok := strings.CutPrefix(line, "password="); ok {
+			password, helperFormat = v, true
+		} else if v, ok := strings.CutPrefix(line, "username="); ok {
+			username = v
+		}
+	}
+	if helperFormat {
+		return username, password
+	}
+	return "", strings.TrimSpace(out)
+}
+
+// credentialFailed drops cached credential of the repository if err is
+// authentication failure so that it's refreshed on next remote operation.
+// it returns true if cached credential was dropped.
+func (r *Repository) credentialFailed(err error) bool {
+	if !errors.Is(err, ErrAuthFailed) {
+		return false
+	}
+	if r.creds.invalidate() {
+		r.log.Warn("remote rejected credential, it will be refreshed")
+		return true
+	}
+	return false
+}
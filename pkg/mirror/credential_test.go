@@ -0,0 +1,131 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseCredential(t *testing.T) {
+	tests := []struct {
+		name         string
+		out          string
+		wantUsername string
+		wantPassword string
+	}{
+		{"token", "s3cr3t\n", "", "s3cr3t"},
+		{"token_with_spaces", "  s3cr3t  \n\n", "", "s3cr3t"},
+		{"helper_format", "username=bot\npassword=s3cr3t\n", "bot", "s3cr3t"},
+		{"helper_format_no_username", "protocol=https\npassword=s3cr3t\n", "", "s3cr3t"},
+		{"empty", "\n", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, password := parseCredential(tt.out)
+			if username != tt.wantUsername || password != tt.wantPassword {
+				t.Errorf("parseCredential() = %q, %q want %q, %q", username, password, tt.wantUsername, tt.wantPassword)
+			}
+		})
+	}
+}
+
+// mustCredentialScript creates script which prints content of the token
+// file and counts its invocations
+func mustCredentialScript(t *testing.T, dir string) (script, tokenFile, countFile string) {
+	t.Helper()
+	script = filepath.Join(dir, "credential.sh")
+	tokenFile = filepath.Join(dir, "token")
+	countFile = filepath.Join(dir, "count")
+	content := "#!/bin/sh\necho x >> " + countFile + "\ncat " + tokenFile + "\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script, tokenFile, countFile
+}
+
+func credentialRuns(t *testing.T, countFile string) int {
+	t.Helper()
+	data, err := os.ReadFile(countFile)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "x")
+}
+
+func Test_credentialCache(t *testing.T) {
+	dir := t.TempDir()
+	script, tokenFile, countFile := mustCredentialScript(t, dir)
+	if err := os.WriteFile(tokenFile, []byte("token-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &Auth{Username: "bot", CredentialCommand: []string{script}, CredentialTTL: time.Minute}
+	now := time.Now()
+	var c credentialCache
+
+	envs, err := c.envs(txtCtx, testLog, auth, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := basicAuthEnvs("bot", "token-1"); !strings.Contains(strings.Join(envs, "\n"), want[2]) {
+		t.Errorf("unexpected envs: %v", envs)
+	}
+
+	t.Log("cached credential is used until ttl expires")
+	if err := os.WriteFile(tokenFile, []byte("token-2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.envs(txtCtx, testLog, auth, now.Add(30*time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := credentialRuns(t, countFile); got != 1 {
+		t.Errorf("credential command should be run once got:%d", got)
+	}
+	if c.password != "token-1" {
+		t.Errorf("cached credential should be used")
+	}
+
+	t.Log("credential is refreshed after ttl")
+	if _, err := c.envs(txtCtx, testLog, auth, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := credentialRuns(t, countFile); got != 2 || c.password != "token-2" {
+		t.Errorf("credential should be refreshed runs:%d", got)
+	}
+
+	t.Log("credential is refreshed after invalidation")
+	if !c.invalidate() {
+		t.Errorf("invalidate should return true for cached credential")
+	}
+	if c.invalidate() {
+		t.Errorf("invalidate should return false if credential is not cached")
+	}
+	if _, err := c.envs(txtCtx, testLog, auth, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := credentialRuns(t, countFile); got != 3 {
+		t.Errorf("credential should be refreshed runs:%d", got)
+	}
+
+	t.Log("failed command doesn't leak output")
+	failing := &Auth{CredentialCommand: []string{"sh", "-c", "echo leaked-token; exit 1"}}
+	_, err = c.envs(txtCtx, testLog, failing, now)
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed got:%v", err)
+	}
+	if strings.Contains(err.Error(), "leaked-token") {
+		t.Errorf("error should not contain command output: %v", err)
+	}
+
+	t.Log("empty credential is rejected")
+	empty := &Auth{CredentialCommand: []string{"true"}}
+	if _, err := c.envs(txtCtx, testLog, empty, now); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed got:%v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// diskUsageInterval is the min time between disk usage measurements of the
+// mirror cycles, walking large repositories is expensive
+var diskUsageInterval = 10 * time.Minute
+
+// RepoDiskUsage represents disk space used by the mirrored repository
+type RepoDiskUsage struct {
+	// RepoBytes is the size of the bare repository excluding worktrees
+	RepoBytes int64 `json:"repoBytes"`
+	// WorktreesBytes is the size of all the checked out worktrees
+	WorktreesBytes int64 `json:"worktreesBytes"`
+}
+
+// Total returns total bytes used by the repository and its worktrees
+func (u RepoDiskUsage) Total() int64 {
+	return u.RepoBytes + u.WorktreesBytes
+}
+
+// DiskUsage walks the repository dir and returns bytes used by the bare
+// repository and its worktrees.
+func (r *Repository) DiskUsage(ctx context.Context) (RepoDiskUsage, error) {
+	var usage RepoDiskUsage
+
+	wtRoot := r.worktreesRoot() + "/"
+	err := filepath.WalkDir(r.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// files can be removed by concurrent gc or worktree clean up
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if strings.HasPrefix(path, wtRoot) {
+			usage.WorktreesBytes += info.Size()
+		} else {
+			usage.RepoBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return RepoDiskUsage{}, fmt.Errorf("unable to calculate disk usage err:%w", err)
+	}
+	return usage, nil
+}
+
+// updateDiskUsage refreshes recorded disk usage of the repository, usage is
+// measured at most once every diskUsageInterval. if usage is over the
+// configured quota aggressive gc is run (at most once every gc interval) and
+// if its still over quota repository is marked as over quota. mirror is not
+// failed in either case.
+func (r *Repository) updateDiskUsage(ctx context.Context) {
+	usage := r.diskUsage
+	if r.usageTime.IsZero() || time.Since(r.usageTime) >= diskUsageInterval {
+		var err error
+		if usage, err = r.DiskUsage(ctx); err != nil {
+			r.log.Error("unable to get disk usage", "err", err)
+			return
+		}
+		r.usageTime = time.Now()
+	}
+
+	if r.maxDiskUsage > 0 && usage.Total() > r.maxDiskUsage &&
+		(r.lastQuotaGC.IsZero() || time.Since(r.lastQuotaGC) >= r.gcInterval) {
+		r.log.Warn("disk usage is over quota, running aggressive gc", "bytes", usage.Total(), "quota", r.maxDiskUsage)
+		start := time.Now()
+		r.lastQuotaGC = start
+		// git [-c <key>=<value>...] gc --aggressive --prune=now
+		args := slices.Concat(r.gitConfig, []string{"gc", "--aggressive", "--prune=now"})
+		_, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, args...)
+		recordGC(r.gitURL.Repo, start)
+		if err != nil {
+			r.lastGCFailure = start
+			r.log.Error("unable to run aggressive gc", "err", err)
+		} else {
+			r.lastGC = start
+			if usage, err = r.DiskUsage(ctx); err != nil {
+				r.log.Error("unable to get disk usage", "err", err)
+				return
+			}
+			r.usageTime = time.Now()
+		}
+	}
+
+	r.diskUsage = usage
+	r.overQuota = r.maxDiskUsage > 0 && usage.Total() > r.maxDiskUsage
+	if r.overQuota {
+		r.log.Error("disk usage is over quota after gc", "bytes", usage.Total(), "quota", r.maxDiskUsage)
+	}
+	recordDiskUsage(r.gitURL.Repo, usage, r.overQuota)
+}
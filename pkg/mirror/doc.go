@@ -1,6 +1,8 @@
 // Package mirror periodically mirrors (bare clones) remote repositories locally.
 // The mirror is created with `--mirror=fetch` hence everything in `refs/*` on the remote
 // will be directly mirrored into `refs/*` in the local repository.
+// RefSpecs can be configured to only mirror subset of the refs (eg. `refs/heads/*`)
+// or SingleBranch to only mirror one branch of very large repositories.
 // it can also maintain multiple mirrored checked out worktrees on different references.
 //
 // The implementation borrows heavily from [kubernetes/git-sync].
@@ -38,5 +40,81 @@
 //		panic(err)
 //	}
 //
+// # Publishing worktrees:
+//
+// worktrees are published by atomically swapping the symlink at the link path,
+// readers following the link either see the old or the new worktree.
+// with `copy` publish mode the worktree is copied (or hard linked) into a new
+// versioned dir next to the link before the swap, so link never points outside
+// of the link dir and partially copied tree is never visible. old worktrees and
+// copies are removed after a short stale timeout so readers should not hold
+// resolved paths for long.
+//
+// # Serving mirrors over HTTP:
+//
+// mirrored repositories can be cloned directly from the mirror using read only
+// git smart HTTP protocol
+//
+//	http.Handle("/repos/", http.StripPrefix("/repos", repos.GitHTTPHandler()))
+//
+//	// git clone http://<host>/repos/<repo>.git
+//
+// status of all the repositories and their worktrees can be served as JSON
+//
+//	http.Handle("/status", repos.StatusHandler())
+//
+// readiness of the pool can be served for Kubernetes readiness probe, pool is
+// ready once all the repositories (or only the ones marked as `critical`) have
+// completed their first successful mirror cycle. since handler doesn't wait for
+// in-flight mirrors, HTTP server can be started before initial mirror so that
+// metrics can be scraped while large repositories are being cloned
+//
+//	http.Handle("/ready", repos.ReadyHandler())
+//
+// worktree links can be added and removed on the running pool, added link is
+// published by the mirror run queued by the handler
+//
+//	http.Handle("/worktrees", repos.WorktreeHandler())
+//
+//	// curl -X POST 'http://<host>/worktrees?remote=<remote>&link=<link>&ref=<ref>'
+//	// curl -X DELETE 'http://<host>/worktrees?remote=<remote>&link=<link>'
+//
+// published link can be rolled back to the previous worktree retained on the
+// link, updates of the link are paused until its resumed
+//
+//	http.Handle("/rollback", repos.RollbackHandler())
+//
+//	// curl -X POST 'http://<host>/rollback?remote=<remote>&link=<link>'
+//	// curl -X DELETE 'http://<host>/rollback?remote=<remote>&link=<link>'
+//
+// all the handlers authorize requests using the authorizer of the pool and
+// record decisions in the audit log if its enabled. handlers which change the
+// state of the pool (pause, worktrees and rollback) reject requests unless
+// authorizer is set. TokenAuthorizer authenticates static bearer tokens loaded
+// from files, see Authorizer for required roles.
+//
+//	auth, err := mirror.NewTokenAuthorizer(
+//		mirror.TokenFile{Name: "ci", Path: "/etc/git-mirror/ci-token", Role: mirror.RoleAdmin},
+//	)
+//	repos.SetAuthorizer(auth)
+//
+//	// curl -X POST -H 'Authorization: Bearer <token>' 'http://<host>/rollback?remote=<remote>&link=<link>'
+//
+// # Events:
+//
+// controllers embedding the pool can react to changes instead of polling,
+// events are delivered without blocking the mirror loops so subscriber should
+// use buffered channel and drain it promptly.
+//
+//	events := make(chan mirror.Event, 100)
+//	repos.SubscribeEvents(events)
+//	defer repos.UnsubscribeEvents(events)
+//
+//	for e := range events {
+//		if e.Type == mirror.EventWorktreePublished {
+//			reconcile(e.Link, e.NewHash)
+//		}
+//	}
+//
 // [kubernetes/git-sync]: https://github.com/kubernetes/git-sync
 package mirror
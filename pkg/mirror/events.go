@@ -0,0 +1,182 @@
+package mirror
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventType is the type of the Event emitted by the pool
+type EventType string
+
+const (
+	// EventRepositoryAdded is emitted when repository is added to the pool
+	EventRepositoryAdded EventType = "repository-added"
+	// EventRepositoryRemoved is emitted when repository is removed from the
+	// pool, WorktreeRemoved events of its links are emitted before it
+	EventRepositoryRemoved EventType = "repository-removed"
+	// EventMirrorCompleted is emitted after every mirror cycle, Err is set
+	// if cycle failed
+	EventMirrorCompleted EventType = "mirror-completed"
+	// EventWorktreePublished is emitted when worktree link is published on
+	// the new hash
+	EventWorktreePublished EventType = "worktree-published"
+	// EventWorktreeRemoved is emitted when worktree link is removed, either
+	// by RemoveWorktreeLink or because its ref no longer exists
+	EventWorktreeRemoved EventType = "worktree-removed"
+)
+
+// Event is the change of the pool, repository or worktree link. fields
+// which are not relevant to the event type are left empty.
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Remote string
+	// Link is the absolute path of the worktree link of worktree events
+	Link string
+	// OldHash and NewHash are the hashes of the worktree events, OldHash is
+	// empty if link was published for the first time and NewHash is empty
+	// if link was removed
+	OldHash string
+	NewHash string
+	// UpdatedRefs are the refs updated by the completed mirror cycle
+	UpdatedRefs []RefUpdate
+	// Err is the error of the failed mirror cycle
+	Err error
+}
+
+// eventStream delivers events to the channels subscribed by
+// RepoPool.SubscribeEvents. stream is shared by the pool and all its
+// repositories so that repositories added later deliver to the same
+// subscribers.
+type eventStream struct {
+	lock        sync.Mutex
+	subscribers []chan<- Event
+	log         *slog.Logger
+}
+
+// subscribe adds channel to the subscribers
+func (s *eventStream) subscribe(ch chan<- Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !slices.Contains(s.subscribers, ch) {
+		s.subscribers = append(s.subscribers, ch)
+	}
+}
+
+// unsubscribe removes channel from the subscribers
+func (s *eventStream) unsubscribe(ch chan<- Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.subscribers = slices.DeleteFunc(s.subscribers, func(c chan<- Event) bool { return c == ch })
+}
+
+// enabled returns true if stream has any subscribers, events are not
+// recorded otherwise
+func (s *eventStream) enabled() bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.subscribers) > 0
+}
+
+// emit sends events to all the subscribers without blocking
+func (s *eventStream) emit(events ...Event) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, e := range events {
+		for _, ch := range s.subscribers {
+			// each subscriber gets its own copy so it can modify it
+			e := e
+			e.UpdatedRefs = slices.Clone(e.UpdatedRefs)
+			select {
+			case ch <- e:
+			default:
+				recordEventDropped()
+				s.log.Warn("event subscriber is not ready, dropping event", "type", e.Type, "remote", e.Remote, "link", e.Link)
+			}
+		}
+	}
+}
+
+// SubscribeEvents registers given channel to receive events of all the
+// repositories in the pool including repositories added later. events are
+// only recorded while pool has subscribers. delivery is non-blocking same
+// as Subscribe, if channel is not ready to receive the event is dropped and
+// counted by the git_mirror_events_dropped_total metric. events are emitted
+// after repository lock is released so subscriber can call pool methods
+// without deadlock.
+func (rp *RepoPool) SubscribeEvents(ch chan<- Event) {
+	rp.events.subscribe(ch)
+}
+
+// UnsubscribeEvents removes given channel from the event subscribers.
+// channel is not closed, it is safe to close it once UnsubscribeEvents
+// returns.
+func (rp *RepoPool) UnsubscribeEvents(ch chan<- Event) {
+	rp.events.unsubscribe(ch)
+}
+
+// Stop stops mirror loops of all the repositories in the pool, it blocks
+// until current mirror cycles are finished.
+func (rp *RepoPool) Stop() {
+	var wg sync.WaitGroup
+	for _, repo := range rp.repositories() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			repo.StopLoop()
+		}()
+	}
+	wg.Wait()
+}
+
+// setEventStream sets the event stream of the pool
+func (r *Repository) setEventStream(s *eventStream) {
+	r.eventsLock.Lock()
+	defer r.eventsLock.Unlock()
+
+	r.events = s
+}
+
+// queueEvent queues event to be emitted once repository lock is released
+// by emitPendingEvents
+func (r *Repository) queueEvent(e Event) {
+	r.eventsLock.Lock()
+	defer r.eventsLock.Unlock()
+
+	if !r.events.enabled() {
+		return
+	}
+	e.Time = r.now()
+	e.Remote = r.remote
+	r.pendingEvents = append(r.pendingEvents, e)
+}
+
+// queueLinkRemoved queues WorktreeRemoved event of the link which is being
+// removed, it must be called before link is unpublished
+func (r *Repository) queueLinkRemoved(wl *WorkTreeLink) {
+	hash, _ := wl.CurrentHash()
+	r.queueEvent(Event{Type: EventWorktreeRemoved, Link: wl.link, OldHash: hash})
+}
+
+// emitPendingEvents emits all queued events, it must be called after
+// repository lock is released
+func (r *Repository) emitPendingEvents() {
+	r.eventsLock.Lock()
+	events, stream := r.pendingEvents, r.events
+	r.pendingEvents = nil
+	r.eventsLock.Unlock()
+
+	stream.emit(events...)
+}
@@ -0,0 +1,56 @@
+package mirror
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestEventStream(t *testing.T) {
+	s := &eventStream{log: slog.Default()}
+
+	// events are not recorded without subscribers
+	s.emit(Event{Type: EventRepositoryAdded})
+	if s.enabled() {
+		t.Fatalf("stream should not be enabled without subscribers")
+	}
+
+	ch1, ch2 := make(chan Event, 2), make(chan Event, 1)
+	s.subscribe(ch1)
+	s.subscribe(ch1)
+	s.subscribe(ch2)
+	if !s.enabled() {
+		t.Fatalf("stream should be enabled with subscribers")
+	}
+
+	// slow subscriber doesn't block the others
+	refs := []RefUpdate{{Ref: "refs/heads/main"}}
+	s.emit(Event{Type: EventMirrorCompleted, UpdatedRefs: refs}, Event{Type: EventMirrorCompleted})
+	if got := len(ch1); got != 2 {
+		t.Errorf("expected 2 events got:%d", got)
+	}
+	if got := len(ch2); got != 1 {
+		t.Errorf("expected 1 event got:%d", got)
+	}
+	// each subscriber gets its own copy of the refs
+	e := <-ch1
+	e.UpdatedRefs[0].Ref = "changed"
+	if e := <-ch2; e.UpdatedRefs[0].Ref != "refs/heads/main" {
+		t.Errorf("refs should not be shared between subscribers got:%s", e.UpdatedRefs[0].Ref)
+	}
+
+	s.unsubscribe(ch1)
+	s.unsubscribe(ch2)
+	if s.enabled() {
+		t.Errorf("stream should not be enabled after unsubscribe")
+	}
+	// unsubscribed channel can be closed
+	close(ch2)
+	s.emit(Event{Type: EventRepositoryRemoved})
+
+	// pool without event stream is no-op
+	var disabled *eventStream
+	disabled.emit(Event{Type: EventRepositoryAdded})
+	if disabled.enabled() {
+		t.Errorf("nil stream should be disabled")
+	}
+}
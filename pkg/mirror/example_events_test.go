@@ -0,0 +1,80 @@
+package mirror_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/mirror"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_Example_events(t *testing.T) {
+	Example_events()
+}
+
+func Example_events() {
+	tmpRoot, err := os.MkdirTemp("", "git-mirror-events-example-*")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpRoot)
+
+	config := `
+defaults:
+  root: /tmp/git-mirror
+  interval: 30s
+  mirror_timeout: 2m
+  git_gc: always
+repositories:
+  - remote: https://github.com/utilitywarehouse/git-mirror.git
+    worktrees:
+    - link: main
+`
+	conf := mirror.RepoPoolConfig{}
+	if err := yaml.Unmarshal([]byte(config), &conf); err != nil {
+		panic(err)
+	}
+	conf.Defaults.Root = tmpRoot
+
+	repos, err := mirror.NewRepoPool(conf, slog.Default(), nil)
+	if err != nil {
+		panic(err)
+	}
+
+	// events are only recorded while pool has subscribers so channel
+	// should be subscribed before starting mirror loop
+	events := make(chan mirror.Event, 100)
+	repos.SubscribeEvents(events)
+
+	// controller loop reconciles on every published worktree until
+	// events channel is closed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for e := range events {
+			switch e.Type {
+			case mirror.EventWorktreePublished:
+				fmt.Println("reconcile", "link", e.Link, "hash", e.NewHash)
+			case mirror.EventMirrorCompleted:
+				if e.Err != nil {
+					fmt.Println("mirror failed", "remote", e.Remote, "err", e.Err)
+				}
+			}
+		}
+	}()
+
+	if err := repos.MirrorAll(context.Background(), 5*time.Minute); err != nil {
+		panic(err)
+	}
+	repos.StartLoop()
+
+	// stop mirror loops and close events channel once it's unsubscribed
+	repos.Stop()
+	repos.UnsubscribeEvents(events)
+	close(events)
+	<-done
+}
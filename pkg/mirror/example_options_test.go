@@ -0,0 +1,58 @@
+package mirror_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/mirror"
+)
+
+func ExampleNewRepositoryWithOptions() {
+	repo, err := mirror.NewRepositoryWithOptions(
+		"https://github.com/utilitywarehouse/git-mirror.git",
+		mirror.WithRoot("/tmp/git-mirror"),
+		mirror.WithInterval(time.Minute),
+		mirror.WithWorktree("main", "main", ""),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.Background()
+	if err := repo.Mirror(ctx); err != nil {
+		panic(err)
+	}
+	go repo.StartLoop(ctx)
+
+	hash, err := repo.Hash(ctx, "main", "")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("last commit hash at main", "hash", hash)
+}
+
+func ExampleNewRepositoryWithOptions_multipleWorktrees() {
+	repo, err := mirror.NewRepositoryWithOptions(
+		"git@github.com:utilitywarehouse/git-mirror.git",
+		mirror.WithRoot("/tmp/git-mirror"),
+		mirror.WithSSHAuth("/etc/git-secret/ssh", "/etc/git-secret/known_hosts"),
+		mirror.WithGC("always"),
+		mirror.WithLogger(slog.Default()),
+		// worktree on the default branch of the remote
+		mirror.WithWorktree("head", "", ""),
+		// worktree of only 'pkg' dir of the 'main' branch
+		mirror.WithWorktree("/tmp/links/pkg", "main", "pkg"),
+		mirror.WithWorktreeConfig(mirror.WorktreeConfig{Link: "release", RefPattern: "v*"}),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.Background()
+	if err := repo.Mirror(ctx); err != nil {
+		panic(err)
+	}
+	go repo.StartLoop(ctx)
+}
@@ -0,0 +1,108 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// exportIgnoredPaths returns paths of the given commit which have
+// 'export-ignore' attribute set, same as the paths excluded by `git archive`.
+// attributes are read from the .gitattributes files of the commit using
+// a temporary index, so result doesn't depend on what is checked out in the
+// worktree (eg. pathspec). if dir is ignored its content is not returned.
+func (wl *WorkTreeLink) exportIgnoredPaths(ctx context.Context, wt, hash string) ([]string, error) {
+	tmpDir, err := os.MkdirTemp("", "git-mirror-attr-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temp index dir err:%w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	envs := slices.Concat(wl.envs, []string{"GIT_INDEX_FILE=" + filepath.Join(tmpDir, "index")})
+
+	// git read-tree <hash>
+	if _, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, envs, wt, "read-tree", hash); err != nil {
+		return nil, fmt.Errorf("unable to read tree into temp index err:%w", err)
+	}
+
+	// dirs are listed as well since attribute set on dir doesn't apply to
+	// the files in it
+	// git ls-tree -r -t -z --name-only <hash>
+	paths := bytes.NewBuffer(nil)
+	if err := runGitCommandStream(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, wt, nil, paths, "ls-tree", "-r", "-t", "-z", "--name-only", hash); err != nil {
+		return nil, fmt.Errorf("unable to list tree err:%w", err)
+	}
+
+	// git check-attr --cached -z --stdin export-ignore
+	attrs := bytes.NewBuffer(nil)
+	if err := runGitCommandStream(ctx, wl.log, wl.gitOps, wl.runner, envs, wt, paths, attrs, "check-attr", "--cached", "-z", "--stdin", "export-ignore"); err != nil {
+		return nil, fmt.Errorf("unable to check export-ignore attributes err:%w", err)
+	}
+
+	// output is '<path> NUL <attribute> NUL <info> NUL' in ls-tree order so
+	// parent dir is always listed before its content
+	fields := strings.Split(strings.TrimSuffix(attrs.String(), "\x00"), "\x00")
+	if len(fields)%3 != 0 {
+		return nil, fmt.Errorf("unexpected check-attr output fields:%d", len(fields))
+	}
+	var ignored []string
+	for i := 0; i+2 < len(fields); i += 3 {
+		path, info := fields[i], fields[i+2]
+		if info != "set" {
+			continue
+		}
+		if len(ignored) > 0 && isSubPath(ignored[len(ignored)-1], path) {
+			continue
+		}
+		ignored = append(ignored, path)
+	}
+	return ignored, nil
+}
+
+// removeExportIgnored removes paths with 'export-ignore' attribute from the
+// checked out worktree. paths which were not checked out are skipped.
+func (wl *WorkTreeLink) removeExportIgnored(ctx context.Context, wt, hash string) error {
+	ignored, err := wl.exportIgnoredPaths(ctx, wt, hash)
+	if err != nil {
+		return err
+	}
+	for _, path := range ignored {
+		// path might be under a committed symlink dir, which must not be followed
+		if err := safeRemoveAll(wt, filepath.Join(wt, path)); err != nil {
+			return fmt.Errorf("unable to remove export-ignore path:%s err:%w", path, err)
+		}
+	}
+	if len(ignored) > 0 {
+		wl.log.Debug("removed export-ignore paths from worktree", "count", len(ignored))
+	}
+	return nil
+}
+
+// checkExportIgnored returns error if any path with 'export-ignore' attribute
+// exists in the given worktree
+func (wl *WorkTreeLink) checkExportIgnored(ctx context.Context, wt string) error {
+	// git rev-parse HEAD
+	hash, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, wt, "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("unable to get worktree hash err:%w", err)
+	}
+	ignored, err := wl.exportIgnoredPaths(ctx, wt, hash)
+	if err != nil {
+		return err
+	}
+	for _, path := range ignored {
+		_, err := os.Lstat(filepath.Join(wt, path))
+		switch {
+		case err == nil:
+			return fmt.Errorf("worktree contains export-ignore path:%s", path)
+		case !errors.Is(err, fs.ErrNotExist):
+			return fmt.Errorf("unable to stat export-ignore path:%s err:%w", path, err)
+		}
+	}
+	return nil
+}
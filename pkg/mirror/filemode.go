@@ -0,0 +1,110 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	gitModeSymlink    = "120000"
+	gitModeExecutable = "100755"
+
+	// maxFileModeSamples is the max number of symlinks and executable files
+	// verified after checkout
+	maxFileModeSamples = 100
+)
+
+// treeEntry is the file of the commit tree with its git mode
+type treeEntry struct {
+	mode string
+	path string
+}
+
+// fileModeArgs returns config args which make checkout create symlinks and
+// executable files regardless of core.symlinks and core.fileMode of the
+// mirror. git sets them to false on init if file system of the mirror doesn't
+// support them and worktrees would inherit that.
+func (r *Repository) fileModeArgs() []string {
+	if !r.fileModes {
+		return nil
+	}
+	return []string{"-c", "core.symlinks=true", "-c", "core.fileMode=true"}
+}
+
+// verifyFileModes compares git modes of the symlinks and executable files of
+// the commit (limited to the pathspec of the link) with the files checked out
+// in the worktree dir. only first maxFileModeSamples entries are checked.
+func (r *Repository) verifyFileModes(ctx context.Context, wl *WorkTreeLink, wtPath, hash string) error {
+	if !r.fileModes {
+		return nil
+	}
+
+	emptyTree, err := r.emptyTreeHash(ctx)
+	if err != nil {
+		return err
+	}
+	// ls-tree doesn't support glob pathspecs hence diff against empty tree
+	// git diff-tree -r -z --no-renames <empty-tree> <hash> [-- <pathspec>]
+	args := []string{"diff-tree", "-r", "-z", "--no-renames", emptyTree, hash}
+	if wl.pathspec != "" {
+		args = append(args, "--", wl.pathspec)
+	}
+	out, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, r.dir, args...)
+	if err != nil {
+		return fmt.Errorf("unable to list files of the commit err:%w", err)
+	}
+
+	var checked int
+	for _, e := range parseDiffTreeEntries(out) {
+		if e.mode != gitModeSymlink && e.mode != gitModeExecutable {
+			continue
+		}
+		if checked == maxFileModeSamples {
+			break
+		}
+		checked++
+
+		info, err := os.Lstat(filepath.Join(wtPath, e.path))
+		if err != nil {
+			return fmt.Errorf("%w: unable to stat checked out file path:%s err:%w", ErrFileModeMismatch, e.path, err)
+		}
+		if got := diskMode(info); got != e.mode {
+			return fmt.Errorf("%w: path:%s git:%s disk:%s", ErrFileModeMismatch, e.path, e.mode, got)
+		}
+	}
+	return nil
+}
+
+// parseDiffTreeEntries parses added files from the output of
+// 'diff-tree -r -z' against empty tree
+func parseDiffTreeEntries(out string) []treeEntry {
+	var entries []treeEntry
+	// ':000000 <mode> <src-hash> <dst-hash> A\0<path>\0'
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) < 2 {
+			continue
+		}
+		entries = append(entries, treeEntry{mode: meta[1], path: fields[i+1]})
+	}
+	return entries
+}
+
+// diskMode returns git mode equivalent of the file on disk
+func diskMode(info fs.FileInfo) string {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		return gitModeSymlink
+	case info.Mode().IsRegular() && info.Mode().Perm()&0100 != 0:
+		return gitModeExecutable
+	case info.Mode().IsRegular():
+		return "100644"
+	default:
+		return fmt.Sprintf("%o", info.Mode())
+	}
+}
@@ -0,0 +1,25 @@
+package mirror
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseDiffTreeEntries(t *testing.T) {
+	out := ":000000 100644 0000000000000000000000000000000000000000 e69de29bb2d1d6434b8b29ae775ad8c2e48c5391 A\x00dir/file\x00" +
+		":000000 100755 0000000000000000000000000000000000000000 e69de29bb2d1d6434b8b29ae775ad8c2e48c5391 A\x00dir/run script.sh\x00" +
+		":000000 120000 0000000000000000000000000000000000000000 1269488f7fb1f4b56a8c0e5eb48cecbfadfa9219 A\x00link\x00"
+
+	want := []treeEntry{
+		{mode: "100644", path: "dir/file"},
+		{mode: "100755", path: "dir/run script.sh"},
+		{mode: "120000", path: "link"},
+	}
+	if diff := cmp.Diff(want, parseDiffTreeEntries(out), cmp.AllowUnexported(treeEntry{})); diff != "" {
+		t.Errorf("parseDiffTreeEntries() mismatch (-want +got):\n%s", diff)
+	}
+	if got := parseDiffTreeEntries(""); len(got) != 0 {
+		t.Errorf("parseDiffTreeEntries() expected no entries got:%v", got)
+	}
+}
@@ -0,0 +1,108 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// defaultGCInterval is the time between scheduled gc runs if not configured
+	defaultGCInterval = 24 * time.Hour
+	// gcCheckInterval is how often gc loop checks if scheduled gc is due
+	gcCheckInterval = time.Minute
+)
+
+// RunGC runs git gc on the mirrored repository with the given mode, valid
+// values are 'auto', 'always' or 'aggressive'. repository write lock is only
+// held for the duration of the gc command. waiting for the lock and the gc
+// command are bounded by the git timeout or the mirror timeout if not set.
+func (r *Repository) RunGC(ctx context.Context, mode string) error {
+	args := []string{"gc"}
+	switch mode {
+	case gcAuto:
+		args = append(args, "--auto")
+	case gcAlways:
+		// no extra flags
+	case gcAggressive:
+		args = append(args, "--aggressive")
+	default:
+		return fmt.Errorf("wrong gc mode provided, must be one of %s, %s, %s",
+			gcAuto, gcAlways, gcAggressive)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.gcTimeout())
+	defer cancel()
+
+	if err := r.lock.LockContext(ctx); err != nil {
+		return fmt.Errorf("unable to lock repository for gc err:%w", err)
+	}
+	defer r.lock.Unlock()
+
+	ctx, span := r.startSpan(ctx, "gc", attribute.String("repo", r.gitURL.Repo), attribute.String("mode", mode))
+	start := time.Now()
+	// git [-c <key>=<value>...] gc [--auto|--aggressive]
+	_, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, slices.Concat(r.gitConfig, args)...)
+	endSpan(span, err)
+	recordGC(r.gitURL.Repo, start)
+	if err != nil {
+		r.lastGCFailure = start
+		return fmt.Errorf("unable to run gc err:%w", err)
+	}
+	r.lastGC = start
+	r.log.Debug("gc completed", "mode", mode, "duration", time.Since(start))
+	return nil
+}
+
+// gcTimeout returns the time allowed for the gc including waiting for the
+// repository lock, timeouts are read from the config snapshot as the lock
+// might be held by the mirror cycle
+func (r *Repository) gcTimeout() time.Duration {
+	conf := r.remoteConf.Load()
+	if conf.gitTimeout > 0 {
+		return conf.gitTimeout
+	}
+	return conf.mirrorTimeout
+}
+
+// RunScheduledGC runs gc with the configured gc mode if its due ie. gc
+// interval has passed since the last successful and the last failed gc run
+// and repository was mirrored. it
+// returns true if gc was run. mirror loop started by StartLoop checks it
+// periodically outside of the mirror cycle, callers which run mirror cycles
+// using Mirror without the loop must call it to keep repository packed.
+func (r *Repository) RunScheduledGC(ctx context.Context) (bool, error) {
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return false, err
+	}
+	mode, due := r.gitGC, !r.lastSuccess.IsZero() &&
+		time.Since(r.lastGC) >= r.gcInterval && time.Since(r.lastGCFailure) >= r.gcInterval
+	r.lock.RUnlock()
+
+	if mode == gcOff || !due {
+		return false, nil
+	}
+	return true, r.RunGC(ctx, string(mode))
+}
+
+// gcLoop runs scheduled gc every gc check interval until given context is
+// cancelled, see RunScheduledGC.
+func (r *Repository) gcLoop(ctx context.Context) {
+	t := time.NewTicker(gcCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if _, err := r.RunScheduledGC(ctx); err != nil {
+			r.log.Error("scheduled gc failed", "err", err)
+		}
+	}
+}
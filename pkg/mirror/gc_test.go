@@ -0,0 +1,65 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/mirror/repotest"
+)
+
+func TestRepository_RunGC(t *testing.T) {
+	runner := repotest.NewFakeRunner()
+	runner.Expect("gc").ReturnError(&GitError{Args: []string{"gc"}, ExitCode: 128, Err: errors.New("exit status 128")}).Times(1)
+	runner.Expect("gc").Return("")
+
+	repo, err := NewRepositoryWithRunner(RepositoryConfig{
+		Remote:        "https://github.com/org/repo.git",
+		Root:          t.TempDir(),
+		Interval:      testInterval,
+		MirrorTimeout: testTimeout,
+		GitTimeout:    100 * time.Millisecond,
+		GitGC:         "always",
+	}, nil, runner, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+
+	t.Run("failure", func(t *testing.T) {
+		if err := repo.RunGC(txtCtx, "always"); err == nil {
+			t.Fatal("expected gc error")
+		}
+		if !repo.lastGC.IsZero() {
+			t.Errorf("last gc must only be set on success got:%s", repo.lastGC)
+		}
+		if repo.lastGCFailure.IsZero() {
+			t.Error("last gc failure is not set")
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		if err := repo.RunGC(txtCtx, "always"); err != nil {
+			t.Fatalf("unexpected gc error: %v", err)
+		}
+		if repo.lastGC.IsZero() {
+			t.Error("last gc is not set")
+		}
+	})
+
+	t.Run("lock-timeout", func(t *testing.T) {
+		repo.lock.Lock()
+		defer repo.lock.Unlock()
+
+		done := make(chan error, 1)
+		go func() { done <- repo.RunGC(txtCtx, "always") }()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("RunGC() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("gc is blocked on the repository lock")
+		}
+	})
+}
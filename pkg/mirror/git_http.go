@@ -0,0 +1,108 @@
+package mirror
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const uploadPackService = "git-upload-pack"
+
+// GitHTTPHandler returns http.Handler which serves mirrored repositories over
+// read only git smart HTTP protocol. repositories are served using their repo
+// name ie `/<repo>.git` hence handler can be mounted under any prefix with
+// http.StripPrefix. only git-upload-pack (clone/fetch) service is supported.
+// it requires read-only role, see Authorizer.
+func (rp *RepoPool) GitHTTPHandler() http.Handler {
+	return rp.authorized(methodRoles{http.MethodGet: RoleReadOnly, http.MethodPost: RoleReadOnly}, rp.serveGitHTTP)
+}
+
+func (rp *RepoPool) serveGitHTTP(w http.ResponseWriter, req *http.Request) {
+	name, rest, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	repo, err := rp.RepositoryByName(name)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	switch {
+	case rest == "info/refs" && req.Method == http.MethodGet:
+		if req.URL.Query().Get("service") != uploadPackService {
+			http.Error(w, "only smart http protocol is supported", http.StatusForbidden)
+			return
+		}
+		repo.serveUploadPack(w, req, true)
+	case rest == uploadPackService && req.Method == http.MethodPost:
+		repo.serveUploadPack(w, req, false)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// serveUploadPack runs `git upload-pack --stateless-rpc` against the mirrored
+// repository. repository is read locked while serving so that concurrent
+// mirror cycle doesn't remove objects mid-transfer. upload-pack is run with
+// the same envs, git config and proxy as the mirror cycle commands.
+func (r *Repository) serveUploadPack(w http.ResponseWriter, req *http.Request, advertise bool) {
+	if err := r.lock.RLockContext(req.Context()); err != nil {
+		http.Error(w, "repository is busy", http.StatusServiceUnavailable)
+		return
+	}
+	defer r.lock.RUnlock()
+
+	body := req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, "unable to read gzip body", http.StatusBadRequest)
+			return
+		}
+		defer gr.Close()
+		body = gr
+	}
+
+	args := slices.Concat(r.remoteArgs(), []string{"upload-pack", "--stateless-rpc"})
+	if advertise {
+		args = append(args, "--advertise-refs")
+	}
+	args = append(args, r.dir)
+
+	envs := r.envs
+	if r.proxyURL != "" {
+		envs = appendGitConfigEnv(envs, "http.proxy", r.proxyURL)
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if advertise {
+		w.Header().Set("Content-Type", "application/x-"+uploadPackService+"-advertisement")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, pktLine("# service="+uploadPackService+"\n"))
+		io.WriteString(w, "0000")
+	} else {
+		w.Header().Set("Content-Type", "application/x-"+uploadPackService+"-result")
+		w.WriteHeader(http.StatusOK)
+	}
+
+	var stdin io.Reader
+	if !advertise {
+		stdin = body
+	}
+	// git [-c <key>=<value>...] upload-pack --stateless-rpc [--advertise-refs] <dir>
+	if err := runGitCommandStream(req.Context(), r.log, r.gitOps, r.runner, envs, "", stdin, w, args...); err != nil {
+		// headers are already sent so only log the error
+		r.log.Error("unable to serve upload-pack", "advertise", advertise, "err", err)
+	}
+}
+
+// pktLine encodes given string in git pkt-line format
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
@@ -0,0 +1,74 @@
+package mirror
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/utilitywarehouse/git-mirror/pkg/mirror/repotest"
+)
+
+func TestRepository_serveUploadPack(t *testing.T) {
+	root := t.TempDir()
+	runner := repotest.NewFakeRunner()
+	runner.ExpectPrefix("-c").Return("0000")
+
+	repo, err := NewRepositoryWithRunner(RepositoryConfig{
+		Remote:        "https://github.com/org/repo.git",
+		Root:          root,
+		Interval:      testInterval,
+		MirrorTimeout: testTimeout,
+		GitGC:         "always",
+		ProxyURL:      "http://proxy:3128",
+		GitConfig:     map[string]string{"pack.threads": "2"},
+	}, []string{"FOO=bar"}, runner, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+
+	t.Run("envs", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/repo.git/info/refs?service=git-upload-pack", nil)
+		repo.serveUploadPack(w, req, true)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status got:%d want:%d", w.Code, http.StatusOK)
+		}
+		calls := runner.Calls()
+		if len(calls) != 1 {
+			t.Fatalf("expected 1 git call got:%v", calls)
+		}
+		wantArgs := []string{"-c", "pack.threads=2", "upload-pack", "--stateless-rpc", "--advertise-refs", filepath.Join(root, "repo.git")}
+		if diff := cmp.Diff(wantArgs, calls[0].Args); diff != "" {
+			t.Errorf("args mismatch (-want +got):\n%s", diff)
+		}
+		for _, want := range []string{"FOO=bar", "GIT_CONFIG_KEY_0=http.proxy", "GIT_CONFIG_VALUE_0=http://proxy:3128"} {
+			if !slices.Contains(calls[0].Envs, want) {
+				t.Errorf("env %q missing from %v", want, calls[0].Envs)
+			}
+		}
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		repo.lock.Lock()
+		defer repo.lock.Unlock()
+
+		ctx, cancel := context.WithCancel(txtCtx)
+		cancel()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/repo.git/git-upload-pack", strings.NewReader("0000")).WithContext(ctx)
+		repo.serveUploadPack(w, req, false)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("status got:%d want:%d", w.Code, http.StatusServiceUnavailable)
+		}
+		if got := len(runner.Calls()); got != 1 {
+			t.Errorf("upload-pack must not run without lock, calls:%d", got)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package mirror
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// gitConfigKeyRgx matches git config key ie section[.subsection].name
+var gitConfigKeyRgx = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]*(\.[^\s=]+)?\.[a-zA-Z][a-zA-Z0-9-]*$`)
+
+// deniedGitConfigKeys are the lower case git config keys, or key prefixes
+// ending with '.', which can't be set via GitConfig as they can run commands,
+// redirect the remote or change config managed by the mirror
+var deniedGitConfigKeys = []string{
+	"alias.",
+	"core.askpass",
+	"core.bare",
+	"core.editor",
+	"core.fsmonitor",
+	"core.gitproxy",
+	"core.hookspath",
+	"core.pager",
+	"core.sshcommand",
+	"core.worktree",
+	"credential.",
+	"diff.external",
+	"filter.",
+	"gpg.",
+	"http.proxy",
+	"include.",
+	"includeif.",
+	"protocol.",
+	"remote.",
+	"sequence.editor",
+	"ssh.",
+	"submodule.",
+	"uploadpack.",
+	"url.",
+}
+
+// validateGitConfig returns error if any of the git config keys is invalid
+// or not allowed
+func validateGitConfig(config map[string]string) error {
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		if !gitConfigKeyRgx.MatchString(key) {
+			return fmt.Errorf("invalid git config key '%s', must be in the form of section[.subsection].name", key)
+		}
+		lower := strings.ToLower(key)
+		for _, denied := range deniedGitConfigKeys {
+			if lower == denied || (strings.HasSuffix(denied, ".") && strings.HasPrefix(lower, denied)) {
+				return fmt.Errorf("git config key '%s' is not allowed", key)
+			}
+		}
+		if strings.ContainsAny(config[key], "\n\x00") {
+			return fmt.Errorf("git config value of the key '%s' must be single line", key)
+		}
+	}
+	return nil
+}
+
+// gitConfigArgs returns '-c key=value' args of the git config sorted by key
+func gitConfigArgs(config map[string]string) []string {
+	var args []string
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		args = append(args, "-c", key+"="+config[key])
+	}
+	return args
+}
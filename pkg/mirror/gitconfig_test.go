@@ -0,0 +1,96 @@
+package mirror
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_validateGitConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]string
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"valid", map[string]string{"fetch.negotiationAlgorithm": "skipping", "pack.threads": "4", "core.packedGitLimit": "512m"}, false},
+		{"valid-subsection", map[string]string{"http.https://host.xz.sslCAInfo": "/etc/ca.pem"}, false},
+		{"invalid-key", map[string]string{"packthreads": "4"}, true},
+		{"invalid-key-space", map[string]string{"pack. threads": "4"}, true},
+		{"invalid-key-equal", map[string]string{"pack.threads=8": "4"}, true},
+		{"invalid-value", map[string]string{"pack.threads": "4\n[alias]"}, true},
+		{"hooks-path", map[string]string{"core.hooksPath": "/tmp/hooks"}, true},
+		{"ssh-command", map[string]string{"Core.SSHCommand": "ssh -o ProxyCommand=x"}, true},
+		{"alias", map[string]string{"alias.fetch": "!sh"}, true},
+		{"url", map[string]string{"url.https://evil.xz/.insteadOf": "https://host.xz/"}, true},
+		{"remote", map[string]string{"remote.origin.url": "https://evil.xz/repo"}, true},
+		{"filter", map[string]string{"filter.lfs.smudge": "sh"}, true},
+		{"include-if", map[string]string{"includeIf.gitdir:/.path": "/tmp/config"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateGitConfig(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("validateGitConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRepo_gitConfigArgs(t *testing.T) {
+	r, err := NewRepository(RepositoryConfig{
+		Remote:    "user@host.xz:path/to/repo.git",
+		Root:      "/tmp",
+		Interval:  time.Second,
+		GitGC:     "always",
+		ProxyURL:  "http://proxy:3128",
+		FetchJobs: 4,
+		GitConfig: map[string]string{"pack.threads": "2", "fetch.negotiationAlgorithm": "skipping"},
+	}, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantConfig := []string{"-c", "fetch.negotiationAlgorithm=skipping", "-c", "pack.threads=2"}
+	if diff := cmp.Diff(wantConfig, r.gitConfig); diff != "" {
+		t.Errorf("gitConfig mismatch (-want +got):\n%s", diff)
+	}
+
+	// proxy is passed via envs and not args
+	wantFetch := []string{
+		"-c", "fetch.negotiationAlgorithm=skipping", "-c", "pack.threads=2",
+		"fetch", "origin", "--no-progress", "--porcelain", "--no-auto-gc", "--prune", "--jobs=4",
+	}
+	if diff := cmp.Diff(wantFetch, r.fetchArgs()); diff != "" {
+		t.Errorf("fetchArgs() mismatch (-want +got):\n%s", diff)
+	}
+
+	// updated config is used by next commands
+	if err := r.UpdateConfig(txtCtx, RepositoryConfig{
+		Remote:    "user@host.xz:path/to/repo.git",
+		Root:      "/tmp",
+		Interval:  time.Second,
+		GitGC:     "always",
+		GitConfig: map[string]string{"core.packedGitLimit": "512m"},
+	}); err != nil {
+		t.Fatalf("unable to update config err:%v", err)
+	}
+	wantFetch = []string{
+		"-c", "core.packedGitLimit=512m",
+		"fetch", "origin", "--no-progress", "--porcelain", "--no-auto-gc", "--prune",
+	}
+	if diff := cmp.Diff(wantFetch, r.fetchArgs()); diff != "" {
+		t.Errorf("fetchArgs() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := NewRepository(RepositoryConfig{
+		Remote:    "user@host.xz:path/to/repo.git",
+		Root:      "/tmp",
+		Interval:  time.Second,
+		GitGC:     "always",
+		GitConfig: map[string]string{"core.hooksPath": "/tmp/hooks"},
+	}, nil, slog.Default()); err == nil {
+		t.Errorf("expected error for disallowed git config key")
+	}
+}
@@ -0,0 +1,168 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+var (
+	// ErrAuthFailed is returned if remote rejected the credentials or the
+	// remote repository is not accessible with them
+	ErrAuthFailed = fmt.Errorf("remote authentication failed")
+
+	// ErrRefNotFound is returned if given ref or object doesn't exist in
+	// the mirror or on the remote
+	ErrRefNotFound = fmt.Errorf("ref not found")
+
+	// ErrNetwork is returned if remote couldn't be reached
+	ErrNetwork = fmt.Errorf("remote network error")
+
+	// stderr patterns of the common git failures, auth patterns are matched
+	// first as http errors also contain 'unable to access'
+	authErrRgx = regexp.MustCompile(`(?i)(authentication failed|could not read (username|password)|terminal prompts disabled|permission denied \(publickey|invalid username or password|host key verification failed|repository not found|does not appear to be a git repository|returned error: 40[13])`)
+	refErrRgx  = regexp.MustCompile(`(?i)(unknown revision|bad revision|ambiguous argument|not a valid object name|couldn't find remote ref|needed a single revision|invalid reference|not a valid ref|remote branch .* not found)`)
+	// missingObjectErrRgx matches cat-file failures if object or path of
+	// the tree doesn't exist
+	missingObjectErrRgx = regexp.MustCompile(`(?i)(path '.*' does not exist in|exists on disk, but not in|not a valid object name|invalid object name)`)
+	networkErrRgx       = regexp.MustCompile(`(?i)(could not resolve (host|proxy)|connection (refused|timed out|reset)|network is unreachable|no route to host|operation timed out|ssh: connect to host|the remote end hung up unexpectedly|early eof|tls handshake|ssl_connect|returned error: 5\d\d)`)
+)
+
+// ErrorClass is the category of the git command failure
+type ErrorClass string
+
+const (
+	ErrorClassAuth        ErrorClass = "auth"
+	ErrorClassRefNotFound ErrorClass = "ref-not-found"
+	ErrorClassNetwork     ErrorClass = "network"
+	ErrorClassCorrupt     ErrorClass = "corrupt"
+	ErrorClassTimeout     ErrorClass = "timeout"
+	ErrorClassOther       ErrorClass = "other"
+)
+
+// GitError is returned if git command fails, it wraps the exec error so
+// context errors can still be matched with errors.Is
+type GitError struct {
+	// Args are the args of the command with credentials redacted
+	Args []string
+	// ExitCode is the exit code of the command, -1 if command didn't exit
+	// on its own (eg. it was killed on timeout)
+	ExitCode int
+	// Stdout and Stderr are the trimmed outputs of the command, Stdout is
+	// empty if output was streamed to the caller
+	Stdout string
+	Stderr string
+	Err    error
+
+	cmd      string
+	streamed bool
+}
+
+func (e *GitError) Error() string {
+	cmd := e.cmd
+	// errors returned by the custom GitRunner might not set the cmd
+	if cmd == "" {
+		cmd = commandString("git", e.Args)
+	}
+	if e.streamed {
+		return fmt.Sprintf("Run(%s): err:%s { stderr: %q }", cmd, e.Err, e.Stderr)
+	}
+	return fmt.Sprintf("Run(%s): err:%s { stdout: %q, stderr: %q }", cmd, e.Err, e.Stdout, e.Stderr)
+}
+
+func (e *GitError) Unwrap() error { return e.Err }
+
+// class returns category of the failure based on stderr and exit code
+func (e *GitError) class() ErrorClass {
+	switch {
+	case errors.Is(e.Err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case authErrRgx.MatchString(e.Stderr):
+		return ErrorClassAuth
+	case refErrRgx.MatchString(e.Stderr):
+		return ErrorClassRefNotFound
+	// 'rev-parse --verify --quiet' exits with 1 without any output
+	case e.ExitCode == 1 && e.Stderr == "" && slices.Contains(e.Args, "--verify"):
+		return ErrorClassRefNotFound
+	case networkErrRgx.MatchString(e.Stderr):
+		return ErrorClassNetwork
+	case corruptionErrRgx.MatchString(e.Stderr):
+		return ErrorClassCorrupt
+	default:
+		return ErrorClassOther
+	}
+}
+
+// ClassifyError returns category of the given error, sentinel errors
+// returned by the repository are checked first and then the stderr of the
+// wrapped GitError if any. empty class is returned for nil error.
+func ClassifyError(err error) ErrorClass {
+	var gErr *GitError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrAuthFailed):
+		return ErrorClassAuth
+	case errors.Is(err, ErrRefNotFound):
+		return ErrorClassRefNotFound
+	case errors.Is(err, ErrNetwork):
+		return ErrorClassNetwork
+	case errors.As(err, &gErr):
+		return gErr.class()
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case corruptionErrRgx.MatchString(err.Error()):
+		return ErrorClassCorrupt
+	default:
+		return ErrorClassOther
+	}
+}
+
+// IsAuthError returns true if error was caused by rejected credentials
+func IsAuthError(err error) bool { return ClassifyError(err) == ErrorClassAuth }
+
+// IsRefNotFound returns true if error was caused by missing ref or object
+func IsRefNotFound(err error) bool { return ClassifyError(err) == ErrorClassRefNotFound }
+
+// IsNetworkError returns true if error was caused by unreachable remote
+func IsNetworkError(err error) bool { return ClassifyError(err) == ErrorClassNetwork }
+
+// isMissingObject returns true if cat-file failed because object or path
+// doesn't exist, other failures (eg. timeout, cancelled context or corrupt
+// repository) return false
+func isMissingObject(err error) bool {
+	var gErr *GitError
+	if !errors.As(err, &gErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// 'cat-file -e' exits with 1 without any output if object doesn't exist
+	if gErr.ExitCode == 1 && gErr.Stderr == "" {
+		return true
+	}
+	return gErr.ExitCode == 128 && missingObjectErrRgx.MatchString(gErr.Stderr)
+}
+
+// classifyGitErr wraps given git error with the sentinel error of its class
+// so callers can use errors.Is, err is returned as is if there is no
+// matching sentinel
+func classifyGitErr(err error) error {
+	var gErr *GitError
+	if !errors.As(err, &gErr) {
+		return err
+	}
+	switch gErr.class() {
+	case ErrorClassAuth:
+		if hostKeyErrRgx.MatchString(gErr.Stderr) {
+			return fmt.Errorf("%w: %w: %w", ErrAuthFailed, ErrHostKeyMismatch, err)
+		}
+		return fmt.Errorf("%w: %w", ErrAuthFailed, err)
+	case ErrorClassRefNotFound:
+		return fmt.Errorf("%w: %w", ErrRefNotFound, err)
+	case ErrorClassNetwork:
+		return fmt.Errorf("%w: %w", ErrNetwork, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,166 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	exitErr := &exec.ExitError{}
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"nil", nil, ""},
+		{"https_auth",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "remote: Invalid username or password.\nfatal: Authentication failed for 'https://github.com/org/repo.git/'"},
+			ErrorClassAuth},
+		{"https_no_prompt",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: could not read Username for 'https://github.com': terminal prompts disabled"},
+			ErrorClassAuth},
+		{"https_forbidden",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: unable to access 'https://gitea.internal/org/repo.git/': The requested URL returned error: 403"},
+			ErrorClassAuth},
+		{"ssh_key",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "git@github.com: Permission denied (publickey).\nfatal: Could not read from remote repository."},
+			ErrorClassAuth},
+		{"ssh_host_key",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "Host key verification failed.\nfatal: Could not read from remote repository."},
+			ErrorClassAuth},
+		{"repo_not_found",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "remote: Repository not found.\nfatal: repository 'https://github.com/org/missing.git/' not found"},
+			ErrorClassAuth},
+		{"log_unknown_ref",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: ambiguous argument 'missing': unknown revision or path not in the working tree."},
+			ErrorClassRefNotFound},
+		{"rev_parse_verify",
+			&GitError{Args: []string{"rev-parse", "--verify", "missing^{commit}"}, ExitCode: 128, Err: exitErr, Stderr: "fatal: Needed a single revision"},
+			ErrorClassRefNotFound},
+		{"rev_parse_verify_quiet",
+			&GitError{Args: []string{"rev-parse", "--verify", "--quiet", "missing"}, ExitCode: 1, Err: exitErr},
+			ErrorClassRefNotFound},
+		{"cat_file",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: Not a valid object name missing"},
+			ErrorClassRefNotFound},
+		{"fetch_missing_ref",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: couldn't find remote ref refs/heads/missing"},
+			ErrorClassRefNotFound},
+		{"clone_missing_branch",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "warning: Could not find remote branch missing to clone.\nfatal: Remote branch missing not found in upstream origin"},
+			ErrorClassRefNotFound},
+		{"dns",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: unable to access 'https://github.com/org/repo.git/': Could not resolve host: github.com"},
+			ErrorClassNetwork},
+		{"ssh_connect",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "ssh: connect to host github.com port 22: Connection refused\nfatal: Could not read from remote repository."},
+			ErrorClassNetwork},
+		{"hung_up",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "error: RPC failed; curl 18 transfer closed with outstanding read data remaining\nfatal: early EOF\nfatal: the remote end hung up unexpectedly"},
+			ErrorClassNetwork},
+		{"server_error",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: unable to access 'https://github.com/org/repo.git/': The requested URL returned error: 502"},
+			ErrorClassNetwork},
+		{"corrupt",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "error: object file .git/objects/4b/825dc642cb6eb9a060e54bf8d69288fbee4904 is empty\nfatal: loose object 4b825dc642cb6eb9a060e54bf8d69288fbee4904 is corrupt"},
+			ErrorClassCorrupt},
+		{"timeout",
+			&GitError{ExitCode: -1, Err: context.DeadlineExceeded},
+			ErrorClassTimeout},
+		{"other",
+			&GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: not a git repository (or any of the parent directories): .git"},
+			ErrorClassOther},
+		{"wrapped_git_error",
+			&MirrorError{Phase: MirrorPhaseFetch, Err: fmt.Errorf("unable to fetch err:%w", &GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: Authentication failed"})},
+			ErrorClassAuth},
+		{"sentinel", fmt.Errorf("%w: blah", ErrRefNotFound), ErrorClassRefNotFound},
+		{"context", fmt.Errorf("unable to start command err:%w", context.DeadlineExceeded), ErrorClassTimeout},
+		{"plain", errors.New("blah"), ErrorClassOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError() got:%s want:%s", got, tt.want)
+			}
+			if got := IsAuthError(tt.err); got != (tt.want == ErrorClassAuth) {
+				t.Errorf("IsAuthError() got:%t", got)
+			}
+			if got := IsRefNotFound(tt.err); got != (tt.want == ErrorClassRefNotFound) {
+				t.Errorf("IsRefNotFound() got:%t", got)
+			}
+			if got := IsNetworkError(tt.err); got != (tt.want == ErrorClassNetwork) {
+				t.Errorf("IsNetworkError() got:%t", got)
+			}
+		})
+	}
+}
+
+func Test_classifyGitErr(t *testing.T) {
+	exitErr := &exec.ExitError{}
+	tests := []struct {
+		name   string
+		err    error
+		target error
+	}{
+		{"auth", &GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: Authentication failed"}, ErrAuthFailed},
+		{"ref", &GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: bad revision 'missing'"}, ErrRefNotFound},
+		{"network", &GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: Could not resolve host: github.com"}, ErrNetwork},
+		{"timeout", &GitError{ExitCode: -1, Err: context.DeadlineExceeded}, context.DeadlineExceeded},
+		{"other", &GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: blah"}, exitErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyGitErr(tt.err)
+			if !errors.Is(got, tt.target) {
+				t.Errorf("classifyGitErr() = %v, want wrapped %v", got, tt.target)
+			}
+			var gErr *GitError
+			if !errors.As(got, &gErr) {
+				t.Errorf("classifyGitErr() should keep GitError got:%v", got)
+			}
+		})
+	}
+
+	if got := classifyGitErr(nil); got != nil {
+		t.Errorf("classifyGitErr(nil) = %v", got)
+	}
+}
+
+func Test_isMissingObject(t *testing.T) {
+	exitErr := &exec.ExitError{}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"exists exit code", &GitError{ExitCode: 1, Err: exitErr}, true},
+		{"missing path", &GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: path 'missing' does not exist in 'abc123'"}, true},
+		{"invalid object", &GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: Not a valid object name zz"}, true},
+		{"timeout", &GitError{ExitCode: -1, Err: context.DeadlineExceeded}, false},
+		{"cancelled", &GitError{ExitCode: -1, Err: context.Canceled}, false},
+		{"corrupt", &GitError{ExitCode: 128, Err: exitErr, Stderr: "fatal: loose object abc123 (stored in objects/ab/c123) is corrupt"}, false},
+		{"not git error", errors.New("git ops limit"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isMissingObject(tt.err); got != tt.want {
+				t.Errorf("isMissingObject() got:%t want:%t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitError_Error(t *testing.T) {
+	err := &GitError{ExitCode: 128, Err: errors.New("exit status 128"), Stdout: "out", Stderr: "fatal: blah", cmd: "git log"}
+	if got, want := err.Error(), `Run(git log): err:exit status 128 { stdout: "out", stderr: "fatal: blah" }`; got != want {
+		t.Errorf("Error() got:%s want:%s", got, want)
+	}
+	err.streamed = true
+	if got, want := err.Error(), `Run(git log): err:exit status 128 { stderr: "fatal: blah" }`; got != want {
+		t.Errorf("Error() got:%s want:%s", got, want)
+	}
+}
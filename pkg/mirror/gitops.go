@@ -0,0 +1,64 @@
+package mirror
+
+import (
+	"context"
+)
+
+// gitOpsLimiter bounds the number of concurrent git subprocesses of all the
+// repositories sharing it. nil limiter doesn't limit git subprocesses but
+// running git ops are still recorded.
+type gitOpsLimiter struct {
+	sem chan struct{}
+}
+
+// newGitOpsLimiter returns limiter allowing max concurrent git ops, nil is
+// returned if max is 0 which means unlimited
+func newGitOpsLimiter(max int) *gitOpsLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &gitOpsLimiter{sem: make(chan struct{}, max)}
+}
+
+// acquire blocks until git op can be started or ctx is done. returned release
+// func must be called once git op is finished
+func (l *gitOpsLimiter) acquire(ctx context.Context) (func(), error) {
+	if l != nil {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			recordGitOps(gitOpsQueued, 1)
+			select {
+			case l.sem <- struct{}{}:
+				recordGitOps(gitOpsQueued, -1)
+			case <-ctx.Done():
+				recordGitOps(gitOpsQueued, -1)
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	recordGitOps(gitOpsRunning, 1)
+	return func() {
+		recordGitOps(gitOpsRunning, -1)
+		if l != nil {
+			<-l.sem
+		}
+	}, nil
+}
+
+// setGitOps sets the limiter shared by all git commands of the repository
+// and its worktrees
+func (r *Repository) setGitOps(l *gitOpsLimiter) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.gitOps = l
+	for _, wl := range r.workTreeLinks {
+		wl.gitOps = l
+	}
+	// remote queries run with the config snapshot
+	if conf := r.remoteConf.Load(); conf != nil {
+		r.storeRemoteConfig(conf.cacheTTL)
+	}
+}
@@ -0,0 +1,181 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// GitRunner runs git commands of the repository. default runner executes
+// the configured git executable, custom runner can be supplied via
+// NewRepositoryWithRunner, WithGitRunner or NewRepoPoolWithRunner eg. to
+// script git behaviour in tests. git ops limit, tracing and logging of the
+// commands are handled by the repository. runner must be safe for
+// concurrent use. only git commands are run by the runner, ssh-keyscan of
+// FetchHostKeys is always executed directly.
+type GitRunner interface {
+	// Run runs git with given args in the dir, envs are added to the
+	// environment of the command. it returns trimmed stdout of the command.
+	// failed command should return *GitError so that failure is classified
+	// same as failures of the git executable.
+	Run(ctx context.Context, envs []string, dir string, args ...string) (string, error)
+}
+
+// GitStreamRunner can be implemented by the GitRunner to stream stdin and
+// stdout of the commands (eg. archive, bundle and cat-file). if runner
+// doesn't implement it output of Run is written to the stdout writer and
+// commands which require stdin fail.
+type GitStreamRunner interface {
+	RunStream(ctx context.Context, envs []string, dir string, stdin io.Reader, stdout io.Writer, args ...string) error
+}
+
+// errStdinNotSupported is returned if command requires stdin but GitRunner
+// doesn't implement GitStreamRunner
+var errStdinNotSupported = errors.New("git runner doesn't support stdin")
+
+// execGitRunner is the default GitRunner which executes git executable
+type execGitRunner struct {
+	path string // path to the git executable, PATH lookup is used if empty
+}
+
+// executable returns the path of the git executable
+func (e execGitRunner) executable() string {
+	if e.path == "" {
+		return gitExecutablePath
+	}
+	return e.path
+}
+
+func (e execGitRunner) Run(ctx context.Context, envs []string, dir string, args ...string) (string, error) {
+	stdout, _, err := e.output(ctx, envs, dir, args...)
+	return stdout, err
+}
+
+func (e execGitRunner) RunStream(ctx context.Context, envs []string, dir string, stdin io.Reader, stdout io.Writer, args ...string) error {
+	_, err := e.run(ctx, envs, dir, stdin, stdout, args...)
+	return err
+}
+
+// output runs the command and returns its trimmed stdout and stderr
+func (e execGitRunner) output(ctx context.Context, envs []string, dir string, args ...string) (string, string, error) {
+	outbuf := bytes.NewBuffer(nil)
+	stderr, err := e.run(ctx, envs, dir, nil, outbuf, args...)
+	stdout := strings.TrimSpace(outbuf.String())
+	var gErr *GitError
+	if errors.As(err, &gErr) {
+		gErr.Stdout, gErr.streamed = stdout, false
+		return "", "", gErr
+	}
+	return stdout, stderr, err
+}
+
+// run runs the command streaming its stdin and stdout, it returns trimmed
+// stderr of the successful command
+func (e execGitRunner) run(ctx context.Context, envs []string, dir string, stdin io.Reader, stdout io.Writer, args ...string) (string, error) {
+	gitExec := e.executable()
+
+	cmd := exec.CommandContext(ctx, gitExec, args...)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	defer setCmdCancel(cmd, gitWaitDelay)()
+
+	errbuf := bytes.NewBuffer(nil)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = errbuf
+
+	if len(envs) > 0 {
+		cmd.Env = append(cmd.Env, envs...)
+	}
+
+	err := cmd.Run()
+	if err == nil {
+		return strings.TrimSpace(errbuf.String()), nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = ctx.Err()
+	}
+	return "", &GitError{
+		Args:     redactArgs(args),
+		ExitCode: cmd.ProcessState.ExitCode(),
+		Stderr:   strings.TrimSpace(errbuf.String()),
+		Err:      err,
+		cmd:      commandString(gitExec, args),
+		streamed: true,
+	}
+}
+
+// streamRunner returns GitStreamRunner of the runner, runners which don't
+// implement it are wrapped so that output of Run is written to stdout
+func streamRunner(runner GitRunner) GitStreamRunner {
+	if sr, ok := runner.(GitStreamRunner); ok {
+		return sr
+	}
+	return runStreamFallback{runner}
+}
+
+type runStreamFallback struct {
+	GitRunner
+}
+
+func (f runStreamFallback) RunStream(ctx context.Context, envs []string, dir string, stdin io.Reader, stdout io.Writer, args ...string) error {
+	if stdin != nil {
+		return fmt.Errorf("%w cmd:%s", errStdinNotSupported, commandString("git", args))
+	}
+	out, err := f.Run(ctx, envs, dir, args...)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(stdout, out)
+	return err
+}
+
+// runWithStderr runs the command using the runner, stderr of the successful
+// command is only returned by the default runner as other runners don't
+// expose it. stderr is only used by the trace logs.
+func runWithStderr(ctx context.Context, runner GitRunner, envs []string, dir string, args ...string) (string, string, error) {
+	if e, ok := runner.(execGitRunner); ok {
+		return e.output(ctx, envs, dir, args...)
+	}
+	stdout, err := runner.Run(ctx, envs, dir, args...)
+	return stdout, "", err
+}
+
+// runStreamWithStderr is same as runWithStderr but streams stdin and stdout
+// of the command, see streamRunner
+func runStreamWithStderr(ctx context.Context, runner GitRunner, envs []string, dir string, stdin io.Reader, stdout io.Writer, args ...string) (string, error) {
+	if e, ok := runner.(execGitRunner); ok {
+		return e.run(ctx, envs, dir, stdin, stdout, args...)
+	}
+	return "", streamRunner(runner).RunStream(ctx, envs, dir, stdin, stdout, args...)
+}
+
+// runnerExecutable returns name of the git executable used in the logs
+func runnerExecutable(runner GitRunner) string {
+	if e, ok := runner.(execGitRunner); ok {
+		return e.executable()
+	}
+	return "git"
+}
+
+// isExecGitRunner returns true if runner is the default runner which
+// executes git executable
+func isExecGitRunner(runner GitRunner) bool {
+	_, ok := runner.(execGitRunner)
+	return ok
+}
+
+// customRunner returns runner supplied by the user or nil if repository
+// uses default runner, its used to keep the runner when repository is
+// re-created from the new config
+func (r *Repository) customRunner() GitRunner {
+	if isExecGitRunner(r.runner) {
+		return nil
+	}
+	return r.runner
+}
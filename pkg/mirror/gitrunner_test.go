@@ -0,0 +1,276 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/utilitywarehouse/git-mirror/pkg/mirror/repotest"
+)
+
+var _ GitRunner = (*repotest.FakeRunner)(nil)
+
+func TestRepository_fakeRunner(t *testing.T) {
+	root := t.TempDir()
+	runner := repotest.NewFakeRunner()
+	runner.Expect("show", "--no-patch", "--format=%s", "abc123").Return("'fix: subject'")
+	runner.Expect("show", "--name-only", "--pretty=format:", "abc123").Return("a.txt\nb/c.txt")
+	runner.Expect("log", "--pretty=format:%H", "-n", "1", "main", "--", "dir").Return("abc123").Times(1)
+	runner.ExpectPrefix("log").ReturnError(&GitError{
+		Args:     []string{"log"},
+		ExitCode: 128,
+		Stderr:   "fatal: ambiguous argument 'missing': unknown revision or path not in the working tree.",
+		Err:      errors.New("exit status 128"),
+	})
+
+	repo, err := NewRepositoryWithRunner(RepositoryConfig{
+		Remote:        "https://github.com/org/repo.git",
+		Root:          root,
+		Interval:      testInterval,
+		MirrorTimeout: testTimeout,
+		GitGC:         "always",
+	}, nil, runner, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+
+	if got, err := repo.Subject(txtCtx, "abc123"); err != nil || got != "fix: subject" {
+		t.Errorf("Subject() = %q, %v", got, err)
+	}
+	got, err := repo.ChangedFiles(txtCtx, "abc123")
+	if diff := cmp.Diff([]string{"a.txt", "b/c.txt"}, got); err != nil || diff != "" {
+		t.Errorf("ChangedFiles() err:%v mismatch (-want +got):\n%s", err, diff)
+	}
+	if got, err := repo.Hash(txtCtx, "main", "dir"); err != nil || got != "abc123" {
+		t.Errorf("Hash() = %q, %v", got, err)
+	}
+	// second call is matched by the failing expectation
+	if _, err := repo.Hash(txtCtx, "main", "dir"); !errors.Is(err, ErrRefNotFound) {
+		t.Errorf("Hash() error = %v, want %v", err, ErrRefNotFound)
+	}
+	runner.AssertExpectations(t)
+
+	// all commands are run in the repository dir
+	wantDir := filepath.Join(root, "repo.git")
+	for _, c := range runner.Calls() {
+		if c.Dir != wantDir {
+			t.Errorf("command '%s' run in dir:%s want:%s", c, c.Dir, wantDir)
+		}
+	}
+
+	t.Run("object-exists", func(t *testing.T) {
+		runner := repotest.NewFakeRunner()
+		runner.Expect("cat-file", "-e", "missing").ReturnError(&GitError{ExitCode: 1, Err: errors.New("exit status 1")})
+		runner.Expect("cat-file", "-e", "slow").ReturnError(&GitError{ExitCode: -1, Err: context.DeadlineExceeded})
+		defer func(old GitRunner) { repo.runner = old }(repo.runner)
+		repo.runner = runner
+
+		if err := repo.ObjectExists(txtCtx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ObjectExists() error = %v, want %v", err, ErrNotFound)
+		}
+		err := repo.ObjectExists(txtCtx, "slow")
+		if errors.Is(err, ErrNotFound) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ObjectExists() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("unexpected-call", func(t *testing.T) {
+		if err := repo.ObjectExists(txtCtx, "abc123"); !errors.Is(err, repotest.ErrUnexpectedCall) {
+			t.Errorf("ObjectExists() error = %v, want %v", err, repotest.ErrUnexpectedCall)
+		}
+	})
+
+	t.Run("stream-without-stdin", func(t *testing.T) {
+		runner.Expect("ls-tree").Return("out")
+		buf := &bytes.Buffer{}
+		if err := runGitCommandStream(txtCtx, testLog, nil, runner, nil, "", nil, buf, "ls-tree"); err != nil || buf.String() != "out" {
+			t.Errorf("runGitCommandStream() = %q, %v", buf.String(), err)
+		}
+		if err := runGitCommandStream(txtCtx, testLog, nil, runner, nil, "", &bytes.Buffer{}, buf, "ls-tree"); !errors.Is(err, errStdinNotSupported) {
+			t.Errorf("runGitCommandStream() error = %v, want %v", err, errStdinNotSupported)
+		}
+	})
+
+	t.Run("update-config-keeps-runner", func(t *testing.T) {
+		gitExec := filepath.Join(t.TempDir(), "git")
+		if err := os.WriteFile(gitExec, nil, 0755); err != nil {
+			t.Fatalf("unable to write git exec err:%v", err)
+		}
+		conf := RepositoryConfig{
+			Remote:        "https://github.com/org/repo.git",
+			Root:          root,
+			Interval:      testInterval,
+			MirrorTimeout: testTimeout,
+			GitGC:         "always",
+			GitExecPath:   gitExec,
+		}
+		if err := repo.UpdateConfig(txtCtx, conf); err != nil {
+			t.Fatalf("unable to update config err:%v", err)
+		}
+		if repo.runner != runner {
+			t.Errorf("custom runner should be kept on git exec path update")
+		}
+	})
+}
+
+func TestRepository_lfs(t *testing.T) {
+	conf := RepositoryConfig{
+		Remote:        "https://github.com/org/repo.git",
+		Root:          t.TempDir(),
+		Interval:      testInterval,
+		MirrorTimeout: testTimeout,
+		GitGC:         "always",
+		LFS:           true,
+	}
+
+	runner := repotest.NewFakeRunner()
+	if _, err := NewRepositoryWithRunner(conf, nil, runner, testLog); err == nil {
+		t.Fatal("expected error if git-lfs is not available")
+	}
+
+	runner.Expect("lfs", "version").Return("git-lfs/3.6.0")
+	runner.Expect("lfs", "ls-files", "--name-only", "--include", "empty", "abc123").Return("")
+	runner.ExpectPrefix("lfs", "ls-files").Return("data.bin")
+	repo, err := NewRepositoryWithRunner(conf, nil, runner, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+
+	repo.Pause()
+	if _, err := repo.lfsFetch(txtCtx, testLog, "abc123", ""); !errors.Is(err, ErrPaused) {
+		t.Errorf("lfsFetch() error = %v, want %v", err, ErrPaused)
+	}
+	if hasLFS, err := repo.lfsFetch(txtCtx, testLog, "abc123", "empty"); hasLFS || err != nil {
+		t.Errorf("lfsFetch() without lfs files = %t, %v", hasLFS, err)
+	}
+	repo.Resume()
+
+	repo.fetchWindow = FetchWindow{Start: "01:00", End: "05:00"}
+	repo.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+	if _, err := repo.lfsFetch(txtCtx, testLog, "abc123", ""); !errors.Is(err, ErrOutsideFetchWindow) {
+		t.Errorf("lfsFetch() error = %v, want %v", err, ErrOutsideFetchWindow)
+	}
+	if got := runner.CallsWithPrefix("lfs", "fetch"); len(got) != 0 {
+		t.Errorf("lfs objects should not be fetched from remote got:%v", got)
+	}
+}
+
+func TestRepository_ListRemoteRefs_gitConfig(t *testing.T) {
+	runner := repotest.NewFakeRunner()
+	runner.Expect("-c", "http.lowSpeedLimit=1000", "ls-remote", "origin", "refs/heads/*").
+		Return("abc123\trefs/heads/main").Times(1)
+
+	repo, err := NewRepositoryWithRunner(RepositoryConfig{
+		Remote:        "https://github.com/org/repo.git",
+		Root:          t.TempDir(),
+		Interval:      testInterval,
+		MirrorTimeout: testTimeout,
+		GitGC:         "always",
+		GitConfig:     map[string]string{"http.lowSpeedLimit": "1000"},
+		ProxyURL:      "http://proxy:3128",
+	}, nil, runner, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+
+	// remote query doesn't wait for the lock held by the mirror cycle
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	refs, err := repo.ListRemoteRefs(context.Background(), "refs/heads/*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(map[string]string{"refs/heads/main": "abc123"}, refs); diff != "" {
+		t.Errorf("ListRemoteRefs() mismatch (-want +got):\n%s", diff)
+	}
+	// proxy is passed via env same as for the fetch
+	calls := runner.Calls()
+	if len(calls) != 1 || !slices.Contains(calls[0].Envs, "GIT_CONFIG_VALUE_0=http://proxy:3128") {
+		t.Errorf("proxy should be set in envs got:%v", calls)
+	}
+	runner.AssertExpectations(t)
+}
+
+func TestGitError_Error_customRunner(t *testing.T) {
+	err := &GitError{Args: []string{"fetch", "origin"}, ExitCode: 1, Stderr: "boom", Err: errors.New("exit status 1")}
+	want := `Run(git fetch origin): err:exit status 1 { stdout: "", stderr: "boom" }`
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func Test_runWithStderr(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "clone")
+	if _, err := (execGitRunner{}).Run(context.Background(), nil, "", "init", "-q", src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// clone of the empty repository succeeds with warning on stderr
+	_, stderr, err := runWithStderr(context.Background(), execGitRunner{}, nil, "", "clone", src, dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stderr == "" {
+		t.Errorf("stderr of the default runner should be returned")
+	}
+
+	runner := repotest.NewFakeRunner()
+	runner.Fallback = execGitRunner{}
+	_, stderr, err = runWithStderr(context.Background(), runner, nil, "", "clone", src, filepath.Join(t.TempDir(), "clone"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stderr != "" {
+		t.Errorf("stderr of the custom runner should be empty got:%q", stderr)
+	}
+}
+
+func TestRepository_useCloneRevision(t *testing.T) {
+	runner := repotest.NewFakeRunner()
+	runner.Expect("version").ReturnError(&GitError{
+		Args:     []string{"version"},
+		ExitCode: -1,
+		Err:      errors.New("signal: killed"),
+	}).Times(1)
+	runner.Expect("version").Return("git version 2.49.0").Times(1)
+
+	conf := RepositoryConfig{
+		Remote:        "https://github.com/org/repo.git",
+		Root:          t.TempDir(),
+		Interval:      testInterval,
+		MirrorTimeout: testTimeout,
+		GitGC:         "always",
+	}
+	repo, err := NewRepositoryWithRunner(conf, nil, runner, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+
+	// failed probe is not cached, successful one is
+	for i, want := range []bool{false, true, true} {
+		if got := repo.useCloneRevision(txtCtx); got != want {
+			t.Errorf("useCloneRevision() call:%d = %t, want %t", i, got, want)
+		}
+	}
+	runner.AssertExpectations(t)
+
+	// disabled by config without probing git
+	conf.DisableCloneRevision = true
+	if err := repo.UpdateConfig(txtCtx, conf); err != nil {
+		t.Fatalf("unable to update config err:%v", err)
+	}
+	runner.Reset()
+	if repo.useCloneRevision(txtCtx) {
+		t.Errorf("useCloneRevision() = true, want false if disabled by config")
+	}
+	if calls := runner.Calls(); len(calls) != 0 {
+		t.Errorf("unexpected git calls %v", calls)
+	}
+}
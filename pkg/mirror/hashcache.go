@@ -0,0 +1,86 @@
+package mirror
+
+import (
+	"context"
+	"sync"
+)
+
+// maxHashCacheEntries is the max number of cached hashes, cache is cleared
+// once its full so that unbounded set of refs and paths can't grow it forever
+const maxHashCacheEntries = 10000
+
+// hashCache is the read-through cache of Repository.Hash results keyed by ref
+// and path. entries are only valid for the refs of the mirror they were
+// resolved on, since refs are only updated under repository write lock cache
+// is checked and cleared before write lock is released so Hash call made
+// after mirror cycle never returns value resolved before it.
+type hashCache struct {
+	lock    sync.Mutex        // protects entries as Hash is called with read lock
+	refs    string            // refs of the mirror (including HEAD) entries were resolved on
+	entries map[string]string // ref + path -> hash
+}
+
+func newHashCache() *hashCache {
+	return &hashCache{entries: make(map[string]string)}
+}
+
+func (c *hashCache) get(ref, path string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	hash, ok := c.entries[ref+"\x00"+path]
+	return hash, ok
+}
+
+func (c *hashCache) set(ref, path, hash string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.entries) >= maxHashCacheEntries {
+		clear(c.entries)
+	}
+	c.entries[ref+"\x00"+path] = hash
+}
+
+// reset clears all the entries, it must be called with repository write lock
+// held whenever refs of the mirror are changed outside of mirror cycle
+func (c *hashCache) reset() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.refs = ""
+	clear(c.entries)
+}
+
+// syncHashCache clears hash cache if refs of the mirror have changed since
+// entries were resolved, cache is also cleared if refs can't be listed.
+// it must be called with repository write lock held.
+func (r *Repository) syncHashCache(ctx context.Context) {
+	c := r.hashCache
+	if c == nil {
+		return
+	}
+
+	// git show-ref --head
+	// HEAD is included so that change of the default branch is detected
+	refs, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "show-ref", "--head")
+	if err != nil {
+		r.log.Debug("unable to list refs, clearing hash cache", "err", err)
+		refs = ""
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if refs != "" && refs == c.refs {
+		return
+	}
+	if len(c.entries) > 0 {
+		r.log.Debug("refs changed, clearing hash cache", "entries", len(c.entries))
+	}
+	c.refs = refs
+	clear(c.entries)
+}
@@ -1,29 +1,58 @@
 package mirror
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
 	"math/rand"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/giturl"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
-	updatedRefRgx = regexp.MustCompile(`(?m)^[^=] \w+ \w+ (refs\/[^\s]+)`)
+	// time given to the cancelled git process to exit after SIGTERM
+	// before all the processes in its group are killed
+	gitWaitDelay = 5 * time.Second
+
+	// flag of the first line might be trimmed if its ' ' (fast-forward)
+	updatedRefRgx = regexp.MustCompile(`(?m)^(?:([^=]) )?([0-9a-f]+) ([0-9a-f]+) (refs\/[^\s]+)`)
 
 	// Objects can be named by their 40 hexadecimal digit SHA-1 name
 	// or 64 hexadecimal digit SHA-256 name
 	commitHashRgx            = regexp.MustCompile("^([0-9A-Fa-f]{40}|[0-9A-Fa-f]{64})$")
 	abbreviatedCommitHashRgx = regexp.MustCompile("^[0-9A-Fa-f]{7,}$")
+
+	// to parse output of "git version"
+	// git version 2.39.5
+	gitVersionRgx = regexp.MustCompile(`^git version (\d+)\.(\d+)`)
+
+	// errDirEmpty is returned by sanity checks if checked dir is empty
+	errDirEmpty = errors.New("directory is empty")
+
+	// errRepoRepairable is returned by repo sanity checks if repo config
+	// doesn't match but it can be fixed without re-creating the repo
+	errRepoRepairable = errors.New("repairable repo config")
+
+	// errRepoCorrupt is returned by repo sanity checks if objects of the
+	// repo failed consistency check
+	errRepoCorrupt = errors.New("repo objects are corrupt")
 )
 
+// minimum git version which supports 'git clone --revision'
+const cloneRevisionMajor, cloneRevisionMinor = 2, 49
+
 // IsCommitHash returns whether or not a string is a 40 char SHA-1
 // or 64 char SHA-256 hash
 func IsFullCommitHash(hash string) bool {
@@ -36,6 +65,18 @@ func IsCommitHash(hash string) bool {
 	return abbreviatedCommitHashRgx.MatchString(hash)
 }
 
+// supportsCloneRevision returns true if given output of 'git version'
+// is of the version which supports 'git clone --revision'
+func supportsCloneRevision(version string) bool {
+	match := gitVersionRgx.FindStringSubmatch(version)
+	if match == nil {
+		return false
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return major > cloneRevisionMajor || (major == cloneRevisionMajor && minor >= cloneRevisionMinor)
+}
+
 func dirIsEmpty(path string) (bool, error) {
 	dirents, err := os.ReadDir(path)
 	if err != nil {
@@ -52,13 +93,54 @@ func absLink(root, link string) string {
 		linkAbs = filepath.Join(root, link)
 	}
 
-	return linkAbs
+	return filepath.Clean(linkAbs)
+}
+
+// validateLinkTarget makes sure worktree link can be published on the given
+// absolute path. link can only be outside of the root if allowOutside is set
+// and even then it can't be '/', the root or any of its parents or inside
+// the repository dir. nearest existing parent of the link must be a
+// directory so that missing parents can be created on publish.
+func validateLinkTarget(linkAbs, root, repoDir string, allowOutside bool) error {
+	root = filepath.Clean(root)
+	switch {
+	case !allowOutside && !isSubPath(root, linkAbs):
+		return fmt.Errorf("link path is outside of the root, allow_links_outside_root is not set link:%s root:%s", linkAbs, root)
+	case linkAbs == "/":
+		return fmt.Errorf("link path can't be root of the filesystem")
+	case linkAbs == root || strings.HasPrefix(root, linkAbs+"/"):
+		return fmt.Errorf("link path can't be the repository root or its parent link:%s root:%s", linkAbs, root)
+	case isSubPath(repoDir, linkAbs):
+		return fmt.Errorf("link path can't be inside the repository dir link:%s repo-dir:%s", linkAbs, repoDir)
+	}
+
+	for dir := filepath.Dir(linkAbs); ; dir = filepath.Dir(dir) {
+		fi, err := os.Stat(dir)
+		if err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("parent of the link is not a directory link:%s parent:%s", linkAbs, dir)
+			}
+			return nil
+		}
+		if errors.Is(err, syscall.ENOTDIR) {
+			return fmt.Errorf("parent of the link is not a directory link:%s err:%w", linkAbs, err)
+		}
+		// permission errors are reported on publish
+		if !errors.Is(err, fs.ErrNotExist) || dir == "/" {
+			return nil
+		}
+	}
+}
+
+// isSubPath returns true if path is same as dir or inside of it
+func isSubPath(dir, path string) bool {
+	return dir != "" && (path == dir || strings.HasPrefix(path, dir+"/"))
 }
 
 // reCreate removes dir and any children it contains and creates new dir
-// on the same path
-func reCreate(path string) error {
-	if err := os.RemoveAll(path); err != nil {
+// on the same path. path must be inside of the given root, see safeRemoveAll
+func reCreate(root, path string) error {
+	if err := safeRemoveAll(root, path); err != nil {
 		return fmt.Errorf("can't delete unusable dir: %w", err)
 	}
 	if err := os.MkdirAll(path, defaultDirMode); err != nil {
@@ -68,33 +150,165 @@ func reCreate(path string) error {
 }
 
 // publishSymlink atomically sets link to point at the specified target.
+// new symlink is created with temp name in the link dir and renamed over the
+// link, so readers always see either old or new target and never a missing
+// link. missing parent dirs of the link are created with given dir mode.
 // both linkPath and targetPath must be absolute paths
-func publishSymlink(linkPath string, targetPath string) error {
+func publishSymlink(linkPath string, targetPath string, dirMode fs.FileMode) error {
 	linkDir, linkFile := splitAbs(linkPath)
 
+	// only existing symlink is replaced, rename would silently replace
+	// regular file which might be data not owned by the mirror
+	if fi, err := os.Lstat(linkPath); err == nil && fi.Mode()&fs.ModeSymlink == 0 {
+		return fmt.Errorf("link path %s exists and is not a symlink", linkPath)
+	}
+
+	// link dir might be pruned by concurrent removal of the other link in
+	// the same dir before temp link is created in it, in which case dir is
+	// created again. once temp link is created dir is not empty and can't
+	// be pruned
+	var tmplink string
+	for attempt := 1; ; attempt++ {
+		var err error
+		tmplink, err = createTempSymlink(linkDir, linkFile, targetPath, dirMode)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) || attempt >= maxLinkDirAttempts {
+			return err
+		}
+	}
+
+	// make sure link resolves to the target before its published
+	if err := checkSymlink(tmplink, targetPath); err != nil {
+		os.Remove(tmplink)
+		return err
+	}
+
+	if err := os.Rename(tmplink, linkPath); err != nil {
+		os.Remove(tmplink)
+		if errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EBUSY) {
+			return fmt.Errorf("link %s is a mount point or on a different filesystem than its dir and can't be atomically replaced err:%w", linkPath, err)
+		}
+		return fmt.Errorf("error replacing symlink: %w", err)
+	}
+
+	return nil
+}
+
+// createTempSymlink creates missing link dir with given mode and symlink to
+// the target with temp name in it, path of the temp link is returned.
+// linkFile might exits and pointing to old worktree hence we cant create
+// symlink to it directly. temp link must be created in the link dir so that
+// rename is on the same filesystem
+func createTempSymlink(linkDir, linkFile, targetPath string, dirMode fs.FileMode) (string, error) {
 	// Make sure the link directory exists.
-	if err := os.MkdirAll(linkDir, defaultDirMode); err != nil {
-		return fmt.Errorf("error making symlink dir: %w", err)
+	if err := mkdirAllMode(linkDir, dirMode); err != nil {
+		return "", fmt.Errorf("error making symlink dir: %w", err)
+	}
+
+	target, err := symlinkTarget(linkDir, targetPath)
+	if err != nil {
+		return "", err
 	}
 
-	// linkDir is absolute, so we need to change it to a relative path.  This is
-	// so it can be volume-mounted at another path and the symlink still works.
+	tmplink := filepath.Join(linkDir, linkFile+"-"+nextRandom())
+	if err := os.Symlink(target, tmplink); err != nil {
+		return "", fmt.Errorf("error creating symlink: %w", err)
+	}
+	return tmplink, nil
+}
+
+// removeEmptyParents removes empty parent dirs of the given path up to but
+// never including the root, its a no-op if path is not inside the root.
+// dirs already removed are skipped and pruning stops at the first dir
+// which is not empty (eg. other link was published in it concurrently).
+func removeEmptyParents(root, path string) error {
+	root = filepath.Clean(root)
+	for dir := filepath.Dir(path); dir != root && isSubPath(root, dir); dir = filepath.Dir(dir) {
+		err := os.Remove(dir)
+		switch {
+		case err == nil, errors.Is(err, fs.ErrNotExist):
+		case errors.Is(err, syscall.ENOTEMPTY), errors.Is(err, syscall.EEXIST):
+			return nil
+		default:
+			return fmt.Errorf("unable to remove empty link dir:%s err:%w", dir, err)
+		}
+	}
+	return nil
+}
+
+// symlinkTarget returns path of the target relative to the link dir so that
+// it can be volume-mounted at another path and the symlink still works.
+// if link dir is reached via symlinks (eg. link root is a symlink to other
+// mount) relative path would be resolved from the real dir by the kernel,
+// so absolute target path is returned instead.
+func symlinkTarget(linkDir, targetPath string) (string, error) {
+	realDir, err := filepath.EvalSymlinks(linkDir)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve link dir err:%w", err)
+	}
+	if realDir != filepath.Clean(linkDir) {
+		return targetPath, nil
+	}
 	targetRelative, err := filepath.Rel(linkDir, targetPath)
 	if err != nil {
-		return fmt.Errorf("error converting to relative path: %w", err)
+		return "", fmt.Errorf("error converting to relative path: %w", err)
 	}
+	return targetRelative, nil
+}
 
-	// linkFile might exits and pointing to old worktree
-	// hence we cant create symlink to it directly
-	tmplink := linkFile + "-" + nextRandom()
-	if err := os.Symlink(targetRelative, filepath.Join(linkDir, tmplink)); err != nil {
-		return fmt.Errorf("error creating symlink: %w", err)
+// checkSymlink returns error if link doesn't resolve to the target
+func checkSymlink(link, targetPath string) error {
+	ti, err := os.Stat(targetPath)
+	if err != nil {
+		return fmt.Errorf("unable to stat symlink target err:%w", err)
 	}
+	li, err := os.Stat(link)
+	if err != nil || !os.SameFile(li, ti) {
+		return fmt.Errorf("symlink %s does not resolve to target %s, link and target might be on different mounts err:%v", link, targetPath, err)
+	}
+	return nil
+}
 
-	if err := os.Rename(filepath.Join(linkDir, tmplink), linkPath); err != nil {
-		return fmt.Errorf("error replacing symlink: %w", err)
+// mkdirAllMode is same as os.MkdirAll but given mode is explicitly set on
+// the created dirs so that it is not affected by umask. existing dirs are
+// not changed
+func mkdirAllMode(dir string, mode fs.FileMode) error {
+	if fi, err := os.Stat(dir); err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := mkdirAllMode(parent, mode); err != nil {
+			return err
+		}
 	}
+	if err := os.Mkdir(dir, mode); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.Chmod(dir, mode)
+}
+
+// writeFileAtomic writes data to the file via temp file and rename so that
+// readers never see partial content. path must be absolute
+func writeFileAtomic(path string, data []byte) error {
+	dir, file := splitAbs(path)
 
+	tmpFile := filepath.Join(dir, "."+file+"-"+nextRandom())
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("error writing temp file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("error replacing file: %w", err)
+	}
 	return nil
 }
 
@@ -120,14 +334,23 @@ func readAbsLink(link string) (string, error) {
 
 // removeDirContents iterated the specified dir and removes all contents
 func removeDirContents(dir string, log *slog.Logger) error {
-	return removeDirContentsIf(dir, log, func(fi os.FileInfo) (bool, error) {
+	return removeDirContentsIf(dir, dir, log, func(fi os.FileInfo) (bool, error) {
 		return true, nil
 	})
 }
 
 // removeDirContents iterated the specified dir and removes entries
-// if given function returns true for the given entry
-func removeDirContentsIf(dir string, log *slog.Logger, fn func(fi os.FileInfo) (bool, error)) error {
+// if given function returns true for the given entry. dir must resolve to the
+// root or inside of it and entries are never followed if they are symlinks,
+// so that corrupted symlink can't point clean up at unrelated data.
+func removeDirContentsIf(root, dir string, log *slog.Logger, fn func(fi os.FileInfo) (bool, error)) error {
+	if _, err := os.Lstat(dir); err != nil {
+		return err
+	}
+	if err := pathInside(root, dir); err != nil {
+		log.Error("refusing to remove contents of the dir outside of the root", "dir", dir, "root", root, "err", err)
+		return err
+	}
 	dirents, err := os.ReadDir(dir)
 	if err != nil {
 		return err
@@ -138,7 +361,7 @@ func removeDirContentsIf(dir string, log *slog.Logger, fn func(fi os.FileInfo) (
 	for _, fi := range dirents {
 		name := fi.Name()
 		p := filepath.Join(dir, name)
-		stat, err := os.Stat(p)
+		stat, err := os.Lstat(p)
 		if err != nil {
 			log.Error("failed to stat path, skipping", "path", p, "err", err)
 			continue
@@ -149,7 +372,10 @@ func removeDirContentsIf(dir string, log *slog.Logger, fn func(fi os.FileInfo) (
 		} else if !shouldDelete {
 			continue
 		}
-		if err := os.RemoveAll(p); err != nil {
+		if err := safeRemoveAll(dir, p); err != nil {
+			if errors.Is(err, errUnsafePath) {
+				log.Error("refusing to remove path outside of the dir", "path", p, "dir", dir, "err", err)
+			}
 			errs = append(errs, err)
 		}
 	}
@@ -186,49 +412,285 @@ func nextRandom() string {
 func updatedRefs(output string) []string {
 	var refs []string
 
+	for _, u := range parseRefUpdates(output) {
+		refs = append(refs, u.Ref)
+	}
+
+	return refs
+}
+
+// parseRefUpdates parses output of 'git fetch --porcelain' and returns
+// updated refs with old and new hashes
+func parseRefUpdates(output string) []RefUpdate {
+	var updates []RefUpdate
+
 	for _, match := range updatedRefRgx.FindAllStringSubmatch(output, -1) {
-		refs = append(refs, match[1])
+		updates = append(updates, RefUpdate{Ref: match[4], OldHash: match[2], NewHash: match[3], Type: refUpdateType(match[1])})
 	}
 
+	return updates
+}
+
+// parseLsRemote parses output of 'git ls-remote' and returns map of the refs
+// and their hashes
+func parseLsRemote(output string) map[string]string {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		hash, ref, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok {
+			continue
+		}
+		refs[ref] = hash
+	}
 	return refs
 }
 
-// runGitCommand runs git command with given arguments on given CWD
-func runGitCommand(ctx context.Context, log *slog.Logger, envs []string, cwd string, args ...string) (string, error) {
+// diffRefMaps returns sorted list of refs which are added, updated or deleted
+// in the new ref map compared to the old one
+func diffRefMaps(oldRefs, newRefs map[string]string) []string {
+	var changed []string
+	for ref, hash := range newRefs {
+		if oldHash, ok := oldRefs[ref]; !ok || oldHash != hash {
+			changed = append(changed, ref)
+		}
+	}
+	for ref := range oldRefs {
+		if _, ok := newRefs[ref]; !ok {
+			changed = append(changed, ref)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
 
-	cmdStr := gitExecutablePath + " " + strings.Join(args, " ")
-	log.Log(ctx, -8, "running command", "cwd", cwd, "cmd", cmdStr)
+// gitWorktree is the worktree registered in the repository
+type gitWorktree struct {
+	path   string
+	bare   bool
+	locked bool
+}
+
+// parseWorktreeList parses output of 'git worktree list --porcelain'
+func parseWorktreeList(output string) []gitWorktree {
+	var worktrees []gitWorktree
+	for _, block := range strings.Split(output, "\n\n") {
+		var wt gitWorktree
+		for _, line := range strings.Split(strings.TrimSpace(block), "\n") {
+			switch key, value, _ := strings.Cut(line, " "); key {
+			case "worktree":
+				wt.path = value
+			case "bare":
+				wt.bare = true
+			case "locked":
+				wt.locked = true
+			}
+		}
+		if wt.path != "" {
+			worktrees = append(worktrees, wt)
+		}
+	}
+	return worktrees
+}
+
+// refUpdateType returns update type based on the flag of the
+// 'git fetch --porcelain' output line
+func refUpdateType(flag string) RefUpdateType {
+	switch flag {
+	case "*":
+		return RefCreated
+	case "+":
+		return RefForced
+	case "-":
+		return RefDeleted
+	default:
+		return RefUpdated
+	}
+}
+
+// validateRefSpec makes sure given fetch refspec is in the form of
+// [+]<src>:<dst> or ^<src> (negative refspec) where <dst> is under 'refs/'
+// and pattern '*' is used on both sides or on neither side
+func validateRefSpec(refSpec string) error {
+	if strings.HasPrefix(refSpec, "^") {
+		if !strings.HasPrefix(refSpec, "^refs/") || strings.Contains(refSpec, ":") {
+			return fmt.Errorf("invalid negative refspec '%s', must be in the form of ^refs/<pattern>", refSpec)
+		}
+		return nil
+	}
+
+	src, dst, ok := strings.Cut(strings.TrimPrefix(refSpec, "+"), ":")
+	if !ok || src == "" || !strings.HasPrefix(dst, "refs/") {
+		return fmt.Errorf("invalid refspec '%s', must be in the form of [+]<src>:refs/<dst>", refSpec)
+	}
+	if strings.Count(src, "*") > 1 || strings.Count(src, "*") != strings.Count(dst, "*") {
+		return fmt.Errorf("invalid refspec '%s', '*' must be used once on both src and dst", refSpec)
+	}
+	return nil
+}
+
+// refMatchesRefSpecs returns true if given ref will be mirrored by any of the
+// given fetch refspecs. HEAD and commit hashes are always allowed.
+// short ref names are matched the same way git resolves them,
+// ie <ref>, refs/<ref>, refs/tags/<ref>, refs/heads/<ref> etc..
+func refMatchesRefSpecs(ref string, refSpecs []string) bool {
+	if ref == "HEAD" || IsCommitHash(ref) {
+		return true
+	}
+
+	candidates := []string{ref}
+	if !strings.HasPrefix(ref, "refs/") {
+		candidates = []string{"refs/" + ref, "refs/tags/" + ref, "refs/heads/" + ref, "refs/remotes/" + ref}
+	}
+
+	for _, c := range candidates {
+		matched := false
+		for _, rs := range refSpecs {
+			if strings.HasPrefix(rs, "^") {
+				continue
+			}
+			_, dst, _ := strings.Cut(strings.TrimPrefix(rs, "+"), ":")
+			if matchRefPattern(dst, c) {
+				matched = true
+				break
+			}
+		}
+		// negative refspecs exclude refs matched by other refspecs
+		for _, rs := range refSpecs {
+			if strings.HasPrefix(rs, "^") && matchRefPattern(strings.TrimPrefix(rs, "^"), c) {
+				matched = false
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRefPattern matches ref with refspec pattern which may
+// contain single '*' matching any part of the ref
+func matchRefPattern(pattern, ref string) bool {
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return pattern == ref
+	}
+	return len(ref) >= len(prefix)+len(suffix) &&
+		strings.HasPrefix(ref, prefix) && strings.HasSuffix(ref, suffix)
+}
+
+// sameRefSpecs returns true if both list contains same refspecs
+// irrespective of their order
+func sameRefSpecs(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
 
-	cmd := exec.CommandContext(ctx, gitExecutablePath, args...)
-	if cwd != "" {
-		cmd.Dir = cwd
+// runGitCommand runs git command with given arguments on given CWD using the
+// runner, default runner is used if its nil. command is not started until
+// git ops limiter allows it or ctx is done
+func runGitCommand(ctx context.Context, log *slog.Logger, gitOps *gitOpsLimiter, runner GitRunner, envs []string, cwd string, args ...string) (string, error) {
+	if runner == nil {
+		runner = execGitRunner{}
 	}
-	outbuf := bytes.NewBuffer(nil)
-	errbuf := bytes.NewBuffer(nil)
-	cmd.Stdout = outbuf
-	cmd.Stderr = errbuf
 
-	if len(envs) > 0 {
-		cmd.Env = append(cmd.Env, envs...)
+	ctx, span := startGitSpan(ctx, args)
+
+	cmdStr := commandString(runnerExecutable(runner), args)
+
+	release, err := gitOps.acquire(ctx)
+	if err != nil {
+		endSpan(span, err)
+		return "", fmt.Errorf("Run(%s): unable to start command err:%w", cmdStr, err)
 	}
+	defer release()
+
+	log.Log(ctx, -8, "running command", "cwd", cwd, "cmd", cmdStr)
 
 	start := time.Now()
-	err := cmd.Run()
+	stdout, stderr, err := runWithStderr(ctx, runner, envs, cwd, args...)
 	runTime := time.Since(start)
 
-	stdout := strings.TrimSpace(outbuf.String())
-	stderr := strings.TrimSpace(errbuf.String())
-	if ctx.Err() == context.DeadlineExceeded {
-		err = ctx.Err()
-	}
+	span.SetAttributes(attribute.String("git.duration", runTime.String()))
+	endSpan(span, err)
 	if err != nil {
-		return "", fmt.Errorf("Run(%s): err:%w { stdout: %q, stderr: %q }", cmdStr, err, stdout, stderr)
+		return "", err
 	}
-	log.Log(ctx, -8, "command result", "stdout", stdout, "stderr", stderr, "time", runTime)
+	// output might contain urls with credentials (eg. 'git config --get remote.origin.url')
+	log.Log(ctx, -8, "command result", "stdout", giturl.Redact(stdout), "stderr", giturl.Redact(stderr), "time", runTime)
 
 	return stdout, nil
 }
 
+// runGitCommandStream runs git command with given arguments on given CWD,
+// stdin is passed to the command and stdout is streamed to the given writer
+func runGitCommandStream(ctx context.Context, log *slog.Logger, gitOps *gitOpsLimiter, runner GitRunner, envs []string, cwd string, stdin io.Reader, stdout io.Writer, args ...string) error {
+	if runner == nil {
+		runner = execGitRunner{}
+	}
+
+	ctx, span := startGitSpan(ctx, args)
+
+	cmdStr := commandString(runnerExecutable(runner), args)
+
+	release, err := gitOps.acquire(ctx)
+	if err != nil {
+		endSpan(span, err)
+		return fmt.Errorf("Run(%s): unable to start command err:%w", cmdStr, err)
+	}
+	defer release()
+
+	log.Log(ctx, -8, "running command", "cwd", cwd, "cmd", cmdStr)
+
+	start := time.Now()
+	stderr, err := runStreamWithStderr(ctx, runner, envs, cwd, stdin, stdout, args...)
+	runTime := time.Since(start)
+
+	span.SetAttributes(attribute.String("git.duration", runTime.String()))
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	log.Log(ctx, -8, "command result", "stderr", giturl.Redact(stderr), "time", runTime)
+
+	return nil
+}
+
+// commandString returns printable command for logs and errors, credentials
+// of the urls in the args and in config args (eg. 'http.proxy=<url>') are
+// redacted
+func commandString(gitExec string, args []string) string {
+	return gitExec + " " + strings.Join(redactArgs(args), " ")
+}
+
+// redactArgs returns copy of the args with credentials of the urls redacted,
+// see giturl.Redact
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = giturl.Redact(arg)
+	}
+	return redacted
+}
+
+// failureBackoff returns wait time before next mirror cycle after given
+// number of consecutive failures. it is interval * 2^failures capped at
+// maxBackoff, if maxBackoff is not set 10 times the interval is used.
+func failureBackoff(interval, maxBackoff time.Duration, failures int) time.Duration {
+	if maxBackoff <= 0 {
+		maxBackoff = defaultBackoffFactor * interval
+	}
+	wait := interval
+	for i := 0; i < failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if failures > 0 {
+		wait = min(wait, maxBackoff)
+	}
+	return wait
+}
+
 // jitter returns a time.Duration between duration and duration + maxFactor * duration.
 func jitter(duration time.Duration, maxFactor float64) time.Duration {
 	return duration + time.Duration(rand.Float64()*maxFactor*float64(duration))
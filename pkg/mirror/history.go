@@ -0,0 +1,155 @@
+package mirror
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/lock"
+)
+
+// maxHistoryEvents is the max number of events of each type retained
+// in the change history of the repository
+const maxHistoryEvents = 1000
+
+// RefUpdateType represents the type of the ref update done by the fetch
+type RefUpdateType string
+
+const (
+	// RefCreated new ref is fetched
+	RefCreated RefUpdateType = "created"
+	// RefUpdated existing ref is updated (fast-forward)
+	RefUpdated RefUpdateType = "updated"
+	// RefForced existing ref is force updated
+	RefForced RefUpdateType = "forced"
+	// RefDeleted ref is pruned as it was deleted from the remote
+	RefDeleted RefUpdateType = "deleted"
+)
+
+// RefUpdate represents a ref updated by the fetch
+type RefUpdate struct {
+	Time    time.Time     `json:"time"`
+	Ref     string        `json:"ref"`
+	OldHash string        `json:"oldHash"`
+	NewHash string        `json:"newHash"`
+	Type    RefUpdateType `json:"type"`
+}
+
+// LinkUpdate represents a worktree link published on a new commit.
+// NewHash is empty if worktree was removed from the link.
+type LinkUpdate struct {
+	Time    time.Time `json:"time"`
+	Link    string    `json:"link"`
+	OldHash string    `json:"oldHash"`
+	NewHash string    `json:"newHash"`
+}
+
+// FailedCycle represents a mirror cycle which returned an error
+type FailedCycle struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// ChangeReport contains all the changes recorded in the given time window
+// in chronological order.
+type ChangeReport struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// Incomplete is set if window starts before the retained history
+	// hence report might be missing some changes
+	Incomplete   bool          `json:"incomplete"`
+	RefUpdates   []RefUpdate   `json:"refUpdates"`
+	LinkUpdates  []LinkUpdate  `json:"linkUpdates"`
+	FailedCycles []FailedCycle `json:"failedCycles"`
+}
+
+// changeHistory keeps bounded in-memory history of the changes made by
+// mirror cycles. it has its own lock so history can be read while
+// repository is being mirrored.
+type changeHistory struct {
+	lock         lock.RWMutex
+	start        time.Time // time from which history is complete
+	refUpdates   []RefUpdate
+	linkUpdates  []LinkUpdate
+	failedCycles []FailedCycle
+}
+
+func newChangeHistory(start time.Time) *changeHistory {
+	return &changeHistory{start: start}
+}
+
+func (u RefUpdate) at() time.Time   { return u.Time }
+func (u LinkUpdate) at() time.Time  { return u.Time }
+func (c FailedCycle) at() time.Time { return c.Time }
+
+func (h *changeHistory) recordRefUpdates(updates []RefUpdate) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, u := range updates {
+		h.refUpdates = appendBounded(h, h.refUpdates, u)
+	}
+}
+
+func (h *changeHistory) recordLinkUpdate(u LinkUpdate) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.linkUpdates = appendBounded(h, h.linkUpdates, u)
+}
+
+func (h *changeHistory) recordFailedCycle(c FailedCycle) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.failedCycles = appendBounded(h, h.failedCycles, c)
+}
+
+// appendBounded appends event to the list and drops the oldest event if list
+// is over the limit. history start is moved forward to the time of the
+// dropped event. must be called with lock held.
+func appendBounded[T interface{ at() time.Time }](h *changeHistory, events []T, e T) []T {
+	events = append(events, e)
+	if len(events) <= maxHistoryEvents {
+		return events
+	}
+	if t := events[0].at(); t.After(h.start) {
+		h.start = t
+	}
+	return slices.Delete(events, 0, 1)
+}
+
+func (h *changeHistory) between(since, until time.Time) ChangeReport {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	report := ChangeReport{
+		Since:      since,
+		Until:      until,
+		Incomplete: since.Before(h.start),
+	}
+	inWindow := func(t time.Time) bool {
+		return !t.Before(since) && !t.After(until)
+	}
+	for _, u := range h.refUpdates {
+		if inWindow(u.Time) {
+			report.RefUpdates = append(report.RefUpdates, u)
+		}
+	}
+	for _, u := range h.linkUpdates {
+		if inWindow(u.Time) {
+			report.LinkUpdates = append(report.LinkUpdates, u)
+		}
+	}
+	for _, c := range h.failedCycles {
+		if inWindow(c.Time) {
+			report.FailedCycles = append(report.FailedCycles, c)
+		}
+	}
+	return report
+}
+
+// ChangesBetween returns ref updates, worktree link updates and failed mirror
+// cycles recorded between since and until (inclusive). report is built from
+// retained in-memory history without running any git commands, if window
+// starts before the retained history report will be marked as Incomplete.
+func (r *Repository) ChangesBetween(ctx context.Context, since, until time.Time) (ChangeReport, error) {
+	return r.history.between(since, until), nil
+}
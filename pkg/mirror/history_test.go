@@ -0,0 +1,105 @@
+package mirror
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_changeHistory_between(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+
+	h := newChangeHistory(t0)
+	h.recordRefUpdates([]RefUpdate{
+		{Time: at(1), Ref: "refs/heads/main", OldHash: "a1", NewHash: "a2"},
+		{Time: at(1), Ref: "refs/heads/other", OldHash: "b1", NewHash: "b2"},
+	})
+	h.recordLinkUpdate(LinkUpdate{Time: at(1), Link: "/root/link", OldHash: "a1", NewHash: "a2"})
+	h.recordFailedCycle(FailedCycle{Time: at(2), Error: "boom"})
+	h.recordRefUpdates([]RefUpdate{{Time: at(3), Ref: "refs/heads/main", OldHash: "a2", NewHash: "a3"}})
+	h.recordLinkUpdate(LinkUpdate{Time: at(3), Link: "/root/link", OldHash: "a2", NewHash: "a3"})
+
+	tests := []struct {
+		name         string
+		since, until time.Time
+		want         ChangeReport
+	}{
+		{
+			"all",
+			t0, at(5),
+			ChangeReport{
+				Since: t0, Until: at(5),
+				RefUpdates: []RefUpdate{
+					{Time: at(1), Ref: "refs/heads/main", OldHash: "a1", NewHash: "a2"},
+					{Time: at(1), Ref: "refs/heads/other", OldHash: "b1", NewHash: "b2"},
+					{Time: at(3), Ref: "refs/heads/main", OldHash: "a2", NewHash: "a3"},
+				},
+				LinkUpdates: []LinkUpdate{
+					{Time: at(1), Link: "/root/link", OldHash: "a1", NewHash: "a2"},
+					{Time: at(3), Link: "/root/link", OldHash: "a2", NewHash: "a3"},
+				},
+				FailedCycles: []FailedCycle{{Time: at(2), Error: "boom"}},
+			},
+		},
+		{
+			"only-failure",
+			at(2), at(2),
+			ChangeReport{
+				Since: at(2), Until: at(2),
+				FailedCycles: []FailedCycle{{Time: at(2), Error: "boom"}},
+			},
+		},
+		{
+			"last-cycle",
+			at(2).Add(time.Second), at(10),
+			ChangeReport{
+				Since: at(2).Add(time.Second), Until: at(10),
+				RefUpdates:  []RefUpdate{{Time: at(3), Ref: "refs/heads/main", OldHash: "a2", NewHash: "a3"}},
+				LinkUpdates: []LinkUpdate{{Time: at(3), Link: "/root/link", OldHash: "a2", NewHash: "a3"}},
+			},
+		},
+		{
+			"before-history",
+			at(-5), at(0),
+			ChangeReport{Since: at(-5), Until: at(0), Incomplete: true},
+		},
+		{
+			"no-changes",
+			at(4), at(10),
+			ChangeReport{Since: at(4), Until: at(10)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.between(tt.since, tt.until)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("between() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_changeHistory_bounded(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+
+	h := newChangeHistory(t0)
+	for i := 1; i <= maxHistoryEvents+10; i++ {
+		h.recordFailedCycle(FailedCycle{Time: at(i), Error: fmt.Sprint(i)})
+	}
+
+	if len(h.failedCycles) != maxHistoryEvents {
+		t.Errorf("history should be bounded got:%d want:%d", len(h.failedCycles), maxHistoryEvents)
+	}
+
+	// oldest 10 events are dropped
+	if got := h.between(at(5), at(20)); !got.Incomplete || len(got.FailedCycles) != 10 {
+		t.Errorf("expected incomplete report with 10 events got: %t %d", got.Incomplete, len(got.FailedCycles))
+	}
+	if got := h.between(at(11), at(20)); got.Incomplete || len(got.FailedCycles) != 10 {
+		t.Errorf("expected complete report with 10 events got: %t %d", got.Incomplete, len(got.FailedCycles))
+	}
+}
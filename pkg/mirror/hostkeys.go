@@ -0,0 +1,199 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/giturl"
+)
+
+// ErrHostKeyMismatch is returned if remote host key doesn't match the key
+// pinned in the known hosts file
+var ErrHostKeyMismatch = fmt.Errorf("remote host key mismatch")
+
+var (
+	hostKeyErrRgx = regexp.MustCompile(`(?i)(host key verification failed|remote host identification has changed)`)
+
+	// knownHostsLock serialises updates of the managed known hosts files as
+	// same file is usually shared by all repositories of the pool
+	knownHostsLock sync.Mutex
+)
+
+// isSSHRemote returns true if given remote uses ssh transport
+func isSSHRemote(remote string) bool {
+	remote = giturl.NormaliseURL(remote)
+	return giturl.IsSCPURL(remote) || giturl.IsSSHURL(remote)
+}
+
+// FetchHostKeys returns public keys of the given ssh host (eg. 'github.com'
+// or 'gitea.internal:2222') in the known hosts format. keys are fetched with
+// 'ssh-keyscan' so they are not verified in any way, caller must make sure
+// they are fetched over trusted network. ssh-keyscan is run directly, not by
+// the GitRunner and without the proxy of the repositories, it is not used
+// by the managed known hosts bootstrap.
+func FetchHostKeys(ctx context.Context, host string) ([]string, error) {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	if hostname == "" || strings.HasPrefix(hostname, "-") {
+		return nil, fmt.Errorf("invalid ssh host '%s'", host)
+	}
+
+	args := []string{"-q"}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	// ssh-keyscan -q [-p <port>] <host>
+	cmd := exec.CommandContext(ctx, "ssh-keyscan", append(args, hostname)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to scan host keys of '%s' err:%w stderr:%q", host, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var keys []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no host keys found for '%s'", host)
+	}
+	return keys, nil
+}
+
+// knownHostsPattern returns host pattern used by ssh in the known hosts file,
+// host on the non default port is written as '[host]:port'
+func knownHostsPattern(host string) string {
+	h, p, err := net.SplitHostPort(host)
+	if err != nil || p == "22" {
+		if err == nil {
+			return h
+		}
+		return host
+	}
+	return "[" + h + "]:" + p
+}
+
+// knownHostsContains returns true if given known hosts data has a key of
+// the host pattern, both plain and hashed host names are checked. revoked
+// keys and certificate authorities are not keys of the host.
+func knownHostsContains(data []byte, pattern string) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// marker lines (@revoked, @cert-authority) don't pin keys of the host
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+			continue
+		}
+		for _, h := range strings.Split(fields[0], ",") {
+			if h == pattern || hashedHostMatches(h, pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hashedHostMatches returns true if given hashed known hosts entry
+// ('|1|<salt>|<hash>') is of the host pattern
+func hashedHostMatches(entry, pattern string) bool {
+	parts := strings.Split(entry, "|")
+	if len(parts) != 4 || parts[0] != "" || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(pattern))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// bootstrapKnownHosts adds keys of the remote host to the managed known hosts
+// file if host is not already in the file. keys are added by ssh itself
+// (StrictHostKeyChecking=accept-new) on the first connection made by
+// 'git ls-remote' so that it goes through the git runner and the proxy same
+// as other remote commands. keys of the known host are never updated so
+// changed keys are rejected by ssh. command is run with the given config
+// snapshot so repository lock is not required.
+func (r *Repository) bootstrapKnownHosts(ctx context.Context, conf *remoteConfig) error {
+	auth := conf.auth
+	if !auth.SSHKnownHostsBootstrap || r.gitURL.Host == "" {
+		return nil
+	}
+
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+
+	path := auth.SSHKnownHostsPath
+	pattern := knownHostsPattern(r.gitURL.Host)
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to read known hosts file err:%w", err)
+	}
+	if knownHostsContains(data, pattern) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), defaultDirMode); err != nil {
+		return fmt.Errorf("unable to create known hosts dir err:%w", err)
+	}
+
+	sshCmd := auth.sshCommandEnv("accept-new")
+	if conf.proxyURL != "" {
+		sshCmd += " " + sshProxyOption(conf.proxyURL)
+	}
+
+	if conf.gitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.gitTimeout)
+		defer cancel()
+	}
+
+	args := slices.Concat(conf.gitConfig, []string{"ls-remote", r.remoteURL, "HEAD"})
+	// git [-c <key>=<value>...] ls-remote <remote> HEAD
+	_, lsErr := runGitCommand(ctx, r.log, conf.gitOps, conf.runner, slices.Concat(conf.envs, []string{sshCmd}), "", args...)
+
+	// keys are added before authentication so command can fail for other
+	// reasons (eg. auth) which are then reported by the caller's command
+	data, err = os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to read known hosts file err:%w", err)
+	}
+	if !knownHostsContains(data, pattern) {
+		if lsErr != nil {
+			return fmt.Errorf("unable to add host keys of '%s' to known hosts file err:%w", pattern, lsErr)
+		}
+		return fmt.Errorf("host keys of '%s' were not added to known hosts file", pattern)
+	}
+
+	r.log.Info("remote host keys pinned in managed known hosts file", "host", pattern, "path", path)
+	return nil
+}
@@ -0,0 +1,134 @@
+package mirror
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/mirror/repotest"
+)
+
+func Test_knownHostsContains(t *testing.T) {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("[gitea.internal]:2222"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	data := []byte(`# comment github.com ssh-ed25519 AAAA
+github.com,140.82.121.4 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl
+@cert-authority *.example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl
+@revoked bitbucket.org ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl
+` + hashed + ` ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl
+gitlab.com
+`)
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"github.com", true},
+		{"github.com:22", true},
+		{"gitea.internal:2222", true},
+		{"gitea.internal", false},
+		{"gitlab.com", false},
+		// marker lines don't pin keys of the host
+		{"*.example.com", false},
+		{"bitbucket.org", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := knownHostsContains(data, knownHostsPattern(tt.host)); got != tt.want {
+				t.Errorf("knownHostsContains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// knownHostsRunner simulates ssh adding keys of the unknown host to the
+// known hosts file on ls-remote
+type knownHostsRunner struct {
+	path string
+	line string
+}
+
+func (k knownHostsRunner) Run(_ context.Context, _ []string, _ string, args ...string) (string, error) {
+	if k.line == "" || !slices.Contains(args, "ls-remote") {
+		return "", errors.New("permission denied (publickey)")
+	}
+	f, err := os.OpenFile(k.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = f.WriteString(k.line + "\n")
+	return "", err
+}
+
+func TestRepository_bootstrapKnownHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+	key := "github.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+
+	runner := repotest.NewFakeRunner()
+	runner.Fallback = knownHostsRunner{path: path, line: key}
+	repo, err := NewRepositoryWithRunner(RepositoryConfig{
+		Remote:   "git@github.com:org/repo.git",
+		Root:     "/tmp/root",
+		Interval: time.Minute,
+		GitGC:    "always",
+		ProxyURL: "http://proxy:3128",
+		Auth:     Auth{SSHKnownHostsPath: path, SSHKnownHostsBootstrap: true},
+	}, nil, runner, slog.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := repo.bootstrapKnownHosts(context.Background(), repo.remoteConf.Load()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !knownHostsContains(data, "github.com") {
+		t.Fatalf("host keys should be added got:%s err:%v", data, err)
+	}
+
+	// keys are added by ssh run via the runner and the proxy
+	calls := runner.CallsWithPrefix("ls-remote")
+	if len(calls) != 1 {
+		t.Fatalf("expected one ls-remote call got:%v", runner.Calls())
+	}
+	if want := []string{"ls-remote", "git@github.com:org/repo.git", "HEAD"}; !slices.Equal(calls[0].Args, want) {
+		t.Errorf("unexpected args got:%v want:%v", calls[0].Args, want)
+	}
+	sshCmd := calls[0].Envs[len(calls[0].Envs)-1]
+	for _, opt := range []string{"UserKnownHostsFile=" + path, "StrictHostKeyChecking=accept-new", "ProxyCommand=nc"} {
+		if !strings.Contains(sshCmd, opt) {
+			t.Errorf("ssh command should contain %s got:%s", opt, sshCmd)
+		}
+	}
+
+	// known host is not scanned again
+	runner.Reset()
+	if err := repo.bootstrapKnownHosts(context.Background(), repo.remoteConf.Load()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls := runner.Calls(); len(calls) != 0 {
+		t.Errorf("unexpected calls for known host:%v", calls)
+	}
+
+	// error is returned if keys were not added
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	runner.Fallback = knownHostsRunner{path: path}
+	if err := repo.bootstrapKnownHosts(context.Background(), repo.remoteConf.Load()); err == nil {
+		t.Errorf("expected error if host keys were not added")
+	}
+}
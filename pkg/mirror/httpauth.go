@@ -0,0 +1,277 @@
+package mirror
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is the role of the caller of the pool's http handlers, higher role
+// includes all the lower roles
+type Role int
+
+const (
+	// rolePublic is the role of the requests which are served without
+	// authorization unless public handlers are locked, see
+	// RepoPool.LockPublicHandlers
+	rolePublic Role = iota
+	// RoleReadOnly can read state of the pool
+	RoleReadOnly
+	// RoleOperator can pause, resume, approve and roll back updates
+	RoleOperator
+	// RoleAdmin can add and remove worktree links
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case rolePublic:
+		return "public"
+	case RoleReadOnly:
+		return "read-only"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return fmt.Sprintf("role(%d)", int(r))
+	}
+}
+
+var (
+	// ErrUnauthenticated is returned by the Authorizer if request doesn't
+	// carry valid credentials
+	ErrUnauthenticated = errors.New("request is not authenticated")
+
+	// ErrForbidden is returned by the Authorizer if caller doesn't have the
+	// role required by the request
+	ErrForbidden = errors.New("caller doesn't have required role")
+)
+
+// Authorizer authorizes requests of the pool's http handlers which read or
+// change state of the pool. it returns name of the caller used in the logs
+// and audit log, error wrapping ErrUnauthenticated or ErrForbidden is
+// returned if request is not allowed. minimum roles of the handlers are...
+//
+//	GitHTTPHandler   GET, POST: read-only
+//	StatusHandler    GET: read-only
+//	ReadyHandler     GET: public (read-only if locked)
+//	PauseHandler     GET: read-only  POST: operator
+//	WorktreeHandler  PUT: operator   POST, DELETE: admin
+//	RollbackHandler  POST, DELETE: operator
+//
+// methods which are not listed are rejected with 405. requests which change
+// the pool state are rejected with 403 if pool has no authorizer, see
+// RepoPool.SetAuthorizer.
+type Authorizer interface {
+	Authorize(req *http.Request, role Role) (string, error)
+}
+
+// AuthorizerFunc is the function implementing Authorizer
+type AuthorizerFunc func(req *http.Request, role Role) (string, error)
+
+func (f AuthorizerFunc) Authorize(req *http.Request, role Role) (string, error) {
+	return f(req, role)
+}
+
+// AllowAll is the Authorizer which allows all requests, it should only be
+// used if handlers are served on trusted network or behind authenticating
+// proxy
+var AllowAll Authorizer = AuthorizerFunc(func(*http.Request, Role) (string, error) {
+	return "anonymous", nil
+})
+
+// SetAuthorizer sets the authorizer of the pool's http handlers
+func (rp *RepoPool) SetAuthorizer(a Authorizer) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	rp.authorizer = a
+}
+
+// LockPublicHandlers sets whether public handlers (ReadyHandler) require
+// read-only role. by default they are served without authorization so that
+// probes don't need a token.
+func (rp *RepoPool) LockPublicHandlers(locked bool) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	rp.lockPublic = locked
+}
+
+// methodRoles maps http methods served by the handler to the minimum role
+// required by the request
+type methodRoles map[string]Role
+
+// authorized returns handler which authorizes every request for the role of
+// its method before passing it to the next handler. all the pool's handlers
+// are wrapped by it, methods which are not classified are rejected with 405
+// so that handlers fail closed.
+func (rp *RepoPool) authorized(roles methodRoles, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		role, ok := roles[req.Method]
+		if !ok {
+			rp.auditRequest(req, "", "", "method-not-allowed")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !rp.authorize(w, req, role) {
+			return
+		}
+		next(w, req)
+	})
+}
+
+// authorize returns true if request is allowed for the given role, error
+// response is written otherwise. requests which only read state are
+// allowed if pool has no authorizer. decisions are recorded in the audit
+// log if its enabled, requests of unlocked public handlers are not recorded.
+func (rp *RepoPool) authorize(w http.ResponseWriter, req *http.Request, role Role) bool {
+	rp.lock.RLock()
+	a, lockPublic := rp.authorizer, rp.lockPublic
+	rp.lock.RUnlock()
+
+	if role == rolePublic {
+		if !lockPublic {
+			return true
+		}
+		role = RoleReadOnly
+	}
+
+	if a == nil {
+		if role <= RoleReadOnly {
+			rp.auditRequest(req, "", role.String(), "allowed")
+			return true
+		}
+		rp.log.Warn("rejecting http request, no authorizer configured", "method", req.Method, "path", req.URL.Path)
+		rp.auditRequest(req, "", role.String(), "no-authorizer")
+		http.Error(w, "no authorizer configured", http.StatusForbidden)
+		return false
+	}
+
+	name, err := a.Authorize(req, role)
+	switch {
+	case err == nil:
+		rp.log.Info("http request authorized", "caller", name, "method", req.Method, "path", req.URL.Path, "role", role)
+		rp.auditRequest(req, name, role.String(), "allowed")
+		return true
+	case errors.Is(err, ErrUnauthenticated):
+		rp.log.Warn("http request rejected", "method", req.Method, "path", req.URL.Path, "role", role, "err", err)
+		rp.auditRequest(req, name, role.String(), "unauthenticated")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		rp.log.Warn("http request rejected", "caller", name, "method", req.Method, "path", req.URL.Path, "role", role, "err", err)
+		rp.auditRequest(req, name, role.String(), "forbidden")
+		http.Error(w, ErrForbidden.Error(), http.StatusForbidden)
+	}
+	return false
+}
+
+// auditRequest records authorization decision of the http request in the
+// audit log if its enabled, role is empty if method is not classified
+func (rp *RepoPool) auditRequest(req *http.Request, caller, role, outcome string) {
+	rp.audit.record(AuditEvent{
+		Time:    time.Now().UTC(),
+		Caller:  caller,
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Role:    role,
+		Outcome: outcome,
+	})
+}
+
+// TokenFile is the bearer token of the TokenAuthorizer loaded from the file
+type TokenFile struct {
+	// Name of the token used in the logs
+	Name string
+	// Path of the file containing the token
+	Path string
+	// Role granted to the token
+	Role Role
+}
+
+// TokenAuthorizer is the Authorizer which authenticates requests using
+// static bearer tokens loaded from files. tokens are re-read by Reload so
+// they can be rotated without restart.
+type TokenAuthorizer struct {
+	files []TokenFile
+
+	lock   sync.RWMutex
+	tokens []loadedToken
+}
+
+type loadedToken struct {
+	name  string
+	token []byte
+	role  Role
+}
+
+// NewTokenAuthorizer creates authorizer and loads the token files
+func NewTokenAuthorizer(files ...TokenFile) (*TokenAuthorizer, error) {
+	for _, f := range files {
+		if f.Name == "" || f.Path == "" {
+			return nil, fmt.Errorf("token name and path are required")
+		}
+		if f.Role < RoleReadOnly || f.Role > RoleAdmin {
+			return nil, fmt.Errorf("invalid role of the token name:%s role:%s", f.Name, f.Role)
+		}
+	}
+	a := &TokenAuthorizer{files: files}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload re-reads all the token files, existing tokens are kept if any of
+// the files can't be read
+func (a *TokenAuthorizer) Reload() error {
+	var tokens []loadedToken
+	for _, f := range a.files {
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			return fmt.Errorf("unable to read token file name:%s err:%w", f.Name, err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return fmt.Errorf("token file is empty name:%s", f.Name)
+		}
+		tokens = append(tokens, loadedToken{name: f.Name, token: []byte(token), role: f.Role})
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.tokens = tokens
+	return nil
+}
+
+// Authorize authenticates the bearer token of the request and checks its
+// role, all the tokens are compared in constant time
+func (a *TokenAuthorizer) Authorize(req *http.Request, role Role) (string, error) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", fmt.Errorf("%w: bearer token is required", ErrUnauthenticated)
+	}
+
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	var match *loadedToken
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), a.tokens[i].token) == 1 {
+			match = &a.tokens[i]
+		}
+	}
+	if match == nil {
+		return "", fmt.Errorf("%w: unknown token", ErrUnauthenticated)
+	}
+	if match.role < role {
+		return match.name, fmt.Errorf("%w: token:%s role:%s required:%s", ErrForbidden, match.name, match.role, role)
+	}
+	return match.name, nil
+}
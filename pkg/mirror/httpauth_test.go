@@ -0,0 +1,193 @@
+package mirror
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenAuthorizer(t *testing.T) {
+	dir := t.TempDir()
+	writeToken := func(name, token string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(token), 0600); err != nil {
+			t.Fatalf("unable to write token err:%v", err)
+		}
+		return path
+	}
+
+	a, err := NewTokenAuthorizer(
+		TokenFile{Name: "reader", Path: writeToken("reader", "r-token\n"), Role: RoleReadOnly},
+		TokenFile{Name: "operator", Path: writeToken("operator", "o-token"), Role: RoleOperator},
+		TokenFile{Name: "admin", Path: writeToken("admin", "a-token"), Role: RoleAdmin},
+	)
+	if err != nil {
+		t.Fatalf("unable to create authorizer err:%v", err)
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		role     Role
+		wantName string
+		wantErr  error
+	}{
+		{"no-header", "", RoleReadOnly, "", ErrUnauthenticated},
+		{"basic-auth", "Basic YTpi", RoleReadOnly, "", ErrUnauthenticated},
+		{"unknown-token", "Bearer x-token", RoleReadOnly, "", ErrUnauthenticated},
+		{"reader-read", "Bearer r-token", RoleReadOnly, "reader", nil},
+		{"reader-operate", "Bearer r-token", RoleOperator, "reader", ErrForbidden},
+		{"operator-operate", "Bearer o-token", RoleOperator, "operator", nil},
+		{"operator-admin", "Bearer o-token", RoleAdmin, "operator", ErrForbidden},
+		{"admin-admin", "Bearer a-token", RoleAdmin, "admin", nil},
+		{"admin-read", "Bearer a-token", RoleReadOnly, "admin", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			name, err := a.Authorize(req, tt.role)
+			if !errors.Is(err, tt.wantErr) || name != tt.wantName {
+				t.Errorf("Authorize() = %q, %v want %q, %v", name, err, tt.wantName, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("rotation", func(t *testing.T) {
+		writeToken("admin", "a-token-2")
+		if err := a.Reload(); err != nil {
+			t.Fatalf("unable to reload err:%v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer a-token")
+		if _, err := a.Authorize(req, RoleAdmin); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("expected old token to be rejected err:%v", err)
+		}
+		req.Header.Set("Authorization", "Bearer a-token-2")
+		if _, err := a.Authorize(req, RoleAdmin); err != nil {
+			t.Errorf("expected new token to be accepted err:%v", err)
+		}
+
+		// tokens are kept if file can't be read
+		os.Remove(filepath.Join(dir, "admin"))
+		if err := a.Reload(); err == nil {
+			t.Errorf("expected reload error for missing file")
+		}
+		if _, err := a.Authorize(req, RoleAdmin); err != nil {
+			t.Errorf("expected token to be kept err:%v", err)
+		}
+	})
+
+	if _, err := NewTokenAuthorizer(TokenFile{Name: "x", Path: filepath.Join(dir, "reader")}); err == nil {
+		t.Errorf("expected error for token without role")
+	}
+}
+
+func TestRepoPool_authorize(t *testing.T) {
+	rp := &RepoPool{log: testLog}
+	check := func(role Role, wantCode int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		ok := rp.authorize(w, httptest.NewRequest(http.MethodPost, "/", nil), role)
+		if ok != (wantCode == http.StatusOK) || w.Code != wantCode {
+			t.Errorf("authorize(%s) = %t code:%d want code:%d", role, ok, w.Code, wantCode)
+		}
+	}
+
+	// handlers fail closed without authorizer except for reading state
+	check(RoleReadOnly, http.StatusOK)
+	check(RoleOperator, http.StatusForbidden)
+	check(RoleAdmin, http.StatusForbidden)
+
+	rp.SetAuthorizer(AllowAll)
+	check(RoleAdmin, http.StatusOK)
+
+	rp.SetAuthorizer(AuthorizerFunc(func(*http.Request, Role) (string, error) {
+		return "", ErrUnauthenticated
+	}))
+	check(RoleReadOnly, http.StatusUnauthorized)
+}
+
+func TestRepoPool_authorized(t *testing.T) {
+	rp := &RepoPool{log: testLog, audit: &auditLog{events: make(chan AuditEvent, 20), log: testLog}}
+
+	tokenPath := filepath.Join(t.TempDir(), "reader")
+	if err := os.WriteFile(tokenPath, []byte("r-token"), 0600); err != nil {
+		t.Fatalf("unable to write token err:%v", err)
+	}
+	auth, err := NewTokenAuthorizer(TokenFile{Name: "reader", Path: tokenPath, Role: RoleReadOnly})
+	if err != nil {
+		t.Fatalf("unable to create authorizer err:%v", err)
+	}
+	rp.SetAuthorizer(auth)
+
+	check := func(h http.Handler, method, target, token string, wantCode int) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != wantCode {
+			t.Errorf("%s %s code:%d want:%d", method, target, w.Code, wantCode)
+		}
+	}
+	clone := "/repo.git/info/refs?service=git-upload-pack"
+
+	// requests without token can't clone or read status
+	check(rp.GitHTTPHandler(), http.MethodGet, clone, "", http.StatusUnauthorized)
+	check(rp.GitHTTPHandler(), http.MethodPost, "/repo.git/git-upload-pack", "", http.StatusUnauthorized)
+	check(rp.StatusHandler(), http.MethodGet, "/status", "", http.StatusUnauthorized)
+	check(rp.StatusHandler(), http.MethodGet, "/status", "x-token", http.StatusUnauthorized)
+
+	// unknown repo is only reported to the authorized caller
+	check(rp.GitHTTPHandler(), http.MethodGet, clone, "r-token", http.StatusNotFound)
+	check(rp.StatusHandler(), http.MethodGet, "/status", "r-token", http.StatusOK)
+
+	// ready is public unless locked
+	check(rp.ReadyHandler(), http.MethodGet, "/ready", "", http.StatusOK)
+	rp.LockPublicHandlers(true)
+	check(rp.ReadyHandler(), http.MethodGet, "/ready", "", http.StatusUnauthorized)
+	check(rp.ReadyHandler(), http.MethodGet, "/ready", "r-token", http.StatusOK)
+
+	// unclassified methods fail closed
+	check(rp.StatusHandler(), http.MethodDelete, "/status", "r-token", http.StatusMethodNotAllowed)
+
+	rp.SetAuthorizer(AuthorizerFunc(func(*http.Request, Role) (string, error) {
+		return "guest", ErrForbidden
+	}))
+	check(rp.GitHTTPHandler(), http.MethodGet, clone, "", http.StatusForbidden)
+	check(rp.StatusHandler(), http.MethodGet, "/status", "", http.StatusForbidden)
+
+	var got []string
+	for len(rp.audit.events) > 0 {
+		e := <-rp.audit.events
+		got = append(got, strings.Join([]string{e.Method, e.Path, e.Caller, e.Role, e.Outcome}, " "))
+	}
+	want := []string{
+		"GET /repo.git/info/refs  read-only unauthenticated",
+		"POST /repo.git/git-upload-pack  read-only unauthenticated",
+		"GET /status  read-only unauthenticated",
+		"GET /status  read-only unauthenticated",
+		"GET /repo.git/info/refs reader read-only allowed",
+		"GET /status reader read-only allowed",
+		"GET /ready  read-only unauthenticated",
+		"GET /ready reader read-only allowed",
+		"DELETE /status   method-not-allowed",
+		"GET /repo.git/info/refs guest read-only forbidden",
+		"GET /status guest read-only forbidden",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("audit events mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,114 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// keepRefPrefix is the namespace of the local refs which protect commits of
+// the pinned worktrees from gc after they are removed from the remote
+const keepRefPrefix = "refs/git-mirror/keep/"
+
+// pinned returns true if worktree link is pinned to a commit hash
+func (w *WorkTreeLink) pinned() bool {
+	return w.refPattern == "" && IsCommitHash(w.ref)
+}
+
+// keepRef returns the keep ref of the pinned worktree link. digest of the
+// link path is used as link names might not be unique or valid ref names.
+func (w *WorkTreeLink) keepRef() string {
+	sum := sha256.Sum256([]byte(w.link))
+	return keepRefPrefix + hex.EncodeToString(sum[:8])
+}
+
+// hasPinnedLinks returns true if any of the worktree links is pinned
+func (r *Repository) hasPinnedLinks() bool {
+	for _, wl := range r.workTreeLinks {
+		if wl.pinned() {
+			return true
+		}
+	}
+	return false
+}
+
+// keepPinnedCommit verifies that pinned commit of the worktree link exists
+// in the mirror and points the keep ref of the link to it so that commit is
+// retained even if upstream history is rewritten.
+// it must be called with repository write lock held.
+func (r *Repository) keepPinnedCommit(ctx context.Context, wl *WorkTreeLink) error {
+	if err := r.objectExists(ctx, wl.ref+"^{commit}"); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("unable to verify pinned commit:%s of worktree:%s err:%w", wl.ref, wl.name, err)
+		}
+		return fmt.Errorf("%w: pinned commit:%s of worktree:%s doesn't exist in the mirror, make sure its covered by the refspecs and run mirror again once its pushed",
+			ErrRefNotFound, wl.ref, wl.name)
+	}
+
+	// git update-ref <keep-ref> <hash>
+	if _, err := runGitCommand(ctx, wl.log, r.gitOps, r.runner, r.envs, r.dir, "update-ref", wl.keepRef(), wl.ref+"^{commit}"); err != nil {
+		return fmt.Errorf("unable to create keep ref of the pinned commit err:%w", err)
+	}
+	return nil
+}
+
+// cleanupKeepRefs re-creates keep refs of the pinned worktree links and
+// removes keep refs of the links which are no longer pinned.
+// it must be called with repository write lock held.
+func (r *Repository) cleanupKeepRefs(ctx context.Context) error {
+	// git for-each-ref --format=%(refname) refs/git-mirror/keep/
+	out, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "for-each-ref", "--format=%(refname)", keepRefPrefix)
+	if err != nil {
+		return fmt.Errorf("unable to list keep refs err:%w", err)
+	}
+	existing := strings.Fields(out)
+
+	var keep []string
+	for _, wl := range r.workTreeLinks {
+		if !wl.pinned() {
+			continue
+		}
+		keep = append(keep, wl.keepRef())
+		// keep ref of the link which is not published yet is created
+		// when its commit is resolved
+		if wl.pinnedHash == "" || slices.Contains(existing, wl.keepRef()) {
+			continue
+		}
+		wl.log.Info("re-creating keep ref of the pinned commit", "ref", wl.keepRef())
+		if err := r.keepPinnedCommit(ctx, wl); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range existing {
+		if slices.Contains(keep, ref) {
+			continue
+		}
+		if err := r.removeKeepRef(ctx, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeKeepRef deletes the given keep ref
+func (r *Repository) removeKeepRef(ctx context.Context, ref string) error {
+	r.log.Info("removing keep ref", "ref", ref)
+	// git update-ref -d <keep-ref>
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "update-ref", "-d", ref); err != nil {
+		return fmt.Errorf("unable to remove keep ref:%s err:%w", ref, err)
+	}
+	return nil
+}
+
+// setPinnedHash records published hash of the pinned worktree link so that
+// it's not resolved again on next mirror cycles
+func (w *WorkTreeLink) setPinnedHash(hash string) {
+	if w.pinned() {
+		w.pinnedHash = hash
+	}
+}
@@ -0,0 +1,106 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// maxLabels is the max number of labels of the repository
+	maxLabels = 16
+	// maxLabelKeyLen is the max length of the label key
+	maxLabelKeyLen = 63
+	// maxLabelValueLen is the max length of the label value
+	maxLabelValueLen = 128
+)
+
+// labelKeyRgx matches label keys which are also valid prometheus label names
+var labelKeyRgx = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedMetricLabels are the labels of the mirror metrics which can't be
+// used as metric labels of the repository
+var reservedMetricLabels = []string{"repo", "result", "reason", "phase", "class"}
+
+// validateLabels verifies keys and values of the repository labels
+func validateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("too many labels (%d), max allowed is %d", len(labels), maxLabels)
+	}
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if err := validateLabelKey(key); err != nil {
+			return err
+		}
+		if v := labels[key]; len(v) > maxLabelValueLen {
+			return fmt.Errorf("value of label %q is too long (%d), max allowed is %d", key, len(v), maxLabelValueLen)
+		}
+	}
+	return nil
+}
+
+// validateMetricLabels verifies label keys added to the mirror metrics
+func validateMetricLabels(keys []string) error {
+	if len(keys) > maxLabels {
+		return fmt.Errorf("too many metric labels (%d), max allowed is %d", len(keys), maxLabels)
+	}
+	for i, key := range keys {
+		if err := validateLabelKey(key); err != nil {
+			return fmt.Errorf("invalid metric label err:%w", err)
+		}
+		if slices.Contains(reservedMetricLabels, key) {
+			return fmt.Errorf("metric label %q is reserved, must not be one of %s", key, reservedMetricLabels)
+		}
+		if slices.Contains(keys[:i], key) {
+			return fmt.Errorf("metric label %q is duplicated", key)
+		}
+	}
+	return nil
+}
+
+func validateLabelKey(key string) error {
+	if len(key) > maxLabelKeyLen {
+		return fmt.Errorf("label key %q is too long (%d), max allowed is %d", key, len(key), maxLabelKeyLen)
+	}
+	if !labelKeyRgx.MatchString(key) || strings.HasPrefix(key, "__") {
+		return fmt.Errorf("label key %q must match %s and must not start with '__'", key, labelKeyRgx)
+	}
+	return nil
+}
+
+// labelAttrs returns labels as sorted log attributes
+func labelAttrs(labels map[string]string) []slog.Attr {
+	var attrs []slog.Attr
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		attrs = append(attrs, slog.String(key, labels[key]))
+	}
+	return attrs
+}
+
+// labelHandler adds current labels of the repository as 'labels' group to
+// every log record. labels are read on every record so that config reload
+// updates labels of the existing loggers of the repository and its worktrees.
+type labelHandler struct {
+	slog.Handler
+	labels *atomic.Pointer[[]slog.Attr]
+}
+
+func (h *labelHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs := h.labels.Load(); attrs != nil && len(*attrs) > 0 {
+		record = record.Clone()
+		record.AddAttrs(slog.Attr{Key: "labels", Value: slog.GroupValue(*attrs...)})
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *labelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &labelHandler{h.Handler.WithAttrs(attrs), h.labels}
+}
+
+func (h *labelHandler) WithGroup(name string) slog.Handler {
+	return &labelHandler{h.Handler.WithGroup(name), h.labels}
+}
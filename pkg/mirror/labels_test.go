@@ -0,0 +1,118 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_validateLabels(t *testing.T) {
+	tooMany := map[string]string{}
+	for _, k := range strings.Split("a b c d e f g h i j k l m n o p q", " ") {
+		tooMany[k] = "v"
+	}
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"valid", map[string]string{"team": "payments", "tier_1": "", "_env": "prod"}, false},
+		{"too-many", tooMany, true},
+		{"dash", map[string]string{"cost-centre": "x"}, true},
+		{"leading-digit", map[string]string{"1team": "x"}, true},
+		{"reserved-prefix", map[string]string{"__name": "x"}, true},
+		{"empty-key", map[string]string{"": "x"}, true},
+		{"long-key", map[string]string{strings.Repeat("k", 64): "x"}, true},
+		{"long-value", map[string]string{"team": strings.Repeat("v", 129)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateLabels(tt.labels); (err != nil) != tt.wantErr {
+				t.Errorf("validateLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateMetricLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"valid", []string{"team", "tier"}, false},
+		{"reserved", []string{"team", "repo"}, true},
+		{"reserved-reason", []string{"reason"}, true},
+		{"duplicated", []string{"team", "team"}, true},
+		{"invalid", []string{"cost-centre"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMetricLabels(tt.keys); (err != nil) != tt.wantErr {
+				t.Errorf("validateMetricLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	rpc := RepoPoolConfig{Defaults: DefaultConfig{MetricLabels: []string{"phase"}}}
+	if err := rpc.ValidateDefaults(); err == nil {
+		t.Error("ValidateDefaults() expected error for reserved metric label")
+	}
+}
+
+func TestRepo_labels(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+
+	rc := RepositoryConfig{
+		Remote:   "user@host.xz:path/to/labels-repo.git",
+		Root:     "/tmp",
+		Interval: 10 * time.Second,
+		GitGC:    "always",
+		Labels:   map[string]string{"team": "payments", "env": "prod"},
+	}
+	r, err := NewRepository(rc, nil, log)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer deleteMetrics(r.gitURL.Repo)
+	if err := r.AddWorktreeLink("link", "main", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf.Reset()
+	r.workTreeLinks["link"].log.Info("test")
+	if got := buf.String(); !strings.Contains(got, "repo=labels-repo.git worktree=link labels.env=prod labels.team=payments") {
+		t.Errorf("worktree log line should include repo labels got:%s", got)
+	}
+	if got := r.Status(context.Background()).Labels; !cmp.Equal(got, rc.Labels) {
+		t.Errorf("unexpected status labels got:%v want:%v", got, rc.Labels)
+	}
+
+	// labels of the existing loggers are updated on config reload
+	newRC := rc
+	newRC.Labels = map[string]string{"team": "platform"}
+	if err := r.UpdateConfig(txtCtx, newRC); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf.Reset()
+	r.workTreeLinks["link"].log.Info("test")
+	if got := buf.String(); !strings.Contains(got, "labels.team=platform") || strings.Contains(got, "labels.env") {
+		t.Errorf("worktree log line should include updated labels got:%s", got)
+	}
+	if got := r.Status(context.Background()).Labels; !cmp.Equal(got, newRC.Labels) {
+		t.Errorf("unexpected status labels got:%v want:%v", got, newRC.Labels)
+	}
+
+	newRC.Labels = map[string]string{"team-name": "platform"}
+	if err := r.UpdateConfig(txtCtx, newRC); err == nil {
+		t.Error("UpdateConfig() expected error for invalid label key")
+	}
+}
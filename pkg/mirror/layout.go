@@ -0,0 +1,118 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// currentLayoutVersion is the version of on-disk layout of the repository
+	// dir and its worktrees root written by this package. it must be bumped
+	// along with a registered migration whenever on-disk artefacts change.
+	currentLayoutVersion = 2
+
+	// layoutVersionFile is the name of the file which holds layout version
+	layoutVersionFile = ".git-mirror-layout-version"
+)
+
+// ErrNewerLayout is returned by Mirror if on-disk layout of the repository is
+// written by newer version of the package. repository will not be mirrored
+// to protect data which might be misinterpreted by this version.
+var ErrNewerLayout = errors.New("repository layout version is newer than supported")
+
+// layoutMigration migrates on-disk layout of the repository from version
+// 'n' to 'n+1'. migrations must be idempotent as they might be re-run if
+// process crashes before new version is written.
+type layoutMigration func(ctx context.Context, r *Repository) error
+
+// layoutMigrations contains registered migrations keyed by the version
+// they migrate from.
+var layoutMigrations = map[int]layoutMigration{
+	// v0 is the layout before version file was introduced, there is nothing
+	// to migrate apart from writing the version file.
+	0: func(context.Context, *Repository) error { return nil },
+	// v2 names worktree dirs by hash and checkout settings instead of link
+	// name so that links can share them. existing worktrees are still valid
+	// and are moved to the new dirs by the next mirror cycle.
+	1: func(context.Context, *Repository) error { return nil },
+}
+
+// readLayoutVersion returns layout version of the repository. version is read
+// from both repository dir and worktrees root and higher version is returned.
+// if version file doesn't exist 0 is returned.
+func (r *Repository) readLayoutVersion() (int, error) {
+	version := 0
+	for _, dir := range []string{r.dir, r.worktreesRoot()} {
+		data, err := os.ReadFile(filepath.Join(dir, layoutVersionFile))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("unable to read layout version file err:%w", err)
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid layout version %q in %s", data, dir)
+		}
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// writeLayoutVersion writes given version to both repository dir and
+// worktrees root
+func (r *Repository) writeLayoutVersion(version int) error {
+	for _, dir := range []string{r.dir, r.worktreesRoot()} {
+		if err := os.MkdirAll(dir, defaultDirMode); err != nil {
+			return fmt.Errorf("unable to create dir for layout version err:%w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, layoutVersionFile), []byte(strconv.Itoa(version)+"\n"), 0644); err != nil {
+			return fmt.Errorf("unable to write layout version err:%w", err)
+		}
+	}
+	r.layoutVersion = version
+	return nil
+}
+
+// ensureLayout makes sure on-disk layout of the existing repository dir is
+// up to date by running all registered migrations from current version.
+// it must be called with write lock held.
+func (r *Repository) ensureLayout(ctx context.Context) error {
+	return r.migrateLayout(ctx, currentLayoutVersion, layoutMigrations)
+}
+
+func (r *Repository) migrateLayout(ctx context.Context, target int, migrations map[int]layoutMigration) error {
+	if r.layoutVersion > target {
+		return fmt.Errorf("%w found:%d supported:%d", ErrNewerLayout, r.layoutVersion, target)
+	}
+
+	// nothing to migrate, layout version will be written on init
+	if _, err := os.Stat(r.dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	for v := r.layoutVersion; v < target; v++ {
+		migrate, ok := migrations[v]
+		if !ok {
+			return fmt.Errorf("no layout migration registered from version %d", v)
+		}
+
+		r.log.Info("migrating repository layout", "from", v, "to", v+1)
+		err := migrate(ctx, r)
+		recordLayoutMigration(r.gitURL.Repo, err == nil)
+		if err != nil {
+			return fmt.Errorf("unable to migrate layout from version %d err:%w", v, err)
+		}
+
+		if err := r.writeLayoutVersion(v + 1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
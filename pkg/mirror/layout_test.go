@@ -0,0 +1,185 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newLayoutTestRepo(t *testing.T) *Repository {
+	t.Helper()
+
+	root := t.TempDir()
+	rc := RepositoryConfig{
+		Remote:   "file://" + filepath.Join(root, "upstream"),
+		Root:     root,
+		Interval: testInterval,
+		GitGC:    "always",
+	}
+	repo, err := NewRepository(rc, nil, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+	return repo
+}
+
+func mustWriteLayoutFile(t *testing.T, dir, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, defaultDirMode); err != nil {
+		t.Fatalf("unable to create dir err: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, layoutVersionFile), []byte(content), 0644); err != nil {
+		t.Fatalf("unable to write layout file err: %v", err)
+	}
+}
+
+func assertLayoutFile(t *testing.T, dir, want string) {
+	t.Helper()
+
+	got, err := os.ReadFile(filepath.Join(dir, layoutVersionFile))
+	if err != nil {
+		t.Fatalf("unable to read layout file err: %v", err)
+	}
+	if strings.TrimSpace(string(got)) != want {
+		t.Errorf("layout version mismatch in %s got:%q want:%q", dir, got, want)
+	}
+}
+
+func TestRepository_migrateLayout(t *testing.T) {
+	t.Run("no-repo-dir", func(t *testing.T) {
+		repo := newLayoutTestRepo(t)
+		if err := repo.ensureLayout(txtCtx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(repo.dir); !os.IsNotExist(err) {
+			t.Errorf("repo dir should not be created by migration err:%v", err)
+		}
+	})
+
+	t.Run("legacy-layout", func(t *testing.T) {
+		repo := newLayoutTestRepo(t)
+		if err := os.MkdirAll(repo.dir, defaultDirMode); err != nil {
+			t.Fatalf("unable to create dir err: %v", err)
+		}
+		if err := repo.ensureLayout(txtCtx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertLayoutFile(t, repo.dir, fmt.Sprint(currentLayoutVersion))
+		assertLayoutFile(t, repo.worktreesRoot(), fmt.Sprint(currentLayoutVersion))
+	})
+
+	t.Run("forward-migrations", func(t *testing.T) {
+		repo := newLayoutTestRepo(t)
+		mustWriteLayoutFile(t, repo.dir, "1")
+		repo.layoutVersion, _ = repo.readLayoutVersion()
+
+		var ran []int
+		migrations := map[int]layoutMigration{
+			1: func(context.Context, *Repository) error { ran = append(ran, 1); return nil },
+			2: func(context.Context, *Repository) error { ran = append(ran, 2); return nil },
+		}
+		if err := repo.migrateLayout(txtCtx, 3, migrations); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fmt.Sprint(ran) != "[1 2]" {
+			t.Errorf("unexpected migrations run: %v", ran)
+		}
+		assertLayoutFile(t, repo.dir, "3")
+		assertLayoutFile(t, repo.worktreesRoot(), "3")
+
+		// re-run should be no-op
+		if err := repo.migrateLayout(txtCtx, 3, migrations); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(ran) != 2 {
+			t.Errorf("migrations should not be re-run: %v", ran)
+		}
+	})
+
+	t.Run("failed-migration", func(t *testing.T) {
+		repo := newLayoutTestRepo(t)
+		mustWriteLayoutFile(t, repo.dir, "1")
+		repo.layoutVersion, _ = repo.readLayoutVersion()
+
+		migrations := map[int]layoutMigration{
+			1: func(context.Context, *Repository) error { return nil },
+			2: func(context.Context, *Repository) error { return fmt.Errorf("boom") },
+		}
+		if err := repo.migrateLayout(txtCtx, 3, migrations); err == nil {
+			t.Fatalf("expected error")
+		}
+		// successful steps should be persisted
+		assertLayoutFile(t, repo.dir, "2")
+	})
+
+	t.Run("missing-migration", func(t *testing.T) {
+		repo := newLayoutTestRepo(t)
+		mustWriteLayoutFile(t, repo.dir, "1")
+		repo.layoutVersion, _ = repo.readLayoutVersion()
+
+		if err := repo.migrateLayout(txtCtx, 2, map[int]layoutMigration{}); err == nil {
+			t.Fatalf("expected error")
+		}
+		assertLayoutFile(t, repo.dir, "1")
+	})
+}
+
+func TestRepository_newerLayout(t *testing.T) {
+	root := t.TempDir()
+	repoDir := filepath.Join(root, "upstream.git")
+	mustWriteLayoutFile(t, repoDir, "99")
+	// file which would be removed if repo dir was re-created
+	mustWriteLayoutFile(t, filepath.Join(repoDir, "keep"), "keep")
+
+	rc := RepositoryConfig{
+		Remote:   "file://" + filepath.Join(root, "upstream"),
+		Root:     root,
+		Interval: testInterval,
+		GitGC:    "always",
+	}
+	repo, err := NewRepository(rc, nil, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+	if repo.layoutVersion != 99 {
+		t.Errorf("layout version mismatch got:%d want:99", repo.layoutVersion)
+	}
+
+	if err := repo.Mirror(txtCtx); !errors.Is(err, ErrNewerLayout) {
+		t.Errorf("expected ErrNewerLayout got:%v", err)
+	}
+
+	assertLayoutFile(t, repoDir, "99")
+	assertLayoutFile(t, filepath.Join(repoDir, "keep"), "keep")
+}
+
+func TestRepository_corruptedLayout(t *testing.T) {
+	root := t.TempDir()
+	repoDir := filepath.Join(root, "upstream.git")
+	mustWriteLayoutFile(t, repoDir, "not-a-version")
+
+	rc := RepositoryConfig{
+		Remote:   "file://" + filepath.Join(root, "upstream"),
+		Root:     root,
+		Interval: testInterval,
+		GitGC:    "always",
+	}
+	repo, err := NewRepository(rc, nil, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+	if repo.layoutVersion != 0 {
+		t.Errorf("layout version mismatch got:%d want:0", repo.layoutVersion)
+	}
+
+	// corrupted version should be treated as legacy layout and migrated
+	if err := repo.ensureLayout(txtCtx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertLayoutFile(t, repoDir, fmt.Sprint(currentLayoutVersion))
+}
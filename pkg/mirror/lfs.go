@@ -0,0 +1,116 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+)
+
+// lfsSkipSmudgeEnv stops lfs filter from downloading objects during checkout,
+// objects are fetched into the mirror and checked out separately
+const lfsSkipSmudgeEnv = "GIT_LFS_SKIP_SMUDGE=1"
+
+// validateLFS makes sure git-lfs is installed for the git used by the runner
+func validateLFS(ctx context.Context, log *slog.Logger, runner GitRunner, envs []string) error {
+	// git lfs version
+	if _, err := runGitCommand(ctx, log, nil, runner, envs, "", "lfs", "version"); err != nil {
+		return fmt.Errorf("%w: lfs is enabled but git-lfs is not available err:%w", ErrInvalidConfig, err)
+	}
+	return nil
+}
+
+// lfsStorage returns the dir where lfs objects of the mirror are stored
+func (r *Repository) lfsStorage() string {
+	return filepath.Join(r.dir, "lfs")
+}
+
+// lfsFetch fetches lfs objects of the given commit into the mirror. objects
+// are only fetched for the files matching pathspec. it returns false if
+// there are no lfs files in the pathspec so checkout can be skipped.
+// ErrPaused or ErrOutsideFetchWindow is returned if there are lfs files but
+// remote can't be queried.
+func (r *Repository) lfsFetch(ctx context.Context, log *slog.Logger, hash, pathspec string) (bool, error) {
+	args := []string{"lfs", "ls-files", "--name-only"}
+	if pathspec != "" {
+		args = append(args, "--include", pathspec)
+	}
+	// git lfs ls-files --name-only [--include <pathspec>] <hash>
+	files, err := runGitCommand(ctx, log, r.gitOps, r.runner, r.envs, r.dir, append(args, hash)...)
+	if err != nil {
+		return false, fmt.Errorf("unable to list lfs files err:%w", err)
+	}
+	if files == "" {
+		log.Debug("no lfs files found, skipping lfs fetch", "hash", hash, "pathspec", pathspec)
+		return false, nil
+	}
+
+	if r.Paused() {
+		return false, ErrPaused
+	}
+	if !r.fetchWindow.contains(r.now()) && r.fetchWindow.Triggers != FetchWindowTriggersAllow {
+		return false, fmt.Errorf("%w: unable to fetch lfs objects window-start:%s", ErrOutsideFetchWindow, r.fetchWindow.Start)
+	}
+
+	authEnvs, err := r.authEnv(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	args = append(r.remoteArgs(), "lfs", "fetch", "origin", hash)
+	if pathspec != "" {
+		args = append(args, "--include", pathspec)
+	}
+	ctx, cancel := r.withGitTimeout(ctx)
+	defer cancel()
+
+	// git [-c <key>=<value>...] lfs fetch origin <hash> [--include <pathspec>]
+	if _, err := runGitCommand(ctx, log, r.gitOps, r.runner, slices.Concat(r.envs, authEnvs), r.dir, args...); err != nil {
+		err = classifyGitErr(err)
+		r.credentialFailed(err)
+		return false, fmt.Errorf("unable to fetch lfs objects err:%w", err)
+	}
+	return true, nil
+}
+
+// lfsCheckout replaces lfs pointer files in the given checkout dir with
+// the objects stored in the mirror
+func (r *Repository) lfsCheckout(ctx context.Context, log *slog.Logger, dir, pathspec string) error {
+	args := []string{"-c", "lfs.storage=" + r.lfsStorage(), "lfs", "checkout"}
+	if pathspec != "" {
+		args = append(args, pathspec)
+	}
+	// git -c lfs.storage=<repo-dir>/lfs lfs checkout [<pathspec>]
+	if _, err := runGitCommand(ctx, log, r.gitOps, r.runner, r.envs, dir, args...); err != nil {
+		return fmt.Errorf("unable to checkout lfs files err:%w", err)
+	}
+	return nil
+}
+
+// cloneLFSFetch fetches lfs objects of the given ref for Clone if lfs is
+// enabled, it returns true if checkout of lfs files is required along with
+// envs of the checkout commands
+func (r *Repository) cloneLFSFetch(ctx context.Context, ref, pathspec string) (bool, []string, error) {
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return false, nil, err
+	}
+	defer r.lock.RUnlock()
+
+	envs := r.checkoutEnvs()
+	if !r.lfs {
+		return false, envs, nil
+	}
+	hasLFS, err := r.lfsFetch(ctx, r.log, ref, pathspec)
+	return hasLFS, envs, err
+}
+
+// checkoutEnvs returns envs of the checkout commands, lfs objects are not
+// smudged on checkout as they are checked out by lfsCheckout. caller must
+// hold the repository lock.
+func (r *Repository) checkoutEnvs() []string {
+	if !r.lfs {
+		return r.envs
+	}
+	return slices.Concat(r.envs, []string{lfsSkipSmudgeEnv})
+}
@@ -0,0 +1,304 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLoopRestartBackoff is the max wait before crashed mirror loop is
+// restarted, consecutive crashes are reset if loop ran longer than this
+const maxLoopRestartBackoff = 5 * time.Minute
+
+// errLoopAborted is the cause of the loop context cancellation by abortLoop
+var errLoopAborted = errors.New("mirror loop aborted")
+
+// loopRestartBackoff is the wait before crashed mirror loop is restarted for
+// the first time, its doubled on every consecutive crash
+var loopRestartBackoff = 5 * time.Second
+
+// LoopState is the state of the mirror loop of the repository
+type LoopState string
+
+const (
+	// LoopStopped indicates mirror loop was never started, was stopped or
+	// its context was cancelled
+	LoopStopped LoopState = "stopped"
+	// LoopRunning indicates mirror loop is running
+	LoopRunning LoopState = "running"
+	// LoopCrashed indicates mirror loop panicked and is waiting to be
+	// restarted
+	LoopCrashed LoopState = "crashed"
+)
+
+// LoopStatus represents current state of the mirror loop of the repository
+type LoopStatus struct {
+	Remote string    `json:"remote"`
+	State  LoopState `json:"state"`
+	// Restarts is the number of times loop was restarted after panic
+	Restarts int `json:"restarts"`
+	// LastPanic is the value of the last recovered panic
+	LastPanic     string    `json:"lastPanic,omitempty"`
+	LastPanicTime time.Time `json:"lastPanicTime"`
+}
+
+// beginLoop marks mirror loop as running, it returns false if loop is
+// already running. loop is marked before runLoop is started so that loop can
+// be stopped as soon as caller returns.
+func (r *Repository) beginLoop() bool {
+	r.loopLock.Lock()
+	defer r.loopLock.Unlock()
+
+	if r.running {
+		return false
+	}
+	r.running = true
+	r.loopState = LoopRunning
+	r.stopped = make(chan bool)
+	r.abort = make(chan bool)
+	return true
+}
+
+// abortLoop stops mirror loop without waiting for the in-flight mirror cycle
+// to finish, loop context is cancelled so that running git commands are
+// interrupted. it doesn't block, see loopDone.
+func (r *Repository) abortLoop() {
+	r.loopLock.Lock()
+	defer r.loopLock.Unlock()
+
+	if !r.running {
+		return
+	}
+	select {
+	case <-r.abort:
+	default:
+		close(r.abort)
+	}
+}
+
+// endLoop marks mirror loop as stopped and unblocks StopLoop callers
+func (r *Repository) endLoop() {
+	r.loopLock.Lock()
+	defer r.loopLock.Unlock()
+
+	r.running = false
+	r.loopState = LoopStopped
+	close(r.stopped)
+}
+
+// loopRunning returns true if mirror loop is running or waiting to be
+// restarted after crash
+func (r *Repository) loopRunning() bool {
+	r.loopLock.Lock()
+	defer r.loopLock.Unlock()
+
+	return r.running
+}
+
+// loopDone returns channel which is closed once mirror loop exits
+func (r *Repository) loopDone() <-chan bool {
+	r.loopLock.Lock()
+	defer r.loopLock.Unlock()
+
+	if !r.running {
+		done := make(chan bool)
+		close(done)
+		return done
+	}
+	return r.stopped
+}
+
+// LoopStatus returns current state of the mirror loop
+func (r *Repository) LoopStatus() LoopStatus {
+	r.loopLock.Lock()
+	defer r.loopLock.Unlock()
+
+	return LoopStatus{
+		Remote:        r.remote,
+		State:         r.loopState,
+		Restarts:      r.loopRestarts,
+		LastPanic:     r.lastPanic,
+		LastPanicTime: r.lastPanicTime,
+	}
+}
+
+// runLoop runs mirror loop until its stopped or context is done. if loop
+// panics, panic is logged and loop is restarted after backoff with mirror
+// cycle run immediately. caller must mark loop as running with beginLoop.
+func (r *Repository) runLoop(ctx context.Context, waitFirst bool, delay time.Duration) {
+	defer r.endLoop()
+
+	// mirror cycles use context derived from the loop context so that
+	// aborting the loop interrupts in-flight git commands
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	r.loopLock.Lock()
+	abort := r.abort
+	r.loopLock.Unlock()
+	go func() {
+		select {
+		case <-abort:
+			cancel(errLoopAborted)
+		case <-ctx.Done():
+		}
+	}()
+
+	var crashes int
+	for {
+		start := time.Now()
+		if !r.recoverLoop(ctx, waitFirst, delay) {
+			return
+		}
+		if time.Since(start) > maxLoopRestartBackoff {
+			crashes = 0
+		}
+		backoff := failureBackoff(loopRestartBackoff, maxLoopRestartBackoff, crashes)
+		crashes++
+
+		r.log.Info("restarting crashed mirror loop", "backoff", backoff)
+		if !r.waitRestart(ctx, backoff) {
+			return
+		}
+
+		r.loopLock.Lock()
+		r.loopState = LoopRunning
+		r.loopRestarts++
+		r.loopLock.Unlock()
+
+		waitFirst, delay = false, 0
+	}
+}
+
+// recoverLoop runs mirror loop and recovers its panic, it returns true if
+// loop panicked
+func (r *Repository) recoverLoop(ctx context.Context, waitFirst bool, delay time.Duration) (panicked bool) {
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+		r.log.Error("mirror loop panicked", "panic", p, "stack", string(debug.Stack()))
+		recordLoopPanic(r.gitURL.Repo)
+
+		r.loopLock.Lock()
+		r.loopState = LoopCrashed
+		r.lastPanic = fmt.Sprint(p)
+		r.lastPanicTime = r.now()
+		r.loopLock.Unlock()
+
+		panicked = true
+	}()
+
+	r.loop(ctx, waitFirst, delay)
+	return false
+}
+
+// waitRestart blocks until crashed loop should be restarted, restart is not
+// delayed if mirror run is queued via QueueMirrorRun.
+// it returns false if mirror loop should be stopped.
+func (r *Repository) waitRestart(ctx context.Context, backoff time.Duration) bool {
+	t := time.NewTimer(backoff)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.trigger:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-r.stop:
+		return false
+	}
+}
+
+// LoopStatus returns current state of the mirror loops of all the
+// repositories in the pool
+func (rp *RepoPool) LoopStatus() []LoopStatus {
+	repos := rp.repositories()
+	statuses := make([]LoopStatus, 0, len(repos))
+	for _, repo := range repos {
+		statuses = append(statuses, repo.LoopStatus())
+	}
+	return statuses
+}
+
+// RestartRepository stops mirror loop of the repository if its running and
+// starts it again, first mirror cycle is run immediately. it can be used to
+// restart loop which was stopped or is waiting to be restarted after crash.
+// repository can be identified by remote or name, see Lookup.
+func (rp *RepoPool) RestartRepository(remote string) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+
+	repo.StopLoop()
+	// loop might have been started concurrently
+	rp.startLoop(repo, false, 0)
+	rp.log.Info("repository mirror loop restarted", "repo", repo.gitURL.Repo)
+	return nil
+}
+
+// WaitStopped blocks until mirror loops of all the repositories in the pool
+// have exited (eg. after Stop) or context is done in which case context
+// error is returned.
+func (rp *RepoPool) WaitStopped(ctx context.Context) error {
+	for _, repo := range rp.repositories() {
+		select {
+		case <-repo.loopDone():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Shutdown stops mirror loops of all the repositories in the pool without
+// waiting for in-flight mirror cycles to finish, their git commands are
+// interrupted so that loops stop well before mirror timeout. worktree links
+// are only switched once new worktree is fully checked out, hence aborted
+// cycle leaves previously published worktrees in place and partially
+// created worktrees are replaced on the next start.
+// it blocks until all the loops have stopped or context is done, in which
+// case ErrShutdownIncomplete is returned with the repositories which haven't
+// stopped. buffered audit events are written once all the loops have
+// stopped. pool context is cancelled so loops can't
+// be started after Shutdown.
+func (rp *RepoPool) Shutdown(ctx context.Context) error {
+	if rp.cancel != nil {
+		rp.cancel()
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		pending []string
+	)
+	for _, repo := range rp.repositories() {
+		repo.abortLoop()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-repo.loopDone():
+			case <-ctx.Done():
+				mu.Lock()
+				pending = append(pending, repo.gitURL.Repo)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(pending) > 0 {
+		slices.Sort(pending)
+		return fmt.Errorf("%w repos:%s err:%w", ErrShutdownIncomplete, strings.Join(pending, ","), ctx.Err())
+	}
+	rp.log.Info("all repository mirror loops stopped")
+	return rp.audit.close(ctx)
+}
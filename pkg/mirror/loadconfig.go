@@ -0,0 +1,147 @@
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/giturl"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig reads RepoPoolConfig from the given YAML files. if path is a
+// directory all '*.yaml' and '*.yml' files directly in it are read in
+// lexical order, hidden files are ignored.
+//
+// every file is a fragment of the config and is decoded strictly so unknown
+// keys are rejected. repositories of all fragments are concatenated in the
+// order fragments are read. pool level settings (defaults, include, exclude
+// and allow_unmatched_patterns) are only allowed in one file. same remote
+// defined in more than one place is rejected with error naming both files.
+//
+// returned config is not validated, it should be passed to NewRepoPool.
+func LoadConfig(paths ...string) (RepoPoolConfig, error) {
+	var conf RepoPoolConfig
+
+	files, err := configFiles(paths)
+	if err != nil {
+		return conf, err
+	}
+	if len(files) == 0 {
+		return conf, fmt.Errorf("%w: no config files found in %s", ErrInvalidConfig, strings.Join(paths, ","))
+	}
+
+	type remote struct {
+		url  *giturl.URL
+		file string
+	}
+	var poolFile string
+	var remotes []remote
+
+	for _, file := range files {
+		frag, keys, err := readConfigFragment(file)
+		if err != nil {
+			return conf, err
+		}
+
+		if slices.ContainsFunc(keys, func(k string) bool { return k != "repositories" }) {
+			if poolFile != "" {
+				return conf, fmt.Errorf("%w: pool settings are defined in both %s and %s", ErrInvalidConfig, poolFile, file)
+			}
+			poolFile = file
+			conf.Defaults = frag.Defaults
+			conf.Include = frag.Include
+			conf.Exclude = frag.Exclude
+			conf.AllowUnmatchedPatterns = frag.AllowUnmatchedPatterns
+		}
+
+		for _, repo := range frag.Repositories {
+			// invalid remotes are reported by config validation
+			if gURL, err := giturl.Parse(repo.Remote); err == nil {
+				for _, r := range remotes {
+					if giturl.SameURL(r.url, gURL) {
+						return conf, fmt.Errorf("%w: remote %s is defined in both %s and %s", ErrExist, giturl.Redact(repo.Remote), r.file, file)
+					}
+				}
+				remotes = append(remotes, remote{gURL, file})
+			}
+			conf.Repositories = append(conf.Repositories, repo)
+		}
+	}
+
+	return conf, nil
+}
+
+// configFiles returns list of config files for the given paths, directories
+// are expanded to the YAML files in it
+func configFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config path err:%w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config dir err:%w", err)
+		}
+		// entries are sorted by filename
+		for _, e := range entries {
+			if isConfigFragment(e.Name()) && !e.IsDir() {
+				files = append(files, filepath.Join(p, e.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// isConfigFragment returns true if file with the given name in the config
+// dir should be read as config fragment
+func isConfigFragment(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// readConfigFragment decodes config file strictly and returns it along with
+// the top level keys set in the file
+func readConfigFragment(file string) (RepoPoolConfig, []string, error) {
+	var frag RepoPoolConfig
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return frag, nil, fmt.Errorf("unable to read config file err:%w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&frag); err != nil {
+		// empty file is valid fragment
+		if errors.Is(err, io.EOF) {
+			return frag, nil, nil
+		}
+		return frag, nil, fmt.Errorf("%w: unable to parse %s err:%w", ErrInvalidConfig, file, err)
+	}
+
+	var top map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &top); err != nil {
+		return frag, nil, fmt.Errorf("%w: unable to parse %s err:%w", ErrInvalidConfig, file, err)
+	}
+	keys := make([]string, 0, len(top))
+	for k := range top {
+		keys = append(keys, k)
+	}
+	return frag, keys, nil
+}
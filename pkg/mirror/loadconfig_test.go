@@ -0,0 +1,163 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadConfig(t *testing.T) {
+	writeFiles := func(t *testing.T, files map[string]string) string {
+		t.Helper()
+		dir := t.TempDir()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    RepoPoolConfig
+		wantErr error
+		// all these strings must be in the error message
+		wantErrMsg []string
+	}{
+		{
+			name: "merge fragments",
+			files: map[string]string{
+				"00-defaults.yaml": "defaults:\n  root: /tmp/root\n  interval: 30s\ninclude:\n  - https://github.com/org/*\n",
+				"team-a.yaml":      "repositories:\n  - remote: https://github.com/org/a1.git\n  - remote: https://github.com/org/a2.git\n",
+				"team-b.yml":       "repositories:\n  - remote: git@github.com:org/b1.git\n",
+				"empty.yaml":       "",
+				"readme.md":        "not a config",
+				".team-c.yaml.swp": "repositories: [",
+			},
+			want: RepoPoolConfig{
+				Defaults: DefaultConfig{Root: "/tmp/root", Interval: 30 * time.Second},
+				Include:  []string{"https://github.com/org/*"},
+				Repositories: []RepositoryConfig{
+					{Remote: "https://github.com/org/a1.git"},
+					{Remote: "https://github.com/org/a2.git"},
+					{Remote: "git@github.com:org/b1.git"},
+				},
+			},
+		},
+		{
+			name: "defaults in two files",
+			files: map[string]string{
+				"a.yaml": "defaults:\n  root: /tmp/root\n",
+				"b.yaml": "defaults:\n  interval: 30s\n",
+			},
+			wantErr:    ErrInvalidConfig,
+			wantErrMsg: []string{"a.yaml", "b.yaml"},
+		},
+		{
+			name: "pool settings in two files",
+			files: map[string]string{
+				"a.yaml": "defaults:\n  root: /tmp/root\n",
+				"b.yaml": "exclude:\n  - https://github.com/org/*\n",
+			},
+			wantErr:    ErrInvalidConfig,
+			wantErrMsg: []string{"a.yaml", "b.yaml"},
+		},
+		{
+			name: "duplicate remote across fragments",
+			files: map[string]string{
+				"a.yaml": "repositories:\n  - remote: https://github.com/org/repo.git\n",
+				"b.yaml": "repositories:\n  - remote: git@github.com:org/repo.git\n",
+			},
+			wantErr:    ErrExist,
+			wantErrMsg: []string{"a.yaml", "b.yaml"},
+		},
+		{
+			name: "duplicate remote in same fragment",
+			files: map[string]string{
+				"a.yaml": "repositories:\n  - remote: https://github.com/org/repo.git\n  - remote: https://github.com/org/repo\n",
+			},
+			wantErr:    ErrExist,
+			wantErrMsg: []string{"a.yaml"},
+		},
+		{
+			name: "unknown key in fragment",
+			files: map[string]string{
+				"a.yaml": "repositories:\n  - remote: https://github.com/org/a.git\n",
+				"b.yaml": "repositories:\n  - remote: https://github.com/org/b.git\n    intervall: 30s\n",
+			},
+			wantErr:    ErrInvalidConfig,
+			wantErrMsg: []string{"b.yaml", "intervall"},
+		},
+		{
+			name:       "no fragments",
+			files:      map[string]string{"readme.md": "not a config"},
+			wantErr:    ErrInvalidConfig,
+			wantErrMsg: []string{"no config files"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+
+			got, err := LoadConfig(dir)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				for _, msg := range tt.wantErrMsg {
+					if !strings.Contains(err.Error(), msg) {
+						t.Errorf("LoadConfig() error = %v, should contain %q", err, msg)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() unexpected error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("LoadConfig() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_files(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(main, []byte("defaults:\n  root: /tmp/root\nrepositories:\n  - remote: https://github.com/org/a.git\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fragDir := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(fragDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fragDir, "team.yaml"), []byte("repositories:\n  - remote: https://github.com/org/b.git\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadConfig(main, fragDir)
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error = %v", err)
+	}
+	want := RepoPoolConfig{
+		Defaults: DefaultConfig{Root: "/tmp/root"},
+		Repositories: []RepositoryConfig{
+			{Remote: "https://github.com/org/a.git"},
+			{Remote: "https://github.com/org/b.git"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LoadConfig() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := LoadConfig(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("LoadConfig() expected error for missing file")
+	}
+}
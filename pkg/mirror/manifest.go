@@ -0,0 +1,196 @@
+package mirror
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultManifestFile is the name of the manifest file created in the
+// default root if manifest path is not configured
+const defaultManifestFile = ".git-mirror-manifest.json"
+
+// Manifest lists all the worktree links published by the pool
+type Manifest struct {
+	// Links are sorted by link path
+	Links []ManifestLink `json:"links"`
+}
+
+// ManifestLink is the worktree link published by the pool
+type ManifestLink struct {
+	// Link is the absolute path of the published link
+	Link   string `json:"link"`
+	Remote string `json:"remote"`
+	// Ref is the ref of the published worktree, for links with ref pattern
+	// it is the matched tag
+	Ref      string `json:"ref"`
+	Pathspec string `json:"pathspec,omitempty"`
+	Hash     string `json:"hash"`
+	// Updated is the time the current worktree was published on the link
+	Updated time.Time `json:"updated"`
+	// Labels are the labels of the repository of the link
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// manifest keeps published links of all the repositories of the pool and
+// rewrites manifest file when they change. writes of all repositories are
+// serialised by the lock and file is replaced atomically so readers never
+// see partially written file.
+type manifest struct {
+	lock  sync.Mutex
+	path  string                    // abs path of the manifest file, empty if file is disabled
+	links map[string][]ManifestLink // published links keyed by remote
+	log   *slog.Logger
+}
+
+func newManifest(path string, log *slog.Logger) *manifest {
+	return &manifest{
+		path:  path,
+		links: make(map[string][]ManifestLink),
+		log:   log.With("manifest", path),
+	}
+}
+
+// update replaces published links of the remote, file is only rewritten
+// if links have changed
+func (m *manifest) update(remote string, links []ManifestLink) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if old, ok := m.links[remote]; ok && slices.EqualFunc(old, links, sameManifestLink) {
+		return
+	}
+	m.links[remote] = links
+	m.write()
+}
+
+// remove removes all published links of the remote
+func (m *manifest) remove(remote string) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.links[remote]; !ok {
+		return
+	}
+	delete(m.links, remote)
+	m.write()
+}
+
+// snapshot returns current manifest, caller must hold the lock
+func (m *manifest) snapshot() Manifest {
+	mf := Manifest{Links: []ManifestLink{}}
+	for _, remote := range slices.Sorted(maps.Keys(m.links)) {
+		mf.Links = append(mf.Links, m.links[remote]...)
+	}
+	slices.SortFunc(mf.Links, func(a, b ManifestLink) int { return strings.Compare(a.Link, b.Link) })
+	return mf
+}
+
+// write writes manifest to the temp file and renames it over the manifest
+// file, caller must hold the lock
+func (m *manifest) write() {
+	if m.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(m.snapshot(), "", "  ")
+	if err != nil {
+		m.log.Error("unable to encode manifest", "err", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), defaultDirMode); err != nil {
+		m.log.Error("unable to create manifest dir", "err", err)
+		return
+	}
+	if err := writeFileAtomic(m.path, append(data, '\n')); err != nil {
+		m.log.Error("unable to write manifest", "err", err)
+	}
+}
+
+func sameManifestLink(a, b ManifestLink) bool {
+	return a.Link == b.Link && a.Remote == b.Remote && a.Ref == b.Ref &&
+		a.Pathspec == b.Pathspec && a.Hash == b.Hash && a.Updated.Equal(b.Updated) &&
+		maps.Equal(a.Labels, b.Labels)
+}
+
+// Manifest returns all the worktree links currently published by the pool,
+// its the same content as written to the manifest file. links are recorded
+// after every mirror cycle so manifest is empty until repositories are
+// mirrored.
+func (rp *RepoPool) Manifest() Manifest {
+	if rp.manifest == nil {
+		return Manifest{Links: []ManifestLink{}}
+	}
+	rp.manifest.lock.Lock()
+	defer rp.manifest.lock.Unlock()
+
+	return rp.manifest.snapshot()
+}
+
+// setManifest sets the manifest of the pool
+func (r *Repository) setManifest(m *manifest) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.manifest = m
+}
+
+// updateManifest records currently published links of the repository in the
+// manifest of the pool. it must be called without repository lock held.
+func (r *Repository) updateManifest() {
+	r.lock.RLock()
+	m := r.manifest
+	if m == nil {
+		r.lock.RUnlock()
+		return
+	}
+	links := r.manifestLinks()
+	r.lock.RUnlock()
+
+	m.update(r.remote, links)
+}
+
+// manifestLinks returns published links of the repository sorted by link
+// path. it must be called with repository lock held.
+func (r *Repository) manifestLinks() []ManifestLink {
+	var links []ManifestLink
+	for _, wl := range r.workTreeLinks {
+		hash, err := wl.CurrentHash()
+		if err != nil {
+			wl.log.Error("unable to read current hash for manifest", "err", err)
+			continue
+		}
+		// not published yet
+		if hash == "" {
+			continue
+		}
+		ml := ManifestLink{
+			Link:     wl.link,
+			Remote:   r.remote,
+			Ref:      wl.ref,
+			Pathspec: wl.pathspec,
+			Hash:     hash,
+			Labels:   maps.Clone(r.labels),
+		}
+		if ref, err := wl.CurrentRef(); err == nil && ref != "" {
+			ml.Ref = ref
+		}
+		if t, err := wl.readHashFile("time"); err == nil && t != "" {
+			ml.Updated, _ = time.Parse(time.RFC3339, t)
+		}
+		links = append(links, ml)
+	}
+	slices.SortFunc(links, func(a, b ManifestLink) int { return strings.Compare(a.Link, b.Link) })
+	return links
+}
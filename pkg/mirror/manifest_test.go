@@ -0,0 +1,145 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func readManifestFile(t *testing.T, path string) Manifest {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read manifest err:%v", err)
+	}
+	var mf Manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		t.Fatalf("invalid manifest json err:%v content:%s", err, data)
+	}
+	return mf
+}
+
+func Test_manifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "manifest.json")
+	m := newManifest(path, testLog)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	linkA := ManifestLink{Link: "/root/a", Remote: "remote-a", Ref: "main", Hash: "aaa", Updated: now}
+	linkB := ManifestLink{Link: "/root/b", Remote: "remote-b", Ref: "main", Pathspec: "dir", Hash: "bbb", Updated: now}
+	linkC := ManifestLink{Link: "/root/c", Remote: "remote-a", Ref: "v1", Hash: "ccc", Updated: now}
+
+	m.update("remote-a", []ManifestLink{linkA, linkC})
+	m.update("remote-b", []ManifestLink{linkB})
+	want := Manifest{Links: []ManifestLink{linkA, linkB, linkC}}
+	if diff := cmp.Diff(want, readManifestFile(t, path)); diff != "" {
+		t.Errorf("manifest mismatch (-want +got):\n%s", diff)
+	}
+
+	// unchanged links should not re-write the file
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	m.update("remote-a", []ManifestLink{linkA, linkC})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("manifest should not be re-written err:%v", err)
+	}
+
+	linkA.Hash = "aaa2"
+	m.update("remote-a", []ManifestLink{linkA})
+	want = Manifest{Links: []ManifestLink{linkA, linkB}}
+	if diff := cmp.Diff(want, readManifestFile(t, path)); diff != "" {
+		t.Errorf("manifest mismatch (-want +got):\n%s", diff)
+	}
+
+	// updated repository labels should re-write the file
+	linkA.Labels = map[string]string{"team": "payments"}
+	m.update("remote-a", []ManifestLink{linkA})
+	want = Manifest{Links: []ManifestLink{linkA, linkB}}
+	if diff := cmp.Diff(want, readManifestFile(t, path)); diff != "" {
+		t.Errorf("manifest mismatch (-want +got):\n%s", diff)
+	}
+
+	m.remove("remote-b")
+	want = Manifest{Links: []ManifestLink{linkA}}
+	if diff := cmp.Diff(want, readManifestFile(t, path)); diff != "" {
+		t.Errorf("manifest mismatch (-want +got):\n%s", diff)
+	}
+
+	m.remove("remote-a")
+	want = Manifest{Links: []ManifestLink{}}
+	if diff := cmp.Diff(want, readManifestFile(t, path)); diff != "" {
+		t.Errorf("manifest mismatch (-want +got):\n%s", diff)
+	}
+
+	// temp files should not be left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("unexpected files in manifest dir: %v", entries)
+	}
+}
+
+func Test_manifest_concurrent_writes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	m := newManifest(path, testLog)
+	m.update("init", nil)
+
+	stop := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Errorf("unable to read manifest err:%v", err)
+				return
+			}
+			var mf Manifest
+			if err := json.Unmarshal(data, &mf); err != nil {
+				t.Errorf("reader saw invalid manifest err:%v", err)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for r := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			remote := fmt.Sprintf("remote-%d", r)
+			for i := range 50 {
+				var links []ManifestLink
+				for l := range 20 {
+					links = append(links, ManifestLink{
+						Link:   fmt.Sprintf("/root/%s/link-%d", remote, l),
+						Remote: remote,
+						Ref:    "main",
+						Hash:   fmt.Sprintf("%040d", i),
+					})
+				}
+				m.update(remote, links)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-readerDone
+
+	if got := len(readManifestFile(t, path).Links); got != 200 {
+		t.Errorf("unexpected number of links got:%d want:200", got)
+	}
+}
@@ -1,7 +1,10 @@
 package mirror
 
 import (
+	"maps"
+	"slices"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -9,89 +12,1092 @@ import (
 )
 
 var (
+	// mirrorMetricsLock protects mirror metrics which are re-created when
+	// metric label keys change, along with the label keys and values
+	mirrorMetricsLock sync.RWMutex
+	// enabledNamespace is the metrics namespace of EnableMetrics
+	enabledNamespace string
+	// metricLabelKeys are the keys of the repository labels added to the
+	// mirror metrics, see DefaultConfig.MetricLabels
+	metricLabelKeys []string
+	// repoMetricLabels are the labels of the repositories keyed by repo name
+	repoMetricLabels = make(map[string]map[string]string)
+
 	// lastMirrorTimestamp is a Gauge that captures the timestamp of the last
 	// successful git mirror
 	lastMirrorTimestamp *prometheus.GaugeVec
-	// mirrorCount is a Counter vector of git mirrors
-	mirrorCount *prometheus.CounterVec
+	// syncCount is a Counter vector of mirror cycles by result and failure
+	// reason
+	syncCount *prometheus.CounterVec
+	// syncSuccess is a Gauge vector that indicates if last mirror cycle
+	// was successful
+	syncSuccess *prometheus.GaugeVec
 	// mirrorLatency is a Histogram vector that keeps track of git repo mirror durations
 	mirrorLatency *prometheus.HistogramVec
+	// worktreePending is a Gauge vector that indicates if worktree link is
+	// waiting for the first commit on its pathspec
+	worktreePending *prometheus.GaugeVec
+	// layoutMigrationCount is a Counter vector of on-disk layout migrations
+	layoutMigrationCount *prometheus.CounterVec
+	// hashCacheCount is a Counter vector of Hash calls by cache result
+	hashCacheCount *prometheus.CounterVec
+	// mirrorSkippedCount is a Counter vector of mirror cycles which skipped
+	// remote fetch
+	mirrorSkippedCount *prometheus.CounterVec
+	// fetchRetryCount is a Counter vector of retried transient remote failures
+	fetchRetryCount *prometheus.CounterVec
+	// mirrorFailureCount is a Counter vector of failed mirror cycles
+	mirrorFailureCount *prometheus.CounterVec
+	// lastSuccessTimestamp is a Gauge that captures the timestamp of the last
+	// successful Mirror call
+	lastSuccessTimestamp *prometheus.GaugeVec
+	// worktreeUpdatedTimestamp is a Gauge that captures the timestamp of the
+	// last time worktree link was published on new worktree
+	worktreeUpdatedTimestamp *prometheus.GaugeVec
+	// worktreeUpdateFailures is a Counter vector of failed worktree updates
+	worktreeUpdateFailures *prometheus.CounterVec
+	// reinitCount is a Counter vector of mirrors re-initialised due to
+	// corrupted objects
+	reinitCount *prometheus.CounterVec
+	// replicaSyncFailures is a Counter vector of failed replica syncs
+	replicaSyncFailures *prometheus.CounterVec
+	// loopPanics is a Counter vector of recovered mirror loop panics
+	loopPanics *prometheus.CounterVec
+	// consecutiveFailures is a Gauge vector of consecutive failed mirror cycles
+	consecutiveFailures *prometheus.GaugeVec
+	// worktreeEmptyPathspec is a Gauge vector that indicates if worktree
+	// pathspec didn't match any file
+	worktreeEmptyPathspec *prometheus.GaugeVec
+	// worktreeBlocked is a Gauge vector that indicates if worktree update
+	// is blocked as new hash is not a descendant of the published one
+	worktreeBlocked *prometheus.GaugeVec
+	// worktreeRefAmbiguous is a Gauge vector that indicates if short ref
+	// name of the worktree matches both branch and tag
+	worktreeRefAmbiguous *prometheus.GaugeVec
+	// worktreeState is a Gauge vector that indicates health state of the
+	// worktree link, current state is set to 1 and the others to 0
+	worktreeState *prometheus.GaugeVec
+	// repoDiskBytes is a Gauge vector of disk space used by the repository
+	repoDiskBytes *prometheus.GaugeVec
+	// diskQuotaExceeded is a Gauge vector that indicates if repository is
+	// over its disk quota
+	diskQuotaExceeded *prometheus.GaugeVec
+	// gcLatency is a Histogram vector that keeps track of git gc durations
+	gcLatency *prometheus.HistogramVec
+	// lastGCTimestamp is a Gauge that captures the timestamp of the last gc run
+	lastGCTimestamp *prometheus.GaugeVec
+	// nextRunTimestamp is a Gauge that captures the timestamp of the next
+	// scheduled mirror cycle
+	nextRunTimestamp *prometheus.GaugeVec
+	// repoPaused is a Gauge vector that indicates if repository is paused
+	repoPaused *prometheus.GaugeVec
+	// degradedInit is a Gauge vector that indicates if repository was
+	// initialised with fallback HEAD as remote was unreachable
+	degradedInit *prometheus.GaugeVec
+	// autoWorktrees is a Gauge vector of worktree links maintained by the
+	// auto worktree rules of the repository
+	autoWorktrees *prometheus.GaugeVec
+	// auditDropped is a Counter of audit events dropped as audit log buffer
+	// was full
+	auditDropped prometheus.Counter
+	// auditWriteErrors is a Counter of audit events which couldn't be
+	// written to the audit log
+	auditWriteErrors prometheus.Counter
+	// eventsDropped is a Counter of pool events dropped as subscriber
+	// wasn't ready to receive them
+	eventsDropped prometheus.Counter
+	// gitOpsCount is a Gauge vector of running git commands and commands waiting
+	// for git ops limiter
+	gitOpsCount *prometheus.GaugeVec
+)
+
+const (
+	// skipOutsideFetchWindow indicates fetch was skipped as mirror cycle
+	// was run outside of the configured fetch window
+	skipOutsideFetchWindow = "outside-fetch-window"
+	// skipRemoteUnchanged indicates fetch was skipped as refs on the remote
+	// haven't changed since last fetch
+	skipRemoteUnchanged = "remote-unchanged"
+	// skipPaused indicates fetch was skipped as repository is paused
+	skipPaused = "paused"
+)
+
+const (
+	// syncSucceeded is the result of the successful mirror cycle
+	syncSucceeded = "success"
+	// syncFailure is the result of the failed mirror cycle
+	syncFailure = "failure"
+)
+
+const (
+	// hashCacheHit is the result of the Hash call served from the cache
+	hashCacheHit = "hit"
+	// hashCacheMiss is the result of the Hash call which ran git command
+	hashCacheMiss = "miss"
+)
+
+const (
+	// gitOpsRunning is the state of the running git commands
+	gitOpsRunning = "running"
+	// gitOpsQueued is the state of the git commands waiting for a free slot
+	gitOpsQueued = "queued"
 )
 
 // EnableMetrics will enable metrics collection for git mirrors.
+// Metrics of the mirror cycles (git_last_mirror_timestamp, git_mirror_sync_total,
+// git_mirror_sync_success, git_mirror_latency_seconds, git_mirror_failure_count,
+// git_mirror_last_success_timestamp_seconds and git_mirror_consecutive_failures)
+// are also tagged with the repository labels listed in defaults.metric_labels.
 // Available metrics are...
 //   - git_last_mirror_timestamp - (tags: repo)
 //     A Gauge that captures the Timestamp of the last successful git sync per repo.
-//   - git_mirror_count - (tags: repo,success)
-//     A Counter for each repo sync, incremented with each sync attempt and tagged with the result (success=true|false)
+//   - git_mirror_sync_total - (tags: repo,result,reason)
+//     A Counter for each repo sync, incremented with each sync attempt and tagged with the result (result=success|failure)
+//     and the reason of the failure (reason=init|fetch|worktree|cleanup|timeout), reason is empty on success.
+//   - git_mirror_sync_success - (tags: repo)
+//     A Gauge set to 1 if the last repo sync was successful and 0 if it failed.
 //   - git_mirror_latency_seconds - (tags: repo)
 //     A Summary that keeps track of the git sync latency per repo.
+//   - git_worktree_pending - (tags: repo,link)
+//     A Gauge set to 1 if worktree ref resolves but no commit found for its pathspec yet.
+//   - git_layout_migration_count - (tags: repo,success)
+//     A Counter for each on-disk layout migration step tagged with the result (success=true|false)
+//   - git_mirror_skipped_count - (tags: repo,reason)
+//     A Counter for each mirror cycle which skipped remote fetch, tagged with the reason (reason=outside-fetch-window|remote-unchanged)
+//   - git_mirror_fetch_retries_total - (tags: repo,op)
+//     A Counter for each retry of the remote operation (op=fetch|ls-remote) after transient network or timeout error.
+//   - git_mirror_hash_cache_total - (tags: repo,result)
+//     A Counter for each Hash call of the repository with hash cache enabled, tagged with the result (result=hit|miss).
+//   - git_mirror_failure_count - (tags: repo,phase,class)
+//     A Counter for each failed mirror cycle, tagged with the failed phase (phase=init|fetch|worktree|cleanup)
+//     and the error class (class=auth|ref-not-found|network|corrupt|timeout|other)
+//   - git_mirror_last_success_timestamp_seconds - (tags: repo)
+//     A Gauge that captures the Timestamp of the last successful Mirror call per repo.
+//   - git_mirror_worktree_updated_timestamp_seconds - (tags: repo,link)
+//     A Gauge that captures the Timestamp of the last time worktree link was published on new worktree.
+//   - git_mirror_worktree_update_failures_total - (tags: repo,link)
+//     A Counter for each failed attempt to ensure worktree link.
+//   - git_mirror_reinit_total - (tags: repo)
+//     A Counter for each re-initialisation of the mirror due to corrupted objects.
+//   - git_mirror_replica_sync_failures_total - (tags: repo,replica)
+//     A Counter for each failed attempt to sync published worktrees to the replica root.
+//   - git_mirror_loop_panics_total - (tags: repo)
+//     A Counter for each panic recovered in the mirror loop, loop is restarted with backoff.
+//   - git_mirror_consecutive_failures - (tags: repo)
+//     A Gauge that captures the number of consecutive failed mirror cycles, reset on success.
+//   - git_mirror_worktree_empty_pathspec - (tags: repo,link)
+//     A Gauge set to 1 if worktree pathspec didn't match any file on the checked out commit.
+//   - git_mirror_worktree_blocked - (tags: repo,link)
+//     A Gauge set to 1 if worktree update is blocked as new hash is not a descendant of the published one (force-push).
+//   - git_mirror_worktree_ref_ambiguous - (tags: repo,link)
+//     A Gauge set to 1 if short ref name of the worktree matches both branch and tag.
+//   - git_mirror_worktree_state - (tags: repo,link,state)
+//     A Gauge set to 1 for the current health state of the worktree link (state=never-synced|stale|healthy) and 0 for the others.
+//   - git_mirror_repo_disk_bytes - (tags: repo,kind)
+//     A Gauge that captures disk space used by the bare repo (kind=repo) and its worktrees (kind=worktrees).
+//   - git_mirror_disk_quota_exceeded - (tags: repo)
+//     A Gauge set to 1 if repository disk usage is over its quota even after aggressive gc.
+//   - git_mirror_gc_duration_seconds - (tags: repo)
+//     A Histogram that keeps track of the git gc duration per repo.
+//   - git_mirror_gc_last_run_timestamp_seconds - (tags: repo)
+//     A Gauge that captures the Timestamp of the last git gc run per repo.
+//   - git_mirror_next_run_timestamp_seconds - (tags: repo)
+//     A Gauge that captures the Timestamp of the next scheduled mirror cycle per repo.
+//   - git_mirror_paused - (tags: repo)
+//     A Gauge set to 1 if repository is paused and remote is not fetched.
+//   - git_mirror_degraded_init - (tags: repo)
+//     A Gauge set to 1 if repository was initialised with fallback HEAD as remote default branch couldn't be resolved.
+//   - git_mirror_auto_worktrees - (tags: repo)
+//     A Gauge that captures the number of worktree links maintained by the auto worktree rules of the repository.
+//   - git_mirror_git_ops - (tags: state)
+//     A Gauge that captures the number of git commands running (state=running) or waiting for a free slot (state=queued).
+//   - git_mirror_audit_dropped_total
+//     A Counter for each audit event dropped as audit log writes couldn't keep up.
+//   - git_mirror_audit_write_errors_total
+//     A Counter for each audit event which couldn't be written to the audit log.
+//   - git_mirror_events_dropped_total
+//     A Counter for each pool event dropped as events consumer couldn't keep up.
 func EnableMetrics(metricsNamespace string, registerer prometheus.Registerer) {
-	lastMirrorTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	mirrorMetricsLock.Lock()
+	enabledNamespace = metricsNamespace
+	newMirrorMetrics(metricsNamespace, metricLabelKeys)
+	mirrorMetricsLock.Unlock()
+	prometheus.MustRegister(mirrorCollector{})
+	registerer.MustRegister(mirrorCollector{})
+	worktreePending = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: metricsNamespace,
-		Name:      "git_last_mirror_timestamp",
-		Help:      "Timestamp of the last successful git mirror",
+		Name:      "git_worktree_pending",
+		Help:      "Whether worktree is waiting for first commit on its pathspec",
 	},
 		[]string{
 			// name of the repository
 			"repo",
+			// absolute path of the worktree link
+			"link",
 		},
 	)
 
-	mirrorCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	layoutMigrationCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: metricsNamespace,
-		Name:      "git_mirror_count",
-		Help:      "Count of git mirror operations",
+		Name:      "git_layout_migration_count",
+		Help:      "Count of on-disk layout migrations",
 	},
 		[]string{
 			// name of the repository
 			"repo",
-			// Whether the apply was successful or not
+			// Whether the migration was successful or not
 			"success",
 		},
 	)
 
-	mirrorLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	fetchRetryCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: metricsNamespace,
-		Name:      "git_mirror_latency_seconds",
-		Help:      "Latency for git repo mirror",
-		Buckets:   []float64{0.5, 1, 5, 10, 20, 30, 60, 90, 120, 150, 300},
+		Name:      "git_mirror_fetch_retries_total",
+		Help:      "Count of remote operations retried after transient failure",
 	},
 		[]string{
 			// name of the repository
 			"repo",
+			// retried remote operation
+			"op",
 		},
 	)
 
+	hashCacheCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_hash_cache_total",
+		Help:      "Count of Hash calls by cache result",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// hit or miss
+			"result",
+		},
+	)
+
+	mirrorSkippedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_skipped_count",
+		Help:      "Count of git mirror cycles which skipped remote fetch",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// reason why fetch was skipped
+			"reason",
+		},
+	)
+
+	worktreeUpdatedTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_worktree_updated_timestamp_seconds",
+		Help:      "Timestamp of the last worktree link update",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// absolute path of the worktree link
+			"link",
+		},
+	)
+
+	worktreeUpdateFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_worktree_update_failures_total",
+		Help:      "Count of failed worktree link updates",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// absolute path of the worktree link
+			"link",
+		},
+	)
+
+	reinitCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_reinit_total",
+		Help:      "Count of mirror re-initialisations due to corrupted objects",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+		},
+	)
+
+	replicaSyncFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_replica_sync_failures_total",
+		Help:      "Count of failed replica syncs",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// replica root path
+			"replica",
+		},
+	)
+
+	loopPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_loop_panics_total",
+		Help:      "Count of panics recovered in the mirror loop",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+		},
+	)
+
+	worktreeEmptyPathspec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_worktree_empty_pathspec",
+		Help:      "Whether worktree pathspec didn't match any file",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// absolute path of the worktree link
+			"link",
+		},
+	)
+
+	worktreeBlocked = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_worktree_blocked",
+		Help:      "Whether worktree update is blocked waiting for approval of force-push",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// absolute path of the worktree link
+			"link",
+		},
+	)
+
+	worktreeRefAmbiguous = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_worktree_ref_ambiguous",
+		Help:      "Whether short ref name of the worktree matches both branch and tag",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// absolute path of the worktree link
+			"link",
+		},
+	)
+
+	worktreeState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_worktree_state",
+		Help:      "Health state of the worktree link",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// absolute path of the worktree link
+			"link",
+			// health state of the link
+			"state",
+		},
+	)
+
+	repoDiskBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_repo_disk_bytes",
+		Help:      "Disk space used by the repository",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+			// bare repo or worktrees
+			"kind",
+		},
+	)
+
+	diskQuotaExceeded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_disk_quota_exceeded",
+		Help:      "Whether repository disk usage is over its quota",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+		},
+	)
+
+	gcLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_gc_duration_seconds",
+		Help:      "Duration of git gc runs",
+		Buckets:   []float64{0.5, 1, 5, 10, 30, 60, 120, 300, 600, 1200},
+	},
+		[]string{
+			// name of the repository
+			"repo",
+		},
+	)
+
+	lastGCTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_gc_last_run_timestamp_seconds",
+		Help:      "Timestamp of the last git gc run",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+		},
+	)
+
+	nextRunTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_next_run_timestamp_seconds",
+		Help:      "Timestamp of the next scheduled mirror cycle",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+		},
+	)
+
+	repoPaused = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_paused",
+		Help:      "Whether repository is paused and remote is not fetched",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+		},
+	)
+
+	degradedInit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_degraded_init",
+		Help:      "Whether repository was initialised with fallback HEAD as remote default branch couldn't be resolved",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+		},
+	)
+
+	autoWorktrees = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_auto_worktrees",
+		Help:      "Number of worktree links maintained by the auto worktree rules",
+	},
+		[]string{
+			// name of the repository
+			"repo",
+		},
+	)
+
+	gitOpsCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_git_ops",
+		Help:      "Number of running and queued git commands",
+	},
+		[]string{
+			// running or queued
+			"state",
+		},
+	)
+
+	auditDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_audit_dropped_total",
+		Help:      "Count of audit events dropped as audit log buffer was full",
+	})
+
+	auditWriteErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_audit_write_errors_total",
+		Help:      "Count of audit events which couldn't be written to the audit log",
+	})
+
+	eventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_events_dropped_total",
+		Help:      "Count of pool events dropped as subscriber wasn't ready to receive them",
+	})
+
 	registerer.MustRegister(
-		lastMirrorTimestamp,
-		mirrorCount,
-		mirrorLatency,
+		worktreePending,
+		layoutMigrationCount,
+		mirrorSkippedCount,
+		fetchRetryCount,
+		hashCacheCount,
+		worktreeUpdatedTimestamp,
+		worktreeUpdateFailures,
+		reinitCount,
+		replicaSyncFailures,
+		loopPanics,
+		worktreeEmptyPathspec,
+		worktreeBlocked,
+		worktreeRefAmbiguous,
+		worktreeState,
+		repoDiskBytes,
+		diskQuotaExceeded,
+		gcLatency,
+		lastGCTimestamp,
+		nextRunTimestamp,
+		repoPaused,
+		degradedInit,
+		autoWorktrees,
+		gitOpsCount,
+		auditDropped,
+		auditWriteErrors,
+		eventsDropped,
+	)
+}
+
+// newMirrorMetrics creates metrics of the mirror cycles which are labeled
+// with the given repository label keys in addition to their own labels.
+// it must be called with mirror metrics lock held.
+func newMirrorMetrics(metricsNamespace string, labelKeys []string) {
+	lastMirrorTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_last_mirror_timestamp",
+		Help:      "Timestamp of the last successful git mirror",
+	},
+		slices.Concat([]string{
+			// name of the repository
+			"repo",
+		}, labelKeys),
+	)
+
+	syncCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_sync_total",
+		Help:      "Count of mirror cycles by result and failure reason",
+	},
+		slices.Concat([]string{
+			// name of the repository
+			"repo",
+			// success or failure
+			"result",
+			// failed phase or timeout, empty on success
+			"reason",
+		}, labelKeys),
+	)
+
+	syncSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_sync_success",
+		Help:      "Whether last mirror cycle was successful",
+	},
+		slices.Concat([]string{
+			// name of the repository
+			"repo",
+		}, labelKeys),
+	)
+
+	mirrorLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_latency_seconds",
+		Help:      "Latency for git repo mirror",
+		Buckets:   []float64{0.5, 1, 5, 10, 20, 30, 60, 90, 120, 150, 300},
+	},
+		slices.Concat([]string{
+			// name of the repository
+			"repo",
+		}, labelKeys),
+	)
+
+	mirrorFailureCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_failure_count",
+		Help:      "Count of failed git mirror cycles",
+	},
+		slices.Concat([]string{
+			// name of the repository
+			"repo",
+			// phase of the mirror cycle which failed
+			"phase",
+			// class of the error which caused the failure
+			"class",
+		}, labelKeys),
+	)
+
+	lastSuccessTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_last_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful mirror",
+	},
+		slices.Concat([]string{
+			// name of the repository
+			"repo",
+		}, labelKeys),
 	)
+
+	consecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "git_mirror_consecutive_failures",
+		Help:      "Number of consecutive failed mirror cycles",
+	},
+		slices.Concat([]string{
+			// name of the repository
+			"repo",
+		}, labelKeys),
+	)
+
+}
+
+// mirrorCollector collects metrics of the mirror cycles. metrics are
+// re-created when metric label keys change and registry doesn't allow
+// re-registering metric with different labels, hence its registered as
+// unchecked collector which doesn't describe its metrics.
+type mirrorCollector struct{}
+
+func (mirrorCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (mirrorCollector) Collect(ch chan<- prometheus.Metric) {
+	mirrorMetricsLock.RLock()
+	defer mirrorMetricsLock.RUnlock()
+
+	for _, c := range []prometheus.Collector{lastMirrorTimestamp, syncCount, syncSuccess, mirrorLatency, mirrorFailureCount, lastSuccessTimestamp, consecutiveFailures} {
+		c.Collect(ch)
+	}
+}
+
+// setMetricLabelKeys sets keys of the repository labels added to the mirror
+// metrics. if metrics are already enabled mirror metrics are re-created with
+// the new labels and their current values are lost.
+func setMetricLabelKeys(keys []string) {
+	mirrorMetricsLock.Lock()
+	defer mirrorMetricsLock.Unlock()
+
+	if slices.Equal(keys, metricLabelKeys) {
+		return
+	}
+	metricLabelKeys = slices.Clone(keys)
+
+	// if metrics not enabled return
+	if lastMirrorTimestamp == nil {
+		return
+	}
+	newMirrorMetrics(enabledNamespace, metricLabelKeys)
+}
+
+// setRepoMetricLabels sets labels of the repository added to its mirror
+// metrics, existing series are removed if values of the metric labels change
+func setRepoMetricLabels(repo string, labels map[string]string) {
+	mirrorMetricsLock.Lock()
+	defer mirrorMetricsLock.Unlock()
+
+	old := repoMetricLabels[repo]
+	repoMetricLabels[repo] = maps.Clone(labels)
+	for _, key := range metricLabelKeys {
+		if old[key] != labels[key] {
+			deleteMirrorMetrics(repo)
+			return
+		}
+	}
+}
+
+// mirrorLabels returns given labels of the mirror metric of the repository
+// along with its metric labels. it must be called with mirror metrics lock held.
+func mirrorLabels(repo string, labels prometheus.Labels) prometheus.Labels {
+	labels["repo"] = repo
+	for _, key := range metricLabelKeys {
+		labels[key] = repoMetricLabels[repo][key]
+	}
+	return labels
 }
 
 // recordGitMirror records a repository mirror attempt by updating all the
-// relevant metrics
-func recordGitMirror(repo string, success bool) {
+// relevant metrics, failures are labeled with the reason of the given error
+func recordGitMirror(repo string, err error) {
+	mirrorMetricsLock.RLock()
+	defer mirrorMetricsLock.RUnlock()
+
 	// if metrics not enabled return
-	if lastMirrorTimestamp == nil || mirrorCount == nil {
+	if lastMirrorTimestamp == nil || syncCount == nil || syncSuccess == nil {
 		return
 	}
-	if success {
-		lastMirrorTimestamp.With(prometheus.Labels{
-			"repo": repo,
-		}).Set(float64(time.Now().Unix()))
+	if err != nil {
+		syncCount.With(mirrorLabels(repo, prometheus.Labels{
+			"result": syncFailure,
+			"reason": failureReason(err),
+		})).Inc()
+		syncSuccess.With(mirrorLabels(repo, prometheus.Labels{})).Set(0)
+		return
 	}
-	mirrorCount.With(prometheus.Labels{
+	lastMirrorTimestamp.With(mirrorLabels(repo, prometheus.Labels{})).Set(float64(time.Now().Unix()))
+	syncCount.With(mirrorLabels(repo, prometheus.Labels{
+		"result": syncSucceeded,
+		"reason": "",
+	})).Inc()
+	syncSuccess.With(mirrorLabels(repo, prometheus.Labels{})).Set(1)
+}
+
+func updateMirrorLatency(repo string, start time.Time) {
+	mirrorMetricsLock.RLock()
+	defer mirrorMetricsLock.RUnlock()
+
+	// if metrics not enabled return
+	if mirrorLatency == nil {
+		return
+	}
+	mirrorLatency.With(mirrorLabels(repo, prometheus.Labels{})).Observe(time.Since(start).Seconds())
+}
+
+func recordWorktreePending(repo, link string, pending bool) {
+	// if metrics not enabled return
+	if worktreePending == nil {
+		return
+	}
+	var v float64
+	if pending {
+		v = 1
+	}
+	worktreePending.WithLabelValues(repo, link).Set(v)
+}
+
+func recordLayoutMigration(repo string, success bool) {
+	// if metrics not enabled return
+	if layoutMigrationCount == nil {
+		return
+	}
+	layoutMigrationCount.With(prometheus.Labels{
 		"repo":    repo,
 		"success": strconv.FormatBool(success),
 	}).Inc()
 }
 
-func updateMirrorLatency(repo string, start time.Time) {
+func recordMirrorSkipped(repo, reason string) {
 	// if metrics not enabled return
-	if mirrorLatency == nil {
+	if mirrorSkippedCount == nil {
+		return
+	}
+	mirrorSkippedCount.WithLabelValues(repo, reason).Inc()
+}
+
+// recordFetchRetries records number of retries of the remote operation
+func recordFetchRetries(repo, op string, retries int) {
+	// if metrics not enabled return
+	if fetchRetryCount == nil || retries <= 0 {
+		return
+	}
+	fetchRetryCount.WithLabelValues(repo, op).Add(float64(retries))
+}
+
+// recordHashCache records result of the hash cache lookup
+func recordHashCache(repo, result string) {
+	// if metrics not enabled return
+	if hashCacheCount == nil {
+		return
+	}
+	hashCacheCount.WithLabelValues(repo, result).Inc()
+}
+
+// recordMirrorFailure records failed mirror cycle with the failed phase and
+// the class of the error
+func recordMirrorFailure(repo string, phase MirrorPhase, class ErrorClass) {
+	mirrorMetricsLock.RLock()
+	defer mirrorMetricsLock.RUnlock()
+
+	// if metrics not enabled return
+	if mirrorFailureCount == nil {
+		return
+	}
+	mirrorFailureCount.With(mirrorLabels(repo, prometheus.Labels{
+		"phase": string(phase),
+		"class": string(class),
+	})).Inc()
+}
+
+// recordMirrorSuccess records timestamp of the successful mirror
+func recordMirrorSuccess(repo string) {
+	mirrorMetricsLock.RLock()
+	defer mirrorMetricsLock.RUnlock()
+
+	// if metrics not enabled return
+	if lastSuccessTimestamp == nil {
+		return
+	}
+	lastSuccessTimestamp.With(mirrorLabels(repo, prometheus.Labels{})).Set(float64(time.Now().Unix()))
+}
+
+// recordWorktreeUpdate records timestamp of the worktree link update
+func recordWorktreeUpdate(repo, link string) {
+	// if metrics not enabled return
+	if worktreeUpdatedTimestamp == nil {
+		return
+	}
+	worktreeUpdatedTimestamp.WithLabelValues(repo, link).Set(float64(time.Now().Unix()))
+}
+
+// recordWorktreeUpdateFailure records failed attempt to ensure worktree link
+func recordWorktreeUpdateFailure(repo, link string) {
+	// if metrics not enabled return
+	if worktreeUpdateFailures == nil {
+		return
+	}
+	worktreeUpdateFailures.WithLabelValues(repo, link).Inc()
+}
+
+// recordReinit records re-initialisation of the mirror
+func recordReinit(repo string) {
+	// if metrics not enabled return
+	if reinitCount == nil {
+		return
+	}
+	reinitCount.WithLabelValues(repo).Inc()
+}
+
+// recordReplicaSyncFailure records failed attempt to sync replica root
+func recordReplicaSyncFailure(repo, replica string) {
+	// if metrics not enabled return
+	if replicaSyncFailures == nil {
 		return
 	}
-	mirrorLatency.WithLabelValues(repo).Observe(time.Since(start).Seconds())
+	replicaSyncFailures.WithLabelValues(repo, replica).Inc()
+}
+
+// recordLoopPanic records panic recovered in the mirror loop
+func recordLoopPanic(repo string) {
+	// if metrics not enabled return
+	if loopPanics == nil {
+		return
+	}
+	loopPanics.WithLabelValues(repo).Inc()
+}
+
+// recordConsecutiveFailures records number of consecutive failed mirror cycles
+func recordConsecutiveFailures(repo string, failures int) {
+	mirrorMetricsLock.RLock()
+	defer mirrorMetricsLock.RUnlock()
+
+	// if metrics not enabled return
+	if consecutiveFailures == nil {
+		return
+	}
+	consecutiveFailures.With(mirrorLabels(repo, prometheus.Labels{})).Set(float64(failures))
+}
+
+// recordWorktreeEmptyPathspec records if worktree pathspec didn't match any file
+func recordWorktreeEmptyPathspec(repo, link string, empty bool) {
+	// if metrics not enabled return
+	if worktreeEmptyPathspec == nil {
+		return
+	}
+	var v float64
+	if empty {
+		v = 1
+	}
+	worktreeEmptyPathspec.WithLabelValues(repo, link).Set(v)
+}
+
+// recordWorktreeBlocked records if worktree update is blocked
+func recordWorktreeBlocked(repo, link string, blocked bool) {
+	// if metrics not enabled return
+	if worktreeBlocked == nil {
+		return
+	}
+	var v float64
+	if blocked {
+		v = 1
+	}
+	worktreeBlocked.WithLabelValues(repo, link).Set(v)
+}
+
+// recordWorktreeRefAmbiguous records if short ref name of the worktree is
+// ambiguous
+func recordWorktreeRefAmbiguous(repo, link string, ambiguous bool) {
+	// if metrics not enabled return
+	if worktreeRefAmbiguous == nil {
+		return
+	}
+	var v float64
+	if ambiguous {
+		v = 1
+	}
+	worktreeRefAmbiguous.WithLabelValues(repo, link).Set(v)
+}
+
+// recordWorktreeState sets gauge of the given state of the worktree link
+// to 1 and the other states to 0
+func recordWorktreeState(repo, link string, state LinkState) {
+	// if metrics not enabled return
+	if worktreeState == nil {
+		return
+	}
+	for _, s := range []LinkState{LinkStateNeverSynced, LinkStateStale, LinkStateHealthy} {
+		var v float64
+		if s == state {
+			v = 1
+		}
+		worktreeState.WithLabelValues(repo, link, string(s)).Set(v)
+	}
+}
+
+// recordDiskUsage records disk usage of the repository and its quota state
+func recordDiskUsage(repo string, usage RepoDiskUsage, overQuota bool) {
+	// if metrics not enabled return
+	if repoDiskBytes == nil || diskQuotaExceeded == nil {
+		return
+	}
+	repoDiskBytes.WithLabelValues(repo, "repo").Set(float64(usage.RepoBytes))
+	repoDiskBytes.WithLabelValues(repo, "worktrees").Set(float64(usage.WorktreesBytes))
+	var v float64
+	if overQuota {
+		v = 1
+	}
+	diskQuotaExceeded.WithLabelValues(repo).Set(v)
+}
+
+// recordGC records duration and timestamp of the gc run
+func recordGC(repo string, start time.Time) {
+	// if metrics not enabled return
+	if gcLatency == nil || lastGCTimestamp == nil {
+		return
+	}
+	gcLatency.WithLabelValues(repo).Observe(time.Since(start).Seconds())
+	lastGCTimestamp.WithLabelValues(repo).Set(float64(start.Unix()))
+}
+
+// recordNextRun records timestamp of the next scheduled mirror cycle
+func recordNextRun(repo string, next time.Time) {
+	// if metrics not enabled return
+	if nextRunTimestamp == nil {
+		return
+	}
+	nextRunTimestamp.WithLabelValues(repo).Set(float64(next.Unix()))
+}
+
+// recordPaused records if repository is paused
+func recordPaused(repo string, paused bool) {
+	// if metrics not enabled return
+	if repoPaused == nil {
+		return
+	}
+	var v float64
+	if paused {
+		v = 1
+	}
+	repoPaused.WithLabelValues(repo).Set(v)
+}
+
+// recordDegradedInit records if repository is running with fallback HEAD
+func recordDegradedInit(repo string, degraded bool) {
+	// if metrics not enabled return
+	if degradedInit == nil {
+		return
+	}
+	var v float64
+	if degraded {
+		v = 1
+	}
+	degradedInit.WithLabelValues(repo).Set(v)
+}
+
+// recordAutoWorktrees records number of worktree links maintained by the
+// auto worktree rules of the repository
+func recordAutoWorktrees(repo string, count int) {
+	// if metrics not enabled return
+	if autoWorktrees == nil {
+		return
+	}
+	autoWorktrees.WithLabelValues(repo).Set(float64(count))
+}
+
+// recordGitOps adds delta to the number of git commands in the given state
+func recordGitOps(state string, delta float64) {
+	// if metrics not enabled return
+	if gitOpsCount == nil {
+		return
+	}
+	gitOpsCount.WithLabelValues(state).Add(delta)
+}
+
+// recordAuditDropped records audit event dropped due to full buffer
+func recordAuditDropped() {
+	// if metrics not enabled return
+	if auditDropped == nil {
+		return
+	}
+	auditDropped.Inc()
+}
+
+// recordAuditWriteError records audit event which couldn't be written
+func recordAuditWriteError() {
+	// if metrics not enabled return
+	if auditWriteErrors == nil {
+		return
+	}
+	auditWriteErrors.Inc()
+}
+
+// recordEventDropped records pool event dropped due to full buffer
+func recordEventDropped() {
+	// if metrics not enabled return
+	if eventsDropped == nil {
+		return
+	}
+	eventsDropped.Inc()
+}
+
+// deleteMetrics removes all the metrics of the given repository
+// so series are not leaked once repository is removed
+func deleteMetrics(repo string) {
+	mirrorMetricsLock.Lock()
+	deleteMirrorMetrics(repo)
+	delete(repoMetricLabels, repo)
+	mirrorMetricsLock.Unlock()
+
+	labels := prometheus.Labels{"repo": repo}
+	for _, gv := range []*prometheus.GaugeVec{worktreePending, worktreeUpdatedTimestamp, worktreeEmptyPathspec, worktreeBlocked, worktreeRefAmbiguous, worktreeState, repoDiskBytes, diskQuotaExceeded, lastGCTimestamp, nextRunTimestamp, repoPaused, degradedInit, autoWorktrees} {
+		if gv != nil {
+			gv.DeletePartialMatch(labels)
+		}
+	}
+	for _, cv := range []*prometheus.CounterVec{layoutMigrationCount, mirrorSkippedCount, fetchRetryCount, hashCacheCount, worktreeUpdateFailures, reinitCount, replicaSyncFailures, loopPanics} {
+		if cv != nil {
+			cv.DeletePartialMatch(labels)
+		}
+	}
+	for _, hv := range []*prometheus.HistogramVec{gcLatency} {
+		if hv != nil {
+			hv.DeletePartialMatch(labels)
+		}
+	}
+}
+
+// deleteMirrorMetrics removes mirror metrics of the repository.
+// it must be called with mirror metrics lock held.
+func deleteMirrorMetrics(repo string) {
+	labels := prometheus.Labels{"repo": repo}
+	for _, gv := range []*prometheus.GaugeVec{lastMirrorTimestamp, syncSuccess, lastSuccessTimestamp, consecutiveFailures} {
+		if gv != nil {
+			gv.DeletePartialMatch(labels)
+		}
+	}
+	for _, cv := range []*prometheus.CounterVec{syncCount, mirrorFailureCount} {
+		if cv != nil {
+			cv.DeletePartialMatch(labels)
+		}
+	}
+	if mirrorLatency != nil {
+		mirrorLatency.DeletePartialMatch(labels)
+	}
+}
+
+// deleteWorktreeMetrics removes all the metrics of the given worktree link
+func deleteWorktreeMetrics(repo, link string) {
+	labels := prometheus.Labels{"repo": repo, "link": link}
+	for _, gv := range []*prometheus.GaugeVec{worktreePending, worktreeUpdatedTimestamp, worktreeEmptyPathspec, worktreeBlocked, worktreeRefAmbiguous} {
+		if gv != nil {
+			gv.Delete(labels)
+		}
+	}
+	if worktreeUpdateFailures != nil {
+		worktreeUpdateFailures.Delete(labels)
+	}
+	if worktreeState != nil {
+		worktreeState.DeletePartialMatch(labels)
+	}
 }
@@ -0,0 +1,207 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var enableMetricsOnce sync.Once
+
+// enableTestMetrics enables metrics once for the test binary as metrics are
+// also registered with the default registerer
+func enableTestMetrics(t *testing.T) {
+	t.Helper()
+	enableMetricsOnce.Do(func() { EnableMetrics("test", prometheus.NewRegistry()) })
+}
+
+func Test_recordGitMirror(t *testing.T) {
+	enableTestMetrics(t)
+	repo := "metrics-test-repo"
+	deleteMetrics(repo)
+	defer deleteMetrics(repo)
+
+	gitTimeout := &GitError{Args: []string{"fetch"}, ExitCode: -1, Err: context.DeadlineExceeded}
+	for _, err := range []error{
+		nil,
+		&MirrorError{MirrorPhaseFetch, errors.New("unable to fetch")},
+		&MirrorError{MirrorPhaseFetch, errors.New("unable to fetch")},
+		&MirrorError{MirrorPhaseInit, errors.New("unable to init")},
+		&MirrorError{MirrorPhaseWorktree, fmt.Errorf("%w link:link1", ErrRepoWTUpdateFailed)},
+		&MirrorError{MirrorPhaseCleanup, errors.New("unable to cleanup")},
+		&MirrorError{MirrorPhaseFetch, fmt.Errorf("unable to fetch err:%w", gitTimeout)},
+		nil,
+	} {
+		recordGitMirror(repo, err)
+	}
+
+	want := `
+# HELP test_git_mirror_sync_total Count of mirror cycles by result and failure reason
+# TYPE test_git_mirror_sync_total counter
+test_git_mirror_sync_total{reason="",repo="metrics-test-repo",result="success"} 2
+test_git_mirror_sync_total{reason="cleanup",repo="metrics-test-repo",result="failure"} 1
+test_git_mirror_sync_total{reason="fetch",repo="metrics-test-repo",result="failure"} 2
+test_git_mirror_sync_total{reason="init",repo="metrics-test-repo",result="failure"} 1
+test_git_mirror_sync_total{reason="timeout",repo="metrics-test-repo",result="failure"} 1
+test_git_mirror_sync_total{reason="worktree",repo="metrics-test-repo",result="failure"} 1
+`
+	if err := testutil.CollectAndCompare(syncCount, strings.NewReader(want), "test_git_mirror_sync_total"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.ToFloat64(syncSuccess.WithLabelValues(repo)); got != 1 {
+		t.Errorf("sync success should be set after successful cycle got:%v", got)
+	}
+
+	recordGitMirror(repo, &MirrorError{MirrorPhaseWorktree, ErrRepoWTUpdateFailed})
+	if got := testutil.ToFloat64(syncSuccess.WithLabelValues(repo)); got != 0 {
+		t.Errorf("sync success should be cleared after failed cycle got:%v", got)
+	}
+
+	// all label combinations of removed repository are deleted
+	deleteMetrics(repo)
+	if got := testutil.CollectAndCount(syncCount, "test_git_mirror_sync_total"); got != 0 {
+		t.Errorf("expected no sync series after delete got:%d", got)
+	}
+	if got := testutil.CollectAndCount(syncSuccess, "test_git_mirror_sync_success"); got != 0 {
+		t.Errorf("expected no sync success series after delete got:%d", got)
+	}
+}
+
+func Test_recordGitMirror_labels(t *testing.T) {
+	enableTestMetrics(t)
+	setMetricLabelKeys([]string{"team"})
+	defer setMetricLabelKeys(nil)
+
+	setRepoMetricLabels("metrics-labels-a", map[string]string{"team": "payments", "env": "prod"})
+	setRepoMetricLabels("metrics-labels-b", nil)
+	defer deleteMetrics("metrics-labels-a")
+	defer deleteMetrics("metrics-labels-b")
+
+	recordGitMirror("metrics-labels-a", nil)
+	recordGitMirror("metrics-labels-b", &MirrorError{MirrorPhaseFetch, errors.New("unable to fetch")})
+	recordMirrorFailure("metrics-labels-b", MirrorPhaseFetch, ErrorClassNetwork)
+
+	want := `
+# HELP test_git_mirror_sync_total Count of mirror cycles by result and failure reason
+# TYPE test_git_mirror_sync_total counter
+test_git_mirror_sync_total{reason="",repo="metrics-labels-a",result="success",team="payments"} 1
+test_git_mirror_sync_total{reason="fetch",repo="metrics-labels-b",result="failure",team=""} 1
+`
+	if err := testutil.CollectAndCompare(syncCount, strings.NewReader(want), "test_git_mirror_sync_total"); err != nil {
+		t.Error(err)
+	}
+	labels := prometheus.Labels{"repo": "metrics-labels-b", "phase": "fetch", "class": string(ErrorClassNetwork), "team": ""}
+	if got := testutil.ToFloat64(mirrorFailureCount.With(labels)); got != 1 {
+		t.Errorf("expected failure with empty team label got:%v", got)
+	}
+
+	// series with old label values are removed when labels change
+	setRepoMetricLabels("metrics-labels-a", map[string]string{"team": "platform"})
+	recordGitMirror("metrics-labels-a", nil)
+	want = `
+# HELP test_git_mirror_sync_success Whether last mirror cycle was successful
+# TYPE test_git_mirror_sync_success gauge
+test_git_mirror_sync_success{repo="metrics-labels-a",team="platform"} 1
+test_git_mirror_sync_success{repo="metrics-labels-b",team=""} 0
+`
+	if err := testutil.CollectAndCompare(syncSuccess, strings.NewReader(want), "test_git_mirror_sync_success"); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_recordGitMirror_mirror_timeout(t *testing.T) {
+	enableTestMetrics(t)
+	testTmpDir := mustTmpDir(t)
+	defer os.RemoveAll(testTmpDir)
+
+	upstream := filepath.Join(testTmpDir, testUpstreamRepo)
+	mustInitRepo(t, upstream, "file", t.Name())
+
+	rc := RepositoryConfig{
+		Remote:        "file://" + upstream,
+		Root:          filepath.Join(testTmpDir, testRoot),
+		Interval:      testInterval,
+		MirrorTimeout: testTimeout,
+		GitGC:         "always",
+	}
+	repo, err := NewRepository(rc, testENVs, testLog)
+	if err != nil {
+		t.Fatalf("unable to create new repo error: %v", err)
+	}
+	defer deleteMetrics(repo.gitURL.Repo)
+
+	// mirror cycle is cancelled by its deadline
+	ctx, cancel := context.WithTimeout(txtCtx, time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	err = repo.Mirror(ctx)
+	if err == nil {
+		t.Fatal("expected mirror to fail")
+	}
+	recordGitMirror(repo.gitURL.Repo, err)
+
+	labels := prometheus.Labels{"repo": repo.gitURL.Repo, "result": syncFailure, "reason": "timeout"}
+	if got := testutil.ToFloat64(syncCount.With(labels)); got != 1 {
+		t.Errorf("expected failure with timeout reason got:%v err:%v", got, err)
+	}
+}
+
+func Test_recordWorktreeMetrics(t *testing.T) {
+	enableTestMetrics(t)
+	repo := "metrics-test-worktree-repo"
+	deleteMetrics(repo)
+	defer deleteMetrics(repo)
+
+	before := float64(time.Now().Unix())
+
+	recordMirrorSuccess(repo)
+	if got := testutil.ToFloat64(lastSuccessTimestamp.With(mirrorLabels(repo, prometheus.Labels{}))); got < before {
+		t.Errorf("expected last success timestamp to be set got:%v", got)
+	}
+
+	for _, link := range []string{"link1", "link2"} {
+		recordWorktreeUpdate(repo, link)
+		recordWorktreeUpdateFailure(repo, link)
+		recordWorktreeUpdateFailure(repo, link)
+	}
+	if got := testutil.ToFloat64(worktreeUpdatedTimestamp.WithLabelValues(repo, "link1")); got < before {
+		t.Errorf("expected worktree updated timestamp to be set got:%v", got)
+	}
+	if got := testutil.ToFloat64(worktreeUpdateFailures.WithLabelValues(repo, "link1")); got != 2 {
+		t.Errorf("expected 2 worktree update failures got:%v", got)
+	}
+
+	// only series of the removed link are deleted, Delete reports whether
+	// series still existed
+	deleteWorktreeMetrics(repo, "link1")
+	if worktreeUpdatedTimestamp.DeleteLabelValues(repo, "link1") {
+		t.Error("expected worktree updated series of the link to be deleted")
+	}
+	if worktreeUpdateFailures.DeleteLabelValues(repo, "link1") {
+		t.Error("expected worktree failures series of the link to be deleted")
+	}
+	if got := testutil.ToFloat64(worktreeUpdateFailures.WithLabelValues(repo, "link2")); got != 2 {
+		t.Errorf("expected worktree failures of other link to be kept got:%v", got)
+	}
+
+	// all the series of the removed repository are deleted
+	deleteMetrics(repo)
+	if lastSuccessTimestamp.Delete(mirrorLabels(repo, prometheus.Labels{})) {
+		t.Error("expected last success series to be deleted")
+	}
+	if worktreeUpdatedTimestamp.DeleteLabelValues(repo, "link2") {
+		t.Error("expected worktree updated series to be deleted")
+	}
+	if worktreeUpdateFailures.DeleteLabelValues(repo, "link2") {
+		t.Error("expected worktree failures series to be deleted")
+	}
+}
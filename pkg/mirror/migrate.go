@@ -0,0 +1,232 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/giturl"
+)
+
+// ErrMigrationFailed is returned if repository can't be migrated to the new
+// remote, existing repository is kept unchanged in the pool
+var ErrMigrationFailed = fmt.Errorf("repository migration failed")
+
+// previousRepoDir returns existing repository dir of the first previous
+// remote of the config. empty string is returned if the repository dir of
+// the remote itself already exists or none of the previous dirs exist.
+func previousRepoDir(repoConf RepositoryConfig) string {
+	gURL, err := giturl.Parse(giturl.NormaliseURL(repoConf.Remote))
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(repoDirPath(repoConf.Root, gURL)); !os.IsNotExist(err) {
+		return ""
+	}
+	for _, prev := range repoConf.PreviousRemotes {
+		pURL, err := giturl.Parse(giturl.NormaliseURL(prev))
+		if err != nil {
+			continue
+		}
+		dir := repoDirPath(repoConf.Root, pURL)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// MigrationSource returns remote of the repository in the pool which can be
+// migrated to the given config instead of being removed and re-created. it
+// is the repository with remote listed in PreviousRemotes of the config or
+// the repository which uses the same repository dir (eg. same repository
+// name on a different host). config must have defaults applied.
+// caller should only migrate repositories which are removed from the config.
+func (rp *RepoPool) MigrationSource(repoConf RepositoryConfig) (string, bool) {
+	gURL, err := giturl.Parse(giturl.NormaliseURL(repoConf.Remote))
+	if err != nil {
+		return "", false
+	}
+	var prevURLs []*giturl.URL
+	for _, prev := range repoConf.PreviousRemotes {
+		if pURL, err := giturl.Parse(giturl.NormaliseURL(prev)); err == nil {
+			prevURLs = append(prevURLs, pURL)
+		}
+	}
+	dir := repoDirPath(repoConf.Root, gURL)
+
+	repos := rp.repositories()
+	// remote is already mirrored
+	if slices.ContainsFunc(repos, func(r *Repository) bool { return giturl.SameURL(r.gitURL, gURL) }) {
+		return "", false
+	}
+	for _, r := range repos {
+		if slices.ContainsFunc(prevURLs, func(u *giturl.URL) bool { return giturl.SameURL(r.gitURL, u) }) {
+			return r.remote, true
+		}
+	}
+	for _, r := range repos {
+		if r.dir == dir {
+			return r.remote, true
+		}
+	}
+	return "", false
+}
+
+// MigrateRepository moves repository of the pool mirroring oldRemote to the
+// remote of the given config without re-cloning it. new remote is verified
+// with ls-remote and fetched into the existing mirror before repository is
+// swapped so published worktree links keep pointing to the existing
+// worktrees throughout, they are updated by the next mirror cycle only if
+// content of the new remote differs. links which are not in the new config
+// are removed.
+// existing mirror is only reused if new config resolves to the same
+// repository dir (see MigrationSource) and mirrors same refs with same
+// depth. on failure error wrapping ErrMigrationFailed is returned and old
+// repository keeps mirroring the old remote. mirror loop is restarted if it
+// was running. config must have defaults applied.
+func (rp *RepoPool) MigrateRepository(ctx context.Context, oldRemote string, repoConf RepositoryConfig) error {
+	repo, err := rp.Repository(oldRemote)
+	if err != nil {
+		return err
+	}
+	if _, err := rp.Repository(repoConf.Remote); err == nil {
+		return ErrExist
+	}
+
+	newRepo, err := newRepository(ctx, repoConf, repo.commonEnvs, repo.customRunner(), rp.log)
+	if err != nil {
+		return fmt.Errorf("%w: unable to create repository remote:%s err:%w", ErrMigrationFailed, giturl.Redact(repoConf.Remote), err)
+	}
+
+	switch {
+	case newRepo.dir != repo.dir:
+		return fmt.Errorf("%w: repository dir doesn't match old:%s new:%s", ErrMigrationFailed, repo.dir, newRepo.dir)
+	case !sameRefSpecs(newRepo.refSpecs, repo.refSpecs) || newRepo.singleBranch != repo.singleBranch:
+		return fmt.Errorf("%w: mirrored refs don't match", ErrMigrationFailed)
+	case newRepo.depth != repo.depth:
+		return fmt.Errorf("%w: depth doesn't match old:%d new:%d", ErrMigrationFailed, repo.depth, newRepo.depth)
+	}
+
+	others := slices.DeleteFunc(rp.repositories(), func(r *Repository) bool { return r == repo })
+	for _, wl := range newRepo.workTreeLinks {
+		if err := linkOverlaps(others, wl.link); err != nil {
+			return fmt.Errorf("%w: %w", ErrMigrationFailed, err)
+		}
+	}
+
+	// verify new remote before stopping the old repository
+	if err := newRepo.verifyRemote(ctx); err != nil {
+		return fmt.Errorf("%w: unable to list refs of the new remote:%s err:%w", ErrMigrationFailed, newRepo.remote, err)
+	}
+
+	running := repo.loopRunning()
+	repo.StopLoop()
+	restart := func() {
+		if running {
+			rp.startLoop(repo, false, 0)
+		}
+	}
+
+	repo.lock.Lock()
+	if err := newRepo.switchRemote(ctx, repo.remoteURL); err != nil {
+		repo.lock.Unlock()
+		restart()
+		return fmt.Errorf("%w: %w", ErrMigrationFailed, err)
+	}
+
+	if repo.Paused() {
+		newRepo.Pause()
+	}
+
+	rp.lock.Lock()
+	rp.repos = slices.DeleteFunc(rp.repos, func(r *Repository) bool { return r == repo })
+	err = rp.addRepository(newRepo)
+	if err == nil {
+		rp.indexLinks(repo, nil)
+	}
+	rp.lock.Unlock()
+	if err != nil {
+		// only possible if new remote was added concurrently
+		rp.lock.Lock()
+		rp.repos = append(rp.repos, repo)
+		rp.lock.Unlock()
+		newRepo.revertRemote(ctx, repo.remoteURL)
+		repo.lock.Unlock()
+		restart()
+		return fmt.Errorf("%w: %w", ErrMigrationFailed, err)
+	}
+
+	// links dropped from the config are not maintained by the new repository
+	for _, wl := range repo.workTreeLinks {
+		if newRepo.hasLink(wl.link) {
+			continue
+		}
+		if err := repo.unpublishWorktreeLink(wl); err != nil {
+			repo.log.Error("unable to remove worktree link of the old remote", "link", wl.link, "err", err)
+		}
+	}
+	repo.lock.Unlock()
+
+	rp.manifest.remove(repo.remote)
+	newRepo.updateManifest()
+
+	rp.log.Info("repository migrated to new remote", "old", repo.remote, "new", newRepo.remote, "path", newRepo.dir)
+	if repo.gitURL.Repo != newRepo.gitURL.Repo {
+		deleteMetrics(repo.gitURL.Repo)
+	}
+	rp.events.emit(Event{Type: EventRepositoryRemoved, Time: time.Now(), Remote: repo.remote})
+	rp.events.emit(Event{Type: EventRepositoryAdded, Time: time.Now(), Remote: newRepo.remote})
+
+	if running {
+		rp.startLoop(newRepo, false, 0)
+	}
+	return nil
+}
+
+// verifyRemote checks that remote of the repository is reachable with the
+// configured auth. it doesn't depend on the origin of the repository dir.
+func (r *Repository) verifyRemote(ctx context.Context) error {
+	envs, err := r.authEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := r.withGitTimeout(ctx)
+	defer cancel()
+
+	args := append(r.remoteArgs(), "ls-remote", "--heads", r.remoteURL)
+	// git [-c <key>=<value>...] ls-remote --heads <remote>
+	_, err = runGitCommand(ctx, r.log, r.gitOps, r.runner, slices.Concat(r.envs, envs), "", args...)
+	err = classifyGitErr(err)
+	r.credentialFailed(err)
+	return err
+}
+
+// switchRemote points origin of the existing repository dir to the remote of
+// the repository and fetches it. origin is reverted to the old remote if
+// fetch fails so the existing repository remains usable.
+// caller must hold write lock of the repository currently using the dir.
+func (r *Repository) switchRemote(ctx context.Context, oldRemote string) error {
+	// git remote set-url origin <remote>
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "remote", "set-url", "origin", r.remoteURL); err != nil {
+		return fmt.Errorf("unable to set remote url err:%w", err)
+	}
+
+	if _, err := r.fetch(ctx); err != nil {
+		r.revertRemote(ctx, oldRemote)
+		return fmt.Errorf("unable to fetch new remote err:%w", err)
+	}
+	return nil
+}
+
+// revertRemote points origin of the repository dir back to the old remote
+func (r *Repository) revertRemote(ctx context.Context, oldRemote string) {
+	// git remote set-url origin <remote>
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "remote", "set-url", "origin", oldRemote); err != nil {
+		// old repository repairs remote url on next cycle
+		r.log.Error("unable to revert remote url", "remote", giturl.Redact(oldRemote), "err", err)
+	}
+}
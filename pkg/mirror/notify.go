@@ -0,0 +1,82 @@
+package mirror
+
+import (
+	"slices"
+)
+
+// RefChange represents the refs updated by a single mirror cycle of the
+// repository
+type RefChange struct {
+	Remote  string
+	Updates []RefUpdate
+}
+
+// Subscribe registers given channel to receive RefChange after every mirror
+// cycle which updated at least one ref. delivery is non-blocking so that slow
+// subscriber doesn't hold up the mirror loop, if channel is not ready to
+// receive the change is dropped and warning is logged. subscribers should
+// use buffered channel and drain it promptly.
+func (r *Repository) Subscribe(ch chan<- RefChange) {
+	r.subsLock.Lock()
+	defer r.subsLock.Unlock()
+
+	if !slices.Contains(r.subscribers, ch) {
+		r.subscribers = append(r.subscribers, ch)
+	}
+}
+
+// Unsubscribe removes given channel from the subscribers. channel is not
+// closed, it is safe to close it once Unsubscribe returns.
+func (r *Repository) Unsubscribe(ch chan<- RefChange) {
+	r.subsLock.Lock()
+	defer r.subsLock.Unlock()
+
+	r.subscribers = slices.DeleteFunc(r.subscribers, func(c chan<- RefChange) bool { return c == ch })
+}
+
+// publishRefChange sends updated refs to all the subscribers without blocking
+func (r *Repository) publishRefChange(updates []RefUpdate) {
+	if len(updates) == 0 {
+		return
+	}
+
+	r.subsLock.Lock()
+	defer r.subsLock.Unlock()
+
+	for _, ch := range r.subscribers {
+		// each subscriber gets its own copy so it can modify it
+		change := RefChange{Remote: r.remote, Updates: slices.Clone(updates)}
+		select {
+		case ch <- change:
+		default:
+			r.log.Warn("subscriber is not ready, dropping ref change", "updates", len(updates))
+		}
+	}
+}
+
+// Subscribe registers given channel to receive RefChange of all the
+// repositories in the pool including repositories added later.
+// see Repository.Subscribe for delivery policy.
+func (rp *RepoPool) Subscribe(ch chan<- RefChange) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	if !slices.Contains(rp.subscribers, ch) {
+		rp.subscribers = append(rp.subscribers, ch)
+	}
+	for _, repo := range rp.repos {
+		repo.Subscribe(ch)
+	}
+}
+
+// Unsubscribe removes given channel from the subscribers of all the
+// repositories in the pool
+func (rp *RepoPool) Unsubscribe(ch chan<- RefChange) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	rp.subscribers = slices.DeleteFunc(rp.subscribers, func(c chan<- RefChange) bool { return c == ch })
+	for _, repo := range rp.repos {
+		repo.Unsubscribe(ch)
+	}
+}
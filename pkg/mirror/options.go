@@ -0,0 +1,208 @@
+package mirror
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// defaultInterval is the mirror interval of NewRepositoryWithOptions
+	defaultInterval = 30 * time.Second
+	// defaultMirrorTimeout is the mirror timeout of NewRepositoryWithOptions
+	defaultMirrorTimeout = 2 * time.Minute
+)
+
+// repoOptions holds config built by the options
+type repoOptions struct {
+	conf   RepositoryConfig
+	envs   []string
+	log    *slog.Logger
+	runner GitRunner
+	tp     trace.TracerProvider
+}
+
+// Option configures the repository created by NewRepositoryWithOptions.
+// options validate given values eagerly and return one of the ErrInvalid*
+// errors so invalid values are reported before repository is created.
+type Option func(*repoOptions) error
+
+// NewRepositoryWithOptions creates new repository for the given remote using
+// options. repository is validated same as RepositoryConfig passed to
+// NewRepository. WithRoot is required, defaults of other options are...
+//   - interval: 30s
+//   - mirror timeout: 2m
+//   - gc mode: 'auto'
+//   - worktree ref: 'HEAD'
+func NewRepositoryWithOptions(remote string, opts ...Option) (*Repository, error) {
+	o := &repoOptions{
+		conf: RepositoryConfig{
+			Remote:        remote,
+			Interval:      defaultInterval,
+			MirrorTimeout: defaultMirrorTimeout,
+			GitGC:         gcAuto,
+		},
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	repo, err := NewRepositoryWithRunner(o.conf, o.envs, o.runner, o.log)
+	if err != nil {
+		return nil, err
+	}
+	if o.tp != nil {
+		repo.SetTracerProvider(o.tp)
+	}
+	return repo, nil
+}
+
+// WithRoot sets the absolute path of the root dir where repository dir and
+// relative worktree links are created
+func WithRoot(root string) Option {
+	return func(o *repoOptions) error {
+		if err := validateRoot(root); err != nil {
+			return err
+		}
+		o.conf.Root = root
+		return nil
+	}
+}
+
+// WithInterval sets the time between mirror cycles, default is 30s.
+// it replaces schedule set by WithSchedule
+func WithInterval(interval time.Duration) Option {
+	return func(o *repoOptions) error {
+		if err := validateInterval(interval); err != nil {
+			return err
+		}
+		o.conf.Interval = interval
+		o.conf.Schedule = ""
+		return nil
+	}
+}
+
+// WithSchedule sets the cron expression of the mirror cycles, see
+// RepositoryConfig.Schedule. it replaces interval
+func WithSchedule(schedule string) Option {
+	return func(o *repoOptions) error {
+		if err := validateSchedule(schedule); err != nil {
+			return err
+		}
+		o.conf.Schedule = schedule
+		o.conf.Interval = 0
+		return nil
+	}
+}
+
+// WithMirrorTimeout sets the time allowed for the complete mirror cycle,
+// default is 2m
+func WithMirrorTimeout(timeout time.Duration) Option {
+	return func(o *repoOptions) error {
+		if timeout <= 0 {
+			return fmt.Errorf("%w: mirror timeout (%s) must be positive", ErrInvalidConfig, timeout)
+		}
+		o.conf.MirrorTimeout = timeout
+		return nil
+	}
+}
+
+// WithGC sets the gc mode, valid values are 'auto', 'always', 'aggressive'
+// or 'off'. default is 'auto'
+func WithGC(mode string) Option {
+	return func(o *repoOptions) error {
+		if err := validateGCMode(mode); err != nil {
+			return err
+		}
+		o.conf.GitGC = mode
+		return nil
+	}
+}
+
+// WithSSHAuth sets the ssh key and known hosts files used to fetch the
+// remote. known hosts is optional, if empty host key is not verified
+func WithSSHAuth(keyPath, knownHostsPath string) Option {
+	return func(o *repoOptions) error {
+		if !filepath.IsAbs(keyPath) {
+			return fmt.Errorf("%w: ssh key path '%s' must be absolute", ErrInvalidAuth, keyPath)
+		}
+		if knownHostsPath != "" && !filepath.IsAbs(knownHostsPath) {
+			return fmt.Errorf("%w: ssh known hosts path '%s' must be absolute", ErrInvalidAuth, knownHostsPath)
+		}
+		o.conf.Auth.SSHKeyPath = keyPath
+		o.conf.Auth.SSHKnownHostsPath = knownHostsPath
+		return nil
+	}
+}
+
+// WithHTTPAuth sets the username and the file containing password or token
+// used to fetch https remote
+func WithHTTPAuth(username, passwordFilePath string) Option {
+	return func(o *repoOptions) error {
+		if !filepath.IsAbs(passwordFilePath) {
+			return fmt.Errorf("%w: password file path '%s' must be absolute", ErrInvalidAuth, passwordFilePath)
+		}
+		o.conf.Auth.Username = username
+		o.conf.Auth.PasswordFilePath = passwordFilePath
+		return nil
+	}
+}
+
+// WithWorktree adds worktree link of the given ref, pathspec is optional.
+// link is created under root if its not absolute and default ref is 'HEAD'
+func WithWorktree(link, ref, pathspec string) Option {
+	return WithWorktreeConfig(WorktreeConfig{Link: link, Ref: ref, Pathspec: pathspec})
+}
+
+// WithWorktreeConfig adds worktree link with the given config
+func WithWorktreeConfig(wtc WorktreeConfig) Option {
+	return func(o *repoOptions) error {
+		if wtc.Link == "" {
+			return fmt.Errorf("%w: symlink path cannot be empty", ErrInvalidWorktree)
+		}
+		o.conf.Worktrees = append(o.conf.Worktrees, wtc)
+		return nil
+	}
+}
+
+// WithEnvs sets envs passed to all git commands of the repository
+func WithEnvs(envs ...string) Option {
+	return func(o *repoOptions) error {
+		o.envs = append(o.envs, envs...)
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the repository, default is slog.Default()
+func WithLogger(log *slog.Logger) Option {
+	return func(o *repoOptions) error {
+		o.log = log
+		return nil
+	}
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider used to create
+// spans of the mirror operations. spans are created for Mirror with child
+// spans for init, fetch, worktree links, cleanup and every git command, and
+// for gc. git command spans only include the sub command name and recorded
+// errors only include redacted command args as output might contain
+// credentials. tracing is disabled by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *repoOptions) error {
+		o.tp = tp
+		return nil
+	}
+}
+
+// WithGitRunner sets the runner of all git commands of the repository,
+// default runner executes git executable
+func WithGitRunner(runner GitRunner) Option {
+	return func(o *repoOptions) error {
+		o.runner = runner
+		return nil
+	}
+}
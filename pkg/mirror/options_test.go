@@ -0,0 +1,101 @@
+package mirror
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewRepositoryWithOptions(t *testing.T) {
+	remote := "https://github.com/org/repo.git"
+
+	tests := []struct {
+		name    string
+		remote  string
+		opts    []Option
+		wantErr error
+	}{
+		{"valid", remote, []Option{WithRoot("/tmp"), WithInterval(time.Minute), WithGC("always"), WithWorktree("link", "main", "")}, nil},
+		{"defaults", remote, []Option{WithRoot("/tmp")}, nil},
+		{"invalid_remote", "not a url", []Option{WithRoot("/tmp")}, ErrInvalidRemote},
+		{"missing_root", remote, nil, ErrInvalidRoot},
+		{"relative_root", remote, []Option{WithRoot("tmp")}, ErrInvalidRoot},
+		{"invalid_interval", remote, []Option{WithRoot("/tmp"), WithInterval(time.Millisecond)}, ErrInvalidInterval},
+		{"schedule", remote, []Option{WithRoot("/tmp"), WithSchedule("*/5 * * * *")}, nil},
+		{"interval_after_schedule", remote, []Option{WithRoot("/tmp"), WithSchedule("@hourly"), WithInterval(time.Minute)}, nil},
+		{"invalid_schedule", remote, []Option{WithRoot("/tmp"), WithSchedule("*/5 * * *")}, ErrInvalidSchedule},
+		{"invalid_gc", remote, []Option{WithRoot("/tmp"), WithGC("sometimes")}, ErrInvalidGCMode},
+		{"invalid_timeout", remote, []Option{WithRoot("/tmp"), WithMirrorTimeout(0)}, ErrInvalidConfig},
+		{"relative_ssh_key", remote, []Option{WithRoot("/tmp"), WithSSHAuth("key", "")}, ErrInvalidAuth},
+		{"http_auth_on_scp_remote", "git@github.com:org/repo.git", []Option{WithRoot("/tmp"), WithHTTPAuth("user", "/pass")}, ErrInvalidAuth},
+		{"empty_link", remote, []Option{WithRoot("/tmp"), WithWorktree("", "main", "")}, ErrInvalidWorktree},
+		{"duplicate_link", remote, []Option{WithRoot("/tmp"), WithWorktree("link", "main", ""), WithWorktree("link", "dev", "")}, ErrInvalidWorktree},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := NewRepositoryWithOptions(tt.remote, tt.opts...)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("NewRepositoryWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if repo.remote != tt.remote || repo.root != "/tmp" {
+				t.Errorf("unexpected repository remote:%s root:%s", repo.remote, repo.root)
+			}
+		})
+	}
+}
+
+func TestNewRepositoryWithOptions_defaults(t *testing.T) {
+	repo, err := NewRepositoryWithOptions("https://github.com/org/repo.git", WithRoot("/tmp"), WithWorktree("link", "", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.interval != defaultInterval || repo.mirrorTimeout != defaultMirrorTimeout || repo.gitGC != gcAuto {
+		t.Errorf("unexpected defaults interval:%s timeout:%s gc:%s", repo.interval, repo.mirrorTimeout, repo.gitGC)
+	}
+	wl, err := repo.WorktreeLink("link")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wl.ref != "HEAD" || wl.link != "/tmp/link" {
+		t.Errorf("unexpected worktree link:%s ref:%s", wl.link, wl.ref)
+	}
+}
+
+func TestNewRepository_typedErrors(t *testing.T) {
+	valid := RepositoryConfig{Remote: "https://github.com/org/repo.git", Root: "/tmp", Interval: time.Minute, GitGC: "auto"}
+
+	tests := []struct {
+		name    string
+		modify  func(rc *RepositoryConfig)
+		wantErr error
+	}{
+		{"invalid_remote", func(rc *RepositoryConfig) { rc.Remote = "blah" }, ErrInvalidRemote},
+		{"invalid_root", func(rc *RepositoryConfig) { rc.Root = "tmp" }, ErrInvalidRoot},
+		{"invalid_interval", func(rc *RepositoryConfig) { rc.Interval = 0 }, ErrInvalidInterval},
+		{"interval_and_schedule", func(rc *RepositoryConfig) { rc.Schedule = "0 * * * *" }, ErrInvalidSchedule},
+		{"invalid_schedule", func(rc *RepositoryConfig) { rc.Interval = 0; rc.Schedule = "60 * * * *" }, ErrInvalidSchedule},
+		{"never_matching_schedule", func(rc *RepositoryConfig) { rc.Interval = 0; rc.Schedule = "0 0 30 2 *" }, ErrInvalidSchedule},
+		{"invalid_gc", func(rc *RepositoryConfig) { rc.GitGC = "" }, ErrInvalidGCMode},
+		{"invalid_depth", func(rc *RepositoryConfig) { rc.Depth = -1 }, ErrInvalidConfig},
+		{"invalid_refspec", func(rc *RepositoryConfig) { rc.RefSpecs = []string{"refs/heads/*"} }, ErrInvalidConfig},
+		{"invalid_single_branch", func(rc *RepositoryConfig) { rc.SingleBranch = "main:main" }, ErrInvalidConfig},
+		{"single_branch_and_refspecs", func(rc *RepositoryConfig) { rc.SingleBranch = "main"; rc.RefSpecs = []string{defaultRefSpec} }, ErrInvalidConfig},
+		{"worktree_ref_not_mirrored", func(rc *RepositoryConfig) {
+			rc.SingleBranch = "main"
+			rc.Worktrees = []WorktreeConfig{{Link: "link", Ref: "other"}}
+		}, ErrRefNotMirrored},
+		{"invalid_worktree", func(rc *RepositoryConfig) { rc.Worktrees = []WorktreeConfig{{Link: ""}} }, ErrInvalidWorktree},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := valid
+			tt.modify(&rc)
+			if _, err := NewRepository(rc, nil, nil); !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewRepository() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
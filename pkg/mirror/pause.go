@@ -0,0 +1,113 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ErrPaused is returned by the methods which query the remote while
+// repository is paused
+var ErrPaused = fmt.Errorf("repository is paused")
+
+// Pause stops repository from running any remote operations (fetch, ls-remote)
+// until Resume is called. mirror cycles still run local phases so published
+// worktrees are kept healthy and read methods (Hash, Clone etc) keep working.
+// in-flight mirror cycle is not affected, pause takes effect from the next cycle.
+func (r *Repository) Pause() {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+
+	if r.paused {
+		return
+	}
+	r.paused = true
+	r.log.Info("repository paused")
+	recordPaused(r.gitURL.Repo, true)
+}
+
+// Resume resumes paused repository, if mirror run was queued while
+// repository was paused it is started immediately
+func (r *Repository) Resume() {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+
+	if !r.paused {
+		return
+	}
+	r.paused = false
+	r.log.Info("repository resumed", "queued-run", r.pausedRun)
+	recordPaused(r.gitURL.Repo, false)
+
+	if r.pausedRun {
+		r.pausedRun = false
+		r.triggered = true
+		r.queueMirrorRun()
+	}
+}
+
+// Paused returns true if repository is paused
+func (r *Repository) Paused() bool {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+
+	return r.paused
+}
+
+// Pause pauses all the repositories of the pool, repositories added to the
+// pool while its paused are also paused. see Repository.Pause
+func (rp *RepoPool) Pause() {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	rp.paused = true
+	for _, repo := range rp.repos {
+		repo.Pause()
+	}
+}
+
+// Resume resumes all the repositories of the pool. see Repository.Resume
+func (rp *RepoPool) Resume() {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	rp.paused = false
+	for _, repo := range rp.repos {
+		repo.Resume()
+	}
+}
+
+// Paused returns true if pool is paused
+func (rp *RepoPool) Paused() bool {
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+
+	return rp.paused
+}
+
+// PauseHandler returns http.Handler which reports paused state of the pool
+// on GET and pauses or resumes the pool on POST with 'paused=true|false'
+// query param. state is rendered as JSON. pausing and resuming requires
+// operator role, see Authorizer.
+func (rp *RepoPool) PauseHandler() http.Handler {
+	roles := methodRoles{http.MethodGet: RoleReadOnly, http.MethodPost: RoleOperator}
+	return rp.authorized(roles, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPost {
+			paused, err := strconv.ParseBool(req.URL.Query().Get("paused"))
+			if err != nil {
+				http.Error(w, "paused query param must be true or false", http.StatusBadRequest)
+				return
+			}
+			if paused {
+				rp.Pause()
+			} else {
+				rp.Resume()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]bool{"paused": rp.Paused()}); err != nil {
+			rp.log.Error("unable to encode paused state", "err", err)
+		}
+	})
+}
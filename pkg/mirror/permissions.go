@@ -0,0 +1,237 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Permissions controls ownership and modes of the checked out worktree files.
+// it is applied before worktree is published so readers never observe
+// partially updated permissions.
+type Permissions struct {
+	// Owner is the user name or uid set as owner of the worktree files.
+	// ownership is only changed if git-mirror runs as root or has
+	// CAP_CHOWN capability, otherwise warning is logged
+	Owner string `yaml:"owner"`
+
+	// Group is the group name or gid set as group of the worktree files
+	Group string `yaml:"group"`
+
+	// DirMode is the octal mode (eg. '0755') applied to all the dirs
+	DirMode string `yaml:"dir_mode"`
+
+	// FileMode is the octal mode (eg. '0644') applied to all the regular
+	// files. executable bits of the files are kept
+	FileMode string `yaml:"file_mode"`
+}
+
+// wtPermissions is the parsed Permissions, -1 id or 0 mode means unchanged
+type wtPermissions struct {
+	uid, gid          int
+	dirMode, fileMode fs.FileMode
+}
+
+// parse validates and resolves permissions config
+func (p Permissions) parse() (wtPermissions, error) {
+	perms := wtPermissions{uid: -1, gid: -1}
+	var err error
+
+	if p.Owner != "" {
+		if perms.uid, err = lookupID(p.Owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		}); err != nil {
+			return perms, fmt.Errorf("invalid owner %q err:%w", p.Owner, err)
+		}
+	}
+	if p.Group != "" {
+		if perms.gid, err = lookupID(p.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		}); err != nil {
+			return perms, fmt.Errorf("invalid group %q err:%w", p.Group, err)
+		}
+	}
+	if perms.dirMode, err = parseMode(p.DirMode); err != nil {
+		return perms, fmt.Errorf("invalid dir mode %q err:%w", p.DirMode, err)
+	}
+	// dirs must be traversable by the owner so worktree can be updated
+	if perms.dirMode != 0 && perms.dirMode&0700 != 0700 {
+		return perms, fmt.Errorf("invalid dir mode %q, owner must have rwx permissions", p.DirMode)
+	}
+	if perms.fileMode, err = parseMode(p.FileMode); err != nil {
+		return perms, fmt.Errorf("invalid file mode %q err:%w", p.FileMode, err)
+	}
+	return perms, nil
+}
+
+// isSet returns true if any of the permissions needs to be applied
+func (p wtPermissions) isSet() bool {
+	return p.uid != -1 || p.gid != -1 || p.dirMode != 0 || p.fileMode != 0
+}
+
+// lookupID returns given id if its numeric otherwise its looked up by name
+func lookupID(nameOrID string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		if id < 0 {
+			return 0, fmt.Errorf("id must not be negative")
+		}
+		return id, nil
+	}
+	id, err := lookup(nameOrID)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// parseMode parses octal permission bits, special bits are not supported
+func parseMode(mode string) (fs.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if m == 0 || m > 0777 {
+		return 0, fmt.Errorf("mode must be between 0001 and 0777")
+	}
+	return fs.FileMode(m), nil
+}
+
+// applyPermissions applies permissions to all the files of the given worktree
+// dir. top level entries are walked in parallel. ownership of the worktree dir
+// is not changed as git refuses to work in dirs owned by other users, worktree's
+// '.git' file and symlinks are skipped.
+func applyPermissions(ctx context.Context, log *slog.Logger, dir string, perms wtPermissions) error {
+	if !perms.isSet() {
+		return nil
+	}
+
+	if (perms.uid != -1 || perms.gid != -1) && !canChown(dir, perms.uid, perms.gid) {
+		log.Warn("not permitted to change ownership of worktree files, requires root or CAP_CHOWN", "owner", perms.uid, "group", perms.gid)
+		perms.uid, perms.gid = -1, -1
+	}
+
+	if perms.dirMode != 0 {
+		if err := os.Chmod(dir, perms.dirMode); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, runtime.NumCPU())
+	)
+	for _, e := range entries {
+		// '.git' file links worktree to the repository and it's only used by git-mirror
+		if e.Name() == ".git" && !e.IsDir() {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(path string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := applyPermissionsTree(ctx, path, perms); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(filepath.Join(dir, e.Name()))
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// canChown checks if ownership can be changed to given ids by changing
+// ownership of a temp file created in the given dir
+func canChown(dir string, uid, gid int) bool {
+	f, err := os.CreateTemp(dir, ".chown-check-")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	return !errors.Is(os.Lchown(f.Name(), uid, gid), fs.ErrPermission)
+}
+
+// applyPermissionsTree applies permissions to the given path and all its
+// children. modes of dirs are set after their children so walk is not
+// affected by the new modes
+func applyPermissionsTree(ctx context.Context, root string, perms wtPermissions) error {
+	var dirs []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		if perms.uid != -1 || perms.gid != -1 {
+			if err := os.Lchown(path, perms.uid, perms.gid); err != nil {
+				return err
+			}
+		}
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, path)
+		case d.Type().IsRegular() && perms.fileMode != 0:
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			// keep executable bits of the file
+			mode := perms.fileMode | (info.Mode().Perm() & 0111)
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if perms.dirMode != 0 {
+		for _, d := range slices.Backward(dirs) {
+			if err := os.Chmod(d, perms.dirMode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package mirror
+
+import (
+	"os/exec"
+	"time"
+)
+
+// setCmdCancel makes sure command is killed if it doesn't exit within
+// waitDelay after context cancellation.
+func setCmdCancel(cmd *exec.Cmd, waitDelay time.Duration) func() {
+	cmd.WaitDelay = waitDelay
+	return func() {}
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package mirror
+
+import (
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// setCmdCancel runs command in its own process group so that children
+// (eg. ssh) can be terminated along with it. On context cancellation SIGTERM is
+// sent to the group and if command doesn't exit within waitDelay it is killed.
+// returned func must be called once command has finished, it kills any process
+// left in the group of the cancelled command.
+func setCmdCancel(cmd *exec.Cmd, waitDelay time.Duration) func() {
+	var cancelled atomic.Bool
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		cancelled.Store(true)
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = waitDelay
+
+	return func() {
+		if cancelled.Load() && cmd.Process != nil {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+//go:build unix
+
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunGitCommand_KillsStuckProcess(t *testing.T) {
+	tmpDir := t.TempDir()
+	pidFile := filepath.Join(tmpDir, "pid")
+
+	// fake git which ignores SIGTERM and starts child process like ssh would
+	script := filepath.Join(tmpDir, "git")
+	content := "#!/bin/sh\ntrap '' TERM\nsleep 60 &\necho $! > " + pidFile + "\nwait\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("unable to write script err: %v", err)
+	}
+
+	oldPath, oldDelay := gitExecutablePath, gitWaitDelay
+	defer func() { gitExecutablePath, gitWaitDelay = oldPath, oldDelay }()
+	gitExecutablePath, gitWaitDelay = script, 500*time.Millisecond
+
+	r := &Repository{dir: tmpDir, log: slog.Default()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		r.lock.RLock()
+		defer r.lock.RUnlock()
+		_, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, nil, r.dir, "fetch")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected error from cancelled command")
+		}
+	case <-time.After(200*time.Millisecond + 2*gitWaitDelay):
+		t.Fatalf("command was not killed within wait delay")
+	}
+
+	// lock must be released once command is killed
+	r.lock.Lock()
+	r.lock.Unlock()
+
+	out, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("unable to read pid file err: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		t.Fatalf("unable to parse pid err: %v", err)
+	}
+	// child is re-parented to init once killed so allow some time for reaping
+	for i := 0; i < 10; i++ {
+		if !processRunning(pid) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("child process %d of the cancelled command is still running", pid)
+}
+
+// processRunning returns false if process doesn't exist or is a zombie
+// (killed but not yet reaped by its parent)
+func processRunning(pid int) bool {
+	if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+		return false
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		// proc fs might not be available, rely on signal check
+		return true
+	}
+	// state is the first field after command name ie `pid (comm) S ...`
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
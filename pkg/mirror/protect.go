@@ -0,0 +1,85 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoBlockedUpdate is returned if update of the worktree link is approved
+// but there is no blocked update
+var ErrNoBlockedUpdate = fmt.Errorf("worktree update is not blocked")
+
+// blockedUpdate returns true if update of the protected worktree link from
+// current to remote hash must be blocked as remote hash is not a descendant
+// of the published one (eg. ref was force-pushed). update is allowed if its
+// the approved hash or its descendant.
+func (r *Repository) blockedUpdate(ctx context.Context, wl *WorkTreeLink, currentHash, remoteHash string) (bool, error) {
+	if !wl.protect || currentHash == "" || currentHash == remoteHash {
+		return false, nil
+	}
+
+	ok, err := r.isAncestor(ctx, currentHash, remoteHash)
+	if err != nil {
+		return false, fmt.Errorf("unable to check ancestry of the new hash err:%w", err)
+	}
+	if ok {
+		return false, nil
+	}
+
+	if wl.approved != "" {
+		if wl.approved == remoteHash {
+			wl.log.Info("non fast-forward worktree update approved", "remoteHash", remoteHash, "currentHash", currentHash)
+			return false, nil
+		}
+		if ok, err := r.isAncestor(ctx, wl.approved, remoteHash); err == nil && ok {
+			wl.log.Info("worktree update is descendant of the approved hash", "remoteHash", remoteHash, "approved", wl.approved)
+			return false, nil
+		}
+	}
+
+	if wl.blocked != remoteHash {
+		wl.log.Error("new hash is not a descendant of the published hash, worktree update blocked until approved",
+			"remoteHash", remoteHash, "currentHash", currentHash)
+	}
+	wl.blocked = remoteHash
+	r.setWorktreeStatus(wl, WorktreeStatusBlocked)
+	return true, nil
+}
+
+// isAncestor returns true if commit is an ancestor of the given descendant
+func (r *Repository) isAncestor(ctx context.Context, commit, descendant string) (bool, error) {
+	// git merge-base --is-ancestor <commit> <descendant>
+	_, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "merge-base", "--is-ancestor", commit, descendant)
+	if err == nil {
+		return true, nil
+	}
+	// exit code 1 means its not an ancestor, anything else is an error
+	var gErr *GitError
+	if errors.As(err, &gErr) && gErr.ExitCode == 1 {
+		return false, nil
+	}
+	return false, err
+}
+
+// ApproveWorktreeUpdate approves currently blocked update of the protected
+// worktree link and queues mirror run to publish it. only the blocked hash
+// and its descendants are approved. link must be same as the one used to add
+// worktree link. ErrNoBlockedUpdate is returned if update is not blocked.
+func (r *Repository) ApproveWorktreeUpdate(link string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	wl, ok := r.workTreeLinks[link]
+	if !ok {
+		return fmt.Errorf("%w link:%s", ErrWorktreeLinkNotFound, link)
+	}
+	if wl.blocked == "" {
+		return fmt.Errorf("%w link:%s", ErrNoBlockedUpdate, link)
+	}
+
+	wl.log.Info("worktree update approved", "hash", wl.blocked)
+	wl.approved = wl.blocked
+	r.QueueMirrorRun()
+	return nil
+}
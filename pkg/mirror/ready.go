@@ -0,0 +1,70 @@
+package mirror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ReadyStatus is the readiness of the pool rendered by ReadyHandler
+type ReadyStatus struct {
+	Ready bool `json:"ready"`
+	// NotReady is the list of remotes required for readiness which haven't
+	// completed successful mirror cycle yet
+	NotReady []string `json:"notReady"`
+}
+
+// Ready returns true if repository has completed at least one successful
+// mirror cycle since it was created. it doesn't wait for repository lock
+// so it can be called while mirror is in progress.
+func (r *Repository) Ready() bool {
+	return r.ready.Load()
+}
+
+// Ready returns true if all the repositories required for readiness have
+// completed at least one successful mirror cycle since start, along with
+// the remotes of the required repositories which are not ready yet.
+// if any of the repositories are marked as critical only those are required
+// otherwise all the repositories are required. once ready, repository
+// stays ready even if subsequent mirror cycles fail.
+// it doesn't wait for repository locks so it can be used to serve readiness
+// probe while initial mirror is in progress.
+func (rp *RepoPool) Ready() (bool, []string) {
+	repos := rp.repositories()
+
+	required := make([]*Repository, 0, len(repos))
+	for _, repo := range repos {
+		if repo.critical.Load() {
+			required = append(required, repo)
+		}
+	}
+	if len(required) == 0 {
+		required = repos
+	}
+
+	notReady := []string{}
+	for _, repo := range required {
+		if !repo.Ready() {
+			notReady = append(notReady, repo.remote)
+		}
+	}
+	return len(notReady) == 0, notReady
+}
+
+// ReadyHandler returns http.Handler which serves readiness of the pool as
+// JSON. status code is 200 if pool is ready and 503 otherwise. see Ready.
+// its served without authorization unless public handlers are locked, see
+// RepoPool.LockPublicHandlers.
+func (rp *RepoPool) ReadyHandler() http.Handler {
+	return rp.authorized(methodRoles{http.MethodGet: rolePublic}, func(w http.ResponseWriter, req *http.Request) {
+		var status ReadyStatus
+		status.Ready, status.NotReady = rp.Ready()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			rp.log.Error("unable to encode ready status", "err", err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package mirror
+
+import (
+	"context"
+	"strings"
+)
+
+// batchRefHashes enables resolving hashes of the worktree refs from the
+// single ref listing, its only disabled to compare with individual lookups
+var batchRefHashes = true
+
+// refHashes resolves hashes of the worktree links within a single mirror
+// cycle. branch and tag refs are resolved from the single 'for-each-ref'
+// listing, other refs (eg. HEAD or SHA) and links with pathspec fall back to
+// individual lookups. resolved hashes are cached so links sharing the same
+// ref and pathspec don't run same command again. errors are never cached so
+// missing refs fail with the same errors as individual lookups.
+type refHashes struct {
+	listed bool
+	refs   map[string]string // full ref name -> commit hash, empty if ref is not a commit
+	cache  map[string]string // ref + pathspec -> hash
+	names  map[string]string // symbolic ref -> full ref name
+}
+
+// cachedHash returns the hash of the given ref for the path if specified,
+// same as Repository.hash
+func (r *Repository) cachedHash(ctx context.Context, rh *refHashes, ref, path string) (string, error) {
+	key := ref + "\x00" + path
+	if hash, ok := rh.cache[key]; ok {
+		return hash, nil
+	}
+
+	hash, ok := "", false
+	if batchRefHashes && path == "" {
+		hash, ok = r.listedHash(ctx, rh, ref)
+	}
+	if !ok {
+		var err error
+		if hash, err = r.hash(ctx, ref, path); err != nil {
+			return "", err
+		}
+	}
+
+	if rh.cache == nil {
+		rh.cache = make(map[string]string)
+	}
+	rh.cache[key] = hash
+	return hash, nil
+}
+
+// listedHash returns commit hash of the ref from the ref listing, ref is
+// resolved using same rules as git (see gitrevisions). false is returned if
+// ref can't be resolved from the listing and needs individual lookup.
+func (r *Repository) listedHash(ctx context.Context, rh *refHashes, ref string) (string, bool) {
+	candidates := refCandidates(ref)
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	refs := r.listedRefs(ctx, rh)
+	for _, name := range candidates {
+		if hash, ok := refs[name]; ok {
+			return hash, hash != ""
+		}
+	}
+	// missing ref is looked up individually so error is same as before
+	return "", false
+}
+
+// listedRefs returns refs of the mirror listed once per mirror cycle, nil is
+// returned if refs can't be listed
+func (r *Repository) listedRefs(ctx context.Context, rh *refHashes) map[string]string {
+	if !rh.listed {
+		rh.listed = true
+		refs, err := r.listRefHashes(ctx)
+		if err != nil {
+			r.log.Warn("unable to list refs, falling back to individual lookups", "err", err)
+		}
+		rh.refs = refs
+	}
+	return rh.refs
+}
+
+// listRefHashes returns all refs of the mirror with the commit hash they
+// point to, annotated tags are peeled. hash is empty for refs which are not
+// pointing to a commit.
+func (r *Repository) listRefHashes(ctx context.Context) (map[string]string, error) {
+	// git for-each-ref --format=%(refname) %(objecttype) %(objectname) %(*objecttype) %(*objectname)
+	out, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "for-each-ref",
+		"--format=%(refname) %(objecttype) %(objectname) %(*objecttype) %(*objectname)")
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[1] == "commit":
+			refs[fields[0]] = fields[2]
+		case len(fields) == 5 && fields[3] == "commit":
+			refs[fields[0]] = fields[4]
+		case len(fields) > 0:
+			refs[fields[0]] = ""
+		}
+	}
+	return refs, nil
+}
+
+// refCandidates returns full ref names the given ref can resolve to in the
+// order of precedence used by git. nil is returned if ref needs to be
+// resolved by git (eg. HEAD, SHA or revision expressions).
+func refCandidates(ref string) []string {
+	if ref == "" || strings.HasPrefix(ref, "-") || strings.ContainsAny(ref, "^~:?*[\\ @{") {
+		return nil
+	}
+	// pseudo refs like HEAD or FETCH_HEAD are resolved from the git dir
+	if strings.Trim(ref, "ABCDEFGHIJKLMNOPQRSTUVWXYZ_") == "" {
+		return nil
+	}
+	// hex string might be abbreviated hash
+	if strings.Trim(ref, "0123456789abcdef") == "" {
+		return nil
+	}
+	if strings.HasPrefix(ref, "refs/") {
+		return []string{ref}
+	}
+	return []string{
+		"refs/" + ref,
+		"refs/tags/" + ref,
+		"refs/heads/" + ref,
+		"refs/remotes/" + ref,
+		"refs/remotes/" + ref + "/HEAD",
+	}
+}
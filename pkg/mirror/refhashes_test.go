@@ -0,0 +1,33 @@
+package mirror
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_refCandidates(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want []string
+	}{
+		{"", nil},
+		{"HEAD", nil},
+		{"FETCH_HEAD", nil},
+		{"e0d2c2b", nil},
+		{"main~1", nil},
+		{"v1.0^{}", nil},
+		{"main@{1}", nil},
+		{"-main", nil},
+		{"refs/heads/main", []string{"refs/heads/main"}},
+		{"main", []string{"refs/main", "refs/tags/main", "refs/heads/main", "refs/remotes/main", "refs/remotes/main/HEAD"}},
+		{"feature/a", []string{"refs/feature/a", "refs/tags/feature/a", "refs/heads/feature/a", "refs/remotes/feature/a", "refs/remotes/feature/a/HEAD"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, refCandidates(tt.ref)); diff != "" {
+				t.Errorf("refCandidates() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
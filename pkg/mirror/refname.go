@@ -0,0 +1,108 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RefPrecedence represents which ref short ref name of the worktree resolves
+// to if both branch and tag with the same name exist
+type RefPrecedence string
+
+const (
+	// RefPrecedenceHeads branches are preferred over tags
+	RefPrecedenceHeads RefPrecedence = "heads"
+	// RefPrecedenceTags tags are preferred over branches, same as git
+	RefPrecedenceTags RefPrecedence = "tags"
+)
+
+func (p RefPrecedence) validate() error {
+	switch p {
+	case "", RefPrecedenceHeads, RefPrecedenceTags:
+		return nil
+	}
+	return fmt.Errorf("wrong ref precedence value provided '%s', must be one of %s, %s",
+		p, RefPrecedenceHeads, RefPrecedenceTags)
+}
+
+func (p RefPrecedence) String() string {
+	if p == "" {
+		return string(RefPrecedenceHeads)
+	}
+	return string(p)
+}
+
+// candidates returns full ref names the given short ref can resolve to in the
+// order of precedence. refs with explicit 'refs/' prefix are never expanded.
+func (p RefPrecedence) candidates(ref string) []string {
+	candidates := refCandidates(ref)
+	if p == RefPrecedenceTags || len(candidates) < 3 {
+		return candidates
+	}
+	// git order is refs/<ref>, refs/tags/<ref>, refs/heads/<ref>, ...
+	candidates[1], candidates[2] = candidates[2], candidates[1]
+	return candidates
+}
+
+// resolveRefName returns full ref name of the worktree ref, short names are
+// expanded based on the ref precedence of the link. ambiguous is set if
+// short name matches more than one ref. ref is returned as is if its not
+// a ref name (eg. SHA or revision expression), doesn't exist or refs can't be
+// listed, in which case hash lookup fails with the usual error.
+func (r *Repository) resolveRefName(ctx context.Context, rh *refHashes, wl *WorkTreeLink, ref string) (name string, ambiguous bool) {
+	if IsCommitHash(ref) || strings.HasPrefix(ref, "refs/") {
+		return ref, false
+	}
+
+	candidates := wl.refPrec.candidates(ref)
+	if len(candidates) == 0 {
+		return r.symbolicFullName(ctx, rh, ref), false
+	}
+
+	refs := r.listedRefs(ctx, rh)
+	var matched []string
+	for _, c := range candidates {
+		if _, ok := refs[c]; ok {
+			matched = append(matched, c)
+		}
+	}
+	if len(matched) == 0 {
+		return ref, false
+	}
+	return matched[0], len(matched) > 1
+}
+
+// symbolicFullName returns full name of the ref symbolic ref (eg. HEAD) points
+// to, ref is returned as is if its not a symbolic ref
+func (r *Repository) symbolicFullName(ctx context.Context, rh *refHashes, ref string) string {
+	if name, ok := rh.names[ref]; ok {
+		return name
+	}
+	// git rev-parse --symbolic-full-name <ref>
+	name, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "rev-parse", "--symbolic-full-name", ref)
+	if err != nil || name == "" {
+		name = ref
+	}
+	if rh.names == nil {
+		rh.names = make(map[string]string)
+	}
+	rh.names[ref] = name
+	return name
+}
+
+// setRefName records full ref name of the worktree link resolved on current
+// mirror cycle, ambiguous ref is logged when its first detected or resolves
+// to different ref.
+// it must be called with repository write lock held.
+func (r *Repository) setRefName(wl *WorkTreeLink, name string, ambiguous bool) {
+	if ambiguous && (!wl.ambiguous || name != wl.refName) {
+		wl.log.Warn("ref matches both branch and tag, use fully-qualified ref name to avoid ambiguity",
+			"ref", wl.ref, "refName", name, "precedence", wl.refPrec.String())
+	}
+	if name != wl.refName {
+		wl.log.Info("ref name resolved", "ref", wl.ref, "refName", name, "previous", wl.refName)
+	}
+	wl.refName, wl.ambiguous = name, ambiguous
+	recordWorktreeRefAmbiguous(r.gitURL.Repo, wl.link, ambiguous)
+}
@@ -0,0 +1,30 @@
+package mirror
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRefPrecedence_candidates(t *testing.T) {
+	tests := []struct {
+		prec RefPrecedence
+		ref  string
+		want []string
+	}{
+		{"", "HEAD", nil},
+		{"", "e0d2c2b", nil},
+		{"", "refs/tags/main", []string{"refs/tags/main"}},
+		{RefPrecedenceTags, "refs/heads/main", []string{"refs/heads/main"}},
+		{"", "main", []string{"refs/main", "refs/heads/main", "refs/tags/main", "refs/remotes/main", "refs/remotes/main/HEAD"}},
+		{RefPrecedenceHeads, "main", []string{"refs/main", "refs/heads/main", "refs/tags/main", "refs/remotes/main", "refs/remotes/main/HEAD"}},
+		{RefPrecedenceTags, "main", []string{"refs/main", "refs/tags/main", "refs/heads/main", "refs/remotes/main", "refs/remotes/main/HEAD"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.prec)+"-"+tt.ref, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tt.prec.candidates(tt.ref)); diff != "" {
+				t.Errorf("candidates() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
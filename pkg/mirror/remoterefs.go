@@ -0,0 +1,209 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// remoteConfig is the snapshot of the repository config used by the remote
+// queries, it's replaced on config update so queries can run without
+// waiting for the repository lock held by the mirror cycle
+type remoteConfig struct {
+	auth          *Auth
+	envs          []string
+	runner        GitRunner
+	gitOps        *gitOpsLimiter
+	gitConfig     []string // '-c key=value' args of the configured git config
+	gitTimeout    time.Duration
+	mirrorTimeout time.Duration
+	proxyURL      string
+	cacheTTL      time.Duration
+}
+
+// remoteQuery deduplicates concurrent ls-remote calls with same patterns and
+// caches their results for the configured ttl
+type remoteQuery struct {
+	lock  sync.Mutex
+	calls map[string]*lsRemoteCall
+	cache map[string]cachedRemoteRefs
+}
+
+// lsRemoteCall is the in-flight ls-remote call, done is closed once refs
+// and err are set
+type lsRemoteCall struct {
+	done chan struct{}
+	refs map[string]string
+	err  error
+}
+
+type cachedRemoteRefs struct {
+	refs    map[string]string
+	expires time.Time
+}
+
+// snapshotRemoteConfig returns snapshot of the config used by the commands
+// which talk to the remote, it must be called with repository lock held or
+// before repository is used
+func (r *Repository) snapshotRemoteConfig(cacheTTL time.Duration) *remoteConfig {
+	return &remoteConfig{
+		auth:          r.auth,
+		envs:          r.envs,
+		runner:        r.runner,
+		gitOps:        r.gitOps,
+		gitConfig:     r.remoteArgs(),
+		gitTimeout:    r.gitTimeout,
+		mirrorTimeout: r.mirrorTimeout,
+		proxyURL:      r.proxyURL,
+		cacheTTL:      cacheTTL,
+	}
+}
+
+// storeRemoteConfig updates config snapshot used by the remote queries and
+// drops cached results, it must be called with repository lock held or
+// before repository is used
+func (r *Repository) storeRemoteConfig(cacheTTL time.Duration) {
+	r.remoteConf.Store(r.snapshotRemoteConfig(cacheTTL))
+
+	r.remoteQuery.lock.Lock()
+	r.remoteQuery.cache = nil
+	r.remoteQuery.lock.Unlock()
+}
+
+// ListRemoteRefs returns refs of the remote matching any of the given
+// patterns with their hashes as currently seen on the remote, not as of the
+// last mirror cycle. patterns are matched same as 'git ls-remote' ie. pattern
+// matches tail of the ref name, all refs are returned if no pattern is given.
+// annotated tags are also listed peeled with '^{}' suffix.
+// it doesn't take repository lock so it's not blocked by running mirror
+// cycle, but repository must have been initialised by the first mirror.
+// concurrent calls with same patterns share single ls-remote and results are
+// cached for RemoteRefsCacheTTL if configured.
+func (r *Repository) ListRemoteRefs(ctx context.Context, patterns ...string) (map[string]string, error) {
+	if r.Paused() {
+		return nil, ErrPaused
+	}
+	refs, err := r.queryRemoteRefs(ctx, patterns)
+	if err != nil {
+		return nil, err
+	}
+	return maps.Clone(refs), nil
+}
+
+// RemoteHash returns the commit hash of the given ref as currently seen on
+// the remote. ref can be 'HEAD', full ref name (eg. 'refs/heads/main') or
+// short branch or tag name, branches take precedence over tags and tags are
+// resolved to the commit they point to. see ListRemoteRefs.
+func (r *Repository) RemoteHash(ctx context.Context, ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	refs, err := r.ListRemoteRefs(ctx, ref, ref+"^{}")
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []string{ref}
+	if ref != "HEAD" && !strings.HasPrefix(ref, "refs/") {
+		candidates = []string{"refs/heads/" + ref, "refs/tags/" + ref}
+	}
+	for _, name := range candidates {
+		if hash, ok := refs[name+"^{}"]; ok {
+			return hash, nil
+		}
+		if hash, ok := refs[name]; ok {
+			return hash, nil
+		}
+	}
+	return "", fmt.Errorf("%w: ref:%s not found on the remote", ErrRefNotFound, ref)
+}
+
+// queryRemoteRefs returns cached refs of the given patterns if not expired,
+// otherwise it joins in-flight ls-remote call with same patterns or starts
+// new one. returned map must not be modified.
+func (r *Repository) queryRemoteRefs(ctx context.Context, patterns []string) (map[string]string, error) {
+	conf := r.remoteConf.Load()
+
+	patterns = slices.Clone(patterns)
+	slices.Sort(patterns)
+	key := strings.Join(slices.Compact(patterns), "\n")
+
+	q := &r.remoteQuery
+	q.lock.Lock()
+	if cached, ok := q.cache[key]; ok && r.now().Before(cached.expires) {
+		q.lock.Unlock()
+		return cached.refs, nil
+	}
+	call, ok := q.calls[key]
+	if !ok {
+		call = &lsRemoteCall{done: make(chan struct{})}
+		if q.calls == nil {
+			q.calls = make(map[string]*lsRemoteCall)
+		}
+		q.calls[key] = call
+
+		// call is not bound to the context of the first caller so that
+		// other waiting callers are not affected if its cancelled
+		go r.runRemoteQuery(conf, key, patterns, call)
+	}
+	q.lock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.refs, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runRemoteQuery runs ls-remote of the call and caches result if successful
+func (r *Repository) runRemoteQuery(conf *remoteConfig, key string, patterns []string, call *lsRemoteCall) {
+	timeout := conf.gitTimeout
+	if timeout <= 0 {
+		timeout = conf.mirrorTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	defer cancel()
+
+	call.refs, call.err = r.lsRemotePatterns(ctx, conf, patterns)
+
+	q := &r.remoteQuery
+	q.lock.Lock()
+	delete(q.calls, key)
+	if call.err == nil && conf.cacheTTL > 0 && r.remoteConf.Load() == conf {
+		if q.cache == nil {
+			q.cache = make(map[string]cachedRemoteRefs)
+		}
+		q.cache[key] = cachedRemoteRefs{refs: call.refs, expires: r.now().Add(conf.cacheTTL)}
+	}
+	q.lock.Unlock()
+
+	close(call.done)
+}
+
+// lsRemotePatterns returns refs of the remote matching the patterns using
+// given config snapshot, repository lock is not required
+func (r *Repository) lsRemotePatterns(ctx context.Context, conf *remoteConfig, patterns []string) (map[string]string, error) {
+	envs, err := r.remoteAuthEnv(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// patterns are never parsed as options as they are after the remote
+	args := slices.Concat(conf.gitConfig, []string{"ls-remote", "origin"}, patterns)
+	// git [-c <key>=<value>...] ls-remote origin [<patterns>...]
+	out, err := runGitCommand(ctx, r.log, conf.gitOps, conf.runner, slices.Concat(conf.envs, envs), r.dir, args...)
+	if err != nil {
+		err = classifyGitErr(err)
+		r.credentialFailed(err)
+		return nil, err
+	}
+	return parseLsRemote(out), nil
+}
@@ -0,0 +1,250 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// replicaDir returns abs path of the repository dir in the given replica root
+func (r *Repository) replicaDir(replicaRoot string) string {
+	return filepath.Join(replicaRoot, filepath.Base(r.dir))
+}
+
+// replicaWorktreesRoot returns abs path for all the worktrees of the repo
+// in the given replica root
+func (r *Repository) replicaWorktreesRoot(replicaRoot string) string {
+	return filepath.Join(r.replicaDir(replicaRoot), ".worktrees")
+}
+
+// replicaLink returns path of the worktree link in the given replica root.
+// only links under the repository root can be replicated
+func (r *Repository) replicaLink(replicaRoot string, wl *WorkTreeLink) (string, bool) {
+	rel, err := filepath.Rel(r.root, wl.link)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return filepath.Join(replicaRoot, rel), true
+}
+
+// syncReplicas copies published worktrees to all the replica roots. failure
+// to sync a replica is logged and recorded but doesn't fail the mirror.
+// it must be called with write lock held
+func (r *Repository) syncReplicas() {
+	for _, replicaRoot := range r.replicaRoots {
+		if err := r.syncReplica(replicaRoot); err != nil {
+			r.log.Error("unable to sync replica", "replica", replicaRoot, "err", err)
+			recordReplicaSyncFailure(r.gitURL.Repo, replicaRoot)
+		}
+	}
+}
+
+// syncReplica copies published worktree of each link to the replica root
+// and publishes it using the same atomic symlink swap as primary. worktrees
+// which are no longer published on primary are removed from the replica.
+func (r *Repository) syncReplica(replicaRoot string) error {
+	wtRoot := r.replicaWorktreesRoot(replicaRoot)
+	if err := os.MkdirAll(wtRoot, defaultDirMode); err != nil {
+		return fmt.Errorf("unable to create replica worktrees dir err:%w", err)
+	}
+
+	var errs []error
+	var currentWTDirs []string
+
+	for _, wl := range r.workTreeLinks {
+		link, ok := r.replicaLink(replicaRoot, wl)
+		if !ok {
+			wl.log.Debug("link is outside of the repository root, skipping replica", "replica", replicaRoot)
+			continue
+		}
+
+		wt, err := wl.currentWorktree()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to read worktree link:%s err:%w", wl.link, err))
+			continue
+		}
+
+		// worktree is not published on primary, remove it from replica
+		if wt == "" {
+			if err := removeReplicaLink(replicaRoot, link); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		_, wtDir := splitAbs(wt)
+		currentWTDirs = append(currentWTDirs, wtDir)
+
+		if err := r.syncReplicaLink(wl, wt, link, filepath.Join(wtRoot, wtDir)); err != nil {
+			errs = append(errs, fmt.Errorf("unable to sync link:%s err:%w", link, err))
+		}
+	}
+
+	// remove old worktrees which are no longer linked
+	err := removeDirContentsIf(replicaRoot, wtRoot, r.log, func(fi os.FileInfo) (bool, error) {
+		if !slices.Contains(currentWTDirs, fi.Name()) && time.Since(fi.ModTime()) > staleTimeout {
+			r.log.Info("removing stale replica worktree", "replica", replicaRoot, "worktree", fi.Name())
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// syncReplicaLink copies given primary worktree to the replica worktree path
+// if its not already published on the replica link
+func (r *Repository) syncReplicaLink(wl *WorkTreeLink, wt, link, replicaWT string) error {
+	current, err := readAbsLink(link)
+	if err != nil {
+		return err
+	}
+
+	if current != replicaWT {
+		// worktree might already be copied for other link which shares it
+		if _, err := os.Stat(replicaWT); os.IsNotExist(err) {
+			if err := copyWorktreeAtomic(wt, replicaWT); err != nil {
+				return err
+			}
+		}
+		if err := publishSymlink(link, replicaWT, wl.linkDirMode()); err != nil {
+			return fmt.Errorf("unable to publish symlink err:%w", err)
+		}
+		wl.log.Info("replica worktree published", "link", link, "path", replicaWT)
+	}
+
+	// keep hash file of replica in sync with primary
+	data, err := os.ReadFile(wl.hashFile())
+	if err != nil {
+		return fmt.Errorf("unable to read hash file err:%w", err)
+	}
+	if existing, _ := os.ReadFile(link + hashFileSuffix); string(existing) != string(data) {
+		return writeFileAtomic(link+hashFileSuffix, data)
+	}
+	return nil
+}
+
+// removeReplicaLink removes replica link and its hash file if exists
+func removeReplicaLink(replicaRoot, link string) error {
+	for _, path := range []string{link, link + hashFileSuffix} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove replica link err:%w", err)
+		}
+	}
+	return removeEmptyParents(replicaRoot, link)
+}
+
+// removeReplicas removes replica links of all the worktrees and replica
+// repository dir if deleteRepoDir is set.
+// it must be called with write lock held
+func (r *Repository) removeReplicas(deleteRepoDir bool) error {
+	var errs []error
+	for _, replicaRoot := range r.replicaRoots {
+		for _, wl := range r.workTreeLinks {
+			if link, ok := r.replicaLink(replicaRoot, wl); ok {
+				if err := removeReplicaLink(replicaRoot, link); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		if deleteRepoDir {
+			r.log.Info("removing replica repository dir", "path", r.replicaDir(replicaRoot))
+			if err := safeRemoveAll(replicaRoot, r.replicaDir(replicaRoot)); err != nil {
+				errs = append(errs, fmt.Errorf("unable to remove replica dir err:%w", err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyWorktreeAtomic copies worktree to tmp dir first and then renames it to
+// dst so that partially copied tree is never visible at dst. existing dst is
+// replaced.
+func copyWorktreeAtomic(wt, dst string) error {
+	tmp := dst + ".tmp-" + nextRandom()
+	if err := copyWorktree(wt, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("unable to copy worktree err:%w", err)
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return nil
+}
+
+// copyWorktree copies checked out files of the worktree to dst, files are
+// hard linked if possible. `.git` file of the worktree is not copied as
+// replica is not a git worktree.
+func copyWorktree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			l, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(l, target)
+		default:
+			// hard link only works on the same device
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+// copyFile copies content of the src file to new dst file
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -2,48 +2,140 @@ package mirror
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/utilitywarehouse/git-mirror/pkg/giturl"
+	"github.com/utilitywarehouse/git-mirror/pkg/lock"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	ErrExist    = fmt.Errorf("repo already exist")
 	ErrNotExist = fmt.Errorf("repo does not exist")
+
+	// ErrAmbiguous is returned if repo name matches more than one
+	// repository of the pool
+	ErrAmbiguous = fmt.Errorf("repo name is ambiguous")
+
+	// ErrInitialMirrorFailed is returned by AddRepositoryAndStart if repository
+	// is added to the pool but its initial mirror failed
+	ErrInitialMirrorFailed = fmt.Errorf("initial mirror failed")
+
+	// ErrShutdownIncomplete is returned by Shutdown if mirror loops of some
+	// repositories didn't stop before deadline
+	ErrShutdownIncomplete = fmt.Errorf("mirror loops didn't stop before shutdown deadline")
 )
 
+const defaultMirrorConcurrency = 5
+
 // RepoPool represents the collection of mirrored repositories
-// it provides simple wrapper around Repository methods.
+// it provides simple wrapper around Repository methods. wrappers identify
+// repository by its remote URL, repo name or worktree link path, see Lookup.
 // A RepoPool is safe for concurrent use by multiple goroutines.
 type RepoPool struct {
-	log   *slog.Logger
-	repos []*Repository
+	log               *slog.Logger
+	lock              lock.RWMutex           // protects repos list and links index
+	links             map[string]*Repository // repositories keyed by abs paths of their worktree links, see RepositoryByLink
+	repos             []*Repository
+	mirrorConcurrency int                  // max number of repositories mirrored concurrently by MirrorAll
+	subscribers       []chan<- RefChange   // pool wide ref change subscribers
+	commonEnvs        []string             // envs passed to all repositories of the pool
+	paused            bool                 // repositories added to the pool are paused
+	gitOps            *gitOpsLimiter       // limits concurrent git commands of all repositories
+	audit             *auditLog            // audit log of published content changes and http requests, nil if not enabled
+	manifest          *manifest            // published links of all the repositories, see Manifest
+	events            *eventStream         // events of the pool, see Events
+	jitter            float64              // max random delay added to the interval of all repositories
+	startupStagger    time.Duration        // window over which first mirror cycles are spread by StartLoop
+	runner            GitRunner            // runs git commands of the repositories created by the pool, nil means default
+	authorizer        Authorizer           // authorizes requests of the http handlers, nil rejects requests changing the state
+	lockPublic        bool                 // public http handlers require read-only role
+	ctx               context.Context      // parent context of the mirror loops started by the pool, cancelled by Shutdown
+	cancel            context.CancelFunc   // cancels ctx
+	tracerProvider    trace.TracerProvider // tracer provider of the repositories, nil if not set
 }
 
 // NewRepoPool will create mirror repositories based on given config.
 // Remote repo will not be mirrored until either Mirror() or StartLoop() is called
 func NewRepoPool(conf RepoPoolConfig, log *slog.Logger, commonENVs []string) (*RepoPool, error) {
+	return NewRepoPoolWithRunner(conf, log, commonENVs, nil)
+}
+
+// NewRepoPoolWithRunner creates repo pool same as NewRepoPool but all the
+// repositories created by the pool, including repositories added or
+// re-created later, run git commands using given runner. default runner is
+// used if runner is nil.
+func NewRepoPoolWithRunner(conf RepoPoolConfig, log *slog.Logger, commonENVs []string, runner GitRunner) (*RepoPool, error) {
 	if err := conf.ValidateDefaults(); err != nil {
 		return nil, err
 	}
 
+	if err := conf.FilterRepositories(); err != nil {
+		return nil, err
+	}
+
 	if err := conf.ValidateLinkPaths(); err != nil {
 		return nil, err
 	}
 
+	setMetricLabelKeys(conf.Defaults.MetricLabels)
+
+	noAuth := conf.RemotesWithoutAuth()
 	conf.ApplyDefaults()
 
 	if log == nil {
 		log = slog.Default()
 	}
 
-	rp := &RepoPool{log: log}
+	// public repositories can be mirrored without auth
+	for _, remote := range noAuth {
+		log.Warn("no auth config found for the remote, it must allow unauthenticated access", "remote", remote)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rp := &RepoPool{
+		ctx:               ctx,
+		cancel:            cancel,
+		log:               log,
+		mirrorConcurrency: conf.Defaults.MirrorConcurrency,
+		commonEnvs:        commonENVs,
+		gitOps:            newGitOpsLimiter(conf.Defaults.MaxConcurrentGitOps),
+		events:            &eventStream{log: log},
+		jitter:            defaultJitter,
+		startupStagger:    conf.Defaults.StartupStagger,
+		runner:            runner,
+	}
+	if conf.Defaults.Jitter != nil {
+		rp.jitter = *conf.Defaults.Jitter
+	}
+
+	manifestPath := conf.Defaults.ManifestPath
+	if manifestPath == "" && conf.Defaults.Root != "" {
+		manifestPath = filepath.Join(conf.Defaults.Root, defaultManifestFile)
+	}
+	rp.manifest = newManifest(manifestPath, log)
+
+	if conf.Defaults.AuditLogPath != "" {
+		audit, err := newAuditLog(conf.Defaults.AuditLogPath, log)
+		if err != nil {
+			return nil, err
+		}
+		rp.audit = audit
+	}
 
 	for _, repoConf := range conf.Repositories {
 
-		repo, err := NewRepository(repoConf, commonENVs, log)
+		repo, err := NewRepositoryWithRunner(repoConf, commonENVs, runner, log)
 		if err != nil {
 			return nil, err
 		}
@@ -59,35 +151,230 @@ func NewRepoPool(conf RepoPoolConfig, log *slog.Logger, commonENVs []string) (*R
 // AddRepository will add given repository to repoPool.
 // Remote repo will not be mirrored until either Mirror() or StartLoop() is called
 func (rp *RepoPool) AddRepository(repo *Repository) error {
-	if repo, _ := rp.Repository(repo.remote); repo != nil {
-		return ErrExist
+	rp.lock.Lock()
+	err := rp.addRepository(repo)
+	rp.lock.Unlock()
+
+	if err == nil {
+		rp.events.emit(Event{Type: EventRepositoryAdded, Time: time.Now(), Remote: repo.remote})
+	}
+	return err
+}
+
+// addRepository adds repository to the pool, caller must hold the pool lock
+func (rp *RepoPool) addRepository(repo *Repository) error {
+	for _, r := range rp.repos {
+		if giturl.SameURL(r.gitURL, repo.gitURL) {
+			return ErrExist
+		}
 	}
 
+	repo.setGitOps(rp.gitOps)
+	repo.setJitter(rp.jitter)
+	repo.setAuditLog(rp.audit)
+	repo.setManifest(rp.manifest)
+	repo.setEventStream(rp.events)
+	repo.setLinkIndex(rp.updateLinkIndex)
+	if rp.tracerProvider != nil {
+		repo.SetTracerProvider(rp.tracerProvider)
+	}
 	rp.repos = append(rp.repos, repo)
+	repo.lock.RLock()
+	rp.indexLinks(repo, repo.linkPaths())
+	repo.lock.RUnlock()
+	for _, ch := range rp.subscribers {
+		repo.Subscribe(ch)
+	}
+	if rp.paused {
+		repo.Pause()
+	}
+
+	return nil
+}
+
+// AddRepositoryAndStart creates repository from the given config and adds it
+// to the pool after validating its worktree links against existing
+// repositories. it then runs initial mirror bounded by repository's
+// MirrorTimeout and starts the mirror loop.
+// if initial mirror fails repository is kept in the pool with running loop
+// and error wrapping ErrInitialMirrorFailed is returned so caller can decide
+// to roll back using RemoveRepository. config must have defaults applied.
+func (rp *RepoPool) AddRepositoryAndStart(ctx context.Context, repoConf RepositoryConfig) error {
+	repo, err := newRepository(ctx, repoConf, rp.commonEnvs, rp.runner, rp.log)
+	if err != nil {
+		return err
+	}
+
+	// validate and add under same lock so concurrent adds can't
+	// publish overlapping links
+	rp.lock.Lock()
+	for _, link := range repo.reservedLinkPaths() {
+		if err := linkOverlaps(rp.repos, link); err != nil {
+			rp.lock.Unlock()
+			return err
+		}
+	}
+	err = rp.addRepository(repo)
+	rp.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	rp.events.emit(Event{Type: EventRepositoryAdded, Time: time.Now(), Remote: repo.remote})
+
+	mCtx, cancel := context.WithTimeout(ctx, repo.mirrorTimeout)
+	mErr := repo.Mirror(mCtx)
+	cancel()
+	recordGitMirror(repo.gitURL.Repo, mErr)
+
+	// loop is marked as running before its started so that RemoveRepository
+	// called right after can stop it
+	rp.startLoop(repo, true, 0)
+
+	if mErr != nil {
+		return fmt.Errorf("%w remote:%s err:%w", ErrInitialMirrorFailed, repo.remote, mErr)
+	}
+	return nil
+}
+
+// repositories returns a snapshot of the repositories in the pool
+func (rp *RepoPool) repositories() []*Repository {
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+
+	return slices.Clone(rp.repos)
+}
+
+// RemoveRepository will stop mirror loop of the given repository and remove it
+// from the repoPool along with all its published worktree links.
+// if deleteRepoDir is true mirrored repository dir and its worktrees will
+// also be deleted from the disk. In case of partial clean up failure repository
+// is kept in the pool with stopped mirror loop and error is returned so caller
+// can retry.
+func (rp *RepoPool) RemoveRepository(remote string, deleteRepoDir bool) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+
+	// wait for the current mirror cycle to finish before removing files
+	repo.StopLoop()
+
+	if err := repo.remove(deleteRepoDir); err != nil {
+		return fmt.Errorf("unable to clean up repository remote:%s err:%w", repo.remote, err)
+	}
+
+	rp.lock.Lock()
+	rp.repos = slices.DeleteFunc(rp.repos, func(r *Repository) bool { return r == repo })
+	rp.indexLinks(repo, nil)
+	rp.lock.Unlock()
+
+	rp.manifest.remove(repo.remote)
+	deleteMetrics(repo.gitURL.Repo)
+	rp.events.emit(Event{Type: EventRepositoryRemoved, Time: time.Now(), Remote: repo.remote})
+
+	return nil
+}
+
+// UpdateRepositoryConfig applies updated config to the existing repository
+// with the given remote. interval, fetch window, mirror timeout, gc, auth, envs
+// and git exec path are updated in place.
+// if remote url, root, mirrored refs (refspecs or single branch) or depth of
+// the repository are changed then repository is removed and re-created with
+// the new config, mirror loop is restarted if it was running.
+// config must have defaults applied.
+func (rp *RepoPool) UpdateRepositoryConfig(ctx context.Context, remote string, repoConf RepositoryConfig) error {
+	repo, err := rp.Repository(remote)
+	if err != nil {
+		return err
+	}
 
+	err = repo.UpdateConfig(ctx, repoConf)
+	if !errors.Is(err, ErrRecreateRequired) {
+		return err
+	}
+
+	// new remote must not be mirrored by other repository of the pool
+	if existing, err := rp.Repository(repoConf.Remote); err == nil && existing != repo {
+		return ErrExist
+	}
+
+	rp.log.Info("re-creating repository to apply config", "repo", repo.gitURL.Repo)
+
+	newRepo, err := newRepository(ctx, repoConf, repo.commonEnvs, repo.customRunner(), rp.log)
+	if err != nil {
+		return fmt.Errorf("unable to create repository remote:%s err:%w", giturl.Redact(repoConf.Remote), err)
+	}
+
+	running := repo.loopRunning()
+	if repo.Paused() {
+		newRepo.Pause()
+	}
+	if err := rp.RemoveRepository(repo.remote, false); err != nil {
+		return err
+	}
+	if err := rp.AddRepository(newRepo); err != nil {
+		return err
+	}
+	if running {
+		rp.startLoop(newRepo, false, 0)
+	}
 	return nil
 }
 
 // MirrorAll will trigger mirror on every repo in foreground with given timeout.
-// It will error out if any of the repository mirror errors.
+// Repositories are mirrored concurrently, limited by the configured mirror
+// concurrency and timeout applies to each repository mirror separately.
+// It will return joined errors of all the failed repository mirrors.
 // Ideally MirrorAll should be used for the first mirror cycle to ensure repositories are
 // successfully mirrored
 func (rp *RepoPool) MirrorAll(ctx context.Context, timeout time.Duration) error {
-	for _, repo := range rp.repos {
-		mCtx, cancel := context.WithTimeout(ctx, timeout)
-		err := repo.Mirror(mCtx)
-		cancel()
-		if err != nil {
-			return fmt.Errorf("repository mirror failed err:%w", err)
-		}
+	_, err := rp.MirrorAllWithResult(ctx, timeout)
+	return err
+}
+
+// MirrorAllWithResult mirrors all repositories same as MirrorAll and also
+// returns results of all the repositories keyed by remote URL
+func (rp *RepoPool) MirrorAllWithResult(ctx context.Context, timeout time.Duration) (map[string]MirrorResult, error) {
+	concurrency := rp.concurrency(0)
+
+	repos := rp.repositories()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    []error
+		results = make(map[string]MirrorResult, len(repos))
+		sem     = make(chan struct{}, concurrency)
+	)
+
+	for _, repo := range repos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(repo *Repository) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			mCtx, cancel := context.WithTimeout(ctx, timeout)
+			result, err := repo.MirrorWithResult(mCtx)
+			cancel()
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[repo.remote] = result
+			if err != nil {
+				errs = append(errs, fmt.Errorf("repository mirror failed remote:%s err:%w", repo.remote, err))
+			}
+		}(repo)
 	}
+	wg.Wait()
 
-	return nil
+	return results, errors.Join(errs...)
 }
 
 // Mirror is wrapper around repositories Mirror method
 func (rp *RepoPool) Mirror(ctx context.Context, remote string) error {
-	repo, err := rp.Repository(remote)
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return err
 	}
@@ -95,25 +382,99 @@ func (rp *RepoPool) Mirror(ctx context.Context, remote string) error {
 	return repo.Mirror(ctx)
 }
 
+// MirrorWithResult is wrapper around repositories MirrorWithResult method
+func (rp *RepoPool) MirrorWithResult(ctx context.Context, remote string) (MirrorResult, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return MirrorResult{}, err
+	}
+
+	return repo.MirrorWithResult(ctx)
+}
+
+// QueueMirrorRun is wrapper around repositories QueueMirrorRun method
+func (rp *RepoPool) QueueMirrorRun(remote string) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+	repo.QueueMirrorRun()
+	return nil
+}
+
+// RunGC is wrapper around repositories RunGC method
+func (rp *RepoPool) RunGC(ctx context.Context, remote, mode string) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+	return repo.RunGC(ctx, mode)
+}
+
+// RunScheduledGC runs scheduled gc of all the repositories which are due, see
+// Repository.RunScheduledGC. it returns joined errors of the failed gc runs.
+func (rp *RepoPool) RunScheduledGC(ctx context.Context) error {
+	var errs []error
+	for _, repo := range rp.repositories() {
+		if _, err := repo.RunScheduledGC(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("scheduled gc failed remote:%s err:%w", repo.remote, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // StartLoop will start mirror loop on all repositories
-// if its not already started
+// if its not already started. if StartupStagger is configured first mirror
+// cycles of the started loops are spread evenly over the stagger window.
 func (rp *RepoPool) StartLoop() {
-	for _, repo := range rp.repos {
-		if !repo.running {
-			go repo.StartLoop(context.TODO())
+	var start []*Repository
+	for _, repo := range rp.repositories() {
+		// loop is marked as running before returning so that it can be
+		// stopped right away
+		if repo.beginLoop() {
+			start = append(start, repo)
 			continue
 		}
 		rp.log.Info("start loop is already running", "repo", repo.gitURL.Repo)
 	}
+
+	for i, repo := range start {
+		delay := rp.startupStagger * time.Duration(i) / time.Duration(len(start))
+		go repo.runLoop(rp.loopContext(), false, delay)
+	}
+}
+
+// startLoop marks mirror loop of the repository as running and starts it
+// with the pool context, it does nothing if loop is already running
+func (rp *RepoPool) startLoop(repo *Repository, waitFirst bool, delay time.Duration) {
+	if !repo.beginLoop() {
+		rp.log.Info("start loop is already running", "repo", repo.gitURL.Repo)
+		return
+	}
+	go repo.runLoop(rp.loopContext(), waitFirst, delay)
+}
+
+// loopContext returns the parent context of the mirror loops started by the
+// pool
+func (rp *RepoPool) loopContext() context.Context {
+	if rp.ctx == nil {
+		return context.Background()
+	}
+	return rp.ctx
 }
 
-// Repository will return Repository object based on given remote URL
+// Repository will return Repository object based on given remote URL.
+// remote URLs are compared after normalisation so different spellings of the
+// same remote (eg. scp and https or with and without .git suffix) match.
 func (rp *RepoPool) Repository(remote string) (*Repository, error) {
 	gitURL, err := giturl.Parse(remote)
 	if err != nil {
 		return nil, err
 	}
 
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+
 	for _, repo := range rp.repos {
 		if giturl.SameURL(repo.gitURL, gitURL) {
 			return repo, nil
@@ -122,9 +483,101 @@ func (rp *RepoPool) Repository(remote string) (*Repository, error) {
 	return nil, ErrNotExist
 }
 
+// RepositoryByName returns repository with given repo name ie last element
+// of the remote path, name is matched with and without .git suffix.
+// ErrAmbiguous is returned if more than one repository has same name.
+func (rp *RepoPool) RepositoryByName(name string) (*Repository, error) {
+	name = strings.TrimSuffix(name, ".git")
+
+	var found []*Repository
+	for _, repo := range rp.repositories() {
+		if strings.EqualFold(strings.TrimSuffix(repo.gitURL.Repo, ".git"), name) {
+			found = append(found, repo)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, ErrNotExist
+	case 1:
+		return found[0], nil
+	default:
+		remotes := make([]string, 0, len(found))
+		for _, repo := range found {
+			remotes = append(remotes, repo.remote)
+		}
+		return nil, fmt.Errorf("%w name:%s remotes:%s", ErrAmbiguous, name, strings.Join(remotes, ","))
+	}
+}
+
+// RepositoryByLink returns repository which has worktree link with the given
+// absolute link path
+func (rp *RepoPool) RepositoryByLink(link string) (*Repository, error) {
+	if !filepath.IsAbs(link) {
+		return nil, fmt.Errorf("link path must be absolute: %s", link)
+	}
+	link = filepath.Clean(link)
+
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+
+	if repo, ok := rp.links[link]; ok {
+		return repo, nil
+	}
+	return nil, ErrNotExist
+}
+
+// updateLinkIndex replaces worktree links of the repository in the link
+// index, links of the repositories which are no longer in the pool are
+// ignored. it must be called without repository lock held.
+func (rp *RepoPool) updateLinkIndex(repo *Repository, links []string) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	if !slices.Contains(rp.repos, repo) {
+		return
+	}
+	rp.indexLinks(repo, links)
+}
+
+// indexLinks replaces worktree links of the repository in the link index,
+// caller must hold the pool lock
+func (rp *RepoPool) indexLinks(repo *Repository, links []string) {
+	maps.DeleteFunc(rp.links, func(_ string, r *Repository) bool { return r == repo })
+	if len(links) == 0 {
+		return
+	}
+	if rp.links == nil {
+		rp.links = make(map[string]*Repository)
+	}
+	for _, link := range links {
+		rp.links[link] = repo
+	}
+}
+
+// Lookup returns repository identified by either its remote URL, absolute
+// path of one of its worktree links or its repo name. if given id could be
+// more than one of those then remote URL takes precedence over link path
+// which takes precedence over repo name.
+func (rp *RepoPool) Lookup(id string) (*Repository, error) {
+	if _, err := giturl.Parse(id); err == nil {
+		repo, err := rp.Repository(id)
+		if !errors.Is(err, ErrNotExist) {
+			return repo, err
+		}
+	}
+	if filepath.IsAbs(id) {
+		repo, err := rp.RepositoryByLink(id)
+		if !errors.Is(err, ErrNotExist) {
+			return repo, err
+		}
+	}
+	return rp.RepositoryByName(id)
+}
+
 // AddWorktreeLink is wrapper around repositories AddWorktreeLink method
 func (rp *RepoPool) AddWorktreeLink(remote string, link, ref, pathspec string) error {
-	repo, err := rp.Repository(remote)
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return err
 	}
@@ -134,14 +587,64 @@ func (rp *RepoPool) AddWorktreeLink(remote string, link, ref, pathspec string) e
 	return repo.AddWorktreeLink(link, ref, pathspec)
 }
 
+// RemoveWorktreeLink is wrapper around repositories RemoveWorktreeLink method
+func (rp *RepoPool) RemoveWorktreeLink(ctx context.Context, remote, link string) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+	return repo.RemoveWorktreeLink(ctx, link)
+}
+
+// ApproveWorktreeUpdate is wrapper around repositories ApproveWorktreeUpdate method
+func (rp *RepoPool) ApproveWorktreeUpdate(remote, link string) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+	return repo.ApproveWorktreeUpdate(link)
+}
+
+// RollbackWorktree is wrapper around repositories RollbackWorktree method
+func (rp *RepoPool) RollbackWorktree(ctx context.Context, remote, link string) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+	return repo.RollbackWorktree(ctx, link)
+}
+
+// ResumeWorktree is wrapper around repositories ResumeWorktree method
+func (rp *RepoPool) ResumeWorktree(remote, link string) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+	return repo.ResumeWorktree(link)
+}
+
 func (rp *RepoPool) validateLinkPath(repo *Repository, link string) error {
-	newAbsLink := absLink(repo.root, link)
+	return linkOverlaps(rp.repositories(), absLink(repo.root, link))
+}
 
-	for _, r := range rp.repos {
-		for _, wl := range r.workTreeLinks {
-			if wl.link == newAbsLink {
+// linkOverlaps returns error if any of the given repositories already has
+// worktree link or auto and tag worktree link dir on the given abs link
+// path, if path is inside the repository dir of any of them or if one link
+// path is a dir of the other. links of the repositories are read under
+// their lock as they are changed by the mirror cycles.
+func linkOverlaps(repos []*Repository, newAbsLink string) error {
+	for _, r := range repos {
+		if isSubPath(r.dir, newAbsLink) {
+			return fmt.Errorf("link path is inside repository dir repo:%s path:%s", r.gitURL.Repo, newAbsLink)
+		}
+		for _, link := range r.reservedLinkPaths() {
+			if link == newAbsLink {
 				return fmt.Errorf("repo with overlapping abs link path found repo:%s path:%s",
-					r.gitURL.Repo, wl.link)
+					r.gitURL.Repo, link)
+			}
+			if isSubPath(link, newAbsLink) || isSubPath(newAbsLink, link) {
+				return fmt.Errorf("repo with nested abs link path found repo:%s path:%s new:%s",
+					r.gitURL.Repo, link, newAbsLink)
 			}
 		}
 	}
@@ -149,18 +652,78 @@ func (rp *RepoPool) validateLinkPath(repo *Repository, link string) error {
 	return nil
 }
 
+// ChangesBetween returns change reports of all repositories keyed by
+// remote for the given time window.
+func (rp *RepoPool) ChangesBetween(ctx context.Context, since, until time.Time) (map[string]ChangeReport, error) {
+	repos := rp.repositories()
+	reports := make(map[string]ChangeReport, len(repos))
+	for _, repo := range repos {
+		report, err := repo.ChangesBetween(ctx, since, until)
+		if err != nil {
+			return nil, err
+		}
+		reports[repo.remote] = report
+	}
+	return reports, nil
+}
+
+// VerifyAll runs Verify on all the repositories in the pool and returns
+// their reports. repositories which couldn't be verified are skipped and
+// their errors are returned along with the reports of the rest.
+func (rp *RepoPool) VerifyAll(ctx context.Context) ([]VerifyReport, error) {
+	repos := rp.repositories()
+	reports := make([]VerifyReport, 0, len(repos))
+	var errs []error
+	for _, repo := range repos {
+		report, err := repo.Verify(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to verify repo:%s err:%w", repo.remote, err))
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports, errors.Join(errs...)
+}
+
+// WorktreeStatus is wrapper around repositories WorktreeStatus method
+func (rp *RepoPool) WorktreeStatus(remote, link string) (WorktreeStatus, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return "", err
+	}
+	return repo.WorktreeStatus(link)
+}
+
 // Hash is wrapper around repositories hash method
 func (rp *RepoPool) Hash(ctx context.Context, remote, ref, path string) (string, error) {
-	repo, err := rp.Repository(remote)
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return "", err
 	}
 	return repo.Hash(ctx, ref, path)
 }
 
+// RemoteHash is wrapper around repositories RemoteHash method
+func (rp *RepoPool) RemoteHash(ctx context.Context, remote, ref string) (string, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return "", err
+	}
+	return repo.RemoteHash(ctx, ref)
+}
+
+// ListRemoteRefs is wrapper around repositories ListRemoteRefs method
+func (rp *RepoPool) ListRemoteRefs(ctx context.Context, remote string, patterns ...string) (map[string]string, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return nil, err
+	}
+	return repo.ListRemoteRefs(ctx, patterns...)
+}
+
 // Subject is wrapper around repositories Subject method
 func (rp *RepoPool) Subject(ctx context.Context, remote, hash string) (string, error) {
-	repo, err := rp.Repository(remote)
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return "", err
 	}
@@ -169,7 +732,7 @@ func (rp *RepoPool) Subject(ctx context.Context, remote, hash string) (string, e
 
 // ChangedFiles is wrapper around repositories ChangedFiles method
 func (rp *RepoPool) ChangedFiles(ctx context.Context, remote, hash string) ([]string, error) {
-	repo, err := rp.Repository(remote)
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return nil, err
 	}
@@ -178,25 +741,88 @@ func (rp *RepoPool) ChangedFiles(ctx context.Context, remote, hash string) ([]st
 
 // ObjectExists is wrapper around repositories ObjectExists method
 func (rp *RepoPool) ObjectExists(ctx context.Context, remote, obj string) error {
-	repo, err := rp.Repository(remote)
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return err
 	}
 	return repo.ObjectExists(ctx, obj)
 }
 
+// PlanAdoption is wrapper around repositories PlanAdoption method
+func (rp *RepoPool) PlanAdoption(ctx context.Context, remote string) ([]AdoptChange, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return nil, err
+	}
+	return repo.PlanAdoption(ctx)
+}
+
+// Archive is wrapper around repositories Archive method
+func (rp *RepoPool) Archive(ctx context.Context, remote string, w io.Writer, ref string, pathspecs []string, format string) (string, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return "", err
+	}
+	return repo.Archive(ctx, w, ref, pathspecs, format)
+}
+
+// CreateBundle is wrapper around repositories CreateBundle method
+func (rp *RepoPool) CreateBundle(ctx context.Context, remote string, w io.Writer, refs ...string) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+	return repo.CreateBundle(ctx, w, refs...)
+}
+
+// RestoreFromBundle is wrapper around repositories RestoreFromBundle method
+func (rp *RepoPool) RestoreFromBundle(ctx context.Context, remote string, rd io.Reader) error {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return err
+	}
+	return repo.RestoreFromBundle(ctx, rd)
+}
+
+// CloneFS is wrapper around repositories CloneFS method
+func (rp *RepoPool) CloneFS(ctx context.Context, remote, ref string, pathspecs []string) (fs.FS, string, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return nil, "", err
+	}
+	return repo.CloneFS(ctx, ref, pathspecs)
+}
+
+// FileContent is wrapper around repositories FileContent method
+func (rp *RepoPool) FileContent(ctx context.Context, remote, ref, path string) ([]byte, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return nil, err
+	}
+	return repo.FileContent(ctx, ref, path)
+}
+
+// ListFiles is wrapper around repositories ListFiles method
+func (rp *RepoPool) ListFiles(ctx context.Context, remote, ref, dir string) ([]string, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return nil, err
+	}
+	return repo.ListFiles(ctx, ref, dir)
+}
+
 // Clone is wrapper around repositories Clone method
-func (rp *RepoPool) Clone(ctx context.Context, remote, dst, branch, pathspec string, rmGitDir bool) (string, error) {
-	repo, err := rp.Repository(remote)
+func (rp *RepoPool) Clone(ctx context.Context, remote, dst, branch string, opts CloneOptions) (string, error) {
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return "", err
 	}
-	return repo.Clone(ctx, dst, branch, pathspec, rmGitDir)
+	return repo.Clone(ctx, dst, branch, opts)
 }
 
 // MergeCommits is wrapper around repositories MergeCommits method
 func (rp *RepoPool) MergeCommits(ctx context.Context, remote, mergeCommitHash string) ([]CommitInfo, error) {
-	repo, err := rp.Repository(remote)
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return nil, err
 	}
@@ -205,7 +831,7 @@ func (rp *RepoPool) MergeCommits(ctx context.Context, remote, mergeCommitHash st
 
 // BranchCommits is wrapper around repositories BranchCommits method
 func (rp *RepoPool) BranchCommits(ctx context.Context, remote, branch string) ([]CommitInfo, error) {
-	repo, err := rp.Repository(remote)
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return nil, err
 	}
@@ -214,9 +840,36 @@ func (rp *RepoPool) BranchCommits(ctx context.Context, remote, branch string) ([
 
 // ListCommitsWithChangedFiles is wrapper around repositories ListCommitsWithChangedFiles method
 func (rp *RepoPool) ListCommitsWithChangedFiles(ctx context.Context, remote, ref1, ref2 string) ([]CommitInfo, error) {
-	repo, err := rp.Repository(remote)
+	repo, err := rp.Lookup(remote)
 	if err != nil {
 		return nil, err
 	}
 	return repo.ListCommitsWithChangedFiles(ctx, ref1, ref2)
 }
+
+// MergeCommitsN is wrapper around repositories MergeCommitsN method
+func (rp *RepoPool) MergeCommitsN(ctx context.Context, remote, mergeCommitHash string, n int) ([]CommitInfo, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return nil, err
+	}
+	return repo.MergeCommitsN(ctx, mergeCommitHash, n)
+}
+
+// BranchCommitsN is wrapper around repositories BranchCommitsN method
+func (rp *RepoPool) BranchCommitsN(ctx context.Context, remote, branch string, n int) ([]CommitInfo, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return nil, err
+	}
+	return repo.BranchCommitsN(ctx, branch, n)
+}
+
+// ListCommits is wrapper around repositories ListCommits method
+func (rp *RepoPool) ListCommits(ctx context.Context, remote, ref1, ref2 string, opts ListCommitsOptions) ([]CommitInfo, error) {
+	repo, err := rp.Lookup(remote)
+	if err != nil {
+		return nil, err
+	}
+	return repo.ListCommits(ctx, ref1, ref2, opts)
+}
@@ -1,9 +1,13 @@
 package mirror
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestRepoPool_validateLinkPath(t *testing.T) {
@@ -19,8 +23,10 @@ func TestRepoPool_validateLinkPath(t *testing.T) {
 				Worktrees: []WorktreeConfig{{Link: "link1"}},
 			},
 			{
-				Remote:    "git@github.com:org/repo2.git",
-				Worktrees: []WorktreeConfig{{Link: "link2"}},
+				Remote:        "git@github.com:org/repo2.git",
+				Worktrees:     []WorktreeConfig{{Link: "link2"}},
+				AutoWorktrees: []AutoWorktreeConfig{{RefGlob: "refs/heads/release/*", LinkTemplate: "releases/{short_ref}"}},
+				TagWorktrees:  []TagWorktreeConfig{{Pattern: "v*", LinkPrefix: "tags/"}},
 			},
 		},
 	}
@@ -44,6 +50,11 @@ func TestRepoPool_validateLinkPath(t *testing.T) {
 		{"add-new-link", rp.repos[1], "link3", false},
 		{"add-new-abs-link", rp.repos[0], filepath.Join(os.TempDir(), "temp", "link1"), false},
 		{"add-new-abs-link", rp.repos[1], filepath.Join(os.TempDir(), "temp", "link2"), false},
+		{"add-link-inside-other-repo-dir", rp.repos[1], filepath.Join(root, "repo1.git", "link"), true},
+		{"add-rel-link-inside-other-repo-dir", rp.repos[1], "repo1.git/.worktrees/link", true},
+		{"add-link-inside-other-repo-auto-dir", rp.repos[0], "releases/1.0", true},
+		{"add-link-inside-other-repo-tag-dir", rp.repos[0], "tags/v1.0.0", true},
+		{"add-link-on-other-repo-tag-dir", rp.repos[0], "tags", true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -54,3 +65,167 @@ func TestRepoPool_validateLinkPath(t *testing.T) {
 		})
 	}
 }
+
+func TestRepoPool_Lookup(t *testing.T) {
+	root := "/tmp/root"
+
+	rpc := RepoPoolConfig{
+		Defaults: DefaultConfig{
+			Root: root, Interval: testInterval, MirrorTimeout: testTimeout, GitGC: "always",
+			AllowLinksOutsideRoot: true,
+		},
+		Repositories: []RepositoryConfig{
+			{
+				Remote:    "git@github.com:org/repo1.git",
+				Worktrees: []WorktreeConfig{{Link: "link1"}, {Link: "/tmp/other/link1"}},
+			},
+			{
+				Remote:    "https://github.com/org/service",
+				Worktrees: []WorktreeConfig{{Link: "link2"}},
+			},
+			{
+				Remote: "git@github.com:org/common.git",
+			},
+			{
+				Remote: "git@gitlab.com:team/common.git",
+			},
+			{
+				Remote:    "file:///srv/git/Local.git",
+				Worktrees: []WorktreeConfig{{Link: "/srv/git/local-link"}},
+			},
+		},
+	}
+
+	rp, err := NewRepoPool(rpc, nil, testENVs)
+	if err != nil {
+		t.Fatalf("unexpected err:%s", err)
+	}
+	repo1, service, local := rp.repos[0], rp.repos[1], rp.repos[4]
+
+	tests := []struct {
+		name    string
+		id      string
+		want    *Repository
+		wantErr error
+	}{
+		{"remote", "git@github.com:org/repo1.git", repo1, nil},
+		{"remote-ssh", "ssh://git@github.com/org/repo1", repo1, nil},
+		{"remote-https", "https://github.com/org/repo1.git", repo1, nil},
+		{"remote-case", "GIT@GITHUB.COM:ORG/REPO1.GIT", repo1, nil},
+		{"remote-trailing-slash", "https://github.com/org/service.git/", service, nil},
+		{"remote-local", "/srv/git/Local", local, nil},
+		{"remote-local-file", "file://localhost/srv/git/Local.git", local, nil},
+		{"remote-not-exist", "git@github.com:org/repo3.git", nil, ErrNotExist},
+		{"name", "repo1", repo1, nil},
+		{"name-git", "service.git", service, nil},
+		{"name-case", "local", local, nil},
+		{"name-ambiguous", "common", nil, ErrAmbiguous},
+		{"name-not-exist", "repo3", nil, ErrNotExist},
+		{"link", "/tmp/root/link1", repo1, nil},
+		{"link-other", "/tmp/other/link1", repo1, nil},
+		{"link-unclean", "/tmp/root/./link2/", service, nil},
+		{"link-local", "/srv/git/local-link", local, nil},
+		{"link-not-exist", "/tmp/root/link3", nil, ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rp.Lookup(tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RepoPool.Lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RepoPool.Lookup() got:%v want:%v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := rp.RepositoryByLink("link1"); err == nil {
+		t.Errorf("RepositoryByLink() expected error for relative link")
+	}
+	if got, err := rp.RepositoryByName("Repo1.git"); err != nil || got != repo1 {
+		t.Errorf("RepositoryByName() got:%v err:%v", got, err)
+	}
+
+	// link index must follow links added and removed after pool is created
+	if err := rp.AddWorktreeLink("repo1", "link3", "", ""); err != nil {
+		t.Fatalf("unable to add worktree link err:%v", err)
+	}
+	if got, err := rp.RepositoryByLink("/tmp/root/link3"); err != nil || got != repo1 {
+		t.Errorf("RepositoryByLink() got:%v err:%v", got, err)
+	}
+	if err := rp.RemoveWorktreeLink(txtCtx, "repo1", "link3"); err != nil {
+		t.Fatalf("unable to remove worktree link err:%v", err)
+	}
+	if _, err := rp.RepositoryByLink("/tmp/root/link3"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("RepositoryByLink() error = %v, want %v", err, ErrNotExist)
+	}
+	if err := rp.RemoveRepository("local", false); err != nil {
+		t.Fatalf("unable to remove repository err:%v", err)
+	}
+	if _, err := rp.RepositoryByLink("/srv/git/local-link"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("RepositoryByLink() error = %v, want %v", err, ErrNotExist)
+	}
+}
+
+func Test_runBatch(t *testing.T) {
+	t.Run("bounded", func(t *testing.T) {
+		var running, maxRunning atomic.Int32
+		got := make([]int, 20)
+		runBatch(context.Background(), len(got), 3, func(i int) {
+			if n := running.Add(1); n > maxRunning.Load() {
+				maxRunning.Store(n)
+			}
+			time.Sleep(5 * time.Millisecond)
+			got[i] = i
+			running.Add(-1)
+		})
+		for i := range got {
+			if got[i] != i {
+				t.Errorf("fn not called for index:%d", i)
+			}
+		}
+		if m := maxRunning.Load(); m > 3 {
+			t.Errorf("max concurrent calls got:%d want:3", m)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		errs := make([]error, 5)
+		runBatch(ctx, len(errs), 1, func(i int) {
+			errs[i] = ctx.Err()
+			if i == 1 {
+				cancel()
+			}
+		})
+		want := []error{nil, nil, context.Canceled, context.Canceled, context.Canceled}
+		for i := range want {
+			if !errors.Is(errs[i], want[i]) {
+				t.Errorf("index:%d got:%v want:%v", i, errs[i], want[i])
+			}
+		}
+	})
+}
+
+func TestRepoPool_concurrency(t *testing.T) {
+	tests := []struct {
+		name string
+		pool int
+		n    int
+		want int
+	}{
+		{"explicit", 3, 2, 2},
+		{"pool", 3, 0, 3},
+		{"default", 0, 0, defaultMirrorConcurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := &RepoPool{mirrorConcurrency: tt.pool}
+			if got := rp.concurrency(tt.n); got != tt.want {
+				t.Errorf("concurrency() got:%d want:%d", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,37 +1,163 @@
 package mirror
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
+	"maps"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/utilitywarehouse/git-mirror/pkg/giturl"
 	"github.com/utilitywarehouse/git-mirror/pkg/lock"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	defaultDirMode     fs.FileMode = os.FileMode(0755) // 'rwxr-xr-x'
 	defaultRefSpec                 = "+refs/*:refs/*"
 	minAllowedInterval             = time.Second
+	staleIntervals                 = 3 // number of missed intervals after which link is stale
+	defaultJitter                  = 0.2
 )
 
 var (
+	// ErrDstNotEmpty is returned by Clone if dst is not empty and
+	// force is not set
+	ErrDstNotEmpty = fmt.Errorf("clone destination is not empty")
+
+	// ErrRecreateRequired is returned when updated config can not be applied
+	// in place and repository needs to be re-created
+	ErrRecreateRequired = fmt.Errorf("repository needs to be re-created to apply config")
+
+	// ErrRepoWTUpdateFailed is returned when mirror cycle fails to update
+	// one of the worktrees, previously published worktree is kept
+	ErrRepoWTUpdateFailed = fmt.Errorf("worktree update failed")
+
+	// ErrNotFound is returned by FileContent and ListFiles if path doesn't
+	// exist at the given ref and by ObjectExists if object doesn't exist
+	ErrNotFound = fmt.Errorf("not found")
+
+	// ErrWorktreeLinkNotFound is returned if worktree link was not added to
+	// the repository
+	ErrWorktreeLinkNotFound = fmt.Errorf("worktree link not found")
+
+	// ErrRefNotMirrored is returned if given ref is not covered by the
+	// configured refspecs or single branch of the repository
+	ErrRefNotMirrored = fmt.Errorf("ref not mirrored")
+
+	// ErrFileModeMismatch is returned if symlinks or executable files of the
+	// checked out worktree don't match the modes recorded in git
+	ErrFileModeMismatch = fmt.Errorf("checked out file mode mismatch")
+
+	// ErrOutsideFetchWindow is returned by the methods which need to query
+	// the remote outside of the configured fetch window
+	ErrOutsideFetchWindow = fmt.Errorf("outside of fetch window")
+
 	gitExecutablePath string
 	staleTimeout      time.Duration = 10 * time.Second // time for stale worktrees to be cleaned up
 
+	// to detect git errors caused by corrupted or missing objects
+	corruptionErrRgx = regexp.MustCompile(`(?i)(is corrupt|bad object|missing (blob|tree|commit) |unable to unpack|unable to read( sha1 file of .*)? [0-9a-f]{7,}|inflate: data stream error|hash mismatch|sha1 mismatch|does not point to a valid object)`)
+
 	// to parse output of "git ls-remote --symref origin HEAD"
 	// ref: refs/heads/xxxx  HEAD
 	remoteDefaultBranchRgx = regexp.MustCompile(`^ref:\s+([^\s]+)\s+HEAD`)
 )
 
+// MirrorPhase is the phase of the mirror cycle
+type MirrorPhase string
+
+const (
+	MirrorPhaseInit     MirrorPhase = "init"
+	MirrorPhaseFetch    MirrorPhase = "fetch"
+	MirrorPhaseWorktree MirrorPhase = "worktree"
+	MirrorPhaseCleanup  MirrorPhase = "cleanup"
+)
+
+// MirrorError is returned by Mirror if mirror cycle fails, it wraps the
+// underlying error so causes (including ErrRepoWTUpdateFailed) can be
+// matched with errors.Is/As
+type MirrorError struct {
+	Phase MirrorPhase
+	Err   error
+}
+
+func (e *MirrorError) Error() string { return e.Err.Error() }
+func (e *MirrorError) Unwrap() error { return e.Err }
+
+// errPhase returns phase of the given mirror error if set
+func errPhase(err error) MirrorPhase {
+	var mErr *MirrorError
+	if errors.As(err, &mErr) {
+		return mErr.Phase
+	}
+	return ""
+}
+
+// failureReason returns reason of the failed mirror cycle, its timeout if
+// cycle was cancelled by the deadline of its context otherwise the failed
+// phase
+func failureReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return string(errPhase(err))
+}
+
+// MirrorStatus is the outcome of the last mirror cycle
+type MirrorStatus struct {
+	// Time is the time when last mirror cycle completed
+	Time time.Time
+	// Phase is the phase of the failed mirror cycle, empty on success
+	Phase MirrorPhase
+	// Err is the error of the failed mirror cycle, nil on success
+	Err error
+	// Skipped is the reason mirror cycle was skipped without initialising
+	// the repository (eg. outside of the fetch window), empty otherwise
+	Skipped string
+}
+
+// MirrorResult is the outcome of the mirror cycle returned by MirrorWithResult
+type MirrorResult struct {
+	// FetchDuration is the time taken by init and fetch phases
+	FetchDuration time.Duration
+	// UpdatedRefs are the refs updated by fetch
+	UpdatedRefs []RefUpdate
+	// Worktrees is the outcome of each worktree link keyed by absolute link
+	// path, its nil if mirror cycle failed before worktrees were ensured
+	Worktrees map[string]WorktreeResult
+	// Skipped is the reason mirror cycle was skipped as repository is not
+	// initialised and remote can't be reached, skipped cycle is neither
+	// success nor failure
+	Skipped string
+}
+
+// WorktreeResult is the outcome of the worktree link in the mirror cycle
+type WorktreeResult struct {
+	// Hash is the commit hash of the worktree, empty if it couldn't be
+	// resolved or worktree is pending
+	Hash string
+	// Updated is set if link was published on new worktree
+	Updated bool
+	// Err is the error of the worktree update, it wraps ErrRepoWTUpdateFailed
+	Err error
+}
+
 func init() {
 	gitExecutablePath = exec.Command("git").String()
 }
@@ -45,93 +171,306 @@ const (
 	gcOff        = "off"
 )
 
+const defaultReinitThreshold = 3
+
+// defaultBackoffFactor is the multiple of the interval used as max failure
+// backoff if its not configured
+const defaultBackoffFactor = 10
+
+// fullFetchInterval is the max number of mirror cycles after which fetch is
+// run even if remote refs haven't changed
+const fullFetchInterval = 10
+
+// maxLinkDirAttempts is the max number of attempts to create link in its dir
+// if dir is pruned concurrently by removal of other link
+const maxLinkDirAttempts = 3
+
 // Repository represents the mirrored repository of the given remote.
 // The implementation borrows heavily from https://github.com/kubernetes/git-sync.
 // A Repository is safe for concurrent use by multiple goroutines.
 type Repository struct {
-	lock          lock.RWMutex             // repository will be locked during mirror
-	gitURL        *giturl.URL              // parsed remote git URL
-	remote        string                   // remote repo to mirror
-	root          string                   // absolute path to the root where repo directory createdabsolute path to the root where repo directory created
-	dir           string                   // absolute path to the repo directory
-	interval      time.Duration            // how long to wait between mirrors
-	mirrorTimeout time.Duration            // the total time allowed for the mirror loop
-	auth          *Auth                    // auth information including ssh key path
-	gitGC         gcMode                   // garbage collection
-	envs          []string                 // envs which will be passed to git commands
-	running       bool                     // indicates if repository is running the mirror loop
-	workTreeLinks map[string]*WorkTreeLink // list of worktrees which will be maintained
-	stop, stopped chan bool                // chans to stop mirror loops
+	lock          lock.RWMutex                 // repository will be locked during mirror
+	gitURL        *giturl.URL                  // parsed remote git URL
+	remote        string                       // remote repo to mirror with its password redacted, used in logs and errors
+	remoteURL     string                       // remote repo url including credentials only used to configure git
+	root          string                       // absolute path to the root where repo directory createdabsolute path to the root where repo directory created
+	replicaRoots  []string                     // absolute paths of the roots where published worktrees are replicated
+	dir           string                       // absolute path to the repo directory
+	interval      time.Duration                // how long to wait between mirrors
+	schedule      *cronSchedule                // cron schedule of the mirrors, used instead of interval if set
+	nextRun       time.Time                    // time when next mirror cycle is due
+	mirrorTimeout time.Duration                // the total time allowed for the mirror loop
+	gitTimeout    time.Duration                // timeout for the git commands which talks to the remote
+	auth          *Auth                        // auth information including ssh key path
+	gitGC         gcMode                       // garbage collection
+	gcInterval    time.Duration                // time between scheduled gc runs
+	lastGC        time.Time                    // start time of the last successful gc run
+	lastGCFailure time.Time                    // start time of the last failed gc run
+	refSpecs      []string                     // fetch refspecs of the origin remote
+	singleBranch  string                       // only mirrored branch, local HEAD is fixed to it
+	trackHead     bool                         // update local HEAD if default branch of the remote changes
+	degradedHead  bool                         // local HEAD was set to fallback branch as remote was unreachable on init
+	skipFetch     bool                         // skip fetch if remote refs haven't changed since last fetch
+	remoteRefs    map[string]string            // remote refs listed before last successful fetch
+	hashCache     *hashCache                   // cached results of Hash, nil if not enabled
+	fetchSkips    int                          // number of consecutive cycles which skipped fetch
+	layoutVersion int                          // version of the on-disk layout of the repo dir
+	fetchWindow   FetchWindow                  // time of the day when remote can be fetched
+	depth         int                          // number of commits to fetch, 0 fetches full history
+	prune         bool                         // remove refs which no longer exist on the remote on fetch
+	pruneTags     bool                         // remove tags which no longer exist on the remote on fetch
+	reinitLimit   int                          // consecutive corruption failures before repo is re-initialised
+	corruptCount  int                          // number of consecutive cycles failed due to corrupted objects
+	failures      int                          // number of consecutive failed mirror cycles
+	maxBackoff    time.Duration                // max wait time between failed mirror cycles
+	fetchRetries  int                          // retries of the transient fetch failures within mirror cycle
+	adopt         bool                         // adopt existing repo dir instead of re-creating it
+	outsideLinks  bool                         // absolute links can be published outside of the root
+	gitConfig     []string                     // '-c key=value' args of the configured git config
+	fetchJobs     int                          // parallel jobs of the fetch, 0 uses git default
+	keepPrevious  int                          // number of previously published worktrees retained per link
+	maxDiskUsage  int64                        // disk quota of the repository in bytes, 0 means no quota
+	maxFSBytes    int64                        // max total size of the files of CloneFS
+	lfs           bool                         // fetch and checkout lfs objects
+	fileModes     bool                         // checkout symlinks and executable bits regardless of core config
+	diskUsage     RepoDiskUsage                // disk usage recorded after last clean up
+	overQuota     bool                         // disk usage is over quota even after aggressive gc
+	usageTime     time.Time                    // time when disk usage was last measured
+	lastQuotaGC   time.Time                    // start time of the last aggressive gc run due to disk quota
+	commonEnvs    []string                     // envs provided by the pool which are common to all repositories
+	envs          []string                     // envs which will be passed to git commands
+	gitExec       string                       // path to the git executable
+	runner        GitRunner                    // runs git commands, see GitRunner
+	gitOps        *gitOpsLimiter               // limits concurrent git commands of the pool, nil means unlimited
+	audit         *auditLog                    // audit log of the pool, nil if not enabled
+	creds         credentialCache              // cached output of the auth credential command
+	manifest      *manifest                    // manifest of the pool, nil if not added to the pool
+	linkIndex     func(*Repository, []string)  // records worktree links in the pool's link index, nil if not added to the pool
+	proxyURL      string                       // proxy used by git commands which talks to the remote
+	labels        map[string]string            // labels of the repository, see RepositoryConfig.Labels
+	labelAttrs    *atomic.Pointer[[]slog.Attr] // labels added to all log records of the repository
+	loopLock      sync.Mutex                   // protects running, stopped and loop state
+	running       bool                         // indicates if repository is running the mirror loop
+	abort         chan bool                    // closed to abort in-flight mirror cycle and stop the loop
+	loopState     LoopState                    // state of the mirror loop, see LoopStatus
+	loopRestarts  int                          // number of times mirror loop was restarted after panic
+	lastPanic     string                       // last panic recovered in the mirror loop
+	lastPanicTime time.Time                    // time of the last panic recovered in the mirror loop
+	jitter        float64                      // max random delay added to the interval as a fraction of it
+	pauseLock     sync.Mutex                   // protects paused, pausedRun and triggered
+	paused        bool                         // skip remote operations, only local phases are run
+	pausedRun     bool                         // mirror run was queued while paused
+	triggered     bool                         // next mirror cycle was queued via QueueMirrorRun
+	windowRun     bool                         // mirror run was queued outside of the fetch window and runs once window opens
+	stateLoaded   bool                         // state file was read on the first mirror cycle
+	stateData     []byte                       // content of the state file last read or written
+	workTreeLinks map[string]*WorkTreeLink     // list of worktrees which will be maintained
+	autoRules     []AutoWorktreeConfig         // rules of the worktree links maintained for matching refs
+	tagRules      []TagWorktreeConfig          // rules of the worktree links maintained for the latest tags
+	maxAutoLinks  int                          // max number of worktree links created by the auto rules
+	stop, stopped chan bool                    // chans to stop mirror loops, stopped is re-created on every start
+	reload        chan bool                    // signals mirror loop to pick up updated config
+	trigger       chan bool                    // signals mirror loop to run mirror cycle immediately
+	history       *changeHistory               // retained history of changes made by mirror cycles
+	subsLock      sync.Mutex                   // protects subscribers
+	subscribers   []chan<- RefChange           // channels notified of updated refs
+	eventsLock    sync.Mutex                   // protects events and pendingEvents
+	events        *eventStream                 // event stream of the pool, nil if not added to the pool
+	pendingEvents []Event                      // events queued under repository lock to be emitted once its released
+	noCloneRev    bool                         // 'clone --revision' is disabled by config
+	emptyTree     string                       // hash of the empty tree in the object format of the mirror
+	tracer        trace.Tracer                 // creates spans of the mirror operations
+	cloneLock     sync.Mutex                   // protects cloneProbed and cloneRevision
+	cloneProbed   bool                         // git version was probed successfully
+	cloneRevision bool                         // git supports 'clone --revision'
+	lastSuccess   time.Time                    // time of the last successful mirror cycle
+	ready         atomic.Bool                  // completed successful mirror cycle since start, read without lock
+	critical      atomic.Bool                  // repository is required for readiness of the pool
+	lastStatus    MirrorStatus                 // outcome of the last mirror cycle
+	remoteConf    atomic.Pointer[remoteConfig] // config used by the remote queries which don't take repository lock
+	remoteQuery   remoteQuery                  // deduplicated and cached remote ref queries
+	now           func() time.Time             // returns current time, can be replaced in tests
 	log           *slog.Logger
 }
 
+// repoDirPath returns path of the bare repository dir under the given root.
+// we are going to create bare repo which caller cannot use directly
+// hence we can add repo dir (with .git suffix to indicate bare repo) to the provided root.
+// this also makes it safe to delete this dir and re-create it if needed
+// also this root could have been shared with other mirror repository (repoPool)
+func repoDirPath(root string, gURL *giturl.URL) string {
+	repoDir := gURL.Repo
+	if !strings.HasSuffix(repoDir, ".git") {
+		repoDir += ".git"
+	}
+	return filepath.Join(root, repoDir)
+}
+
 // NewRepository creates new repository from the given config.
 // Remote repo will not be mirrored until either Mirror() or StartLoop() is called.
 func NewRepository(repoConf RepositoryConfig, envs []string, log *slog.Logger) (*Repository, error) {
+	return NewRepositoryWithRunner(repoConf, envs, nil, log)
+}
+
+// NewRepositoryWithRunner creates new repository from the given config which
+// runs all git commands using given runner. default runner which executes
+// GitExecPath is used if runner is nil.
+func NewRepositoryWithRunner(repoConf RepositoryConfig, envs []string, runner GitRunner, log *slog.Logger) (*Repository, error) {
+	return newRepository(context.Background(), repoConf, envs, runner, log)
+}
+
+// newRepository is NewRepositoryWithRunner which runs the config checks
+// (eg. lfs) with the given context
+func newRepository(ctx context.Context, repoConf RepositoryConfig, envs []string, runner GitRunner, log *slog.Logger) (*Repository, error) {
 	remoteURL := giturl.NormaliseURL(repoConf.Remote)
 
 	gURL, err := giturl.Parse(remoteURL)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRemote, err)
 	}
 
 	if log == nil {
 		log = slog.Default()
 	}
 
-	log = log.With("repo", gURL.Repo)
+	if err := repoConf.validate(); err != nil {
+		return nil, err
+	}
 
-	if !filepath.IsAbs(repoConf.Root) {
-		return nil, fmt.Errorf("repository root '%s' must be absolute", repoConf.Root)
+	reinitLimit := repoConf.ReinitThreshold
+	if reinitLimit == 0 {
+		reinitLimit = defaultReinitThreshold
 	}
 
-	if repoConf.Interval < minAllowedInterval {
-		return nil, fmt.Errorf("provided interval between mirroring is too sort (%s), must be > %s", repoConf.Interval, minAllowedInterval)
+	gcInterval := repoConf.GCInterval
+	if gcInterval == 0 {
+		gcInterval = defaultGCInterval
 	}
 
-	switch repoConf.GitGC {
-	case gcAuto, gcAlways, gcAggressive, gcOff:
-	default:
-		return nil, fmt.Errorf("wrong gc value provided, must be one of %s, %s, %s, %s",
-			gcAuto, gcAlways, gcAggressive, gcOff)
+	var schedule *cronSchedule
+	if repoConf.Schedule != "" {
+		// schedule is already validated
+		schedule, _ = parseSchedule(repoConf.Schedule)
 	}
 
-	// we are going to create bare repo which caller cannot use directly
-	// hence we can add repo dir (with .git suffix to indicate bare repo) to the provided root.
-	// this also makes it safe to delete this dir and re-create it if needed
-	// also this root could have been shared with other mirror repository (repoPool)
-	repoDir := gURL.Repo
-	if !strings.HasSuffix(repoDir, ".git") {
-		repoDir += ".git"
+	attrs := labelAttrs(repoConf.Labels)
+	labelsPtr := &atomic.Pointer[[]slog.Attr]{}
+	labelsPtr.Store(&attrs)
+	log = slog.New(&labelHandler{log.Handler(), labelsPtr}).With("repo", gURL.Repo)
+
+	repoDir := repoDirPath(repoConf.Root, gURL)
+	if prevDir := previousRepoDir(repoConf); prevDir != "" {
+		log.Info("reusing repository dir of the previous remote", "path", prevDir)
+		repoDir = prevDir
 	}
-	repoDir = filepath.Join(repoConf.Root, repoDir)
 
 	repo := &Repository{
 		gitURL:        gURL,
-		remote:        remoteURL,
+		remote:        giturl.Redact(remoteURL),
+		remoteURL:     remoteURL,
 		root:          repoConf.Root,
+		replicaRoots:  repoConf.ReplicaRoots,
 		dir:           repoDir,
 		interval:      repoConf.Interval,
+		schedule:      schedule,
 		mirrorTimeout: repoConf.MirrorTimeout,
+		gitTimeout:    repoConf.GitTimeout,
 		auth:          &repoConf.Auth,
 		log:           log,
 		gitGC:         gcMode(repoConf.GitGC),
-		envs:          envs,
+		gcInterval:    gcInterval,
+		tracer:        newTracer(nil),
+		refSpecs:      repoConf.refSpecs(),
+		singleBranch:  strings.TrimPrefix(repoConf.SingleBranch, "refs/heads/"),
+		trackHead:     repoConf.TrackDefaultBranch,
+		skipFetch:     repoConf.SkipFetchIfUnchanged,
+		noCloneRev:    repoConf.DisableCloneRevision,
+		fetchWindow:   repoConf.FetchWindow,
+		depth:         repoConf.Depth,
+		prune:         repoConf.Prune == nil || *repoConf.Prune,
+		pruneTags:     repoConf.PruneTags,
+		lfs:           repoConf.LFS,
+		fileModes:     repoConf.PreserveFileModes == nil || *repoConf.PreserveFileModes,
+		reinitLimit:   reinitLimit,
+		maxBackoff:    repoConf.MaxFailureBackoff,
+		fetchRetries:  repoConf.fetchRetries(),
+		adopt:         repoConf.AdoptExisting,
+		outsideLinks:  repoConf.AllowLinksOutsideRoot,
+		gitConfig:     gitConfigArgs(repoConf.GitConfig),
+		fetchJobs:     repoConf.FetchJobs,
+		keepPrevious:  repoConf.keepPrevious(),
+		jitter:        defaultJitter,
+		maxDiskUsage:  repoConf.MaxDiskUsageBytes,
+		maxFSBytes:    cloneFSLimit(repoConf.MaxCloneFSBytes),
+		commonEnvs:    envs,
+		envs:          slices.Concat(envs, repoConf.Envs),
+		gitExec:       repoConf.GitExecPath,
+		runner:        runner,
+		proxyURL:      repoConf.ProxyURL,
+		labels:        maps.Clone(repoConf.Labels),
+		labelAttrs:    labelsPtr,
 		workTreeLinks: make(map[string]*WorkTreeLink),
+		autoRules:     slices.Clone(repoConf.AutoWorktrees),
+		tagRules:      slices.Clone(repoConf.TagWorktrees),
+		maxAutoLinks:  repoConf.maxAutoWorktrees(),
 		stop:          make(chan bool),
 		stopped:       make(chan bool),
+		loopState:     LoopStopped,
+		reload:        make(chan bool, 1),
+		trigger:       make(chan bool, 1),
+		history:       newChangeHistory(time.Now()),
+		now:           time.Now,
+	}
+	if repo.runner == nil {
+		repo.runner = execGitRunner{path: repoConf.GitExecPath}
+	}
+	if repo.lfs {
+		if err := validateLFS(ctx, log, repo.runner, repo.envs); err != nil {
+			return nil, err
+		}
+	}
+	repo.critical.Store(repoConf.Critical)
+	if repoConf.EnableHashCache {
+		repo.hashCache = newHashCache()
+	}
+	repo.storeRemoteConfig(repoConf.RemoteRefsCacheTTL)
+
+	// corrupted version file is treated as legacy layout since
+	// migrations are idempotent
+	if repo.layoutVersion, err = repo.readLayoutVersion(); err != nil {
+		log.Error("unable to read layout version, assuming legacy layout", "err", err)
+	}
+	if repo.layoutVersion > currentLayoutVersion {
+		log.Error("repository layout is newer than supported, mirror is disabled to protect existing data",
+			"version", repo.layoutVersion, "supported", currentLayoutVersion)
+	}
+
+	if len(repo.gitConfig) > 0 || repo.fetchJobs > 0 {
+		repo.log.Debug("using git config", "config", repo.gitConfig, "fetch-jobs", repo.fetchJobs)
 	}
 
 	for _, wtc := range repoConf.Worktrees {
-		if err := repo.AddWorktreeLink(wtc.Link, wtc.Ref, wtc.Ref); err != nil {
-			return nil, fmt.Errorf("unable to create worktree link err:%w", err)
+		if err := repo.addWorktreeLink(wtc); err != nil {
+			return nil, fmt.Errorf("%w: unable to create worktree link err:%w", ErrInvalidWorktree, err)
 		}
 	}
+	setRepoMetricLabels(gURL.Repo, repo.labels)
 	return repo, nil
 }
 
 // AddWorktreeLink adds add workTree link to the mirror repository.
 func (r *Repository) AddWorktreeLink(link, ref, pathspec string) error {
+	defer r.updateLinkIndex()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.addWorktreeLink(WorktreeConfig{Link: link, Ref: ref, Pathspec: pathspec})
+}
+
+func (r *Repository) addWorktreeLink(wtc WorktreeConfig) error {
+	link, ref := wtc.Link, wtc.Ref
+
 	if link == "" {
 		return fmt.Errorf("symlink path cannot be empty")
 	}
@@ -141,40 +480,259 @@ func (r *Repository) AddWorktreeLink(link, ref, pathspec string) error {
 	}
 
 	linkAbs := absLink(r.root, link)
+	if err := validateLinkTarget(linkAbs, r.root, r.dir, r.outsideLinks); err != nil {
+		return err
+	}
 
-	if ref == "" {
-		ref = "HEAD"
+	if wtc.RefPattern != "" {
+		if ref != "" {
+			return fmt.Errorf("only one of ref or ref pattern can be set link:%s ref:%s pattern:%s", link, ref, wtc.RefPattern)
+		}
+		if err := wtc.RefSort.validate(); err != nil {
+			return err
+		}
+		if !refMatchesRefSpecs("refs/tags/"+wtc.RefPattern, r.refSpecs) {
+			return fmt.Errorf("%w link:%s pattern:%s refspecs:%s", ErrRefNotMirrored, link, wtc.RefPattern, r.refSpecs)
+		}
+	} else {
+		if ref == "" {
+			ref = "HEAD"
+		}
+		if !refMatchesRefSpecs(ref, r.refSpecs) {
+			return fmt.Errorf("%w link:%s ref:%s refspecs:%s", ErrRefNotMirrored, link, ref, r.refSpecs)
+		}
+	}
+
+	if err := wtc.RefPrecedence.validate(); err != nil {
+		return err
+	}
+
+	if err := wtc.Submodules.validate(); err != nil {
+		return err
+	}
+
+	if err := wtc.PublishMode.validate(); err != nil {
+		return err
+	}
+
+	perms, err := wtc.Permissions.parse()
+	if err != nil {
+		return fmt.Errorf("invalid permissions link:%s err:%w", link, err)
+	}
+
+	if wtc.Sparse {
+		if wtc.Pathspec == "" {
+			return fmt.Errorf("sparse checkout requires pathspec link:%s", link)
+		}
+		if strings.ContainsAny(wtc.Pathspec, "*?[") || strings.HasPrefix(wtc.Pathspec, ":") {
+			return fmt.Errorf("sparse checkout only supports plain directory pathspec, glob patterns are not supported link:%s pathspec:%s", link, wtc.Pathspec)
+		}
 	}
 
 	_, linkFile := splitAbs(link)
 
 	wt := &WorkTreeLink{
-		name:     linkFile,
-		link:     linkAbs,
-		ref:      ref,
-		pathspec: pathspec,
-		log:      r.log.With("worktree", linkFile),
+		name:       linkFile,
+		link:       linkAbs,
+		ref:        ref,
+		refPattern: wtc.RefPattern,
+		refSort:    wtc.RefSort,
+		refPrec:    wtc.RefPrecedence,
+		pathspec:   wtc.Pathspec,
+		sparse:     wtc.Sparse,
+		submodules: wtc.Submodules,
+		strictSpec: wtc.FailOnEmptyPathspec,
+		exportIgn:  wtc.RespectExportIgnore,
+		publish:    wtc.PublishMode,
+		protect:    wtc.ProtectAgainstForcePush,
+		wtRoot:     r.worktreesRoot(),
+		perms:      perms,
+		runner:     r.runner,
+		envs:       r.envs,
+		gitOps:     r.gitOps,
+		repoLock:   &r.lock,
+		status:     WorktreeStatusUnknown,
+		log:        r.log.With("worktree", linkFile),
 	}
 
 	r.workTreeLinks[link] = wt
 	return nil
 }
 
+// WorktreeLink returns the worktree link added to the repository.
+// link must be same as the one used to add worktree link.
+func (r *Repository) WorktreeLink(link string) (*WorkTreeLink, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	wl, ok := r.workTreeLinks[link]
+	if !ok {
+		return nil, fmt.Errorf("%w link:%s", ErrWorktreeLinkNotFound, link)
+	}
+	return wl, nil
+}
+
+// hasLink returns true if repository has worktree link with given abs path
+func (r *Repository) hasLink(absLink string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return slices.Contains(r.linkPaths(), absLink)
+}
+
+// linkPaths returns abs paths of all the worktree links of the repository.
+// it must be called with repository lock held.
+func (r *Repository) linkPaths() []string {
+	links := make([]string, 0, len(r.workTreeLinks))
+	for _, wl := range r.workTreeLinks {
+		links = append(links, wl.link)
+	}
+	return links
+}
+
+// reservedLinkPaths returns abs paths of all the worktree links and of the
+// link dirs of the auto and tag worktree rules of the repository, links of
+// the other repositories must not overlap any of them
+func (r *Repository) reservedLinkPaths() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	paths := r.linkPaths()
+	for _, awc := range r.autoRules {
+		paths = append(paths, absLink(r.root, awc.linkDir()))
+	}
+	for _, twc := range r.tagRules {
+		paths = append(paths, absLink(r.root, twc.linkDir()))
+	}
+	return paths
+}
+
+// setLinkIndex sets the function which records worktree links of the
+// repository in the link index of the pool
+func (r *Repository) setLinkIndex(fn func(*Repository, []string)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.linkIndex = fn
+}
+
+// updateLinkIndex records current worktree links of the repository in the
+// link index of the pool. it must be called without repository lock held.
+func (r *Repository) updateLinkIndex() {
+	r.lock.RLock()
+	fn := r.linkIndex
+	links := r.linkPaths()
+	r.lock.RUnlock()
+
+	if fn != nil {
+		fn(r, links)
+	}
+}
+
+// RemoveWorktreeLink removes worktree link from the repository and deletes its
+// published link and hash file immediately, worktree dir itself is removed by
+// the clean up of the next mirror cycle. link must be same as the one used to
+// add worktree link, ErrWorktreeLinkNotFound is returned if link doesn't exist.
+// worktree link is removed from the repository even if published files can't
+// be deleted, in which case error is returned.
+func (r *Repository) RemoveWorktreeLink(ctx context.Context, link string) error {
+	defer r.emitPendingEvents()
+	defer r.updateManifest()
+	defer r.updateLinkIndex()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	wl, ok := r.workTreeLinks[link]
+	if !ok {
+		return fmt.Errorf("%w link:%s", ErrWorktreeLinkNotFound, link)
+	}
+	delete(r.workTreeLinks, link)
+	wl.log.Info("removing worktree link")
+	return r.removeWorktreeLink(ctx, wl)
+}
+
+// removeWorktreeLink deletes published link and hash file of the worktree
+// link which is already removed from the repository.
+// it must be called with repository write lock held.
+func (r *Repository) removeWorktreeLink(ctx context.Context, wl *WorkTreeLink) error {
+	r.queueLinkRemoved(wl)
+
+	errs := []error{r.unpublishWorktreeLink(wl)}
+	if wl.pinnedHash != "" {
+		errs = append(errs, r.removeKeepRef(ctx, wl.keepRef()))
+	}
+	for _, replicaRoot := range r.replicaRoots {
+		if replicaLink, ok := r.replicaLink(replicaRoot, wl); ok {
+			errs = append(errs, removeReplicaLink(replicaRoot, replicaLink))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WorktreeStatus returns the status of the worktree link after the last mirror cycle.
+// link must be same as the one used to add worktree link.
+func (r *Repository) WorktreeStatus(link string) (WorktreeStatus, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	wl, ok := r.workTreeLinks[link]
+	if !ok {
+		return "", fmt.Errorf("%w link:%s", ErrWorktreeLinkNotFound, link)
+	}
+	return wl.status, nil
+}
+
 // Hash returns the hash of the given revision and for the path if specified.
+// ErrRefNotMirrored is returned if ref is not covered by the refspecs.
 func (r *Repository) Hash(ctx context.Context, ref, path string) (string, error) {
-	r.lock.RLock()
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return "", err
+	}
 	defer r.lock.RUnlock()
 
-	return r.hash(ctx, ref, path)
+	if r.hashCache != nil {
+		if hash, ok := r.hashCache.get(ref, path); ok {
+			recordHashCache(r.gitURL.Repo, hashCacheHit)
+			return hash, nil
+		}
+		recordHashCache(r.gitURL.Repo, hashCacheMiss)
+	}
+
+	hash, err := r.hash(ctx, ref, path)
+	if err != nil {
+		return "", r.refNotMirroredErr(ref, err)
+	}
+	if r.hashCache != nil {
+		r.hashCache.set(ref, path, hash)
+	}
+	return hash, nil
+}
+
+// refNotMirroredErr wraps given git error with ErrRefNotMirrored if ref is
+// not covered by the refspecs so that it can be told apart from other
+// failures, err is returned as is otherwise. revision suffixes like '~1'
+// are ignored while matching.
+func (r *Repository) refNotMirroredErr(ref string, err error) error {
+	name := ref
+	if i := strings.IndexAny(name, "~^:@"); i > 0 {
+		name = name[:i]
+	}
+	if refMatchesRefSpecs(name, r.refSpecs) {
+		return err
+	}
+	return fmt.Errorf("%w ref:%s refspecs:%s err:%w", ErrRefNotMirrored, ref, r.refSpecs, err)
 }
 
 // Subject returns commit subject of given commit hash
 func (r *Repository) Subject(ctx context.Context, hash string) (string, error) {
-	r.lock.RLock()
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return "", err
+	}
 	defer r.lock.RUnlock()
 
 	args := []string{"show", `--no-patch`, `--format=%s`, hash}
-	msg, err := runGitCommand(ctx, r.log, r.envs, r.dir, args...)
+	msg, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, args...)
 	if err != nil {
 		return "", err
 	}
@@ -183,11 +741,13 @@ func (r *Repository) Subject(ctx context.Context, hash string) (string, error) {
 
 // ChangedFiles returns path of the changed files for given commit hash
 func (r *Repository) ChangedFiles(ctx context.Context, hash string) ([]string, error) {
-	r.lock.RLock()
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return nil, err
+	}
 	defer r.lock.RUnlock()
 
 	args := []string{"show", `--name-only`, `--pretty=format:`, hash}
-	msg, err := runGitCommand(ctx, r.log, r.envs, r.dir, args...)
+	msg, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -197,6 +757,59 @@ func (r *Repository) ChangedFiles(ctx context.Context, hash string) ([]string, e
 type CommitInfo struct {
 	Hash         string
 	ChangedFiles []string
+	// Author, AuthorEmail and Date (author date) are only set if commits
+	// are listed with ListCommitsOptions.WithMeta
+	Author      string
+	AuthorEmail string
+	Date        time.Time
+}
+
+// ListCommitsOptions limits and filters commits listed by ListCommits
+type ListCommitsOptions struct {
+	// MaxCount is the max number of commits returned, 0 means no limit
+	MaxCount int
+	// Skip is the number of commits skipped before listing, it can be used
+	// with MaxCount for pagination
+	Skip int
+	// Pathspecs limits commits to the ones which touch given paths, only
+	// changed files matching pathspecs are listed
+	Pathspecs []string
+	// Since and Until limits commits to the ones committed in the range
+	Since, Until time.Time
+	// WithMeta sets author and date fields of the listed commits
+	WithMeta bool
+}
+
+// commitMetaFormat is the log pretty format used to list commits with meta,
+// fields are separated by NUL so that they can't clash with author name
+const commitMetaFormat = "%H%x00%an%x00%ae%x00%aI"
+
+// gitArgs returns 'git log' args for the options
+func (o ListCommitsOptions) gitArgs() ([]string, error) {
+	if o.MaxCount < 0 {
+		return nil, fmt.Errorf("max count (%d) must not be negative", o.MaxCount)
+	}
+	if o.Skip < 0 {
+		return nil, fmt.Errorf("skip (%d) must not be negative", o.Skip)
+	}
+
+	args := []string{"log", `--name-only`, `--pretty=format:%H`}
+	if o.WithMeta {
+		args[2] = "--pretty=format:" + commitMetaFormat
+	}
+	if o.MaxCount > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(o.MaxCount))
+	}
+	if o.Skip > 0 {
+		args = append(args, "--skip="+strconv.Itoa(o.Skip))
+	}
+	if !o.Since.IsZero() {
+		args = append(args, "--since="+o.Since.UTC().Format(time.RFC3339))
+	}
+	if !o.Until.IsZero() {
+		args = append(args, "--until="+o.Until.UTC().Format(time.RFC3339))
+	}
+	return args, nil
 }
 
 // MergeCommits lists commits from the mergeCommitHash but not from the first
@@ -205,21 +818,56 @@ func (r *Repository) MergeCommits(ctx context.Context, mergeCommitHash string) (
 	return r.ListCommitsWithChangedFiles(ctx, mergeCommitHash+"^", mergeCommitHash)
 }
 
+// MergeCommitsN is same as MergeCommits but only lists latest n commits
+func (r *Repository) MergeCommitsN(ctx context.Context, mergeCommitHash string, n int) ([]CommitInfo, error) {
+	return r.ListCommits(ctx, mergeCommitHash+"^", mergeCommitHash, ListCommitsOptions{MaxCount: n})
+}
+
 // BranchCommits lists commits from the tip of the branch but not from the HEAD
 // of the repository in chronological order. (latest to oldest)
 func (r *Repository) BranchCommits(ctx context.Context, branch string) ([]CommitInfo, error) {
 	return r.ListCommitsWithChangedFiles(ctx, "HEAD", branch)
 }
 
+// BranchCommitsN is same as BranchCommits but only lists latest n commits
+func (r *Repository) BranchCommitsN(ctx context.Context, branch string, n int) ([]CommitInfo, error) {
+	return r.ListCommits(ctx, "HEAD", branch, ListCommitsOptions{MaxCount: n})
+}
+
 // ListCommitsWithChangedFiles returns path of the changed files for given commit hash
 // list all the commits and files which are reachable from 'ref2', but not from 'ref1'
 // The output is given in reverse chronological order.
 func (r *Repository) ListCommitsWithChangedFiles(ctx context.Context, ref1, ref2 string) ([]CommitInfo, error) {
-	r.lock.RLock()
+	return r.ListCommits(ctx, ref1, ref2, ListCommitsOptions{})
+}
+
+// ListCommits is same as ListCommitsWithChangedFiles but commits can be
+// paginated and filtered using given options. empty list is returned if
+// page is out of range.
+func (r *Repository) ListCommits(ctx context.Context, ref1, ref2 string, opts ListCommitsOptions) ([]CommitInfo, error) {
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return nil, err
+	}
 	defer r.lock.RUnlock()
 
-	args := []string{"log", `--name-only`, `--pretty=format:%H`, ref1 + ".." + ref2}
-	msg, err := runGitCommand(ctx, r.log, r.envs, r.dir, args...)
+	return r.listCommits(ctx, ref1, ref2, opts)
+}
+
+// listCommits lists commits between the refs using given options.
+// it must be called with lock held.
+func (r *Repository) listCommits(ctx context.Context, ref1, ref2 string, opts ListCommitsOptions) ([]CommitInfo, error) {
+	args, err := opts.gitArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, ref1+".."+ref2)
+	if len(opts.Pathspecs) > 0 {
+		args = append(args, "--")
+		args = append(args, opts.Pathspecs...)
+	}
+	// git log --name-only --pretty=format:<format> [--max-count=<n>] [--skip=<n>]
+	// [--since=<date>] [--until=<date>] <ref1>..<ref2> [-- <pathspec>...]
+	msg, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -235,6 +883,11 @@ func (r *Repository) ListCommitsWithChangedFiles(ctx context.Context, ref1, ref2
 // one/readme.yaml
 // one/hello.tf
 // two/readme.yaml
+//
+// output with `--pretty=format:%H%x00%an%x00%ae%x00%aI` is also supported
+// in which case author and date of the commits are set. if output is
+// truncated in the middle of the commit line, that commit and anything after
+// it is ignored.
 func ParseCommitWithChangedFilesList(output string) []CommitInfo {
 	commitCount := 0
 	Commits := []CommitInfo{}
@@ -244,6 +897,15 @@ func ParseCommitWithChangedFilesList(output string) []CommitInfo {
 		if line == "" {
 			continue
 		}
+		if strings.Contains(line, "\x00") {
+			commit, ok := parseCommitMeta(line)
+			if !ok {
+				break
+			}
+			Commits = append(Commits, commit)
+			commitCount += 1
+			continue
+		}
 		if IsFullCommitHash(line) {
 			Commits = append(Commits, CommitInfo{Hash: line})
 			commitCount += 1
@@ -259,108 +921,281 @@ func ParseCommitWithChangedFilesList(output string) []CommitInfo {
 	return Commits
 }
 
-// ObjectExists returns error is given object is not valid or if it doesn't exists
+// parseCommitMeta parses commit line of the commitMetaFormat, false is
+// returned if line is not complete
+func parseCommitMeta(line string) (CommitInfo, bool) {
+	fields := strings.Split(line, "\x00")
+	if len(fields) != 4 || !IsFullCommitHash(fields[0]) {
+		return CommitInfo{}, false
+	}
+	date, err := time.Parse(time.RFC3339, fields[3])
+	if err != nil {
+		return CommitInfo{}, false
+	}
+	return CommitInfo{Hash: fields[0], Author: fields[1], AuthorEmail: fields[2], Date: date}, true
+}
+
+// ObjectExists returns error wrapping ErrNotFound if given object is not
+// valid or if it doesn't exist, other errors are returned if existence
+// couldn't be checked (eg. context is done)
 func (r *Repository) ObjectExists(ctx context.Context, obj string) error {
-	r.lock.RLock()
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return err
+	}
 	defer r.lock.RUnlock()
 
-	args := []string{"cat-file", `-e`, obj}
-	_, err := runGitCommand(ctx, r.log, r.envs, r.dir, args...)
+	return r.objectExists(ctx, obj)
+}
+
+// objectExists returns error wrapping ErrNotFound if given object doesn't
+// exist in the mirror. it must be called with repository lock held.
+func (r *Repository) objectExists(ctx context.Context, obj string) error {
+	// git cat-file -e <obj>
+	_, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "cat-file", "-e", obj)
+	if isMissingObject(err) {
+		return fmt.Errorf("%w obj:%s", ErrNotFound, obj)
+	}
 	return err
 }
 
-// Clone creates a single-branch local clone of the mirrored repository to a new location on
-// disk. On success, it returns the hash of the new repository clone's HEAD.
-// if pathspec is provided only those paths will be checked out.
-// if ref is commit hash then pathspec will be ignored.
-// if rmGitDir is true `.git` folder will be deleted after the clone.
-// if dst not empty all its contents will be removed.
-func (r *Repository) Clone(ctx context.Context, dst, ref, pathspec string, rmGitDir bool) (string, error) {
+// Archive writes archive of the given ref to the writer using `git archive`.
+// supported formats are `tar` and `tgz`, default is tar.
+// if pathspecs are provided only those paths will be included in the archive.
+// On success, it returns the resolved commit hash of the ref.
+func (r *Repository) Archive(ctx context.Context, w io.Writer, ref string, pathspecs []string, format string) (string, error) {
+	switch format {
+	case "":
+		format = "tar"
+	case "tar", "tgz":
+	default:
+		return "", fmt.Errorf("unsupported archive format '%s', must be one of tar, tgz", format)
+	}
+
 	if ref == "" {
 		ref = "HEAD"
 	}
 
-	dst, err := filepath.Abs(dst)
-	if err != nil {
-		return "", fmt.Errorf("unable to convert given dst path '%s' to abs path err:%w", dst, err)
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return "", err
 	}
+	defer r.lock.RUnlock()
 
-	empty, err := dirIsEmpty(dst)
+	// resolve ref before writing anything to the writer
+	hash, err := r.resolveCommit(ctx, ref)
 	if err != nil {
-		return "", fmt.Errorf("unable to verify if dst is empty err:%w", err)
+		return "", err
 	}
 
-	if !empty {
-		// Git won't use this dir for clone.  We remove the contents rather than
-		// the dir itself, because a common use-case is to have a volume mounted
-		// at git.root, which makes removing it impossible.
-		r.log.Info("repo directory was empty or failed checks", "path", dst)
-		if err := removeDirContents(dst, r.log); err != nil {
-			return "", fmt.Errorf("unable to wipe dst err:%w", err)
-		}
+	args := []string{"archive", "--format=" + format, hash}
+	if len(pathspecs) > 0 {
+		args = append(args, "--")
+		args = append(args, pathspecs...)
 	}
-
-	r.lock.RLock()
-	defer r.lock.RUnlock()
-
-	if IsCommitHash(ref) {
-		return r.cloneByRef(ctx, dst, ref, pathspec, rmGitDir)
+	// git archive --format=<format> <hash> [-- <pathspecs>...]
+	if err := runGitCommandStream(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, nil, w, args...); err != nil {
+		return "", err
 	}
-	return r.cloneByBranch(ctx, dst, ref, pathspec, rmGitDir)
+	return hash, nil
 }
 
-func (r *Repository) cloneByBranch(ctx context.Context, dst, branch, pathspec string, rmGitDir bool) (string, error) {
-	args := []string{"clone", "--no-checkout", "--single-branch"}
-	if branch != "HEAD" {
-		args = append(args, "-b", branch)
-	}
-	args = append(args, r.dir, dst)
-	// git clone --no-checkout --single-branch [-b <branch>] <remote> <dst>
-	if _, err := runGitCommand(ctx, r.log, nil, "", args...); err != nil {
-		return "", err
+// FileContent returns content of the file at the given ref from the mirrored
+// repository without checking it out. content is returned verbatim so
+// binary files are supported. ErrNotFound is returned if path doesn't exist
+// at the ref.
+func (r *Repository) FileContent(ctx context.Context, ref, path string) ([]byte, error) {
+	if ref == "" {
+		ref = "HEAD"
 	}
+	path = strings.Trim(path, "/")
 
-	args = []string{"checkout", branch}
-	if pathspec != "" {
-		args = append(args, "--", pathspec)
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return nil, err
 	}
-	// git checkout <branch> -- <pathspec>
-	if _, err := runGitCommand(ctx, r.log, nil, dst, args...); err != nil {
-		return "", err
+	defer r.lock.RUnlock()
+
+	hash, err := r.resolveCommit(ctx, ref)
+	if err != nil {
+		return nil, err
 	}
 
-	// get the hash of the repos HEAD
-	args = []string{"log", "--pretty=format:%H", "-n", "1", "HEAD"}
-	if pathspec != "" {
-		args = append(args, "--", pathspec)
+	// git cat-file -t <hash>:<path>
+	objType, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "cat-file", "-t", hash+":"+path)
+	if isMissingObject(err) {
+		return nil, fmt.Errorf("%w ref:%s path:%s", ErrNotFound, ref, path)
 	}
-	// git log --pretty=format:%H -n 1 HEAD [-- <path>]
-	hash, err := runGitCommand(ctx, r.log, nil, dst, args...)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("unable to get object type ref:%s path:%s err:%w", ref, path, err)
 	}
-
-	if rmGitDir {
-		if err := os.RemoveAll(filepath.Join(dst, ".git")); err != nil {
-			return "", fmt.Errorf("unable to delete git dir err:%w", err)
-		}
+	if objType != "blob" {
+		return nil, fmt.Errorf("path is not a file ref:%s path:%s type:%s", ref, path, objType)
 	}
 
-	return hash, nil
+	// output of runGitCommand is trimmed hence stream raw content to buffer
+	// git cat-file blob <hash>:<path>
+	buf := &bytes.Buffer{}
+	if err := runGitCommandStream(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, nil, buf, "cat-file", "blob", hash+":"+path); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
-func (r *Repository) cloneByRef(ctx context.Context, dst, ref, pathspec string, rmGitDir bool) (string, error) {
-	// git clone --no-checkout <remote> <dst>
-	if _, err := runGitCommand(ctx, r.log, nil, "", "clone", "--no-checkout", r.dir, dst); err != nil {
+// ListFiles returns paths of all the files under the given dir at the ref,
+// paths are relative to the repository root. if dir is empty all the files
+// of the repository are returned. ErrNotFound is returned if dir doesn't
+// exist at the ref.
+func (r *Repository) ListFiles(ctx context.Context, ref, dir string) ([]string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	dir = strings.Trim(dir, "/")
+
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer r.lock.RUnlock()
+
+	hash, err := r.resolveCommit(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"ls-tree", "-r", "-z", "--name-only", hash}
+	if dir != "" {
+		args = append(args, "--", dir)
+	}
+	// git ls-tree -r -z --name-only <hash> [-- <dir>]
+	out, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, f := range strings.Split(out, "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 && dir != "" {
+		return nil, fmt.Errorf("%w ref:%s path:%s", ErrNotFound, ref, dir)
+	}
+	return files, nil
+}
+
+// resolveCommit returns commit hash of the given ref
+func (r *Repository) resolveCommit(ctx context.Context, ref string) (string, error) {
+	// git rev-parse --verify <ref>^{commit}
+	hash, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve ref:%s err:%w", ref, classifyGitErr(err))
+	}
+	return hash, nil
+}
+
+// CloneOptions are the options of the Clone
+type CloneOptions struct {
+	// Pathspec limits the checkout to the given paths, its ignored if ref is
+	// commit hash
+	Pathspec string
+	// RmGitDir deletes `.git` folder after the clone
+	RmGitDir bool
+	// Submodules checks out submodules recursively
+	Submodules bool
+	// Force removes all the contents of the non empty dst, otherwise
+	// ErrDstNotEmpty is returned
+	Force bool
+}
+
+// Clone creates a single-branch local clone of the mirrored repository to a new location on
+// disk. On success, it returns the hash of the new repository clone's HEAD.
+// see CloneOptions for the optional behaviour of the clone.
+// repository is only locked while objects are cloned so concurrent clones
+// into different dst are not serialised behind each other's checkout.
+// `git clone --revision` is used if installed git supports it, otherwise
+// branch is cloned and reset to the commit. setting DisableCloneRevision
+// of the repository config forces the latter.
+func (r *Repository) Clone(ctx context.Context, dst, ref string, opts CloneOptions) (string, error) {
+	pathspec := opts.Pathspec
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	dst, err := filepath.Abs(dst)
+	if err != nil {
+		return "", fmt.Errorf("unable to convert given dst path '%s' to abs path err:%w", dst, err)
+	}
+
+	// dst will be created by clone if it doesn't exist
+	empty, err := dirIsEmpty(dst)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("unable to verify if dst is empty err:%w", err)
+	}
+
+	if err == nil && !empty {
+		if !opts.Force {
+			return "", fmt.Errorf("%w dst:%s", ErrDstNotEmpty, dst)
+		}
+		// Git won't use this dir for clone.  We remove the contents rather than
+		// the dir itself, because a common use-case is to have a volume mounted
+		// at git.root, which makes removing it impossible.
+		r.log.Info("dst is not empty, removing its contents", "path", dst)
+		if err := removeDirContents(dst, r.log); err != nil {
+			return "", fmt.Errorf("unable to wipe dst err:%w", err)
+		}
+	}
+
+	revision, err := r.cloneNoCheckout(ctx, dst, ref)
+	if err != nil {
+		return "", r.refNotMirroredErr(ref, err)
+	}
+
+	// lfs objects are fetched into the mirror and checked out from there as
+	// clone doesn't have the remote
+	hasLFS, checkoutEnvs, err := r.cloneLFSFetch(ctx, ref, pathspec)
+	if err != nil {
 		return "", err
 	}
 
-	args := []string{"reset", "--hard", ref}
-	// git reset --hard <ref>
-	if out, err := runGitCommand(ctx, r.log, nil, dst, args...); err != nil {
+	// local clone has its own copy of objects (hardlinked) hence rest of the
+	// steps only touches dst and doesn't need repository lock
+	var args []string
+	switch {
+	case revision && pathspec != "" && !IsCommitHash(ref):
+		// HEAD is detached at the revision and there is no local branch
+		// git checkout HEAD -- <pathspec>
+		args = []string{"checkout", "HEAD", "--", pathspec}
+	case revision:
+		// git reset --hard HEAD
+		args = []string{"reset", "--hard", "HEAD"}
+	case IsCommitHash(ref):
+		// git reset --hard <ref>
+		args = []string{"reset", "--hard", ref}
+	default:
+		// git checkout <branch> [-- <pathspec>]
+		args = []string{"checkout", ref}
+		if pathspec != "" {
+			args = append(args, "--", pathspec)
+		}
+	}
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, checkoutEnvs, dst, args...); err != nil {
 		return "", err
-	} else {
-		fmt.Println(out)
+	}
+
+	if hasLFS {
+		if err := r.lfsCheckout(ctx, r.log, dst, pathspec); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.Submodules {
+		// submodule update needs repository's auth and envs
+		if err := r.lock.RLockContext(ctx); err != nil {
+			return "", err
+		}
+		err := r.updateSubmodules(ctx, r.log, dst, pathspec, true)
+		r.lock.RUnlock()
+		if err != nil {
+			return "", err
+		}
 	}
 
 	// get the hash of the repos HEAD
@@ -368,15 +1203,14 @@ func (r *Repository) cloneByRef(ctx context.Context, dst, ref, pathspec string,
 	if pathspec != "" {
 		args = append(args, "--", pathspec)
 	}
-
 	// git log --pretty=format:%H -n 1 HEAD [-- <path>]
-	hash, err := runGitCommand(ctx, r.log, nil, dst, args...)
+	hash, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, nil, dst, args...)
 	if err != nil {
 		return "", err
 	}
 
-	if rmGitDir {
-		if err := os.RemoveAll(filepath.Join(dst, ".git")); err != nil {
+	if opts.RmGitDir {
+		if err := safeRemoveAll(dst, filepath.Join(dst, ".git")); err != nil {
 			return "", fmt.Errorf("unable to delete git dir err:%w", err)
 		}
 	}
@@ -384,39 +1218,409 @@ func (r *Repository) cloneByRef(ctx context.Context, dst, ref, pathspec string,
 	return hash, nil
 }
 
-// StartLoop mirrors repository periodically based on repo's mirror interval
+// cloneNoCheckout clones mirrored repository into dst without checking out.
+// it returns true if only the given revision was cloned with detached HEAD
+// any files. only single branch is cloned if ref is not a commit hash.
+func (r *Repository) cloneNoCheckout(ctx context.Context, dst, ref string) (bool, error) {
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return false, err
+	}
+	defer r.lock.RUnlock()
+
+	// abbreviated hash can't be used as revision and HEAD is cloned by default
+	if ref != "HEAD" && (!IsCommitHash(ref) || IsFullCommitHash(ref)) && r.useCloneRevision(ctx) {
+		// git [-c <key>=<value>...] clone --no-checkout --revision <ref> <remote> <dst>
+		args := slices.Concat(r.gitConfig, []string{"clone", "--no-checkout", "--revision", ref, r.dir, dst})
+		_, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, nil, "", args...)
+		return true, err
+	}
+
+	args := slices.Concat(r.gitConfig, []string{"clone", "--no-checkout"})
+	if !IsCommitHash(ref) {
+		args = append(args, "--single-branch")
+		if ref != "HEAD" {
+			args = append(args, "-b", ref)
+		}
+	}
+	args = append(args, r.dir, dst)
+	// git [-c <key>=<value>...] clone --no-checkout [--single-branch] [-b <branch>] <remote> <dst>
+	_, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, nil, "", args...)
+	return false, err
+}
+
+// useCloneRevision returns true if 'git clone --revision' can be used.
+// installed git version is probed until it succeeds, failed probe (eg.
+// cancelled ctx) falls back to the old strategy only for the current clone.
+// it must be called with read lock held.
+func (r *Repository) useCloneRevision(ctx context.Context) bool {
+	if r.noCloneRev {
+		return false
+	}
+
+	r.cloneLock.Lock()
+	defer r.cloneLock.Unlock()
+
+	if r.cloneProbed {
+		return r.cloneRevision
+	}
+	// git version
+	version, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, nil, "", "version")
+	if err != nil {
+		r.log.Error("unable to get git version, using fallback clone strategy", "err", err)
+		return false
+	}
+	r.cloneProbed = true
+	r.cloneRevision = supportsCloneRevision(version)
+	r.log.Debug("clone strategy selected", "version", version, "revision", r.cloneRevision)
+	return r.cloneRevision
+}
+
+// StartLoop mirrors repository periodically based on repo's mirror interval.
+// loop is restarted with backoff if it panics, see LoopStatus.
 func (r *Repository) StartLoop(ctx context.Context) {
-	if r.running {
+	if !r.beginLoop() {
 		r.log.Error("mirror loop has already been started")
 		return
 	}
-	r.running = true
-	r.log.Info("started repository mirror loop", "interval", r.interval)
+	r.runLoop(ctx, false, 0)
+}
+
+// loop runs mirror cycles until loop is stopped, if waitFirst is set first
+// mirror cycle is only run after interval otherwise its run after given
+// delay. it must only be called by runLoop.
+func (r *Repository) loop(ctx context.Context, waitFirst bool, delay time.Duration) {
+	r.log.Info("started repository mirror loop", "interval", r.interval, "schedule", r.schedule)
+
+	// gc runs on its own schedule so that it doesn't block mirror cycle
+	gcCtx, cancelGC := context.WithCancel(ctx)
+	gcStopped := make(chan bool)
+	go func() {
+		r.gcLoop(gcCtx)
+		close(gcStopped)
+	}()
 
 	defer func() {
-		r.running = false
-		close(r.stopped)
+		cancelGC()
+		<-gcStopped
 	}()
 
+	if waitFirst && !r.waitInterval(ctx) {
+		return
+	}
+	if !waitFirst && delay > 0 && !r.waitDelay(ctx, delay) {
+		return
+	}
+
 	for {
+		r.lock.RLock()
+		timeout := r.mirrorTimeout
+		r.lock.RUnlock()
+
 		// to stop mirror running indefinitely we will use time-out
-		mCtx, cancel := context.WithTimeout(ctx, r.mirrorTimeout)
-		err := r.Mirror(mCtx)
+		mCtx, cancel := context.WithTimeout(ctx, timeout)
+		result, err := r.MirrorWithResult(mCtx)
 		cancel()
+		if errors.Is(context.Cause(ctx), errLoopAborted) {
+			r.log.Info("mirror loop aborted", "err", err)
+			return
+		}
 		if err != nil {
-			r.log.Error("repository mirror failed", "err", err)
+			r.log.Error("repository mirror failed", "phase", errPhase(err), "class", ClassifyError(err), "err", err)
+			recordMirrorFailure(r.gitURL.Repo, errPhase(err), ClassifyError(err))
 		}
-		recordGitMirror(r.gitURL.Repo, err == nil)
+		// skipped cycle is already recorded as skipped
+		if result.Skipped == "" {
+			recordGitMirror(r.gitURL.Repo, err)
+		}
+
+		if !r.waitInterval(ctx) {
+			return
+		}
+	}
+}
 
-		t := time.NewTimer(jitter(r.interval, 0.2))
+// waitInterval blocks until next mirror cycle is due. after failed mirror
+// cycles wait is backed off exponentially. if config is updated while waiting,
+// wait is restarted with the new interval. wait is skipped if mirror run is
+// queued via QueueMirrorRun.
+// it returns false if mirror loop should be stopped.
+func (r *Repository) waitInterval(ctx context.Context) bool {
+	for {
+		r.lock.Lock()
+		wait := r.nextWait()
+		r.nextRun = r.now().Add(wait)
+		recordNextRun(r.gitURL.Repo, r.nextRun)
+		r.lock.Unlock()
+
+		t := time.NewTimer(wait)
 		select {
 		case <-t.C:
+			return true
+		case <-r.trigger:
+			t.Stop()
+			return true
+		case <-r.reload:
+			t.Stop()
 		case <-ctx.Done():
-			return
+			t.Stop()
+			return false
 		case <-r.stop:
-			return
+			t.Stop()
+			return false
+		}
+	}
+}
+
+// setJitter sets max random delay added to the interval as a fraction of it
+func (r *Repository) setJitter(jitter float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.jitter = jitter
+}
+
+// waitDelay blocks until given delay of the first mirror cycle has passed,
+// wait is skipped if mirror run is queued via QueueMirrorRun.
+// it returns false if mirror loop should be stopped.
+func (r *Repository) waitDelay(ctx context.Context, delay time.Duration) bool {
+	r.lock.Lock()
+	r.nextRun = r.now().Add(delay)
+	recordNextRun(r.gitURL.Repo, r.nextRun)
+	r.lock.Unlock()
+
+	r.log.Debug("delaying first mirror cycle", "delay", delay)
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.trigger:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-r.stop:
+		return false
+	}
+}
+
+// nextWait returns time until next mirror cycle. with schedule failed cycles
+// are retried with backoff starting from scheduleRetryInterval but never
+// later than the next scheduled run. caller must hold the repository lock.
+func (r *Repository) nextWait() time.Duration {
+	var wait time.Duration
+	now := r.now()
+	if r.schedule == nil {
+		wait = jitter(failureBackoff(r.interval, r.maxBackoff, r.failures), r.jitter)
+	} else {
+		wait = r.schedule.next(now).Sub(now)
+		if r.failures > 0 {
+			wait = min(wait, failureBackoff(scheduleRetryInterval, r.maxBackoff, r.failures))
+		}
+		wait += time.Duration(rand.Int63n(int64(scheduleJitter)))
+	}
+	// run queued outside of the fetch window starts once window opens, or
+	// immediately if updated window is already open
+	if r.windowRun {
+		if r.fetchWindow.contains(now) {
+			wait = 0
+		} else {
+			wait = min(wait, r.fetchWindow.nextOpen(now).Sub(now))
+		}
+	}
+	return wait
+}
+
+// UpdateConfig applies changed interval, schedule, fetch window, mirror timeout, gc,
+// auth, envs, prune and git exec path settings of the given config to the
+// repository in place. running mirror loop will pick up new interval on the
+// next tick. Remote and Root of the repository, mirrored refs and depth can
+// not be changed, ErrRecreateRequired is returned if they differ.
+// config must have defaults applied.
+func (r *Repository) UpdateConfig(ctx context.Context, repoConf RepositoryConfig) error {
+	if giturl.NormaliseURL(repoConf.Remote) != r.remoteURL ||
+		filepath.Clean(repoConf.Root) != filepath.Clean(r.root) ||
+		!sameRefSpecs(repoConf.refSpecs(), r.refSpecs) ||
+		repoConf.Depth != r.depth {
+		return ErrRecreateRequired
+	}
+
+	if err := repoConf.validate(); err != nil {
+		return err
+	}
+
+	// labels are included in the manifest which is updated once repository
+	// lock is released
+	var labelsChanged bool
+	defer func() {
+		if labelsChanged {
+			r.updateManifest()
+		}
+	}()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if repoConf.LFS {
+		// custom runner doesn't use git executable
+		runner := r.runner
+		if isExecGitRunner(runner) {
+			runner = execGitRunner{path: repoConf.GitExecPath}
+		}
+		if err := validateLFS(ctx, r.log, runner, slices.Concat(r.commonEnvs, repoConf.Envs)); err != nil {
+			return err
+		}
+	}
+
+	if r.interval != repoConf.Interval {
+		r.log.Info("updating mirror interval", "old", r.interval, "new", repoConf.Interval)
+		r.interval = repoConf.Interval
+	}
+	if r.schedule.String() != repoConf.Schedule {
+		r.log.Info("updating mirror schedule", "old", r.schedule, "new", repoConf.Schedule)
+		r.schedule = nil
+		if repoConf.Schedule != "" {
+			r.schedule, _ = parseSchedule(repoConf.Schedule)
+		}
+	}
+	if r.fetchWindow != repoConf.FetchWindow {
+		r.log.Info("updating fetch window", "old", r.fetchWindow, "new", repoConf.FetchWindow)
+		r.fetchWindow = repoConf.FetchWindow
+	}
+	r.mirrorTimeout = repoConf.MirrorTimeout
+	r.gitTimeout = repoConf.GitTimeout
+	r.gitGC = gcMode(repoConf.GitGC)
+	r.gcInterval = repoConf.GCInterval
+	if r.gcInterval == 0 {
+		r.gcInterval = defaultGCInterval
+	}
+	r.auth = &repoConf.Auth
+	r.envs = slices.Concat(r.commonEnvs, repoConf.Envs)
+	for _, wl := range r.workTreeLinks {
+		wl.envs = r.envs
+	}
+	r.replicaRoots = repoConf.ReplicaRoots
+	r.maxBackoff = repoConf.MaxFailureBackoff
+	r.fetchRetries = repoConf.fetchRetries()
+	r.adopt = repoConf.AdoptExisting
+	r.outsideLinks = repoConf.AllowLinksOutsideRoot
+	if gitConfig := gitConfigArgs(repoConf.GitConfig); !slices.Equal(r.gitConfig, gitConfig) {
+		r.log.Debug("updating git config", "old", r.gitConfig, "new", gitConfig)
+		r.gitConfig = gitConfig
+	}
+	r.fetchJobs = repoConf.FetchJobs
+	r.keepPrevious = repoConf.keepPrevious()
+	r.autoRules = slices.Clone(repoConf.AutoWorktrees)
+	r.tagRules = slices.Clone(repoConf.TagWorktrees)
+	r.maxAutoLinks = repoConf.maxAutoWorktrees()
+	r.maxDiskUsage = repoConf.MaxDiskUsageBytes
+	r.maxFSBytes = cloneFSLimit(repoConf.MaxCloneFSBytes)
+	r.critical.Store(repoConf.Critical)
+	r.lfs = repoConf.LFS
+	r.fileModes = repoConf.PreserveFileModes == nil || *repoConf.PreserveFileModes
+	r.proxyURL = repoConf.ProxyURL
+	r.trackHead = repoConf.TrackDefaultBranch
+	r.skipFetch = repoConf.SkipFetchIfUnchanged
+	r.noCloneRev = repoConf.DisableCloneRevision
+	if !r.skipFetch {
+		r.remoteRefs = nil
+	}
+	switch {
+	case repoConf.EnableHashCache && r.hashCache == nil:
+		r.log.Info("enabling hash cache")
+		r.hashCache = newHashCache()
+	case !repoConf.EnableHashCache && r.hashCache != nil:
+		r.log.Info("disabling hash cache")
+		r.hashCache = nil
+	}
+	r.prune = repoConf.Prune == nil || *repoConf.Prune
+	r.pruneTags = repoConf.PruneTags
+	r.reinitLimit = repoConf.ReinitThreshold
+	if r.reinitLimit == 0 {
+		r.reinitLimit = defaultReinitThreshold
+	}
+	if r.gitExec != repoConf.GitExecPath {
+		r.log.Info("updating git exec path", "old", r.gitExec, "new", repoConf.GitExecPath)
+		r.gitExec = repoConf.GitExecPath
+		// new git might support different clone strategy
+		r.cloneProbed = false
+		r.cloneRevision = false
+		// custom runner doesn't use git executable
+		if isExecGitRunner(r.runner) {
+			r.runner = execGitRunner{path: r.gitExec}
+			for _, wl := range r.workTreeLinks {
+				wl.runner = r.runner
+			}
 		}
 	}
+	if !maps.Equal(r.labels, repoConf.Labels) {
+		r.log.Info("updating repository labels", "old", r.labels, "new", repoConf.Labels)
+		r.labels = maps.Clone(repoConf.Labels)
+		attrs := labelAttrs(r.labels)
+		r.labelAttrs.Store(&attrs)
+		setRepoMetricLabels(r.gitURL.Repo, r.labels)
+		labelsChanged = true
+	}
+	r.storeRemoteConfig(repoConf.RemoteRefsCacheTTL)
+
+	// non-blocking as pending signal is enough to pick up latest config
+	select {
+	case r.reload <- true:
+	default:
+	}
+
+	return nil
+}
+
+// QueueMirrorRun signals running mirror loop to start next mirror cycle
+// immediately without waiting for the interval or failure backoff.
+// it does not block and multiple queued runs are coalesced into one.
+// run queued while repository is paused is started on Resume.
+func (r *Repository) QueueMirrorRun() {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+	if r.paused {
+		r.pausedRun = true
+		return
+	}
+	r.triggered = true
+	r.queueMirrorRun()
+}
+
+// takeTriggered returns true if current mirror cycle was queued via
+// QueueMirrorRun and clears the flag
+func (r *Repository) takeTriggered() bool {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+
+	triggered := r.triggered
+	r.triggered = false
+	return triggered
+}
+
+func (r *Repository) queueMirrorRun() {
+	select {
+	case r.trigger <- true:
+	default:
+	}
+}
+
+// StopLoop stops mirror loop if its running. it will block until current
+// mirror cycle is finished
+func (r *Repository) StopLoop() {
+	r.loopLock.Lock()
+	running, stopped := r.running, r.stopped
+	r.loopLock.Unlock()
+
+	if !running {
+		return
+	}
+	select {
+	case r.stop <- true:
+	case <-stopped:
+	}
+	<-stopped
+	r.log.Info("repository mirror loop stopped")
 }
 
 // Mirror will run mirror loop of the repository
@@ -425,63 +1629,360 @@ func (r *Repository) StartLoop(ctx context.Context) {
 //  3. ensure worktrees
 //  4. cleanup if needed
 func (r *Repository) Mirror(ctx context.Context) error {
+	_, err := r.MirrorWithResult(ctx)
+	return err
+}
+
+// MirrorWithResult runs mirror cycle same as Mirror and also returns the
+// outcome of the fetch and of each worktree link. result is returned even if
+// mirror cycle fails. all worktree links are ensured even if one of them
+// fails and ErrRepoWTUpdateFailed is returned if any of them failed.
+func (r *Repository) MirrorWithResult(ctx context.Context) (MirrorResult, error) {
+	// deferred before lock so events are emitted and manifest and link
+	// index (auto worktree links) are updated after lock is released.
+	// link states are recorded after every cycle so that links turn stale
+	// even if cycles fail before worktrees are checked
+	defer r.emitPendingEvents()
+	defer r.updateManifest()
+	defer r.updateLinkIndex()
+	defer r.recordWorktreeStates()
+
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
+	// cached hashes are invalidated before lock is released so that Hash
+	// never returns hash resolved before this cycle
+	defer r.syncHashCache(ctx)
 	defer updateMirrorLatency(r.gitURL.Repo, time.Now())
 
+	var result MirrorResult
+	ctx, span := r.startSpan(ctx, "mirror", attribute.String("repo", r.gitURL.Repo))
+	err := r.mirror(ctx, &result)
+	// commands killed on timeout don't always report context error
+	var mErr *MirrorError
+	if errors.As(err, &mErr) && ctx.Err() == context.DeadlineExceeded && !errors.Is(err, context.DeadlineExceeded) {
+		mErr.Err = fmt.Errorf("%w: %w", mErr.Err, ctx.Err())
+	}
+	endSpan(span, err)
+	r.queueEvent(Event{Type: EventMirrorCompleted, UpdatedRefs: slices.Clone(result.UpdatedRefs), Err: err})
+	if err != nil {
+		r.failures++
+		recordConsecutiveFailures(r.gitURL.Repo, r.failures)
+		r.lastStatus = MirrorStatus{Time: r.now(), Phase: errPhase(err), Err: err}
+		r.history.recordFailedCycle(FailedCycle{Time: r.now(), Error: err.Error()})
+		return result, err
+	}
+	// repository is not initialised so cycle can't be counted as success
+	if result.Skipped != "" {
+		r.lastStatus = MirrorStatus{Time: r.now(), Skipped: result.Skipped}
+		return result, nil
+	}
+	r.failures = 0
+	recordConsecutiveFailures(r.gitURL.Repo, r.failures)
+	r.lastSuccess = r.now()
+	r.lastStatus = MirrorStatus{Time: r.lastSuccess}
+	r.ready.Store(true)
+	recordMirrorSuccess(r.gitURL.Repo)
+
+	r.syncReplicas()
+	return result, nil
+}
+
+// LastMirrorStatus returns the outcome of the last mirror cycle. error and
+// phase are cleared once mirror cycle succeeds.
+func (r *Repository) LastMirrorStatus() MirrorStatus {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.lastStatus
+}
+
+// mirror runs the mirror cycle, it must be called with write lock held
+func (r *Repository) mirror(ctx context.Context, result *MirrorResult) error {
 	start := time.Now()
 
-	if err := r.init(ctx); err != nil {
-		return fmt.Errorf("unable to init repo:%s  err:%w", r.gitURL.Repo, err)
+	if err := r.ensureLayout(ctx); err != nil {
+		return &MirrorError{MirrorPhaseInit, fmt.Errorf("unable to ensure layout repo:%s  err:%w", r.gitURL.Repo, err)}
 	}
 
-	refs, err := r.fetch(ctx)
-	if err != nil {
-		return fmt.Errorf("unable to fetch repo:%s  err:%w", r.gitURL.Repo, err)
+	var refs []RefUpdate
+
+	inWindow := r.fetchWindow.contains(r.now())
+	if triggered := r.takeTriggered(); triggered && !inWindow {
+		if r.fetchWindow.Triggers == FetchWindowTriggersAllow {
+			r.log.Info("triggered mirror run is allowed to fetch outside of fetch window")
+			inWindow = true
+		} else {
+			r.log.Info("triggered mirror run is queued until fetch window opens", "window-start", r.fetchWindow.Start)
+			r.windowRun = true
+		}
+	}
+	if inWindow {
+		r.windowRun = false
+	}
+
+	// while paused or outside of fetch window only local phases are run
+	if paused := r.Paused(); paused || !inWindow {
+		reason := skipOutsideFetchWindow
+		if paused {
+			reason = skipPaused
+		}
+		// init might need to reach remote to (re)initialize repo dir
+		if _, err := os.Stat(r.dir); err != nil || !r.sanityCheckRepo(ctx) {
+			r.log.Info("repository is not initialised, skipping mirror cycle", "reason", reason, "window-start", r.fetchWindow.Start)
+			recordMirrorSkipped(r.gitURL.Repo, reason)
+			result.Skipped = reason
+			return nil
+		}
+		r.log.Debug("skipping fetch", "reason", reason, "window-start", r.fetchWindow.Start)
+		recordMirrorSkipped(r.gitURL.Repo, reason)
+	} else {
+		iCtx, span := r.startSpan(ctx, "init")
+		err := r.init(iCtx)
+		endSpan(span, err)
+		if err != nil {
+			return &MirrorError{MirrorPhaseInit, fmt.Errorf("unable to init repo:%s  err:%w", r.gitURL.Repo, err)}
+		}
+
+		var remoteRefs map[string]string
+		skip := false
+		if r.skipFetch {
+			skip, remoteRefs = r.shouldSkipFetch(ctx)
+		}
+
+		if skip {
+			r.fetchSkips++
+			r.log.Debug("remote refs unchanged, skipping fetch")
+			recordMirrorSkipped(r.gitURL.Repo, skipRemoteUnchanged)
+		} else {
+			fCtx, span := r.startSpan(ctx, "fetch")
+			refs, err = r.fetch(fCtx)
+			span.SetAttributes(attribute.Int("updated-refs", len(refs)))
+			endSpan(span, err)
+			if err != nil {
+				r.remoteRefs, remoteRefs = nil, nil
+				// corrupted objects or refs of the mirror can fail fetch
+				// which is not detected by the sanity check of init
+				reinitRefs, ok := r.recoverFromCorruption(ctx, err)
+				if !ok {
+					return &MirrorError{MirrorPhaseFetch, fmt.Errorf("unable to fetch repo:%s  err:%w", r.gitURL.Repo, err)}
+				}
+				refs = reinitRefs
+			}
+			r.fetchSkips = 0
+			r.remoteRefs = remoteRefs
+			r.history.recordRefUpdates(refs)
+			r.publishRefChange(refs)
+		}
+
+		// local HEAD is updated before ensuring worktrees so that
+		// worktrees on HEAD follow new default branch in the same cycle
+		// HEAD is fixed to the only mirrored branch in single branch mode
+		// default branch is resolved again if repo was initialised while
+		// remote was unreachable
+		if (r.trackHead || r.degradedHead) && r.singleBranch == "" {
+			if err := r.syncDefaultBranch(ctx); err != nil {
+				r.log.Error("unable to sync default branch", "err", err)
+			} else if r.degradedHead {
+				if err := r.setDegradedHead(ctx, false); err != nil {
+					r.log.Error("unable to clear degraded HEAD", "err", err)
+				} else {
+					r.log.Info("remote default branch resolved, repository is no longer degraded")
+				}
+			}
+		}
 	}
 
 	fetchTime := time.Since(start)
+	result.FetchDuration = fetchTime
+	result.UpdatedRefs = refs
+
+	// registrations left by crashed process are removed on the first cycle
+	// as clean up is only run once refs are updated
+	if r.lastSuccess.IsZero() {
+		if err := r.pruneWorktreeRegistrations(ctx); err != nil {
+			r.log.Error("unable to prune worktree registrations", "err", err)
+		}
+	}
 
 	// worktree might need re-creating if it fails check
 	// so always ensure worktree even if nothing fetched
-	for _, wl := range r.workTreeLinks {
-		if err := r.ensureWorktreeLink(ctx, wl); err != nil {
-			return fmt.Errorf("unable to ensure worktree links repo:%s link:%s  err:%w", r.gitURL.Repo, wl.name, err)
+	if err := r.ensureWorktreeLinks(ctx, result); err != nil {
+		reinitRefs, ok := r.recoverFromCorruption(ctx, err)
+		if !ok {
+			return &MirrorError{MirrorPhaseWorktree, err}
+		}
+		// refs fetched by the re-initialised mirror are published same
+		// as the refs of the normal fetch
+		refs = append(refs, reinitRefs...)
+		result.UpdatedRefs = refs
+		r.history.recordRefUpdates(reinitRefs)
+		r.publishRefChange(reinitRefs)
+		// retry with re-initialised mirror
+		if err := r.ensureWorktreeLinks(ctx, result); err != nil {
+			return &MirrorError{MirrorPhaseWorktree, err}
 		}
 	}
+	r.corruptCount = 0
+	r.saveState(result)
 
 	// clean-up can be skipped
 	if len(refs) == 0 {
 		return nil
 	}
 
-	if err := r.cleanup(ctx); err != nil {
-		return fmt.Errorf("unable to cleanup repo:%s  err:%w", r.gitURL.Repo, err)
+	cCtx, span := r.startSpan(ctx, "cleanup")
+	err := r.cleanup(cCtx)
+	endSpan(span, err)
+	if err != nil {
+		return &MirrorError{MirrorPhaseCleanup, fmt.Errorf("unable to cleanup repo:%s  err:%w", r.gitURL.Repo, err)}
 	}
+	r.updateDiskUsage(ctx)
 
 	r.log.Info("mirror cycle complete", "time", time.Since(start), "fetch-time", fetchTime, "updated-refs", len(refs))
 	return nil
 }
 
+// ensureWorktreeLinks ensures all the worktree links of the repository
+func (r *Repository) ensureWorktreeLinks(ctx context.Context, result *MirrorResult) error {
+	ctx, span := r.startSpan(ctx, "ensureWorktreeLinks")
+	defer span.End()
+
+	// hashes are resolved once per cycle as refs can't change while lock is held
+	rh := &refHashes{}
+
+	// links of the auto worktree rules are synced with the refs before
+	// ensuring worktrees so that new links are published in the same cycle
+	r.syncAutoWorktrees(ctx, rh)
+
+	if result.Worktrees == nil && len(r.workTreeLinks) > 0 {
+		result.Worktrees = make(map[string]WorktreeResult, len(r.workTreeLinks))
+	}
+
+	if !r.stateLoaded {
+		r.restoreState()
+		r.stateLoaded = true
+	}
+
+	// failure of one link shouldn't block update of the others
+	var errs []error
+	for _, wl := range r.workTreeLinks {
+		var wtResult WorktreeResult
+		wCtx, wlSpan := r.startSpan(ctx, "ensureWorktreeLink", attribute.String("link", wl.link), attribute.String("ref", wl.ref))
+		err := r.ensureWorktreeLink(wCtx, wl, rh, &wtResult)
+		endSpan(wlSpan, err)
+		wl.lastErr = err
+		if err != nil {
+			// missing ref is expected for links on branches which are
+			// not created yet, so it's recorded separately from failures
+			if errors.Is(err, ErrRefNotFound) {
+				r.setWorktreeStatus(wl, WorktreeStatusRefMissing)
+			} else {
+				r.setWorktreeStatus(wl, WorktreeStatusFailed)
+			}
+			recordWorktreeUpdateFailure(r.gitURL.Repo, wl.link)
+			err = fmt.Errorf("%w repo:%s link:%s  err:%w", ErrRepoWTUpdateFailed, r.gitURL.Repo, wl.name, err)
+			span.RecordError(err)
+			wtResult.Err = err
+			errs = append(errs, err)
+		}
+		result.Worktrees[wl.link] = wtResult
+	}
+	return errors.Join(errs...)
+}
+
+// recoverFromCorruption keeps track of consecutive fetch or worktree failures
+// caused by corrupted objects and re-initialises the mirror once threshold is
+// reached. it returns refs fetched by the re-initialised mirror and true if
+// mirror was re-initialised.
+func (r *Repository) recoverFromCorruption(ctx context.Context, err error) ([]RefUpdate, bool) {
+	if !corruptionErrRgx.MatchString(err.Error()) {
+		r.corruptCount = 0
+		return nil, false
+	}
+
+	r.corruptCount++
+	if r.corruptCount < r.reinitLimit {
+		r.log.Warn("mirror failed due to corrupted objects", "failures", r.corruptCount, "threshold", r.reinitLimit, "err", err)
+		return nil, false
+	}
+
+	r.log.Error("repository objects are corrupted, re-initialising mirror", "failures", r.corruptCount, "err", err)
+	r.corruptCount = 0
+	recordReinit(r.gitURL.Repo)
+
+	refs, err := r.reinit(ctx)
+	if err != nil {
+		r.log.Error("unable to re-initialise mirror", "err", err)
+		return nil, false
+	}
+	return refs, true
+}
+
+// reinit re-creates bare mirror and fetches the remote again, it returns the
+// fetched refs. worktrees root is kept so published links keep pointing to
+// the existing checkouts until new worktrees are created from the
+// re-initialised mirror.
+func (r *Repository) reinit(ctx context.Context) ([]RefUpdate, error) {
+	fallbackHead := r.previousHead(ctx)
+	r.emptyTree = ""
+	if err := r.clearRepoDir(); err != nil {
+		return nil, err
+	}
+
+	if err := r.initBare(ctx, fallbackHead); err != nil {
+		return nil, fmt.Errorf("unable to init repo err:%w", err)
+	}
+
+	refs, err := r.fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch repo err:%w", err)
+	}
+	return refs, nil
+}
+
+// clearRepoDir removes content of the repo dir except worktrees root
+func (r *Repository) clearRepoDir() error {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("unable to read repo dir err:%w", err)
+	}
+	for _, e := range entries {
+		if e.Name() == filepath.Base(r.worktreesRoot()) {
+			continue
+		}
+		if err := safeRemoveAll(r.dir, filepath.Join(r.dir, e.Name())); err != nil {
+			return fmt.Errorf("unable to remove repo dir content err:%w", err)
+		}
+	}
+	return nil
+}
+
+// Directory returns the abs path of the mirrored bare repository
+func (r *Repository) Directory() string {
+	return r.dir
+}
+
 // worktreesRoot returns abs path for all the worktrees of the repo
 // git uses `worktrees` folder for its on use hence we are using `.worktrees`
 func (r *Repository) worktreesRoot() string {
 	return filepath.Join(r.dir, ".worktrees")
 }
 
-// worktreePath generates path based on worktree link and hash.
-// two worktree links can be on same ref but with diff pathspecs
-// hence we cant just use tree hash as path
+// worktreePath generates path based on checkout settings of the worktree
+// link and hash. see worktreeDirName
 func (r *Repository) worktreePath(wl *WorkTreeLink, hash string) string {
 	return filepath.Join(r.worktreesRoot(), wl.worktreeDirName(hash))
 }
 
 // init examines the git repo and determines if it is usable or not. If
 // not, it will (re)initialize it.
-// it will also make a remote call to get `symbolic-ref HEAD` of the remote
-// to get default branch for the remote
+// on (re)initialization it will also make a remote call to get
+// `symbolic-ref HEAD` of the remote to get default branch for the remote,
+// if remote is unreachable HEAD of the previous repo is used if known.
 func (r *Repository) init(ctx context.Context) error {
+	var fallbackHead string
+
 	_, err := os.Stat(r.dir)
 	switch {
 	case os.IsNotExist(err):
@@ -493,25 +1994,62 @@ func (r *Repository) init(ctx context.Context) error {
 	case err != nil:
 		return fmt.Errorf("unable to verify repo dir err:%w", err)
 	default:
-		// Make sure the directory we found is actually usable.
-		if !r.sanityCheckRepo(ctx) {
-			r.log.Error("repo directory was empty or failed checks, re-creating...", "path", r.dir)
-			// Maybe a previous run crashed?  Git won't use this dir.
-			// since we add own folder to given root path we could just delete whole dir
-			// and re-create it
-			if err := reCreate(r.dir); err != nil {
-				return fmt.Errorf("unable to re-create repo dir err:%w", err)
+		// Make sure the directory we found is actually usable. config
+		// mismatches are fixed in place instead of re-creating the repo
+		err := r.checkRepo(ctx)
+		if err != nil && r.adopt && !errors.Is(err, errDirEmpty) && !errors.Is(err, errRepoCorrupt) {
+			r.log.Warn("existing repo doesn't match config, adopting it", "path", r.dir, "err", err)
+			if err = r.adoptRepo(ctx); err == nil {
+				err = r.checkRepo(ctx)
 			}
-		} else {
+			// adopted repo is only re-created if its objects are corrupt
+			if err != nil && !errors.Is(err, errRepoCorrupt) {
+				return fmt.Errorf("unable to adopt existing repo err:%w", err)
+			}
+		}
+		if errors.Is(err, errRepoRepairable) {
+			r.log.Warn("repo config doesn't match, repairing it", "path", r.dir, "err", err)
+			if err = r.repairRepo(ctx); err == nil {
+				err = r.checkRepo(ctx)
+			}
+		}
+		if err == nil {
 			r.log.Log(ctx, -8, "existing repo directory is valid", "path", r.dir)
+			// degraded state is persisted so it survives restart
+			if r.lastSuccess.IsZero() && !r.degradedHead {
+				r.degradedHead = r.readDegradedHead(ctx)
+				recordDegradedInit(r.gitURL.Repo, r.degradedHead)
+			}
 			return nil
 		}
+
+		if errors.Is(err, errDirEmpty) {
+			r.log.Info("repo directory is empty", "path", r.dir)
+		} else {
+			r.log.Error("repo directory failed checks, re-creating...", "path", r.dir, "err", err)
+		}
+		// HEAD of the existing repo is used if remote is unreachable
+		fallbackHead = r.previousHead(ctx)
+		// Maybe a previous run crashed?  Git won't use this dir.
+		// worktrees root is kept so published links keep pointing to the
+		// existing checkouts until new worktrees are created
+		if err := r.clearRepoDir(); err != nil {
+			return err
+		}
 	}
 
+	return r.initBare(ctx, fallbackHead)
+}
+
+// initBare initialises bare repository in the repo dir and configures
+// origin remote. if remote default branch can't be resolved, local HEAD is
+// set to fallbackHead if not empty and repository is marked as degraded
+// so that default branch is resolved again on next cycles.
+func (r *Repository) initBare(ctx context.Context, fallbackHead string) error {
 	// create bare repository as we will use worktrees to checkout files
 	r.log.Info("initializing repo directory", "path", r.dir)
-	// git init -q --bare
-	if _, err := runGitCommand(ctx, r.log, r.envs, r.dir, "init", "-q", "--bare"); err != nil {
+	// git [-c <key>=<value>...] init -q --bare
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, slices.Concat(r.gitConfig, []string{"init", "-q", "--bare"})...); err != nil {
 		return fmt.Errorf("unable to init repo err:%w", err)
 	}
 
@@ -520,132 +2058,451 @@ func (r *Repository) init(ctx context.Context) error {
 	// use --mirror=fetch as we want to create mirrored bare repository. it will make sure
 	// everything in refs/* on the remote will be directly mirrored into refs/* in the local repository.
 	// git remote add --mirror=fetch origin <remote>
-	if _, err := runGitCommand(ctx, r.log, r.envs, r.dir, "remote", "add", "--mirror=fetch", "origin", r.remote); err != nil {
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "remote", "add", "--mirror=fetch", "origin", r.remoteURL); err != nil {
 		return fmt.Errorf("unable to set remote err:%w", err)
 	}
 
-	// get default branch from remote and set it as local HEAD
-	headBranch, err := r.getRemoteDefaultBranch(ctx)
-	if err != nil {
-		return fmt.Errorf("unable to get remote default branch err:%w", err)
+	// replace default mirror refspec if only subset of refs should be mirrored
+	if !slices.Equal(r.refSpecs, []string{defaultRefSpec}) {
+		// git config --unset-all remote.origin.fetch
+		if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--unset-all", "remote.origin.fetch"); err != nil {
+			return fmt.Errorf("unable to unset default refspec err:%w", err)
+		}
+		for _, rs := range r.refSpecs {
+			// git config --add remote.origin.fetch <refspec>
+			if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--add", "remote.origin.fetch", rs); err != nil {
+				return fmt.Errorf("unable to set refspec err:%w", err)
+			}
+		}
+	}
+
+	// record depth used to create the mirror so repo can be re-initialised
+	// if depth changes
+	// git config gitmirror.depth <depth>
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "gitmirror.depth", strconv.Itoa(r.depth)); err != nil {
+		return fmt.Errorf("unable to set depth config err:%w", err)
+	}
+
+	// get default branch from remote and set it as local HEAD, in single
+	// branch mode remote's default branch might not be mirrored
+	headBranch := "refs/heads/" + r.singleBranch
+	degraded := false
+	if r.singleBranch == "" {
+		var err error
+		headBranch, err = r.getRemoteDefaultBranch(ctx)
+		switch {
+		case err == nil:
+		case fallbackHead == "" || ctx.Err() != nil:
+			return fmt.Errorf("unable to get remote default branch err:%w", err)
+		default:
+			r.log.Warn("unable to get remote default branch, initialising with previous HEAD", "head", fallbackHead, "err", err)
+			headBranch, degraded = fallbackHead, true
+		}
 	}
 
 	// set local HEAD to remote HEAD/default branch
 	// git symbolic-ref HEAD <headBranch>(refs/heads/master)
-	if _, err := runGitCommand(ctx, r.log, r.envs, r.dir, "symbolic-ref", "HEAD", headBranch); err != nil {
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "symbolic-ref", "HEAD", headBranch); err != nil {
 		return fmt.Errorf("unable to set remote err:%w", err)
 	}
 
+	if err := r.setDegradedHead(ctx, degraded); err != nil {
+		return err
+	}
+
 	if !r.sanityCheckRepo(ctx) {
 		return fmt.Errorf("can't initialize git repo directory")
 	}
 
-	return nil
+	return r.writeLayoutVersion(currentLayoutVersion)
 }
 
 // getRemoteDefaultBranch will run ls-remote to get HEAD of the remote
 // and parse output to get default branch name
 func (r *Repository) getRemoteDefaultBranch(ctx context.Context) (string, error) {
-	envs := []string{}
-	if giturl.IsSCPURL(r.remote) || giturl.IsSSHURL(r.remote) {
-		envs = append(envs, r.auth.gitSSHCommand())
+	return r.remoteDefaultBranch(ctx, "origin")
+}
+
+// remoteDefaultBranch returns default branch of the given remote name or url
+func (r *Repository) remoteDefaultBranch(ctx context.Context, remote string) (string, error) {
+	envs, err := r.authEnv(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	// git ls-remote --symref origin HEAD
-	out, err := runGitCommand(ctx, r.log, envs, r.dir, "ls-remote", "--symref", "origin", "HEAD")
+	var out string
+	err = r.retryRemote(ctx, "ls-remote", func(ctx context.Context) error {
+		ctx, cancel := r.withGitTimeout(ctx)
+		defer cancel()
+
+		args := append(r.remoteArgs(), "ls-remote", "--symref", remote, "HEAD")
+		// git [-c <key>=<value>...] ls-remote --symref <remote> HEAD
+		var err error
+		out, err = runGitCommand(ctx, r.log, r.gitOps, r.runner, slices.Concat(r.envs, envs), r.dir, args...)
+		return classifyGitErr(err)
+	})
 	if err != nil {
+		r.credentialFailed(err)
 		return "", fmt.Errorf("unable to get default branch err:%w", err)
 	}
 
 	sections := remoteDefaultBranchRgx.FindStringSubmatch(out)
 
 	if len(sections) == 2 {
-		r.log.Info("fetched remote symbolic ref", "default-branch", sections[1])
+		r.log.Debug("fetched remote symbolic ref", "default-branch", sections[1])
 		return sections[1], nil
 	}
 
 	return "", fmt.Errorf("unable to parse ls-remote output:%s sections:%s", out, sections)
 }
 
+// syncDefaultBranch updates local HEAD if default branch of the remote has
+// changed since the repository was initialised
+func (r *Repository) syncDefaultBranch(ctx context.Context) error {
+	remoteHead, err := r.getRemoteDefaultBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	// git symbolic-ref HEAD
+	localHead, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "symbolic-ref", "HEAD")
+	if err != nil {
+		return fmt.Errorf("unable to get local HEAD err:%w", err)
+	}
+	if localHead == remoteHead {
+		return nil
+	}
+
+	// new default branch might not be mirrored if refspecs only covers subset of refs
+	// git rev-parse --verify --quiet <remoteHead>
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "rev-parse", "--verify", "--quiet", remoteHead); err != nil {
+		return fmt.Errorf("new default branch %s is not mirrored err:%w", remoteHead, err)
+	}
+
+	// git symbolic-ref HEAD <remoteHead>
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "symbolic-ref", "HEAD", remoteHead); err != nil {
+		return fmt.Errorf("unable to update local HEAD err:%w", err)
+	}
+	r.log.Info("remote default branch changed, local HEAD updated", "old", localHead, "new", remoteHead)
+	return nil
+}
+
+// withGitTimeout returns context with git timeout applied if configured,
+// it should be used for the git commands which talks to the remote
+func (r *Repository) withGitTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.gitTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.gitTimeout)
+}
+
+// authEnv returns the environment variables required to authenticate
+// with the remote. for ssh remotes managed known hosts file is bootstrapped
+// with the remote host keys if required.
+func (r *Repository) authEnv(ctx context.Context) ([]string, error) {
+	return r.remoteAuthEnv(ctx, r.snapshotRemoteConfig(0))
+}
+
+// remoteAuthEnv returns the environment variables required to authenticate
+// with the remote using auth and proxy of the given config snapshot
+func (r *Repository) remoteAuthEnv(ctx context.Context, conf *remoteConfig) ([]string, error) {
+	auth, proxyURL := conf.auth, conf.proxyURL
+	if giturl.IsSCPURL(r.remote) || giturl.IsSSHURL(r.remote) {
+		if err := r.bootstrapKnownHosts(ctx, conf); err != nil {
+			return nil, fmt.Errorf("unable to bootstrap known hosts err:%w", err)
+		}
+		if proxyURL != "" {
+			return []string{auth.gitSSHCommand() + " " + sshProxyOption(proxyURL)}, nil
+		}
+		return []string{auth.gitSSHCommand()}, nil
+	}
+
+	envs := []string{}
+	var err error
+	switch {
+	case giturl.IsHTTPSURL(r.remote) && len(auth.CredentialCommand) > 0:
+		envs, err = r.creds.envs(ctx, r.log, auth, r.now())
+	case giturl.IsHTTPSURL(r.remote) && auth.hasHTTPAuth():
+		envs, err = auth.gitHTTPAuthEnvs()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// proxy url can contain credentials so its passed via env instead of
+	// command args which are visible in the process list
+	if proxyURL != "" {
+		envs = appendGitConfigEnv(envs, "http.proxy", proxyURL)
+	}
+	return envs, nil
+}
+
+// remoteArgs returns git config args of the configured git config, it
+// should be added to the commands which talks to the remote
+func (r *Repository) remoteArgs() []string {
+	return slices.Clone(r.gitConfig)
+}
+
 // sanityCheckRepo tries to make sure that the repo dir is a valid git repository.
 func (r *Repository) sanityCheckRepo(ctx context.Context) bool {
+	if err := r.checkRepo(ctx); err != nil {
+		if errors.Is(err, errDirEmpty) {
+			r.log.Info("repo directory is empty", "path", r.dir)
+		} else {
+			r.log.Error("repo failed sanity checks", "path", r.dir, "err", err)
+		}
+		return false
+	}
+	return true
+}
+
+// checkRepo runs sanity checks on the repo dir and returns the first failed
+// check as error
+func (r *Repository) checkRepo(ctx context.Context) error {
 	// If it is empty, we are done.
 	if empty, err := dirIsEmpty(r.dir); err != nil {
-		r.log.Error("can't list repo directory", "path", r.dir, "err", err)
-		return false
+		return fmt.Errorf("can't list repo directory err:%w", err)
 	} else if empty {
-		r.log.Info("repo directory is empty", "path", r.dir)
-		return false
+		return errDirEmpty
 	}
 
 	// make sure repo is bare repository
 	// git rev-parse --is-bare-repository
-	if ok, err := runGitCommand(ctx, r.log, r.envs, r.dir, "rev-parse", "--is-bare-repository"); err != nil {
-		r.log.Error("unable to verify bare repo", "path", r.dir, "err", err)
-		return false
+	if ok, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "rev-parse", "--is-bare-repository"); err != nil {
+		return fmt.Errorf("unable to verify bare repo err:%w", err)
 	} else if ok != "true" {
-		r.log.Error("repo is not a bare repository", "path", r.dir)
-		return false
+		return fmt.Errorf("repo is not a bare repository")
 	}
 
 	// Check that this is actually the root of the repo.
 	// git rev-parse --absolute-git-dir
-	if root, err := runGitCommand(ctx, r.log, r.envs, r.dir, "rev-parse", "--absolute-git-dir"); err != nil {
-		r.log.Error("can't get repo git dir", "path", r.dir, "err", err)
-		return false
-	} else {
-		if root != r.dir {
-			r.log.Error("repo directory is under another repo", "path", r.dir, "parent", root)
-			return false
+	if root, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "rev-parse", "--absolute-git-dir"); err != nil {
+		return fmt.Errorf("can't get repo git dir err:%w", err)
+	} else if root != r.dir {
+		return fmt.Errorf("repo directory is under another repo parent:%s", root)
+	}
+
+	// The "origin" remote has special meaning, like in relative-path submodules.
+	// make sure origin exists with correct remote URL
+	// git config --get remote.origin.url
+	if stdout, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--get", "remote.origin.url"); err != nil {
+		return fmt.Errorf("can't get repo config remote.origin.url err:%w", err)
+	} else if stdout != r.remoteURL {
+		return fmt.Errorf("%w: repo configured with diff remote url remote.origin.url:%s", errRepoRepairable, giturl.Redact(stdout))
+	}
+
+	// verify origin's fetch refspecs, since existing mirror may contain refs
+	// outside of the configured refspecs, repo needs to be re-created on change
+	// git config --get-all remote.origin.fetch
+	if stdout, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--get-all", "remote.origin.fetch"); err != nil {
+		return fmt.Errorf("can't get repo config remote.origin.fetch err:%w", err)
+	} else if !sameRefSpecs(strings.Split(stdout, "\n"), r.refSpecs) {
+		return fmt.Errorf("repo configured with incorrect fetch refspec remote.origin.fetch:%s", stdout)
+	}
+
+	// in single branch mode local HEAD must point to the mirrored branch
+	// git symbolic-ref HEAD
+	if r.singleBranch != "" {
+		if stdout, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "symbolic-ref", "HEAD"); err != nil {
+			return fmt.Errorf("%w: can't get repo HEAD err:%w", errRepoRepairable, err)
+		} else if stdout != "refs/heads/"+r.singleBranch {
+			return fmt.Errorf("%w: repo HEAD is not the mirrored single branch HEAD:%s", errRepoRepairable, stdout)
+		}
+	}
+
+	// verify mirror was created with same depth, since shallow history of the
+	// existing mirror can't be un-shallowed/truncated reliably repo needs to
+	// be re-created on change
+	// git config --get gitmirror.depth
+	if stdout, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--get", "gitmirror.depth"); err != nil && r.depth != 0 {
+		return fmt.Errorf("can't get repo config gitmirror.depth err:%w", err)
+	} else if err == nil && stdout != strconv.Itoa(r.depth) {
+		return fmt.Errorf("repo configured with different depth gitmirror.depth:%s", stdout)
+	}
+
+	// Consistency-check the repo. shallow repository passes the check as
+	// fsck respects 'shallow' file. Don't use --verbose because it can be
+	// REALLY verbose.
+	// git fsck --no-progress --connectivity-only
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "fsck", "--no-progress", "--connectivity-only"); err != nil {
+		return fmt.Errorf("%w: repo fsck failed err:%w", errRepoCorrupt, err)
+	}
+
+	return nil
+}
+
+// repairRepo fixes repo config which can be updated in place without
+// re-creating the repo. see errRepoRepairable
+func (r *Repository) repairRepo(ctx context.Context) error {
+	// git remote set-url origin <remote>
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "remote", "set-url", "origin", r.remoteURL); err != nil {
+		return fmt.Errorf("unable to set remote url err:%w", err)
+	}
+	if r.singleBranch != "" {
+		// git symbolic-ref HEAD refs/heads/<branch>
+		if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "symbolic-ref", "HEAD", "refs/heads/"+r.singleBranch); err != nil {
+			return fmt.Errorf("unable to set HEAD err:%w", err)
+		}
+	}
+	return nil
+}
+
+// previousHead returns local HEAD branch of the existing repo which can be
+// used if remote default branch can't be resolved on re-initialisation.
+// HEAD recorded in the state file is preferred as repo might be broken,
+// otherwise main or master branch is used if it exists. empty string is
+// returned if HEAD can't be determined.
+func (r *Repository) previousHead(ctx context.Context) string {
+	if state, _ := r.readState(); state != nil && state.Head != "" {
+		return state.Head
+	}
+	for _, branch := range []string{"refs/heads/main", "refs/heads/master"} {
+		// --git-dir is used so that git doesn't look for repo in parent dirs
+		// git --git-dir <dir> rev-parse --verify --quiet <branch>
+		if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "--git-dir", r.dir, "rev-parse", "--verify", "--quiet", branch); err == nil {
+			return branch
+		}
+	}
+	return ""
+}
+
+// setDegradedHead updates degraded state of the repository and persists it
+// in repo config so that default branch is resolved again after restart
+func (r *Repository) setDegradedHead(ctx context.Context, degraded bool) error {
+	if degraded {
+		// git config gitmirror.degradedHead true
+		if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "gitmirror.degradedHead", "true"); err != nil {
+			return fmt.Errorf("unable to set degraded HEAD config err:%w", err)
+		}
+	} else if r.degradedHead {
+		// git config --unset gitmirror.degradedHead
+		if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--unset", "gitmirror.degradedHead"); err != nil {
+			return fmt.Errorf("unable to unset degraded HEAD config err:%w", err)
+		}
+	}
+	r.degradedHead = degraded
+	recordDegradedInit(r.gitURL.Repo, degraded)
+	return nil
+}
+
+// readDegradedHead returns true if repo was initialised with fallback HEAD
+// and remote default branch hasn't been resolved since
+func (r *Repository) readDegradedHead(ctx context.Context) bool {
+	// git config --type=bool --default=false --get gitmirror.degradedHead
+	out, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "config", "--type=bool", "--default=false", "--get", "gitmirror.degradedHead")
+	return err == nil && out == "true"
+}
+
+// fetch calls git fetch to update all references. if remote rejects the
+// cached credential of the credential command fetch is retried once with
+// the refreshed credential.
+// transient failures are retried within the same mirror cycle, see
+// RepositoryConfig.FetchRetries
+func (r *Repository) fetch(ctx context.Context) ([]RefUpdate, error) {
+	var updates []RefUpdate
+	err := r.retryRemote(ctx, "fetch", func(ctx context.Context) error {
+		var err error
+		updates, err = r.fetchOnce(ctx)
+		if r.credentialFailed(err) {
+			updates, err = r.fetchOnce(ctx)
 		}
+		return err
+	})
+	return updates, err
+}
+
+// fetchOnce runs git fetch
+func (r *Repository) fetchOnce(ctx context.Context) ([]RefUpdate, error) {
+	args := r.fetchArgs()
+
+	envs, err := r.authEnv(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// The "origin" remote has special meaning, like in relative-path submodules.
-	// make sure origin exists with correct remote URL
-	// git config --get remote.origin.url
-	if stdout, err := runGitCommand(ctx, r.log, r.envs, r.dir, "config", "--get", "remote.origin.url"); err != nil {
-		r.log.Error("can't get repo config remote.origin.url", "path", r.dir, "err", err)
-		return false
-	} else if stdout != r.remote {
-		r.log.Error("repo configured with diff remote url", "path", r.dir, "remote.origin.url", stdout)
-		return false
+	ctx, cancel := r.withGitTimeout(ctx)
+	defer cancel()
+
+	// git [-c <key>=<value>...] fetch origin --no-progress --porcelain --no-auto-gc [--no-tags] [--prune] [--prune-tags] [--depth=<depth>] [<refspecs>...]
+	out, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, slices.Concat(r.envs, envs), r.dir, args...)
+
+	updates := parseRefUpdates(out)
+	now := r.now()
+	for i := range updates {
+		updates[i].Time = now
 	}
+	return updates, classifyGitErr(err)
+}
 
-	// verify origin's fetch refspec
-	// git config --get remote.origin.fetch
-	if stdout, err := runGitCommand(ctx, r.log, r.envs, r.dir, "config", "--get", "remote.origin.fetch"); err != nil {
-		r.log.Error("can't get repo config remote.origin.fetch", "path", r.dir, "err", err)
-		return false
-	} else if stdout != defaultRefSpec {
-		r.log.Error("repo configured with incorrect fetch refspec", "path", r.dir, "remote.origin.fetch", stdout)
-		return false
+// shouldSkipFetch lists remote refs and returns true if they are same as the
+// refs listed before last successful fetch. fetch is not skipped after failed
+// mirror cycle or if it was already skipped on last fullFetchInterval-1 cycles.
+// listed refs are returned so they can be recorded once fetch succeeds.
+func (r *Repository) shouldSkipFetch(ctx context.Context) (bool, map[string]string) {
+	remoteRefs, err := r.lsRemote(ctx)
+	if err != nil {
+		r.log.Warn("unable to list remote refs, running fetch", "err", err)
+		return false, nil
 	}
+	if r.remoteRefs == nil || r.failures > 0 || r.fetchSkips >= fullFetchInterval-1 {
+		return false, remoteRefs
+	}
+	if changed := diffRefMaps(r.remoteRefs, remoteRefs); len(changed) > 0 {
+		r.log.Debug("remote refs changed", "refs", changed)
+		return false, remoteRefs
+	}
+	return true, remoteRefs
+}
 
-	// Consistency-check the repo.  Don't use --verbose because it can be
-	// REALLY verbose.
-	// git fsck --no-progress --connectivity-only
-	if _, err := runGitCommand(ctx, r.log, r.envs, r.dir, "fsck", "--no-progress", "--connectivity-only"); err != nil {
-		r.log.Error("repo fsck failed", "path", r.dir, "err", err)
-		return false
+// lsRemote returns all the refs of the remote with their hashes
+func (r *Repository) lsRemote(ctx context.Context) (map[string]string, error) {
+	envs, err := r.authEnv(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return true
+	ctx, cancel := r.withGitTimeout(ctx)
+	defer cancel()
+
+	args := append(r.remoteArgs(), "ls-remote", "origin")
+	// git [-c <key>=<value>...] ls-remote origin
+	out, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, slices.Concat(r.envs, envs), r.dir, args...)
+	if err != nil {
+		err = classifyGitErr(err)
+		r.credentialFailed(err)
+		return nil, err
+	}
+	return parseLsRemote(out), nil
 }
 
-// fetch calls git fetch to update all references
-func (r *Repository) fetch(ctx context.Context) ([]string, error) {
+// fetchArgs returns the args of the fetch command based on the repository config
+func (r *Repository) fetchArgs() []string {
 	// adding --porcelain so output can be parsed for updated refs
 	// do not use -v output it will print all refs
-	args := []string{"fetch", "origin", "--prune", "--no-progress", "--porcelain", "--no-auto-gc"}
-
-	envs := []string{}
-	if giturl.IsSCPURL(r.remote) || giturl.IsSSHURL(r.remote) {
-		envs = append(envs, r.auth.gitSSHCommand())
+	args := append(r.remoteArgs(), "fetch", "origin", "--no-progress", "--porcelain", "--no-auto-gc")
+	// in single branch mode tags pointing into the branch history are not
+	// auto-followed and --prune-tags is skipped as it implies tags refspec
+	if r.singleBranch != "" {
+		args = append(args, "--no-tags")
+	}
+	if r.prune {
+		args = append(args, "--prune")
+		if r.pruneTags && r.singleBranch == "" {
+			args = append(args, "--prune-tags")
+		}
 	}
-
-	// git fetch origin --prune --no-progress --no-auto-gc
-	out, err := runGitCommand(ctx, r.log, envs, r.dir, args...)
-	return updatedRefs(out), err
+	if r.depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", r.depth))
+	}
+	if r.fetchJobs > 0 {
+		args = append(args, fmt.Sprintf("--jobs=%d", r.fetchJobs))
+	}
+	// configured refspecs might match keep refs of the pinned commits so
+	// they are excluded to prevent prune from deleting them
+	if r.prune && r.hasPinnedLinks() {
+		args = append(args, r.refSpecs...)
+		args = append(args, "^"+keepRefPrefix+"*")
+	}
+	return args
 }
 
 // hash returns the hash of the given revision and for the path if specified.
@@ -655,27 +2512,96 @@ func (r *Repository) hash(ctx context.Context, ref, path string) (string, error)
 		args = append(args, "--", path)
 	}
 	// git log --pretty=format:%H -n 1 <ref> [-- <path>]
-	return runGitCommand(ctx, r.log, r.envs, r.dir, args...)
+	hash, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, args...)
+	return hash, classifyGitErr(err)
+}
+
+// resolveRefPattern returns the highest tag matching the ref pattern of the
+// worktree link based on its sort order, empty ref is returned if there is
+// no matching tag
+func (r *Repository) resolveRefPattern(ctx context.Context, wl *WorkTreeLink) (string, error) {
+	// git for-each-ref --sort=<key> --count=1 --format=%(refname) refs/tags/<pattern>
+	ref, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "for-each-ref",
+		"--sort="+wl.refSort.sortKey(), "--count=1", "--format=%(refname)", "refs/tags/"+wl.refPattern)
+	if err != nil {
+		return "", err
+	}
+	return ref, nil
 }
 
 // ensureWorktreeLink will create / validate worktrees
 // it will remove worktree if tracking ref is removed from the remote
-func (r *Repository) ensureWorktreeLink(ctx context.Context, wl *WorkTreeLink) error {
-	// get remote hash from mirrored repo for the worktree link
-	remoteHash, err := r.hash(ctx, wl.ref, wl.pathspec)
-	if err != nil {
-		return fmt.Errorf("unable to get hash for worktree:%s err:%w", wl.name, err)
+func (r *Repository) ensureWorktreeLink(ctx context.Context, wl *WorkTreeLink, rh *refHashes, result *WorktreeResult) error {
+	// rolled back worktree is kept published until link is resumed
+	if wl.paused {
+		hash, err := wl.CurrentHash()
+		if err != nil {
+			return fmt.Errorf("unable to read published hash of paused worktree:%s err:%w", wl.name, err)
+		}
+		result.Hash = hash
+		r.setWorktreeStatus(wl, WorktreeStatusPaused)
+		return nil
+	}
+
+	ref := wl.ref
+	if wl.refPattern != "" {
+		var err error
+		if ref, err = r.resolveRefPattern(ctx, wl); err != nil {
+			return fmt.Errorf("unable to resolve ref pattern for worktree:%s err:%w", wl.name, err)
+		}
+		// pattern might not match any tag yet (eg. before first release) or
+		// all the matching tags were deleted. link is pending and already
+		// published worktree is kept until matching tag is mirrored
+		if ref == "" {
+			if wl.status != WorktreeStatusPending {
+				wl.log.Info("no tag found matching ref pattern, worktree is pending", "pattern", wl.refPattern)
+			}
+			r.setWorktreeStatus(wl, WorktreeStatusPending)
+			return nil
+		}
+		if ref != wl.currentRef {
+			wl.log.Info("ref pattern resolved", "pattern", wl.refPattern, "ref", ref, "previous", wl.currentRef)
+			wl.currentRef = ref
+		}
+	}
+
+	// short ref names are expanded explicitly so that hash doesn't depend
+	// on git's precedence if branch and tag share the name
+	refName, ambiguous := r.resolveRefName(ctx, rh, wl, ref)
+	r.setRefName(wl, refName, ambiguous)
+
+	// commit of the pinned worktree never changes so once its published
+	// there is no need to resolve it again
+	remoteHash := wl.pinnedHash
+	if remoteHash == "" {
+		if wl.pinned() {
+			if err := r.keepPinnedCommit(ctx, wl); err != nil {
+				return err
+			}
+		}
+		// get remote hash from mirrored repo for the worktree link
+		var err error
+		if remoteHash, err = r.cachedHash(ctx, rh, refName, wl.pathspec); err != nil {
+			return fmt.Errorf("unable to get hash for worktree:%s err:%w", wl.name, err)
+		}
 	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("ref", ref), attribute.String("hash", remoteHash))
+	result.Hash = remoteHash
 	var currentHash, currentPath string
 
 	// we do not care if we cant get old worktree path as we can create it
-	currentPath, err = wl.currentWorktree()
+	currentPath, err := wl.currentWorktree()
 	if err != nil {
 		// in case of error we create new worktree
 		wl.log.Error("unable to get current worktree path", "err", err)
 	}
 
-	if currentPath != "" {
+	// worktree recorded before restart can skip git checks
+	restored := wl.restoredWorktree(ref, remoteHash, currentPath)
+	if restored {
+		wl.log.Debug("worktree restored from state file", "hash", remoteHash)
+		currentHash = remoteHash
+	} else if currentPath != "" {
 		// get hash from the worktree folder
 		currentHash, err = wl.workTreeHash(ctx, currentPath)
 		if err != nil {
@@ -684,60 +2610,292 @@ func (r *Repository) ensureWorktreeLink(ctx context.Context, wl *WorkTreeLink) e
 		}
 	}
 
-	// we got empty remote hash so either given worktree ref do not exits yet or
-	// its removed from the remote
+	// hash command errors if ref doesn't exist, so empty remote hash means ref
+	// resolves but there is no commit for the pathspec yet (eg. dir only exists
+	// on other branch). this is expected hence mark worktree as pending
+	// and do not publish link until pathspec matches the history
 	if remoteHash == "" {
+		// pathspec doesn't match any file of the ref, strict link fails
+		// instead of waiting for the pathspec to appear
+		wl.specHash = ""
+		if err := r.setEmptyPathspec(wl, true, ref); err != nil {
+			return err
+		}
+		if wl.status != WorktreeStatusPending {
+			wl.log.Info("no commit found for the pathspec, worktree is pending", "ref", ref, "pathspec", wl.pathspec)
+		}
+		r.setWorktreeStatus(wl, WorktreeStatusPending)
+
 		wt, err := wl.currentWorktree()
 		if err != nil {
-			wl.log.Error("can't get current worktree", "err", err)
+			wl.log.Warn("can't get current worktree", "err", err)
 			return nil
 		}
 		if wt == "" {
 			return nil
 		}
 
-		wl.log.Info("remote hash is empty, removing old worktree", "path", currentPath)
-		if err := r.removeWorktree(ctx, wt); err != nil {
-			wl.log.Error("unable to remove old worktree", "err", err)
+		// worktree might still be published or retained by other links
+		if !r.sharedWorktree(wt, wl) && !r.retainedWorktree(wt, wl) {
+			wl.log.Info("remote hash is empty, removing old worktree", "path", currentPath)
+			if err := r.removeWorktree(ctx, wt); err != nil {
+				wl.log.Error("unable to remove old worktree", "err", err)
+			}
 		}
+		if err := wl.removeCopies(); err != nil {
+			wl.log.Error("unable to remove worktree copies", "err", err)
+		}
+		if err := wl.removeHashFile(); err != nil {
+			wl.log.Error("unable to remove hash file", "err", err)
+		}
+		r.history.recordLinkUpdate(LinkUpdate{Time: r.now(), Link: wl.link, OldHash: currentHash})
+		r.auditLinkUpdate(ctx, wl, ref, currentHash, "")
+		r.queueEvent(Event{Type: EventWorktreeRemoved, Link: wl.link, OldHash: currentHash})
 
 		return nil
 	}
 
-	if currentHash == remoteHash {
-		if wl.sanityCheckWorktree(ctx) {
+	if wl.pathspec != "" {
+		if err := r.checkPathspec(ctx, wl, remoteHash); err != nil {
+			return err
+		}
+	}
+
+	// worktree is moved to new dir if checkout settings of the link have
+	// changed or it was created by older version with link name in the path
+	wtPath := r.worktreePath(wl, remoteHash)
+	if currentHash == remoteHash && isWorktreePath(currentPath, wtPath) {
+		if restored || wl.sanityCheckWorktree(ctx) {
 			wl.log.Debug("current hash is same as remote and checks passed", "hash", currentHash)
+			// publish mode might have changed since worktree was published
+			if !wl.isPublished(currentPath) {
+				wl.log.Info("re-publishing worktree", "mode", wl.publish)
+				if err := wl.publishWorktree(currentPath); err != nil {
+					return err
+				}
+			}
+			// hash file might be missing if worktree was published by older version
+			if published, _ := wl.CurrentHash(); published != currentHash {
+				if err := wl.writeHashFile(currentHash, ref, r.now()); err != nil {
+					return fmt.Errorf("unable to publish hash file err:%w", err)
+				}
+			}
+			r.setWorktreeStatus(wl, WorktreeStatusReady)
+			wl.setPinnedHash(remoteHash)
 			return nil
 		}
 		wl.log.Error("worktree failed checks, re-creating...", "path", currentPath)
 	}
 
-	wl.log.Info("worktree update required", "remoteHash", remoteHash, "currentHash", currentHash)
-	newPath, err := r.createWorktree(ctx, wl, remoteHash)
-	if err != nil {
+	if blocked, err := r.blockedUpdate(ctx, wl, currentHash, remoteHash); err != nil {
+		return err
+	} else if blocked {
+		return nil
+	}
+
+	wl.log.Info("worktree update required", "refName", refName, "remoteHash", remoteHash, "currentHash", currentHash, "path", wtPath)
+	newPath, reused := r.reusableWorktree(ctx, wl, wtPath, remoteHash)
+	if reused {
+		wl.log.Info("reusing worktree published on other link", "path", newPath)
+	} else if newPath, err = r.createWorktree(ctx, wl, remoteHash); err != nil {
 		return fmt.Errorf("unable to create worktree for '%s' err:%w", wl.name, err)
 	}
 
-	if err = publishSymlink(wl.link, newPath); err != nil {
-		return fmt.Errorf("unable to publish symlink err:%w", err)
+	if err = wl.publishWorktree(newPath); err != nil {
+		return err
+	}
+	if err := wl.writeHashFile(remoteHash, ref, r.now()); err != nil {
+		return fmt.Errorf("unable to publish hash file err:%w", err)
+	}
+	recordWorktreeUpdate(r.gitURL.Repo, wl.link)
+	result.Updated = true
+	if currentHash != remoteHash {
+		r.history.recordLinkUpdate(LinkUpdate{Time: r.now(), Link: wl.link, OldHash: currentHash, NewHash: remoteHash})
+		r.auditLinkUpdate(ctx, wl, ref, currentHash, remoteHash)
+		r.queueEvent(Event{Type: EventWorktreePublished, Link: wl.link, OldHash: currentHash, NewHash: remoteHash})
 	}
 
 	// since we use hash to create worktree path it is possible that we
-	// may have re-created current worktree
-	if currentPath != "" && currentPath != newPath {
-		if err := r.removeWorktree(ctx, currentPath); err != nil {
-			wl.log.Error("unable to remove old worktree", "err", err)
+	// may have re-created current worktree. old worktree is retained for
+	// rollback if enabled, worktree of the same hash and settings which
+	// failed checks is removed once its not published on any link
+	retain := currentPath
+	if currentPath != "" && isWorktreePath(currentPath, wtPath) {
+		retain = ""
+		if currentPath != newPath && !r.publishedWorktree(currentPath) {
+			if err := r.removeWorktree(ctx, currentPath); err != nil {
+				wl.log.Error("unable to remove replaced worktree", "path", currentPath, "err", err)
+			}
 		}
 	}
+	r.retainWorktree(ctx, wl, retain, newPath)
+	r.setWorktreeStatus(wl, WorktreeStatusReady)
+	wl.setPinnedHash(remoteHash)
+	return nil
+}
+
+// checkPathspec verifies that pathspec of the worktree link matches at least
+// one file on the given commit, otherwise typo in the pathspec silently
+// results in empty worktree. it returns error only if link is in strict mode.
+func (r *Repository) checkPathspec(ctx context.Context, wl *WorkTreeLink, hash string) error {
+	// files of the commit never change so result of the last check is
+	// used until hash changes
+	if hash == wl.specHash {
+		return r.setEmptyPathspec(wl, wl.emptySpec, hash)
+	}
+
+	emptyTree, err := r.emptyTreeHash(ctx)
+	if err != nil {
+		return err
+	}
+	// ls-tree doesn't support glob pathspecs hence diff against empty tree
+	// git diff-tree -r --name-only <empty-tree> <hash> -- <pathspec>
+	files, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, r.dir, "diff-tree", "-r", "--name-only", emptyTree, hash, "--", wl.pathspec)
+	if err != nil {
+		return fmt.Errorf("unable to list files for pathspec err:%w", err)
+	}
+	wl.specHash = hash
+	return r.setEmptyPathspec(wl, files == "", hash)
+}
+
+// setEmptyPathspec records whether pathspec of the link matched any file of
+// the given revision, error is returned if link is in strict mode and
+// pathspec is empty
+func (r *Repository) setEmptyPathspec(wl *WorkTreeLink, empty bool, rev string) error {
+	if empty && !wl.emptySpec {
+		wl.log.Warn("pathspec did not match any files, worktree will be empty", "rev", rev, "pathspec", wl.pathspec)
+	}
+	wl.emptySpec = empty
+	recordWorktreeEmptyPathspec(r.gitURL.Repo, wl.link, empty)
+
+	if empty && wl.strictSpec {
+		return fmt.Errorf("pathspec did not match any files rev:%s pathspec:%s", rev, wl.pathspec)
+	}
 	return nil
 }
 
-// createWorktree will create new worktree using given hash
-// if worktree already exists on then it will be removed and re-created
+// emptyTreeHash returns hash of the empty tree in the object format of the
+// mirror, its resolved once. it must be called with write lock held.
+func (r *Repository) emptyTreeHash(ctx context.Context) (string, error) {
+	if r.emptyTree != "" {
+		return r.emptyTree, nil
+	}
+	// git hash-object -t tree /dev/null
+	hash, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "hash-object", "-t", "tree", os.DevNull)
+	if err != nil {
+		return "", fmt.Errorf("unable to get empty tree hash err:%w", err)
+	}
+	r.emptyTree = hash
+	return hash, nil
+}
+
+// sharedWorktree returns true if given worktree is published on any link of
+// the repository other than the given link
+func (r *Repository) sharedWorktree(wt string, wl *WorkTreeLink) bool {
+	for _, other := range r.workTreeLinks {
+		if other == wl {
+			continue
+		}
+		if current, err := other.currentWorktree(); err == nil && current == wt {
+			return true
+		}
+	}
+	return false
+}
+
+// reusableWorktree returns path of the worktree of the given path (see
+// isWorktreePath) which is already published on other link, checked out at
+// the given hash and passes sanity checks. since path is keyed by the
+// checkout settings, the content is same as the worktree the given link
+// would create.
+func (r *Repository) reusableWorktree(ctx context.Context, wl *WorkTreeLink, wtPath, hash string) (string, bool) {
+	for _, other := range r.workTreeLinks {
+		if other == wl {
+			continue
+		}
+		wt, err := other.currentWorktree()
+		if err != nil || !isWorktreePath(wt, wtPath) {
+			continue
+		}
+		if current, err := wl.workTreeHash(ctx, wt); err != nil || current != hash {
+			continue
+		}
+		if err := wl.checkWorktree(ctx, wt); err != nil {
+			wl.log.Warn("shared worktree failed sanity checks, not reusing", "path", wt, "err", err)
+			continue
+		}
+		return wt, true
+	}
+	return "", false
+}
+
+// publishedWorktree returns true if given worktree is published or retained
+// for rollback by any link of the repository
+func (r *Repository) publishedWorktree(wt string) bool {
+	for _, wl := range r.workTreeLinks {
+		if current, err := wl.currentWorktree(); err == nil && current == wt {
+			return true
+		}
+		if slices.Contains(wl.previous, wt) {
+			return true
+		}
+	}
+	return false
+}
+
+// setWorktreeStatus updates worktree link status and related metrics, time of
+// the last sync is updated if worktree is ready
+func (r *Repository) setWorktreeStatus(wl *WorkTreeLink, status WorktreeStatus) {
+	wl.status = status
+	if status == WorktreeStatusReady {
+		wl.lastSynced = r.now()
+		// ready worktree is either updated or upstream is back on the
+		// published hash, either way blocked update is no longer relevant
+		wl.blocked, wl.approved = "", ""
+	}
+	recordWorktreePending(r.gitURL.Repo, wl.link, status == WorktreeStatusPending)
+	recordWorktreeBlocked(r.gitURL.Repo, wl.link, wl.blocked != "")
+}
+
+// staleAfter returns time after which worktree links which haven't been
+// synced are considered stale, it's staleIntervals times the interval. with
+// schedule its the time since the last staleIntervals scheduled runs so that
+// gaps of the schedule (eg. nights) are taken into account.
+// it must be called with lock held.
+func (r *Repository) staleAfter() time.Duration {
+	if r.schedule != nil {
+		now := r.now()
+		if prev := r.schedule.prev(now, staleIntervals); !prev.IsZero() {
+			return now.Sub(prev)
+		}
+	}
+	return staleIntervals * r.interval
+}
+
+// recordWorktreeStates records health state of all the worktree links
+func (r *Repository) recordWorktreeStates() {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	now, staleAfter := r.now(), r.staleAfter()
+	for _, wl := range r.workTreeLinks {
+		recordWorktreeState(r.gitURL.Repo, wl.link, wl.state(now, staleAfter))
+	}
+}
+
+// createWorktree will create new worktree using given hash and returns its
+// path. if worktree already exists and is not published it will be removed
+// and re-created, published worktree (eg. which failed sanity checks) is
+// kept in place until links are switched and new worktree is created at
+// the fresh path with unique suffix instead.
 func (r *Repository) createWorktree(ctx context.Context, wl *WorkTreeLink, hash string) (string, error) {
 	// generate path for worktree to checkout files
 	wtPath := r.worktreePath(wl, hash)
 
+	if r.publishedWorktree(wtPath) {
+		wtPath += "." + strconv.FormatInt(r.now().UnixNano(), 36)
+	}
+
 	// remove any existing worktree as we cant create new worktree if path is
 	// not empty
 	if err := r.removeWorktree(ctx, wtPath); err != nil {
@@ -745,29 +2903,103 @@ func (r *Repository) createWorktree(ctx context.Context, wl *WorkTreeLink, hash
 	}
 
 	wl.log.Info("creating worktree", "path", wtPath, "hash", hash)
-	// git worktree add --force --detach --no-checkout <wt-path> <hash>
-	_, err := runGitCommand(ctx, wl.log, nil, r.dir, "worktree", "add", "--force", "--detach", "--no-checkout", wtPath, hash)
+	// git [-c <key>=<value>...] worktree add --force --detach --no-checkout <wt-path> <hash>
+	args := slices.Concat(r.gitConfig, []string{"worktree", "add", "--force", "--detach", "--no-checkout", wtPath, hash})
+	_, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, r.dir, args...)
 	if err != nil {
 		return wtPath, err
 	}
 
-	// only checkout required path if specified
-	args := []string{"checkout", hash}
-	if wl.pathspec != "" {
+	// lfs objects are fetched before checkout so that failed fetch doesn't
+	// publish worktree with pointer files
+	hasLFS := false
+	if r.lfs {
+		if hasLFS, err = r.lfsFetch(ctx, wl.log, hash, wl.pathspec); err != nil {
+			return "", err
+		}
+	}
+
+	args = slices.Concat(r.gitConfig, r.fileModeArgs(), []string{"checkout", hash})
+	if wl.sparse {
+		// only materialise pathspec dir on disk
+		// git [-c core.symlinks=true -c core.fileMode=true] sparse-checkout set --cone <pathspec>
+		sparseArgs := slices.Concat(r.gitConfig, r.fileModeArgs(), []string{"sparse-checkout", "set", "--cone", wl.pathspec})
+		if _, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, wtPath, sparseArgs...); err != nil {
+			return "", err
+		}
+	} else if wl.emptySpec {
+		// checkout errors on pathspec without any file, so publish
+		// empty worktree as warning is already logged
+		return wtPath, nil
+	} else if wl.pathspec != "" {
+		// only checkout required path if specified
 		args = append(args, "--", wl.pathspec)
 	}
-	// git checkout <hash> -- <pathspec>
-	if _, err := runGitCommand(ctx, wl.log, nil, wtPath, args...); err != nil {
+	// git [-c core.symlinks=true -c core.fileMode=true] checkout <hash> [-- <pathspec>]
+	if _, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, r.checkoutEnvs(), wtPath, args...); err != nil {
+		return "", err
+	}
+
+	// worktree is re-created on next mirror cycle as its not published
+	if err := r.verifyFileModes(ctx, wl, wtPath, hash); err != nil {
 		return "", err
 	}
 
+	if hasLFS {
+		if err := r.lfsCheckout(ctx, wl.log, wtPath, wl.pathspec); err != nil {
+			return "", err
+		}
+	}
+
+	if wl.submodules.enabled() {
+		if err := r.updateSubmodules(ctx, wl.log, wtPath, wl.pathspec, wl.submodules == SubmodulesRecursive); err != nil {
+			return "", fmt.Errorf("unable to update submodules err:%w", err)
+		}
+	}
+
+	if wl.exportIgn {
+		if err := wl.removeExportIgnored(ctx, wtPath, hash); err != nil {
+			return "", err
+		}
+	}
+
+	// permissions are applied before worktree is published
+	if err := applyPermissions(ctx, wl.log, wtPath, wl.perms); err != nil {
+		return "", fmt.Errorf("unable to apply permissions err:%w", err)
+	}
+
 	return wtPath, nil
 }
 
-// removeWorktree is used to remove a worktree and its folder if exits
+// updateSubmodules initialises and checks out submodules of the given checkout
+// dir. submodule remotes are fetched using repository's auth.
+func (r *Repository) updateSubmodules(ctx context.Context, log *slog.Logger, dir, pathspec string, recursive bool) error {
+	authEnvs, err := r.authEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	args := append(r.remoteArgs(), "submodule", "update", "--init")
+	if recursive {
+		args = append(args, "--recursive")
+	}
+	if pathspec != "" {
+		args = append(args, "--", pathspec)
+	}
+	ctx, cancel := r.withGitTimeout(ctx)
+	defer cancel()
+
+	// git [-c <key>=<value>...] submodule update --init [--recursive] [-- <pathspec>]
+	_, err = runGitCommand(ctx, log, r.gitOps, r.runner, slices.Concat(r.envs, authEnvs), dir, args...)
+	return err
+}
+
+// removeWorktree is used to remove a worktree and its folder if exits.
+// path is usually read from the published link, so its only removed if it
+// resolves inside the worktrees root
 func (r *Repository) removeWorktree(ctx context.Context, path string) error {
 	// Clean up worktree, if needed.
-	_, err := os.Stat(path)
+	_, err := os.Lstat(path)
 	switch {
 	case os.IsNotExist(err):
 		return nil
@@ -776,51 +3008,55 @@ func (r *Repository) removeWorktree(ctx context.Context, path string) error {
 	}
 
 	r.log.Info("removing worktree", "path", path)
-	if err := os.RemoveAll(path); err != nil {
+	if err := safeRemoveAll(r.worktreesRoot(), path); err != nil {
+		if errors.Is(err, errUnsafePath) {
+			r.log.Error("refusing to remove worktree outside of the worktrees root", "path", path, "err", err)
+		}
 		return fmt.Errorf("error removing directory: %w", err)
 	}
 	// git worktree prune -v
-	if _, err := runGitCommand(ctx, r.log, r.envs, r.dir, "worktree", "prune", "--verbose"); err != nil {
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "worktree", "prune", "--verbose"); err != nil {
 		return err
 	}
 	return nil
 }
 
-// cleanup removes old worktrees and runs git's garbage collection.
+// cleanup removes old worktrees and expires reflog. garbage collection is run
+// separately on its own schedule, see gcLoop.
 func (r *Repository) cleanup(ctx context.Context) error {
 	var cleanupErrs []error
 
+	// retention count might have been lowered since worktrees were retained,
+	// paused link keeps all its worktrees so that it can be rolled back further
+	for _, wl := range r.workTreeLinks {
+		if !wl.paused && len(wl.previous) > r.keepPrevious {
+			wl.previous = wl.previous[:r.keepPrevious]
+		}
+	}
+
 	// Clean up previous worktree(s).
 	if _, err := r.removeStaleWorktrees(); err != nil {
 		cleanupErrs = append(cleanupErrs, err)
 	}
+	for _, wl := range r.workTreeLinks {
+		if err := wl.removeStaleCopies(); err != nil {
+			cleanupErrs = append(cleanupErrs, err)
+		}
+	}
 
 	// Let git know we don't need those old commits any more.
-	// git worktree prune -v
-	if _, err := runGitCommand(ctx, r.log, r.envs, r.dir, "worktree", "prune", "--verbose"); err != nil {
+	if err := r.pruneWorktreeRegistrations(ctx); err != nil {
 		cleanupErrs = append(cleanupErrs, err)
 	}
 
-	// Expire old refs.
-	// git reflog expire --expire-unreachable=all --all
-	if _, err := runGitCommand(ctx, r.log, r.envs, r.dir, "reflog", "expire", "--expire-unreachable=all", "--all"); err != nil {
+	if err := r.cleanupKeepRefs(ctx); err != nil {
 		cleanupErrs = append(cleanupErrs, err)
 	}
 
-	// Run GC if needed.
-	if r.gitGC != gcOff {
-		args := []string{"gc"}
-		switch r.gitGC {
-		case gcAuto:
-			args = append(args, "--auto")
-		case gcAlways:
-			// no extra flags
-		case gcAggressive:
-			args = append(args, "--aggressive")
-		}
-		if _, err := runGitCommand(ctx, r.log, r.envs, r.dir, args...); err != nil {
-			cleanupErrs = append(cleanupErrs, err)
-		}
+	// Expire old refs.
+	// git reflog expire --expire-unreachable=all --all
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "reflog", "expire", "--expire-unreachable=all", "--all"); err != nil {
+		cleanupErrs = append(cleanupErrs, err)
 	}
 
 	if len(cleanupErrs) > 0 {
@@ -842,11 +3078,20 @@ func (r *Repository) removeStaleWorktrees() (int, error) {
 			_, wtDir := splitAbs(t)
 			currentWTDirs = append(currentWTDirs, wtDir)
 		}
+		// worktrees retained for rollback are kept
+		for _, p := range wt.previous {
+			_, wtDir := splitAbs(p)
+			currentWTDirs = append(currentWTDirs, wtDir)
+		}
 	}
 
 	count := 0
-	err := removeDirContentsIf(r.worktreesRoot(), r.log, func(fi os.FileInfo) (bool, error) {
+	err := removeDirContentsIf(r.dir, r.worktreesRoot(), r.log, func(fi os.FileInfo) (bool, error) {
 		// delete files that are over the stale time out, and make sure to never delete the current worktree
+		// or the layout version file
+		if fi.Name() == layoutVersionFile {
+			return false, nil
+		}
 		if !slices.Contains(currentWTDirs, fi.Name()) && time.Since(fi.ModTime()) > staleTimeout {
 			count++
 			r.log.Info("removing stale worktree", "worktree", fi.Name())
@@ -859,3 +3104,160 @@ func (r *Repository) removeStaleWorktrees() (int, error) {
 	}
 	return count, nil
 }
+
+// pruneWorktreeRegistrations removes git's registrations of the worktrees which
+// are not published on any link and whose dirs are either gone or older than
+// stale timeout. registrations of missing dirs left locked by interrupted
+// 'worktree add' are unlocked once lock is older than stale timeout so that
+// they can be pruned.
+func (r *Repository) pruneWorktreeRegistrations(ctx context.Context) error {
+	// git worktree list --porcelain
+	out, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "worktree", "list", "--porcelain")
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool)
+	for _, wl := range r.workTreeLinks {
+		if wt, err := wl.currentWorktree(); err == nil && wt != "" {
+			current[wt] = true
+		}
+		for _, wt := range wl.previous {
+			current[wt] = true
+		}
+	}
+	lockFiles := r.worktreeLockFiles()
+
+	var errs []error
+	for _, wt := range parseWorktreeList(out) {
+		if wt.bare || current[wt.path] {
+			continue
+		}
+		info, err := os.Stat(wt.path)
+		switch {
+		case err == nil:
+			// unpublished worktree is kept until stale timeout for existing readers
+			if time.Since(info.ModTime()) <= staleTimeout {
+				continue
+			}
+			r.log.Info("removing unpublished worktree", "path", wt.path)
+			// double force also removes locked worktree
+			// git worktree remove --force --force <path>
+			if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "worktree", "remove", "--force", "--force", wt.path); err != nil {
+				errs = append(errs, err)
+			}
+		case os.IsNotExist(err):
+			// unlocked registrations are removed by prune
+			if !wt.locked {
+				continue
+			}
+			if li, err := os.Stat(lockFiles[wt.path]); err == nil && time.Since(li.ModTime()) <= staleTimeout {
+				continue
+			}
+			r.log.Info("unlocking registration of missing worktree", "path", wt.path)
+			// git worktree unlock <path>
+			if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "worktree", "unlock", wt.path); err != nil {
+				errs = append(errs, err)
+			}
+		default:
+			errs = append(errs, err)
+		}
+	}
+
+	// git worktree prune -v
+	if _, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, "worktree", "prune", "--verbose"); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// worktreeLockFiles returns path of the lock file in git's admin dir keyed by
+// the path of the registered worktree
+func (r *Repository) worktreeLockFiles() map[string]string {
+	lockFiles := make(map[string]string)
+	adminRoot := filepath.Join(r.dir, "worktrees")
+	entries, err := os.ReadDir(adminRoot)
+	if err != nil {
+		return lockFiles
+	}
+	for _, e := range entries {
+		// 'gitdir' contains path of the '.git' file of the worktree
+		gitdir, err := os.ReadFile(filepath.Join(adminRoot, e.Name(), "gitdir"))
+		if err != nil {
+			continue
+		}
+		wt := filepath.Dir(strings.TrimSpace(string(gitdir)))
+		lockFiles[wt] = filepath.Join(adminRoot, e.Name(), "locked")
+	}
+	return lockFiles
+}
+
+// unpublishWorktreeLink removes published link of the worktree along with its
+// hash file and copies. link is only removed if it points to the worktree of
+// this repository. worktree dir is not removed.
+// it must be called with write lock held
+func (r *Repository) unpublishWorktreeLink(wl *WorkTreeLink) error {
+	wt, err := wl.currentWorktree()
+	if err != nil {
+		return fmt.Errorf("unable to read worktree link:%s err:%w", wl.link, err)
+	}
+	if wt != "" && strings.HasPrefix(wt, r.worktreesRoot()+"/") {
+		if err := os.Remove(wl.link); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove worktree link:%s err:%w", wl.link, err)
+		}
+		if err := wl.removeHashFile(); err != nil {
+			return fmt.Errorf("unable to remove hash file of link:%s err:%w", wl.link, err)
+		}
+		if err := wl.removeCopies(); err != nil {
+			return fmt.Errorf("unable to remove worktree copies of link:%s err:%w", wl.link, err)
+		}
+		if err := removeEmptyParents(r.root, wl.link); err != nil {
+			return err
+		}
+	}
+	deleteWorktreeMetrics(r.gitURL.Repo, wl.link)
+	return nil
+}
+
+// remove removes all published worktree links of the repository, links are
+// only removed if they point to the worktree of this repository.
+// if deleteRepoDir is true mirrored repository dir is deleted along with all
+// its worktrees. mirror loop must be stopped before calling remove.
+func (r *Repository) remove(deleteRepoDir bool) error {
+	defer r.emitPendingEvents()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var errs []error
+
+	for _, wl := range r.workTreeLinks {
+		r.queueLinkRemoved(wl)
+		if err := r.unpublishWorktreeLink(wl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := r.removeReplicas(deleteRepoDir); err != nil {
+		errs = append(errs, err)
+	}
+
+	if !deleteRepoDir {
+		return errors.Join(errs...)
+	}
+
+	// repo dir is always created directly under the root with .git suffix
+	// make sure we never delete anything else
+	if filepath.Dir(r.dir) != filepath.Clean(r.root) || !strings.HasSuffix(r.dir, ".git") {
+		errs = append(errs, fmt.Errorf("refusing to delete repository dir outside of the root dir:%s root:%s", r.dir, r.root))
+		return errors.Join(errs...)
+	}
+
+	r.log.Info("removing repository dir", "path", r.dir)
+	r.hashCache.reset()
+	if err := safeRemoveAll(r.root, r.dir); err != nil {
+		errs = append(errs, fmt.Errorf("unable to remove repository dir:%s err:%w", r.dir, err))
+	}
+
+	return errors.Join(errs...)
+}
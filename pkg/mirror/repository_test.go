@@ -1,6 +1,7 @@
 package mirror
 
 import (
+	"context"
 	"log/slog"
 	"testing"
 	"time"
@@ -17,6 +18,7 @@ func TestNewRepo(t *testing.T) {
 		interval  time.Duration
 		auth      Auth
 		gc        string
+		refSpecs  []string
 	}
 	tests := []struct {
 		name    string
@@ -36,12 +38,24 @@ func TestNewRepo(t *testing.T) {
 			&Repository{
 				gitURL:        &giturl.URL{Scheme: "scp", User: "user", Host: "host.xz", Path: "path/to", Repo: "repo.git"},
 				remote:        "user@host.xz:path/to/repo.git",
+				remoteURL:     "user@host.xz:path/to/repo.git",
 				root:          "/tmp",
 				dir:           "/tmp/repo.git",
 				gitGC:         "always",
+				gcInterval:    defaultGCInterval,
 				interval:      10 * time.Second,
 				auth:          &Auth{SSHKeyPath: "/path/to/key", SSHKnownHostsPath: "path/to/host"},
+				refSpecs:      []string{"+refs/*:refs/*"},
+				prune:         true,
+				fileModes:     true,
+				reinitLimit:   defaultReinitThreshold,
+				maxFSBytes:    defaultMaxCloneFSBytes,
+				fetchRetries:  defaultFetchRetries,
+				jitter:        defaultJitter,
 				workTreeLinks: map[string]*WorkTreeLink{},
+				maxAutoLinks:  defaultMaxAutoWorktrees,
+				keepPrevious:  defaultKeepPrevious,
+				runner:        execGitRunner{},
 			},
 			false,
 		},
@@ -85,6 +99,28 @@ func TestNewRepo(t *testing.T) {
 			},
 			nil,
 			true,
+		}, {
+			"test-wrong-refspec",
+			args{
+				remoteURL: "user@host.xz:path/to/repo.git",
+				root:      "/tmp",
+				interval:  10 * time.Second,
+				gc:        "always",
+				refSpecs:  []string{"refs/heads/*"},
+			},
+			nil,
+			true,
+		}, {
+			"test-https-auth-with-ssh-remote",
+			args{
+				remoteURL: "user@host.xz:path/to/repo.git",
+				root:      "/tmp",
+				interval:  10 * time.Second,
+				gc:        "always",
+				auth:      Auth{Username: "user", PasswordFilePath: "/path/to/token"},
+			},
+			nil,
+			true,
 		}, {
 			"test-wrong-gc",
 			args{
@@ -105,13 +141,14 @@ func TestNewRepo(t *testing.T) {
 				Interval: tt.args.interval,
 				GitGC:    tt.args.gc,
 				Auth:     tt.args.auth,
+				RefSpecs: tt.args.refSpecs,
 			}
 			got, err := NewRepository(rc, nil, slog.Default())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewRepository() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreFields(Repository{}, "log", "lock", "stop", "stopped"), cmp.AllowUnexported(Repository{}, giturl.URL{})); diff != "" {
+			if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreFields(Repository{}, "log", "lock", "stop", "stopped", "reload", "trigger", "history", "subsLock", "eventsLock", "cloneLock", "pauseLock", "ready", "critical", "remoteConf", "remoteQuery", "now", "creds", "loopLock", "loopState", "labelAttrs", "tracer"), cmp.AllowUnexported(Repository{}, giturl.URL{}, execGitRunner{})); diff != "" {
 				t.Errorf("NewRepository() mismatch (-want +got):\n%s", diff)
 			}
 		})
@@ -122,11 +159,14 @@ func TestRepo_AddWorktreeLink(t *testing.T) {
 	r := &Repository{
 		gitURL:        &giturl.URL{Scheme: "scp", User: "user", Host: "host.xz", Path: "path/to", Repo: "repo.git"},
 		root:          "/tmp/root",
+		dir:           "/tmp/root/repo.git",
 		interval:      10 * time.Second,
 		auth:          nil,
 		log:           slog.Default(),
 		gitGC:         "always",
+		refSpecs:      []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"},
 		workTreeLinks: make(map[string]*WorkTreeLink),
+		outsideLinks:  true,
 		stop:          make(chan bool),
 		stopped:       make(chan bool),
 	}
@@ -147,6 +187,7 @@ func TestRepo_AddWorktreeLink(t *testing.T) {
 		{"no-link", args{"", "master", ""}, true},
 		{"no-ref", args{"link3", "", ""}, false},
 		{"absLink", args{"/tmp/link", "tag", ""}, false},
+		{"ref-outside-refspecs", args{"link4", "refs/pull/1/head", ""}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -156,13 +197,15 @@ func TestRepo_AddWorktreeLink(t *testing.T) {
 		})
 	}
 	// compare all worktree links
+	wtRoot := "/tmp/root/repo.git/.worktrees"
+	perms := wtPermissions{uid: -1, gid: -1}
 	want := map[string]*WorkTreeLink{
-		"link":      {name: "link", link: "/tmp/root/link", ref: "master"},
-		"link2":     {name: "link2", link: "/tmp/root/link2", ref: "other-branch", pathspec: "path"},
-		"link3":     {name: "link3", link: "/tmp/root/link3", ref: "HEAD"},
-		"/tmp/link": {name: "link", link: "/tmp/link", ref: "tag"},
+		"link":      {name: "link", link: "/tmp/root/link", ref: "master", wtRoot: wtRoot, perms: perms, status: WorktreeStatusUnknown},
+		"link2":     {name: "link2", link: "/tmp/root/link2", ref: "other-branch", pathspec: "path", wtRoot: wtRoot, perms: perms, status: WorktreeStatusUnknown},
+		"link3":     {name: "link3", link: "/tmp/root/link3", ref: "HEAD", wtRoot: wtRoot, perms: perms, status: WorktreeStatusUnknown},
+		"/tmp/link": {name: "link", link: "/tmp/link", ref: "tag", wtRoot: wtRoot, perms: perms, status: WorktreeStatusUnknown},
 	}
-	if diff := cmp.Diff(want, r.workTreeLinks, cmpopts.IgnoreFields(WorkTreeLink{}, "log"), cmp.AllowUnexported(WorkTreeLink{})); diff != "" {
+	if diff := cmp.Diff(want, r.workTreeLinks, cmpopts.IgnoreFields(WorkTreeLink{}, "log", "repoLock"), cmp.AllowUnexported(WorkTreeLink{}, wtPermissions{})); diff != "" {
 		t.Errorf("Repo.AddWorktreeLink() worktreelinks mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -217,13 +260,403 @@ two/readme
 				{Hash: "80e11d114dd3aa135c18573402a8e688599c69e0", ChangedFiles: []string{"one/readme", "one/hello.tf", "two/readme"}},
 			},
 		},
+		{
+			"with_meta",
+			"267fc66a734de9e4de57d9d20c83566a69cd703c\x00John Doe\x00john@example.com\x002024-01-02T03:04:05+01:00\n" +
+				"one/hello.tf\n" +
+				"\n" +
+				"72ea9c9de6963e97ac472d9ea996e384c6923cca\x00Jane\x00jane@example.com\x002024-01-01T00:00:00Z\n",
+			[]CommitInfo{
+				{
+					Hash: "267fc66a734de9e4de57d9d20c83566a69cd703c", ChangedFiles: []string{"one/hello.tf"},
+					Author: "John Doe", AuthorEmail: "john@example.com", Date: time.Date(2024, 1, 2, 2, 4, 5, 0, time.UTC),
+				},
+				{
+					Hash:   "72ea9c9de6963e97ac472d9ea996e384c6923cca",
+					Author: "Jane", AuthorEmail: "jane@example.com", Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			"with_meta_truncated",
+			"267fc66a734de9e4de57d9d20c83566a69cd703c\x00John Doe\x00john@example.com\x002024-01-02T03:04:05Z\n" +
+				"one/hello.tf\n" +
+				"\n" +
+				"72ea9c9de6963e97ac472d9ea996e384c6923cca\x00Jane\x00jane@exa",
+			[]CommitInfo{
+				{
+					Hash: "267fc66a734de9e4de57d9d20c83566a69cd703c", ChangedFiles: []string{"one/hello.tf"},
+					Author: "John Doe", AuthorEmail: "john@example.com", Date: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				},
+			},
+		},
+		{
+			"with_meta_truncated_date",
+			"267fc66a734de9e4de57d9d20c83566a69cd703c\x00John Doe\x00john@example.com\x002024-01-0",
+			[]CommitInfo{},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := ParseCommitWithChangedFilesList(tt.output)
-			if diff := cmp.Diff(tt.want, got); diff != "" {
+			if diff := cmp.Diff(tt.want, got, cmpopts.EquateApproxTime(0)); diff != "" {
 				t.Errorf("ParseCommitWithChangedFilesList() output mismatch (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
+
+func TestListCommitsOptions_gitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ListCommitsOptions
+		want    []string
+		wantErr bool
+	}{
+		{"default", ListCommitsOptions{}, []string{"log", "--name-only", "--pretty=format:%H"}, false},
+		{
+			"all",
+			ListCommitsOptions{
+				MaxCount: 10, Skip: 20, WithMeta: true,
+				Since: time.Date(2024, 1, 2, 4, 4, 5, 0, time.FixedZone("", 3600)),
+				Until: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+			[]string{"log", "--name-only", "--pretty=format:" + commitMetaFormat, "--max-count=10", "--skip=20", "--since=2024-01-02T03:04:05Z", "--until=2024-02-01T00:00:00Z"},
+			false,
+		},
+		{"negative_max_count", ListCommitsOptions{MaxCount: -1}, nil, true},
+		{"negative_skip", ListCommitsOptions{Skip: -1}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.gitArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("gitArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("gitArgs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRepo_waitInterval(t *testing.T) {
+	r, err := NewRepository(RepositoryConfig{
+		Remote:            "user@host.xz:path/to/repo.git",
+		Root:              "/tmp",
+		Interval:          time.Second,
+		MaxFailureBackoff: 300 * time.Millisecond,
+		GitGC:             "always",
+	}, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// use short interval to keep test fast
+	r.interval = 100 * time.Millisecond
+
+	// jitter adds up to 20% of the wait
+	for failures, want := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		300 * time.Millisecond,
+		300 * time.Millisecond,
+	} {
+		r.failures = failures
+		start := time.Now()
+		if !r.waitInterval(context.Background()) {
+			t.Fatalf("waitInterval() returned false")
+		}
+		if got := time.Since(start); got < want || got > want+want/5+50*time.Millisecond {
+			t.Errorf("waitInterval() with %d failures got:%s want:%s", failures, got, want)
+		}
+	}
+
+	// queued run should bypass the backoff
+	r.maxBackoff = time.Hour
+	r.failures = 10
+	r.QueueMirrorRun()
+	r.QueueMirrorRun()
+	start := time.Now()
+	if !r.waitInterval(context.Background()) {
+		t.Fatalf("waitInterval() returned false")
+	}
+	if got := time.Since(start); got > 50*time.Millisecond {
+		t.Errorf("waitInterval() with queued run got:%s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r.waitInterval(ctx) {
+		t.Errorf("waitInterval() expected false on cancelled context")
+	}
+}
+
+func TestRepo_jitter(t *testing.T) {
+	r, err := NewRepository(RepositoryConfig{
+		Remote:   "user@host.xz:path/to/repo.git",
+		Root:     "/tmp",
+		Interval: time.Minute,
+		GitGC:    "always",
+	}, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		jitter float64
+		max    time.Duration
+	}{
+		{0, time.Minute},
+		{0.5, 90 * time.Second},
+	} {
+		r.setJitter(tt.jitter)
+		for range 100 {
+			if got := r.nextWait(); got < time.Minute || got > tt.max {
+				t.Fatalf("nextWait() with jitter %g got:%s want between:%s and %s", tt.jitter, got, time.Minute, tt.max)
+			}
+		}
+	}
+}
+
+func TestRepo_waitDelay(t *testing.T) {
+	r, err := NewRepository(RepositoryConfig{
+		Remote:   "user@host.xz:path/to/repo.git",
+		Root:     "/tmp",
+		Interval: time.Second,
+		GitGC:    "always",
+	}, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	if !r.waitDelay(context.Background(), 100*time.Millisecond) {
+		t.Fatalf("waitDelay() returned false")
+	}
+	if got := time.Since(start); got < 100*time.Millisecond || got > 150*time.Millisecond {
+		t.Errorf("waitDelay() got:%s want:%s", got, 100*time.Millisecond)
+	}
+	if got := r.nextRun.Sub(start); got < 100*time.Millisecond || got > 150*time.Millisecond {
+		t.Errorf("next run should be set to the end of delay got:%s", got)
+	}
+
+	// queued run should skip the delay
+	r.QueueMirrorRun()
+	start = time.Now()
+	if !r.waitDelay(context.Background(), time.Hour) {
+		t.Fatalf("waitDelay() returned false")
+	}
+	if got := time.Since(start); got > 50*time.Millisecond {
+		t.Errorf("waitDelay() with queued run got:%s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r.waitDelay(ctx, time.Hour) {
+		t.Errorf("waitDelay() expected false on cancelled context")
+	}
+}
+
+func TestRepo_fetchArgs(t *testing.T) {
+	disabled, enabled := false, true
+	tests := []struct {
+		name         string
+		prune        *bool
+		pruneTags    bool
+		depth        int
+		singleBranch string
+		want         []string
+	}{
+		{"default", nil, false, 0, "", []string{"fetch", "origin", "--no-progress", "--porcelain", "--no-auto-gc", "--prune"}},
+		{"prune", &enabled, false, 0, "", []string{"fetch", "origin", "--no-progress", "--porcelain", "--no-auto-gc", "--prune"}},
+		{"prune_tags", nil, true, 0, "", []string{"fetch", "origin", "--no-progress", "--porcelain", "--no-auto-gc", "--prune", "--prune-tags"}},
+		{"no_prune", &disabled, false, 0, "", []string{"fetch", "origin", "--no-progress", "--porcelain", "--no-auto-gc"}},
+		{"no_prune_depth", &disabled, false, 1, "", []string{"fetch", "origin", "--no-progress", "--porcelain", "--no-auto-gc", "--depth=1"}},
+		{"single_branch", nil, true, 0, "main", []string{"fetch", "origin", "--no-progress", "--porcelain", "--no-auto-gc", "--no-tags", "--prune"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRepository(RepositoryConfig{
+				Remote:       "user@host.xz:path/to/repo.git",
+				Root:         "/tmp",
+				Interval:     time.Second,
+				GitGC:        "always",
+				Depth:        tt.depth,
+				Prune:        tt.prune,
+				PruneTags:    tt.pruneTags,
+				SingleBranch: tt.singleBranch,
+			}, nil, slog.Default())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, r.fetchArgs()); diff != "" {
+				t.Errorf("fetchArgs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := NewRepository(RepositoryConfig{
+		Remote:    "user@host.xz:path/to/repo.git",
+		Root:      "/tmp",
+		Interval:  time.Second,
+		GitGC:     "always",
+		Prune:     &disabled,
+		PruneTags: true,
+	}, nil, slog.Default()); err == nil {
+		t.Errorf("NewRepository() expected error for prune_tags without prune")
+	}
+}
+
+func TestRepo_UpdateConfig(t *testing.T) {
+	rc := RepositoryConfig{
+		Remote:   "user@host.xz:path/to/repo.git",
+		Root:     "/tmp",
+		Interval: 10 * time.Second,
+		GitGC:    "always",
+	}
+	r, err := NewRepository(rc, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		update  func(rc *RepositoryConfig)
+		wantErr error
+	}{
+		{"same", func(rc *RepositoryConfig) {}, nil},
+		{"interval", func(rc *RepositoryConfig) { rc.Interval = time.Minute }, nil},
+		{"schedule", func(rc *RepositoryConfig) { rc.Interval = 0; rc.Schedule = "@hourly" }, nil},
+		{"gc-and-auth", func(rc *RepositoryConfig) { rc.GitGC = "off"; rc.Auth = Auth{SSHKeyPath: "/path/to/key"} }, nil},
+		{"fetch-window", func(rc *RepositoryConfig) { rc.FetchWindow = FetchWindow{Start: "01:00", End: "02:00"} }, nil},
+		{"remote-scheme", func(rc *RepositoryConfig) { rc.Remote = "ssh://user@host.xz/path/to/repo.git" }, ErrRecreateRequired},
+		{"root", func(rc *RepositoryConfig) { rc.Root = "/tmp/other" }, ErrRecreateRequired},
+		{"depth", func(rc *RepositoryConfig) { rc.Depth = 1 }, ErrRecreateRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newRC := rc
+			tt.update(&newRC)
+			if err := r.UpdateConfig(txtCtx, newRC); err != tt.wantErr {
+				t.Fatalf("Repo.UpdateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if r.interval != newRC.Interval || r.schedule.String() != newRC.Schedule || r.gitGC != gcMode(newRC.GitGC) || !cmp.Equal(*r.auth, newRC.Auth) || r.fetchWindow != newRC.FetchWindow {
+				t.Errorf("Repo.UpdateConfig() config not applied interval:%s gc:%s auth:%v fetch-window:%v", r.interval, r.gitGC, r.auth, r.fetchWindow)
+			}
+		})
+	}
+
+	for _, update := range []func(rc *RepositoryConfig){
+		func(rc *RepositoryConfig) { rc.Interval = time.Millisecond },
+		func(rc *RepositoryConfig) { rc.Schedule = "@hourly" },
+		func(rc *RepositoryConfig) { rc.GitGC = "blah" },
+		func(rc *RepositoryConfig) { rc.MaxDiskUsageBytes = -1 },
+		func(rc *RepositoryConfig) { rc.MaxCloneFSBytes = -1 },
+		func(rc *RepositoryConfig) { rc.Auth = Auth{Username: "user", PasswordFilePath: "/path/to/token"} },
+	} {
+		newRC := rc
+		update(&newRC)
+		if err := r.UpdateConfig(txtCtx, newRC); err == nil {
+			t.Errorf("Repo.UpdateConfig() expected error for config %+v", newRC)
+		}
+	}
+}
+
+func TestWorkTreeLink_State(t *testing.T) {
+	r, err := NewRepository(RepositoryConfig{
+		Remote:    "user@host.xz:path/to/repo.git",
+		Root:      "/tmp",
+		Interval:  time.Minute,
+		GitGC:     "always",
+		Worktrees: []WorktreeConfig{{Link: "link", Ref: "feature"}},
+	}, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wl := r.workTreeLinks["link"]
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := t0
+	r.now = func() time.Time { return now }
+
+	staleAfter := r.staleAfter()
+	if staleAfter != 3*time.Minute {
+		t.Fatalf("unexpected stale after got:%s", staleAfter)
+	}
+
+	// each step simulates mirror cycle at the given time with the
+	// resulting worktree status
+	steps := []struct {
+		name   string
+		at     time.Duration
+		status WorktreeStatus
+		want   LinkState
+	}{
+		{"before_first_cycle", 0, WorktreeStatusUnknown, LinkStateNeverSynced},
+		{"ref_missing", time.Minute, WorktreeStatusRefMissing, LinkStateNeverSynced},
+		{"checkout_failed", 2 * time.Minute, WorktreeStatusFailed, LinkStateNeverSynced},
+		{"published", 3 * time.Minute, WorktreeStatusReady, LinkStateHealthy},
+		{"up_to_date", 4 * time.Minute, WorktreeStatusReady, LinkStateHealthy},
+		{"failed_within_threshold", 7 * time.Minute, WorktreeStatusFailed, LinkStateHealthy},
+		{"failed_over_threshold", 7*time.Minute + time.Second, WorktreeStatusFailed, LinkStateStale},
+		{"ref_deleted", 10 * time.Minute, WorktreeStatusRefMissing, LinkStateStale},
+		{"recovered", 11 * time.Minute, WorktreeStatusReady, LinkStateHealthy},
+		{"pending", 12 * time.Minute, WorktreeStatusPending, LinkStateHealthy},
+		{"pending_over_threshold", 15 * time.Minute, WorktreeStatusPending, LinkStateStale},
+	}
+	for _, s := range steps {
+		now = t0.Add(s.at)
+		if s.status != WorktreeStatusUnknown {
+			r.setWorktreeStatus(wl, s.status)
+		}
+		if got := wl.State(now, staleAfter); got != s.want {
+			t.Errorf("%s: State() got:%s want:%s", s.name, got, s.want)
+		}
+	}
+	if want := t0.Add(11 * time.Minute); !wl.lastSynced.Equal(want) {
+		t.Errorf("unexpected last synced got:%s want:%s", wl.lastSynced, want)
+	}
+}
+
+func TestRepo_staleAfter(t *testing.T) {
+	// wednesday
+	now := time.Date(2024, 1, 3, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		schedule string
+		now      time.Time
+		want     time.Duration
+	}{
+		{"interval", 30 * time.Second, "", now, 90 * time.Second},
+		{"hourly_schedule", 0, "0 * * * *", now, 2*time.Hour + 30*time.Minute},
+		{"daily_schedule", 0, "30 2 * * *", now, 56 * time.Hour},
+		{"working_hours", 0, "*/15 9-17 * * 1-5", now, 45 * time.Minute},
+		// last runs were on the previous evening
+		{"working_hours_before_start", 0, "*/15 9-17 * * 1-5", now.Add(-150 * time.Minute), 14*time.Hour + 45*time.Minute},
+		// last runs were on friday
+		{"working_hours_monday", 0, "*/15 9-17 * * 1-5", now.Add(-2*24*time.Hour - 150*time.Minute), 2*24*time.Hour + 14*time.Hour + 45*time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRepository(RepositoryConfig{
+				Remote:   "user@host.xz:path/to/repo.git",
+				Root:     "/tmp",
+				Interval: tt.interval,
+				Schedule: tt.schedule,
+				GitGC:    "always",
+			}, nil, slog.Default())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			r.now = func() time.Time { return tt.now }
+			if got := r.staleAfter(); got != tt.want {
+				t.Errorf("staleAfter() got:%s want:%s", got, tt.want)
+			}
+		})
+	}
+}
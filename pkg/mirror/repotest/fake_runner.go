@@ -0,0 +1,213 @@
+// Package repotest provides fakes for testing code which uses the mirror
+// package without running git.
+//
+// FakeRunner implements mirror.GitRunner, it returns scripted results of the
+// expected git commands and records all the invocations so tests can assert
+// argv of the commands run by the repository.
+//
+// Example:
+//
+//	runner := repotest.NewFakeRunner()
+//	runner.Expect("rev-parse", "--verify", "main^{commit}").Return("<hash>")
+//	runner.ExpectPrefix("fetch").ReturnError(errors.New("network down")).Times(1)
+//
+//	repo, err := mirror.NewRepositoryWithRunner(conf, nil, runner, nil)
+//	...
+//	runner.AssertExpectations(t)
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ErrUnexpectedCall is returned by FakeRunner if command doesn't match any
+// of the expectations and there is no fallback runner
+var ErrUnexpectedCall = errors.New("unexpected git command")
+
+// Runner runs git commands, its same as mirror.GitRunner
+type Runner interface {
+	Run(ctx context.Context, envs []string, dir string, args ...string) (string, error)
+}
+
+// Call is the recorded invocation of the git command
+type Call struct {
+	Envs []string
+	Dir  string
+	Args []string
+}
+
+// String returns the command line of the call
+func (c Call) String() string {
+	return "git " + strings.Join(c.Args, " ")
+}
+
+// Expectation is the scripted result of the matching git commands, it must
+// be configured before runner is used
+type Expectation struct {
+	args   []string
+	prefix bool
+	stdout string
+	err    error
+	times  int // max number of matched calls, 0 means unlimited
+	calls  int // number of matched calls
+}
+
+// Return sets trimmed stdout returned by the matching commands
+func (e *Expectation) Return(stdout string) *Expectation {
+	e.stdout = stdout
+	return e
+}
+
+// ReturnError sets error returned by the matching commands, use
+// *mirror.GitError to simulate git failures classified by the repository
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times limits number of calls matched by the expectation, calls over the
+// limit are matched against next expectations. AssertExpectations fails if
+// expectation wasn't called exactly n times.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) String() string {
+	if e.prefix {
+		return "git " + strings.Join(e.args, " ") + " ..."
+	}
+	return "git " + strings.Join(e.args, " ")
+}
+
+func (e *Expectation) matches(args []string) bool {
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+	if e.prefix {
+		return len(args) >= len(e.args) && slices.Equal(args[:len(e.args)], e.args)
+	}
+	return slices.Equal(args, e.args)
+}
+
+// FakeRunner is the git runner which returns results of the expectations
+// matching the command args, expectations are matched in the order they
+// were added. A FakeRunner is safe for concurrent use.
+type FakeRunner struct {
+	// Fallback runs the commands which don't match any expectation, eg.
+	// to record commands run by the real git. if nil such commands fail
+	// with ErrUnexpectedCall.
+	Fallback Runner
+
+	lock       sync.Mutex
+	exps       []*Expectation
+	calls      []Call
+	unexpected []Call
+}
+
+// NewFakeRunner returns runner without any expectations
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{}
+}
+
+// Expect adds expectation of the command with exactly given args
+func (f *FakeRunner) Expect(args ...string) *Expectation {
+	return f.expect(args, false)
+}
+
+// ExpectPrefix adds expectation of the commands whose args start with given
+// args
+func (f *FakeRunner) ExpectPrefix(args ...string) *Expectation {
+	return f.expect(args, true)
+}
+
+func (f *FakeRunner) expect(args []string, prefix bool) *Expectation {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	e := &Expectation{args: slices.Clone(args), prefix: prefix}
+	f.exps = append(f.exps, e)
+	return e
+}
+
+// Run records the call and returns result of the first matching expectation
+func (f *FakeRunner) Run(ctx context.Context, envs []string, dir string, args ...string) (string, error) {
+	call := Call{Envs: slices.Clone(envs), Dir: dir, Args: slices.Clone(args)}
+
+	f.lock.Lock()
+	f.calls = append(f.calls, call)
+	for _, e := range f.exps {
+		if e.matches(args) {
+			e.calls++
+			f.lock.Unlock()
+			if e.err != nil {
+				return "", e.err
+			}
+			return e.stdout, nil
+		}
+	}
+	fallback := f.Fallback
+	if fallback == nil {
+		f.unexpected = append(f.unexpected, call)
+	}
+	f.lock.Unlock()
+
+	if fallback == nil {
+		return "", fmt.Errorf("%w: %s", ErrUnexpectedCall, call)
+	}
+	return fallback.Run(ctx, envs, dir, args...)
+}
+
+// Calls returns all the recorded calls in the order they were run
+func (f *FakeRunner) Calls() []Call {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// CallsWithPrefix returns recorded calls whose args start with given args
+func (f *FakeRunner) CallsWithPrefix(args ...string) []Call {
+	var calls []Call
+	for _, c := range f.Calls() {
+		if len(c.Args) >= len(args) && slices.Equal(c.Args[:len(args)], args) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset clears recorded calls and call counts of the expectations,
+// expectations are kept
+func (f *FakeRunner) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls, f.unexpected = nil, nil
+	for _, e := range f.exps {
+		e.calls = 0
+	}
+}
+
+// AssertExpectations reports test error for each expectation which wasn't
+// called (or not called exactly n times if Times was set) and for each
+// unexpected call
+func (f *FakeRunner) AssertExpectations(t testing.TB) {
+	t.Helper()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, e := range f.exps {
+		switch {
+		case e.times > 0 && e.calls != e.times:
+			t.Errorf("expected '%s' to be called %d times got:%d", e, e.times, e.calls)
+		case e.calls == 0:
+			t.Errorf("expected '%s' to be called", e)
+		}
+	}
+	for _, c := range f.unexpected {
+		t.Errorf("unexpected call '%s' dir:%s", c, c.Dir)
+	}
+}
@@ -0,0 +1,57 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type echoRunner struct{}
+
+func (echoRunner) Run(ctx context.Context, envs []string, dir string, args ...string) (string, error) {
+	return "fallback", nil
+}
+
+func TestFakeRunner(t *testing.T) {
+	ctx := context.Background()
+	errFetch := errors.New("fetch failed")
+
+	f := NewFakeRunner()
+	f.Expect("rev-parse", "HEAD").Return("abc")
+	f.ExpectPrefix("fetch").ReturnError(errFetch).Times(1)
+	f.ExpectPrefix("fetch").Return("ok")
+
+	if got, err := f.Run(ctx, nil, "/dir", "rev-parse", "HEAD"); err != nil || got != "abc" {
+		t.Errorf("Run() = %q, %v", got, err)
+	}
+	if _, err := f.Run(ctx, nil, "/dir", "fetch", "origin"); !errors.Is(err, errFetch) {
+		t.Errorf("Run() error = %v, want %v", err, errFetch)
+	}
+	if got, err := f.Run(ctx, nil, "/dir", "fetch", "origin"); err != nil || got != "ok" {
+		t.Errorf("Run() = %q, %v", got, err)
+	}
+	if got := len(f.CallsWithPrefix("fetch")); got != 2 {
+		t.Errorf("expected 2 fetch calls got:%d", got)
+	}
+	f.AssertExpectations(t)
+
+	// exact expectation doesn't match longer args
+	if _, err := f.Run(ctx, nil, "/dir", "rev-parse", "HEAD", "--verify"); !errors.Is(err, ErrUnexpectedCall) {
+		t.Errorf("Run() error = %v, want %v", err, ErrUnexpectedCall)
+	}
+	mt := &testing.T{}
+	f.AssertExpectations(mt)
+	if !mt.Failed() {
+		t.Errorf("expected unexpected call to fail assertion")
+	}
+
+	f.Reset()
+	if got := len(f.Calls()); got != 0 {
+		t.Errorf("expected no calls after reset got:%d", got)
+	}
+
+	f.Fallback = echoRunner{}
+	if got, err := f.Run(ctx, nil, "/dir", "gc"); err != nil || got != "fallback" {
+		t.Errorf("Run() = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,68 @@
+package mirror
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// defaultFetchRetries is the number of retries of the transient remote
+// failures within single mirror cycle if its not configured
+const defaultFetchRetries = 2
+
+// maxFetchRetries is the max allowed number of retries, retries are bounded
+// by MirrorTimeout anyway but long retries only delay the failure
+const maxFetchRetries = 10
+
+// fetchRetryBackoff is the wait time before first retry of the transient
+// remote failure, it's doubled on every following retry
+var fetchRetryBackoff = time.Second
+
+// isTransient returns true if error is likely to go away on retry ie.
+// remote couldn't be reached or command timed out
+func isTransient(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorClassNetwork, ErrorClassTimeout:
+		return true
+	}
+	return false
+}
+
+// retryTransient runs given remote operation and retries it up to retries
+// times with exponential backoff if it fails with transient error. other
+// errors are returned immediately. retries are stopped once ctx is done or
+// if its deadline is before next attempt. number of attempts made is
+// returned along with the error of the last attempt.
+func retryTransient(ctx context.Context, log *slog.Logger, retries int, op func(context.Context) error) (int, error) {
+	backoff := fetchRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil || attempt > retries || !isTransient(err) || ctx.Err() != nil {
+			return attempt, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			log.Debug("not enough time left to retry", "attempt", attempt, "err", err)
+			return attempt, err
+		}
+
+		log.Warn("transient remote error, retrying", "attempt", attempt, "retries", retries, "backoff", backoff, "err", err)
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return attempt, err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// retryRemote runs given remote operation of the repository with retries of
+// the transient failures and records number of attempts used
+func (r *Repository) retryRemote(ctx context.Context, name string, op func(context.Context) error) error {
+	log := r.log.With("op", name)
+	attempts, err := retryTransient(ctx, log, r.fetchRetries, op)
+	log.Debug("remote operation completed", "attempts", attempts, "err", err)
+	recordFetchRetries(r.gitURL.Repo, name, attempts-1)
+	return err
+}
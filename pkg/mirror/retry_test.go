@@ -0,0 +1,77 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_retryTransient(t *testing.T) {
+	defer func(b time.Duration) { fetchRetryBackoff = b }(fetchRetryBackoff)
+	fetchRetryBackoff = time.Millisecond
+
+	network := &GitError{Args: []string{"fetch"}, ExitCode: 128, Stderr: "fatal: unable to access 'https://host.xz/repo.git/': Could not resolve host: host.xz"}
+	timeout := &GitError{Args: []string{"fetch"}, ExitCode: -1, Err: context.DeadlineExceeded}
+	auth := &GitError{Args: []string{"fetch"}, ExitCode: 128, Stderr: "fatal: Authentication failed for 'https://host.xz/repo.git/'"}
+	notFound := &GitError{Args: []string{"fetch"}, ExitCode: 128, Stderr: "fatal: couldn't find remote ref refs/heads/missing"}
+
+	tests := []struct {
+		name         string
+		retries      int
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{"success", 2, []error{nil}, 1, nil},
+		{"network-then-success", 2, []error{network, nil}, 2, nil},
+		{"timeout-then-success", 2, []error{timeout, network, nil}, 3, nil},
+		{"retries-exhausted", 2, []error{network, network, timeout, nil}, 3, timeout},
+		{"retries-disabled", 0, []error{network, nil}, 1, network},
+		{"auth-not-retried", 2, []error{auth, nil}, 1, auth},
+		{"not-found-not-retried", 2, []error{network, notFound, nil}, 2, notFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			attempts, err := retryTransient(context.Background(), testLog, tt.retries, func(context.Context) error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts {
+				t.Errorf("retryTransient() attempts = %d calls = %d, want %d", attempts, calls, tt.wantAttempts)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("retryTransient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_retryTransient_deadline(t *testing.T) {
+	defer func(b time.Duration) { fetchRetryBackoff = b }(fetchRetryBackoff)
+	fetchRetryBackoff = time.Minute
+
+	network := &GitError{Args: []string{"fetch"}, ExitCode: 128, Stderr: "fatal: the remote end hung up unexpectedly"}
+
+	// backoff doesn't fit within the deadline so no retry is attempted
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	calls := 0
+	attempts, err := retryTransient(ctx, testLog, 2, func(context.Context) error {
+		calls++
+		return network
+	})
+	if attempts != 1 || calls != 1 || !errors.Is(err, network) {
+		t.Errorf("retryTransient() attempts = %d calls = %d err = %v, want single attempt", attempts, calls, err)
+	}
+
+	// cancelled context stops retries
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	attempts, _ = retryTransient(ctx, testLog, 2, func(context.Context) error { return network })
+	if attempts != 1 {
+		t.Errorf("retryTransient() attempts = %d, want 1", attempts)
+	}
+}
@@ -0,0 +1,144 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// defaultKeepPrevious is the number of previously published worktrees
+// retained per link if its not configured
+const defaultKeepPrevious = 1
+
+// maxKeepPrevious is the max allowed number of retained worktrees per link
+const maxKeepPrevious = 10
+
+var (
+	// ErrNoPreviousWorktree is returned if worktree link is rolled back but
+	// there is no previously published worktree retained
+	ErrNoPreviousWorktree = fmt.Errorf("no previous worktree retained")
+	// ErrWorktreeNotPaused is returned if worktree link is resumed but its
+	// updates are not paused
+	ErrWorktreeNotPaused = fmt.Errorf("worktree link is not paused")
+)
+
+// retainWorktree records worktree replaced by the newly published one as the
+// most recent previous worktree of the link. worktrees over the retention
+// count are removed unless they are still used by other links.
+// it must be called with write lock held.
+func (r *Repository) retainWorktree(ctx context.Context, wl *WorkTreeLink, old, current string) {
+	var previous []string
+	if old != "" && old != current {
+		previous = append(previous, old)
+	}
+	for _, wt := range wl.previous {
+		if wt != old && wt != current {
+			previous = append(previous, wt)
+		}
+	}
+
+	if len(previous) > r.keepPrevious {
+		for _, wt := range previous[r.keepPrevious:] {
+			if r.sharedWorktree(wt, wl) || r.retainedWorktree(wt, wl) {
+				continue
+			}
+			if err := r.removeWorktree(ctx, wt); err != nil {
+				wl.log.Error("unable to remove old worktree", "path", wt, "err", err)
+			}
+		}
+		previous = previous[:r.keepPrevious]
+	}
+	wl.previous = previous
+}
+
+// retainedWorktree returns true if given worktree is retained for rollback by
+// any link of the repository other than the given link
+func (r *Repository) retainedWorktree(wt string, wl *WorkTreeLink) bool {
+	for _, other := range r.workTreeLinks {
+		if other != wl && slices.Contains(other.previous, wt) {
+			return true
+		}
+	}
+	return false
+}
+
+// RollbackWorktree atomically re-publishes the most recent previous worktree
+// retained on the link (see RepositoryConfig.KeepPrevious) and pauses
+// further updates of the link until ResumeWorktree is called, otherwise next
+// mirror cycle would re-publish the tip of the ref. calling it again on the
+// paused link rolls it back further. link must be same as the one used to
+// add worktree link. ErrNoPreviousWorktree is returned if there is no
+// worktree to roll back to.
+func (r *Repository) RollbackWorktree(ctx context.Context, link string) error {
+	defer r.emitPendingEvents()
+	defer r.updateManifest()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	wl, ok := r.workTreeLinks[link]
+	if !ok {
+		return fmt.Errorf("%w link:%s", ErrWorktreeLinkNotFound, link)
+	}
+	if len(wl.previous) == 0 {
+		return fmt.Errorf("%w link:%s", ErrNoPreviousWorktree, link)
+	}
+
+	wt := wl.previous[0]
+	if err := wl.checkWorktree(ctx, wt); err != nil {
+		return fmt.Errorf("previous worktree failed checks path:%s err:%w", wt, err)
+	}
+	hash, err := wl.workTreeHash(ctx, wt)
+	if err != nil {
+		return fmt.Errorf("unable to get hash of previous worktree path:%s err:%w", wt, err)
+	}
+	currentHash, err := wl.CurrentHash()
+	if err != nil {
+		return fmt.Errorf("unable to read published hash err:%w", err)
+	}
+	ref, err := wl.CurrentRef()
+	if err != nil {
+		return fmt.Errorf("unable to read published ref err:%w", err)
+	}
+
+	if err := wl.publishWorktree(wt); err != nil {
+		return err
+	}
+	if err := wl.writeHashFile(hash, ref, r.now()); err != nil {
+		return fmt.Errorf("unable to publish hash file err:%w", err)
+	}
+	// rolled back worktree is no longer retained, worktree it replaced is
+	// removed by the clean up
+	wl.previous = wl.previous[1:]
+	wl.paused = true
+	r.setWorktreeStatus(wl, WorktreeStatusPaused)
+	wl.log.Info("worktree link rolled back, updates are paused until resumed", "hash", hash, "previousHash", currentHash)
+
+	r.history.recordLinkUpdate(LinkUpdate{Time: r.now(), Link: wl.link, OldHash: currentHash, NewHash: hash})
+	r.auditLinkUpdate(ctx, wl, ref, currentHash, hash)
+	r.queueEvent(Event{Type: EventWorktreePublished, Link: wl.link, OldHash: currentHash, NewHash: hash})
+	r.syncReplicas()
+	return nil
+}
+
+// ResumeWorktree resumes updates of the worktree link paused by
+// RollbackWorktree and queues mirror run to publish the tip of the ref.
+// link must be same as the one used to add worktree link.
+// ErrWorktreeNotPaused is returned if link is not paused.
+func (r *Repository) ResumeWorktree(link string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	wl, ok := r.workTreeLinks[link]
+	if !ok {
+		return fmt.Errorf("%w link:%s", ErrWorktreeLinkNotFound, link)
+	}
+	if !wl.paused {
+		return fmt.Errorf("%w link:%s", ErrWorktreeNotPaused, link)
+	}
+
+	wl.log.Info("worktree link resumed")
+	wl.paused = false
+	r.QueueMirrorRun()
+	return nil
+}
@@ -0,0 +1,93 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errUnsafePath is returned if path which is about to be removed doesn't
+// resolve inside of the expected root (eg. corrupted or crafted symlink)
+var errUnsafePath = errors.New("path resolves outside of the expected root")
+
+// pathInside returns errUnsafePath if given path, with all the symlinks
+// resolved, is not the root or inside of the root. its used to validate dirs
+// whose contents are about to be removed.
+func pathInside(root, path string) error {
+	resolvedRoot, err := resolveRoot(root, path)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("unable to resolve path:%s err:%w", path, err)
+	}
+	if _, ok := relInside(resolvedRoot, resolved); !ok {
+		return fmt.Errorf("%w path:%s resolved:%s root:%s", errUnsafePath, path, resolved, resolvedRoot)
+	}
+	return nil
+}
+
+// safeRemoveAll removes path and any children it contains only if it
+// resolves strictly inside the given root. symlinks of the parent dirs are
+// resolved but last element is not, so if path itself is a symlink only the
+// link is removed and its target is never touched. symlinks inside of the
+// removed dir are removed without following them. missing path is not an
+// error.
+func safeRemoveAll(root, path string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	resolvedRoot, err := resolveRoot(root, path)
+	if err != nil {
+		return err
+	}
+	dir, base := splitAbs(filepath.Clean(path))
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("unable to resolve parent of the path:%s err:%w", path, err)
+	}
+	resolved := filepath.Join(resolvedDir, base)
+	if rel, ok := relInside(resolvedRoot, resolved); !ok || rel == "." {
+		return fmt.Errorf("%w path:%s resolved:%s root:%s", errUnsafePath, path, resolved, resolvedRoot)
+	}
+
+	fi, err := os.Lstat(resolved)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		return os.Remove(resolved)
+	}
+	// RemoveAll doesn't follow symlinks while deleting children
+	return os.RemoveAll(resolved)
+}
+
+// resolveRoot returns root with all the symlinks resolved, both root and
+// path must be absolute
+func resolveRoot(root, path string) (string, error) {
+	if !filepath.IsAbs(root) || !filepath.IsAbs(path) {
+		return "", fmt.Errorf("root and path must be absolute root:%s path:%s", root, path)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve root:%s err:%w", root, err)
+	}
+	return resolvedRoot, nil
+}
+
+// relInside returns path relative to the root and true if path is the root
+// or inside of it, both paths must be resolved
+func relInside(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "..", false
+	}
+	return rel, true
+}
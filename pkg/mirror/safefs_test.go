@@ -0,0 +1,117 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_safeRemoveAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string // relative to temp dir
+		wantErr  error
+		wantGone bool
+	}{
+		{"file", "root/file", nil, true},
+		{"dir", "root/dir", nil, true},
+		{"missing", "root/missing", nil, true},
+		{"root itself", "root", errUnsafePath, false},
+		{"dot-dot traversal", "root/../outside", errUnsafePath, false},
+		{"parent of root", "root/..", errUnsafePath, false},
+		{"symlink to outside dir", "root/link-outside", nil, true},
+		{"under symlink to outside dir", "root/link-outside/file", errUnsafePath, false},
+		{"under symlink to root of filesystem", "root/link-slash/" + filepath.Base(os.TempDir()), errUnsafePath, false},
+		{"under symlink inside root", "root/link-dir/file", nil, true},
+		{"dir with symlink to outside", "root/dir-with-link", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			root := filepath.Join(tmp, "root")
+			outside := filepath.Join(tmp, "outside")
+			for _, dir := range []string{root, outside, filepath.Join(root, "dir"), filepath.Join(root, "dir-with-link")} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("unable to create dir err:%v", err)
+				}
+			}
+			for _, file := range []string{filepath.Join(root, "file"), filepath.Join(root, "dir", "file"), filepath.Join(outside, "file")} {
+				if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+					t.Fatalf("unable to write file err:%v", err)
+				}
+			}
+			for link, target := range map[string]string{
+				filepath.Join(root, "link-outside"):            outside,
+				filepath.Join(root, "link-slash"):              "/",
+				filepath.Join(root, "link-dir"):                filepath.Join(root, "dir"),
+				filepath.Join(root, "dir-with-link", "escape"): outside,
+			} {
+				if err := os.Symlink(target, link); err != nil {
+					t.Fatalf("unable to create symlink err:%v", err)
+				}
+			}
+
+			path := filepath.Join(tmp, tt.path)
+			err := safeRemoveAll(root, path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("safeRemoveAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Lstat(path); tt.wantGone != os.IsNotExist(err) {
+				t.Errorf("path gone mismatch want:%t err:%v", tt.wantGone, err)
+			}
+
+			// nothing outside of the root is ever touched
+			if _, err := os.Stat(filepath.Join(outside, "file")); err != nil {
+				t.Errorf("file outside of the root should exist err:%v", err)
+			}
+			if _, err := os.Stat(root); err != nil {
+				t.Errorf("root should exist err:%v", err)
+			}
+		})
+	}
+}
+
+func Test_pathInside(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+	for _, dir := range []string{filepath.Join(root, "dir"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("unable to create dir err:%v", err)
+		}
+	}
+	for link, target := range map[string]string{
+		filepath.Join(root, "link-outside"): outside,
+		filepath.Join(root, "link-slash"):   "/",
+		filepath.Join(root, "link-dir"):     filepath.Join(root, "dir"),
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatalf("unable to create symlink err:%v", err)
+		}
+	}
+
+	tests := []struct {
+		path    string
+		wantErr error
+	}{
+		{root, nil},
+		{filepath.Join(root, "dir"), nil},
+		{filepath.Join(root, "link-dir"), nil},
+		{filepath.Join(root, "link-outside"), errUnsafePath},
+		{filepath.Join(root, "link-slash"), errUnsafePath},
+		{filepath.Join(root, ".."), errUnsafePath},
+		{outside, errUnsafePath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if err := pathInside(root, tt.path); !errors.Is(err, tt.wantErr) {
+				t.Errorf("pathInside() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := pathInside("root", root); err == nil {
+		t.Errorf("expected error for relative root")
+	}
+}
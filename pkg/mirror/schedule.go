@@ -0,0 +1,276 @@
+package mirror
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleJitter is the max random delay added to the scheduled mirror
+// cycle so repositories with same schedule are not mirrored all at once
+const scheduleJitter = 30 * time.Second
+
+// scheduleRetryInterval is the initial wait before failed scheduled mirror
+// cycle is retried
+const scheduleRetryInterval = time.Minute
+
+// cronMacros are the supported shorthands of the schedule
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	dayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// cronSchedule is the parsed 5 field cron expression, each field is a bit
+// set of the matching values
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// if both day of month and day of week are restricted either of them
+	// must match, otherwise both must match
+	domStar, dowStar bool
+	loc              *time.Location
+	spec             string
+}
+
+// parseSchedule parses standard 5 field cron expression
+// (minute hour day-of-month month day-of-week). fields support '*', lists,
+// ranges, steps and month/day names, '@daily' like macros are also
+// supported. expression is evaluated in UTC unless it is prefixed with
+// 'CRON_TZ=<IANA name> '.
+func parseSchedule(spec string) (*cronSchedule, error) {
+	s := &cronSchedule{loc: time.UTC, spec: spec}
+
+	spec = strings.TrimSpace(spec)
+	if tz, rest, ok := strings.Cut(spec, " "); ok && strings.HasPrefix(tz, "CRON_TZ=") {
+		loc, err := time.LoadLocation(strings.TrimPrefix(tz, "CRON_TZ="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule timezone err:%w", err)
+		}
+		s.loc = loc
+		spec = strings.TrimSpace(rest)
+	}
+	if expr, ok := cronMacros[spec]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule must have 5 fields (minute hour day-of-month month day-of-week) got %d", len(fields))
+	}
+
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute field err:%w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour field err:%w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day of month field err:%w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("invalid month field err:%w", err)
+	}
+	// 7 is also sunday
+	if s.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("invalid day of week field err:%w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+
+	return s, nil
+}
+
+// parseCronField parses comma separated list of values, ranges (a-b) and
+// steps (*/n or a-b/n) into bit set
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		var start, end int
+		switch {
+		case rng == "*":
+			start, end = min, max
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if start, err = parseCronValue(a, names); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(b, names); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseCronValue(rng, names)
+			if err != nil {
+				return 0, err
+			}
+			start, end = v, v
+			// 'n/step' means from n to max
+			if hasStep {
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return v, nil
+}
+
+// allHours is the hour bit set of the schedule which runs every hour
+const allHours = 1<<24 - 1
+
+// next returns the first activation time after the given time. wall clock
+// times skipped by DST change are not activated. wall clock times repeated by
+// DST change are only activated once unless schedule runs every hour.
+// zero time is returned if schedule never matches (eg. 30 Feb)
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = wallClock(t.Year(), t.Month()+1, 1, 0, s.loc)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = wallClock(t.Year(), t.Month(), t.Day()+1, 0, s.loc)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		t = wallClock(t.Year(), t.Month(), t.Day(), t.Hour()+1, s.loc)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	// minutes are added in absolute time so that repeated wall clock times
+	// are visited as well
+	for s.minute&(1<<uint(t.Minute())) == 0 || (s.hour != allHours && isRepeated(t)) {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	return t
+}
+
+// wallClock returns the first occurrence of the given wall clock hour, unlike
+// time.Date which may return the second occurrence if clocks were turned back
+func wallClock(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	if earlier, ok := earlierOccurrence(t); ok {
+		return earlier
+	}
+	return t
+}
+
+// isRepeated returns true if wall clock of the given time was already passed
+// once before clocks were turned back
+func isRepeated(t time.Time) bool {
+	_, ok := earlierOccurrence(t)
+	return ok
+}
+
+// earlierOccurrence returns the time with the same wall clock as given time
+// if it exists before clocks were turned back within last 12h
+func earlierOccurrence(t time.Time) (time.Time, bool) {
+	_, offset := t.Zone()
+	_, prevOffset := t.Add(-12 * time.Hour).Zone()
+	if prevOffset <= offset {
+		return time.Time{}, false
+	}
+	earlier := t.Add(-time.Duration(prevOffset-offset) * time.Second)
+	_, earlierOffset := earlier.Zone()
+	if earlierOffset != prevOffset || earlier.Hour() != t.Hour() || earlier.Minute() != t.Minute() {
+		return time.Time{}, false
+	}
+	return earlier, true
+}
+
+// prev returns the n-th activation time before the given time. zero time is
+// returned if schedule wasn't activated n times within last few years
+func (s *cronSchedule) prev(t time.Time, n int) time.Time {
+	// activations are listed with next from increasingly earlier start
+	// until there are enough of them
+	for window := time.Hour; window <= 4*365*24*time.Hour; window *= 2 {
+		var activations []time.Time
+		for a := s.next(t.Add(-window)); !a.IsZero() && a.Before(t); a = s.next(a) {
+			activations = append(activations, a)
+		}
+		if len(activations) >= n {
+			return activations[len(activations)-n]
+		}
+	}
+	return time.Time{}
+}
+
+// String returns the original cron expression
+func (s *cronSchedule) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.spec
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,146 @@
+package mirror
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func Test_parseSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"every-minute", "* * * * *", false},
+		{"steps-ranges-lists", "*/15 9-17/2 1,15 * 1-5", false},
+		{"names", "0 0 * jan-mar MON,wed,Fri", false},
+		{"sunday-7", "0 0 * * 7", false},
+		{"macro", "@daily", false},
+		{"timezone", "CRON_TZ=Europe/London 30 1 * * *", false},
+		{"timezone-macro", "CRON_TZ=Europe/London @hourly", false},
+		{"empty", "", true},
+		{"too-few-fields", "* * * *", true},
+		{"too-many-fields", "0 * * * * *", true},
+		{"minute-out-of-range", "60 * * * *", true},
+		{"hour-out-of-range", "0 24 * * *", true},
+		{"dom-zero", "0 0 0 * *", true},
+		{"month-out-of-range", "0 0 * 13 *", true},
+		{"dow-out-of-range", "0 0 * * 8", true},
+		{"reversed-range", "0 17-9 * * *", true},
+		{"zero-step", "*/0 * * * *", true},
+		{"invalid-name", "0 0 * * someday", true},
+		{"invalid-timezone", "CRON_TZ=Nowhere/City * * * * *", true},
+		{"unknown-macro", "@fortnightly", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSchedule(tt.spec); (err != nil) != tt.wantErr {
+				t.Errorf("parseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronSchedule_next(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("unable to load location err:%v", err)
+	}
+	utc := func(mo time.Month, d, h, m int) time.Time { return time.Date(2026, mo, d, h, m, 0, 0, time.UTC) }
+
+	// in 2026 Europe/London clocks go forward on 29 Mar at 01:00 UTC
+	// (01:00 GMT -> 02:00 BST) and back on 25 Oct at 01:00 UTC (02:00 BST -> 01:00 GMT)
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"every-minute", "* * * * *", utc(7, 1, 10, 0), utc(7, 1, 10, 1)},
+		{"seconds-truncated", "* * * * *", utc(7, 1, 10, 0).Add(59 * time.Second), utc(7, 1, 10, 1)},
+		{"step", "*/15 * * * *", utc(7, 1, 10, 1), utc(7, 1, 10, 15)},
+		{"next-hour", "5 * * * *", utc(7, 1, 10, 5), utc(7, 1, 11, 5)},
+		{"next-day", "0 9 * * *", utc(7, 1, 10, 0), utc(7, 2, 9, 0)},
+		{"weekday", "0 9 * * mon-fri", utc(7, 3, 10, 0), utc(7, 6, 9, 0)}, // fri -> mon
+		{"sunday-7", "0 0 * * 7", utc(7, 1, 0, 0), utc(7, 5, 0, 0)},
+		{"dom-or-dow", "0 0 15 * sun", utc(7, 6, 0, 0), utc(7, 12, 0, 0)},
+		{"dom-and-star-dow", "0 0 15 * *", utc(7, 6, 0, 0), utc(7, 15, 0, 0)},
+		{"next-month", "0 0 31 * *", utc(6, 1, 0, 0), utc(7, 31, 0, 0)},
+		{"next-year", "0 0 1 jan *", utc(7, 1, 0, 0), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap-day", "0 0 29 2 *", utc(7, 1, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 30 2 *", utc(7, 1, 0, 0), time.Time{}},
+		{"tz-summer", "CRON_TZ=Europe/London 0 9 * * *", utc(7, 1, 0, 0), utc(7, 1, 8, 0)},
+		{"tz-winter", "CRON_TZ=Europe/London 0 9 * * *", utc(12, 1, 0, 0), utc(12, 1, 9, 0)},
+		// 01:30 doesn't exist on the spring forward day so its skipped
+		{"dst-gap-skipped", "CRON_TZ=Europe/London 30 1 * * *", utc(3, 28, 12, 0), utc(3, 30, 0, 30)},
+		{"dst-gap-hourly", "CRON_TZ=Europe/London 0 * * * *", utc(3, 29, 0, 30), utc(3, 29, 1, 0)},
+		{"dst-gap-after", "CRON_TZ=Europe/London 30 2 * * *", utc(3, 28, 12, 0), utc(3, 29, 1, 30)},
+		// 01:30 happens twice on the fall back day, its only activated once
+		{"dst-repeated-first", "CRON_TZ=Europe/London 30 1 * * *", utc(10, 24, 12, 0), utc(10, 25, 0, 30)},
+		{"dst-repeated-once", "CRON_TZ=Europe/London 30 1 * * *", utc(10, 25, 0, 30), utc(10, 26, 1, 30)},
+		{"dst-repeated-next-hour", "CRON_TZ=Europe/London 0 2 * * *", utc(10, 25, 0, 30), utc(10, 25, 2, 0)},
+		// schedules running every hour carry on in absolute time
+		{"dst-repeated-hourly", "CRON_TZ=Europe/London 30 * * * *", utc(10, 25, 0, 30), utc(10, 25, 1, 30)},
+		{"dst-repeated-every-minute", "CRON_TZ=Europe/London * * * * *", utc(10, 25, 0, 59), utc(10, 25, 1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := s.next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("next() got:%s want:%s", got.In(london), tt.want.In(london))
+			}
+		})
+	}
+}
+
+func TestRepo_nextWait_schedule(t *testing.T) {
+	r, err := NewRepository(RepositoryConfig{
+		Remote:   "user@host.xz:path/to/repo.git",
+		Root:     "/tmp",
+		Schedule: "CRON_TZ=Europe/London 0 1 * * *",
+		GitGC:    "always",
+	}, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// fake clock just before clocks go back, 01:00 BST is 00:00 UTC
+	now := time.Date(2026, 10, 24, 23, 30, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	tests := []struct {
+		name       string
+		failures   int
+		maxBackoff time.Duration
+		want       time.Duration
+	}{
+		{"scheduled", 0, 0, 30 * time.Minute},
+		// retry backoff is shorter than next scheduled run
+		{"retry", 1, 0, 2 * time.Minute},
+		{"retry-max-backoff", 5, 0, 10 * time.Minute},
+		// retry backoff is capped by next scheduled run
+		{"retry-capped", 6, time.Hour, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.failures = tt.failures
+			r.maxBackoff = tt.maxBackoff
+			got := r.nextWait()
+			if got < tt.want || got >= tt.want+scheduleJitter {
+				t.Errorf("nextWait() got:%s want:%s + jitter", got, tt.want)
+			}
+		})
+	}
+
+	// repeated 01:00 GMT is not activated
+	now = time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)
+	r.failures = 0
+	if got, want := r.nextWait(), 25*time.Hour; got < want || got >= want+scheduleJitter {
+		t.Errorf("nextWait() got:%s want:%s + jitter", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// stateVersion is the schema version of the state file, state file with
+	// different version is ignored
+	stateVersion = 1
+
+	// stateFile is the name of the file in the repository dir which holds
+	// state of the worktree links recorded after last successful mirror cycle
+	stateFile = ".git-mirror-state.json"
+)
+
+// repoState is the state of the repository persisted across restarts
+type repoState struct {
+	Version int                  `json:"version"`
+	Remote  string               `json:"remote"`
+	Head    string               `json:"head,omitempty"` // local HEAD branch of the repo
+	Links   map[string]linkState `json:"links"`          // keyed by abs link path
+}
+
+// linkState is the state of the worktree published on the link
+type linkState struct {
+	Hash     string `json:"hash"`
+	Ref      string `json:"ref"`
+	Pathspec string `json:"pathspec"`
+	Sparse   bool   `json:"sparse"`
+	Worktree string `json:"worktree"`
+	// Previous are the worktrees retained for rollback and Paused is set
+	// if link was rolled back, see Repository.RollbackWorktree
+	Previous []string `json:"previous,omitempty"`
+	Paused   bool     `json:"paused,omitempty"`
+}
+
+// stateFilePath returns abs path of the state file of the repository
+func (r *Repository) stateFilePath() string {
+	return filepath.Join(r.dir, stateFile)
+}
+
+// readState reads state file of the repository, nil is returned if file
+// doesn't exist or it's schema version or remote doesn't match
+func (r *Repository) readState() (*repoState, []byte) {
+	data, err := os.ReadFile(r.stateFilePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		r.log.Warn("unable to read state file", "err", err)
+		return nil, nil
+	}
+
+	var state repoState
+	if err := json.Unmarshal(data, &state); err != nil {
+		r.log.Warn("ignoring invalid state file", "err", err)
+		return nil, nil
+	}
+	if state.Version != stateVersion {
+		r.log.Info("ignoring state file with different version", "version", state.Version, "want", stateVersion)
+		return nil, nil
+	}
+	if state.Remote != r.remote {
+		r.log.Info("ignoring state file of different remote", "remote", state.Remote)
+		return nil, nil
+	}
+	return &state, data
+}
+
+// restoreState reads state file and assigns recorded state to the matching
+// worktree links so that first mirror cycle after restart can skip expensive
+// worktree checks. retained worktrees and paused state of the rolled back
+// links are restored as well. it must be called with write lock held.
+func (r *Repository) restoreState() {
+	state, data := r.readState()
+	if state == nil {
+		return
+	}
+
+	for _, wl := range r.workTreeLinks {
+		if ls, ok := state.Links[wl.link]; ok {
+			wl.restored = &ls
+			wl.paused = ls.Paused
+			wl.previous = slices.DeleteFunc(slices.Clone(ls.Previous), func(wt string) bool {
+				_, err := os.Stat(wt)
+				return filepath.Dir(wt) != r.worktreesRoot() || err != nil
+			})
+		}
+	}
+	r.stateData = data
+}
+
+// saveState atomically writes state of the worktree links published by the
+// successful mirror cycle. file is only written if state has changed.
+// it must be called with write lock held.
+func (r *Repository) saveState(result *MirrorResult) {
+	state := repoState{
+		Version: stateVersion,
+		Remote:  r.remote,
+		Head:    r.localHead(),
+		Links:   make(map[string]linkState, len(r.workTreeLinks)),
+	}
+	for _, wl := range r.workTreeLinks {
+		wtResult, ok := result.Worktrees[wl.link]
+		if !ok || wtResult.Hash == "" {
+			continue
+		}
+		wt, err := wl.currentWorktree()
+		if err != nil || wt == "" {
+			continue
+		}
+		ref := wl.ref
+		if wl.refPattern != "" {
+			ref = wl.currentRef
+		}
+		state.Links[wl.link] = linkState{
+			Hash:     wtResult.Hash,
+			Ref:      ref,
+			Pathspec: wl.pathspec,
+			Sparse:   wl.sparse,
+			Worktree: wt,
+			Previous: wl.previous,
+			Paused:   wl.paused,
+		}
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		r.log.Error("unable to encode state", "err", err)
+		return
+	}
+	if bytes.Equal(data, r.stateData) {
+		return
+	}
+	if err := writeFileAtomic(r.stateFilePath(), data); err != nil {
+		r.log.Error("unable to write state file", "err", err)
+		return
+	}
+	r.stateData = data
+}
+
+// restoredWorktree returns true if worktree recorded in the restored state
+// is still published on the link with the given hash. only cheap file system
+// checks are done on the worktree instead of running git commands. restored
+// state is only used once, on the first mirror cycle after restart.
+func (wl *WorkTreeLink) restoredWorktree(ref, hash, wt string) bool {
+	ls := wl.restored
+	if ls == nil {
+		return false
+	}
+	wl.restored = nil
+
+	if ls.Hash != hash || ls.Ref != ref || ls.Pathspec != wl.pathspec ||
+		ls.Sparse != wl.sparse || ls.Worktree != wt {
+		return false
+	}
+	if empty, err := dirIsEmpty(wt); err != nil || empty {
+		return false
+	}
+	// worktree has .git file pointing to the mirror
+	if fi, err := os.Stat(filepath.Join(wt, ".git")); err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	return true
+}
+
+// localHead returns the branch local HEAD points to by reading HEAD file of
+// the repo, empty string is returned if HEAD is detached or can't be read
+func (r *Repository) localHead() string {
+	data, err := os.ReadFile(filepath.Join(r.dir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	head, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: ")
+	if !ok {
+		return ""
+	}
+	return head
+}
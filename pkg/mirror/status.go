@@ -0,0 +1,175 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/giturl"
+)
+
+// statusLockTimeout is the max time status waits for the repository lock
+// so that status is not blocked by in-flight mirror
+const statusLockTimeout = 200 * time.Millisecond
+
+// RepositoryStatus represents current state of the mirrored repository
+type RepositoryStatus struct {
+	Remote   string `json:"remote"`
+	Root     string `json:"root"`
+	Interval string `json:"interval"`
+	// Schedule is the cron expression of the mirror cycles if set instead
+	// of interval
+	Schedule string `json:"schedule,omitempty"`
+	Running  bool   `json:"running"`
+	// Paused is set if remote operations are paused, see Repository.Pause
+	Paused bool `json:"paused"`
+	// NextRun is the time when next mirror cycle is due, its only set
+	// while mirror loop is running
+	NextRun time.Time `json:"nextRun"`
+	// Incomplete is set if repository lock couldn't be acquired in time
+	// (eg. mirror is in progress) hence only static details are set
+	Incomplete  bool      `json:"incomplete"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastError   string    `json:"lastError"`
+	// Skipped is the reason last mirror cycle was skipped before repository
+	// was initialised (eg. outside of the fetch window)
+	Skipped   string             `json:"skipped,omitempty"`
+	Worktrees []WorktreeLinkInfo `json:"worktrees"`
+	// ConsecutiveFailures is the number of mirror cycles failed since
+	// last successful mirror
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// DiskUsage is recorded after clean up step of the last updated mirror
+	// cycle. DiskQuotaExceeded is set if usage is over configured quota
+	DiskUsage         RepoDiskUsage `json:"diskUsage"`
+	DiskQuotaExceeded bool          `json:"diskQuotaExceeded"`
+	// Labels are the labels of the repository, see RepositoryConfig.Labels
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// WorktreeLinkInfo represents current state of the worktree link.
+// for links with RefPattern, Ref is the tag resolved on last mirror cycle
+type WorktreeLinkInfo struct {
+	Link       string         `json:"link"`
+	Ref        string         `json:"ref"`
+	RefPattern string         `json:"refPattern,omitempty"`
+	Pathspec   string         `json:"pathspec"`
+	Path       string         `json:"path"`
+	Hash       string         `json:"hash"`
+	Status     WorktreeStatus `json:"status"`
+	// RefName is the full ref name Ref resolved to on last mirror cycle and
+	// AmbiguousRef is set if short Ref matched both branch and tag
+	RefName      string `json:"refName,omitempty"`
+	AmbiguousRef bool   `json:"ambiguousRef,omitempty"`
+	// EmptyPathspec is set if pathspec didn't match any file on the last
+	// mirror cycle
+	EmptyPathspec bool `json:"emptyPathspec,omitempty"`
+	// BlockedHash is the hash of the update blocked as its not a descendant
+	// of the published hash, see WorktreeConfig.ProtectAgainstForcePush
+	BlockedHash string `json:"blockedHash,omitempty"`
+	// State is the health state of the link, see WorkTreeLink.State.
+	// LastSynced is the time link was last confirmed up to date and
+	// LastError is the error of the last attempt to ensure the worktree
+	State      LinkState `json:"state"`
+	LastSynced time.Time `json:"lastSynced"`
+	LastError  string    `json:"lastError,omitempty"`
+	// Auto is set if link is maintained by the auto worktree rule of the
+	// repository, see RepositoryConfig.AutoWorktrees
+	Auto bool `json:"auto,omitempty"`
+}
+
+// Status returns current state of the repository and its worktree links.
+// it will only wait for the repository lock until given context is done.
+func (r *Repository) Status(ctx context.Context) RepositoryStatus {
+	// remote is stored redacted but status is served over http so make
+	// sure credentials are never exposed. loop state is read under loop lock.
+	status := RepositoryStatus{
+		Remote:  giturl.Redact(r.remote),
+		Root:    r.root,
+		Running: r.loopRunning(),
+		Paused:  r.Paused(),
+	}
+
+	if err := r.lock.RLockContext(ctx); err != nil {
+		status.Incomplete = true
+		return status
+	}
+	defer r.lock.RUnlock()
+
+	status.Interval = r.interval.String()
+	status.Schedule = r.schedule.String()
+	if status.Running {
+		status.NextRun = r.nextRun
+	}
+	status.LastSuccess = r.lastSuccess
+	if r.lastStatus.Err != nil {
+		status.LastError = r.lastStatus.Err.Error()
+	}
+	status.Skipped = r.lastStatus.Skipped
+	status.ConsecutiveFailures = r.failures
+	status.DiskUsage = r.diskUsage
+	status.DiskQuotaExceeded = r.overQuota
+	status.Labels = maps.Clone(r.labels)
+	status.Worktrees = []WorktreeLinkInfo{}
+
+	now, staleAfter := r.now(), r.staleAfter()
+	for _, wl := range r.workTreeLinks {
+		info := WorktreeLinkInfo{
+			Link:          wl.link,
+			Ref:           wl.ref,
+			RefPattern:    wl.refPattern,
+			RefName:       wl.refName,
+			AmbiguousRef:  wl.ambiguous,
+			Pathspec:      wl.pathspec,
+			Status:        wl.status,
+			EmptyPathspec: wl.emptySpec,
+			BlockedHash:   wl.blocked,
+			State:         wl.state(now, staleAfter),
+			LastSynced:    wl.lastSynced,
+			Auto:          wl.auto,
+		}
+		if wl.lastErr != nil {
+			info.LastError = wl.lastErr.Error()
+		}
+		if wl.refPattern != "" {
+			info.Ref = wl.currentRef
+		}
+		var err error
+		if info.Path, err = wl.currentWorktree(); err != nil {
+			wl.log.Error("unable to get current worktree path", "err", err)
+		}
+		if info.Hash, err = wl.CurrentHash(); err != nil {
+			wl.log.Error("unable to get current worktree hash", "err", err)
+		}
+		status.Worktrees = append(status.Worktrees, info)
+	}
+
+	return status
+}
+
+// Status returns current state of all the repositories in the pool.
+// each repository lock is only waited for a short time so status of
+// repositories with in-flight mirror will be marked as incomplete.
+func (rp *RepoPool) Status(ctx context.Context) []RepositoryStatus {
+	repos := rp.repositories()
+	statuses := make([]RepositoryStatus, 0, len(repos))
+	for _, repo := range repos {
+		lCtx, cancel := context.WithTimeout(ctx, statusLockTimeout)
+		statuses = append(statuses, repo.Status(lCtx))
+		cancel()
+	}
+	return statuses
+}
+
+// StatusHandler returns http.Handler which renders status of all the
+// repositories in the pool as JSON. it requires read-only role, see
+// Authorizer.
+func (rp *RepoPool) StatusHandler() http.Handler {
+	return rp.authorized(methodRoles{http.MethodGet: RoleReadOnly}, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rp.Status(req.Context())); err != nil {
+			rp.log.Error("unable to encode status", "err", err)
+		}
+	})
+}
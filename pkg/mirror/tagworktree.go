@@ -0,0 +1,210 @@
+package mirror
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// defaultTagWorktreesKeep is the number of the latest tags published by the
+// tag worktree rule if not configured
+const defaultTagWorktreesKeep = 5
+
+func (twc TagWorktreeConfig) validate() error {
+	if twc.Pattern == "" || strings.HasPrefix(twc.Pattern, "refs/") || strings.ContainsAny(twc.Pattern, " \t\n") {
+		return fmt.Errorf("tag worktree pattern must be glob pattern of the tag names pattern:%s", twc.Pattern)
+	}
+	if !strings.HasSuffix(twc.LinkPrefix, "/") || strings.ContainsAny(twc.LinkPrefix, "{}") || twc.linkDir() == "." {
+		return fmt.Errorf("tag worktree link prefix must be static dir path ending with '/' prefix:%s", twc.LinkPrefix)
+	}
+	if twc.Keep < 0 {
+		return fmt.Errorf("tag worktree keep (%d) must not be negative", twc.Keep)
+	}
+	return twc.Sort.validate()
+}
+
+// linkDir returns the dir of the links created by the rule
+func (twc TagWorktreeConfig) linkDir() string {
+	return filepath.Clean(twc.LinkPrefix)
+}
+
+// keep returns the number of the latest tags published by the rule
+func (twc TagWorktreeConfig) keep() int {
+	if twc.Keep == 0 {
+		return defaultTagWorktreesKeep
+	}
+	return twc.Keep
+}
+
+// link returns the worktree link of the given tag ref, false is returned if
+// tag name is not usable as link name
+func (twc TagWorktreeConfig) link(ref string) (string, bool) {
+	name, ok := autoLinkName(ref)
+	if !ok {
+		return "", false
+	}
+	return twc.LinkPrefix + name, true
+}
+
+// matchingTags returns tag refs matching the pattern of the rule sorted from
+// the latest to the oldest
+func (r *Repository) matchingTags(ctx context.Context, twc TagWorktreeConfig) ([]string, error) {
+	args := []string{"for-each-ref", "--format=%(refname)", "refs/tags/" + twc.Pattern}
+	if twc.Sort == RefSortCreatorDate {
+		args = slices.Insert(args, 1, "--sort="+twc.Sort.sortKey())
+	}
+	// git for-each-ref [--sort=-creatordate] --format=%(refname) refs/tags/<pattern>
+	out, err := runGitCommand(ctx, r.log, r.gitOps, r.runner, r.envs, r.dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, ref := range strings.Split(out, "\n") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			tags = append(tags, ref)
+		}
+	}
+	if twc.Sort != RefSortCreatorDate {
+		slices.SortStableFunc(tags, func(a, b string) int {
+			return compareTagVersions(strings.TrimPrefix(b, "refs/tags/"), strings.TrimPrefix(a, "refs/tags/"))
+		})
+	}
+	return tags, nil
+}
+
+// addTagWorktreeConfigs adds worktree config of the latest tags of each tag
+// worktree rule to the wanted configs keyed by the link. tags which are not
+// pointing to a commit are skipped.
+func (r *Repository) addTagWorktreeConfigs(ctx context.Context, refs map[string]string, wanted map[string]WorktreeConfig) error {
+	for _, twc := range r.tagRules {
+		tags, err := r.matchingTags(ctx, twc)
+		if err != nil {
+			return err
+		}
+		kept := 0
+		for _, ref := range tags {
+			if kept >= twc.keep() {
+				break
+			}
+			// tags not pointing to a commit can't be checked out
+			if refs[ref] == "" {
+				continue
+			}
+			link, ok := twc.link(ref)
+			if !ok {
+				continue
+			}
+			if other, ok := wanted[link]; ok {
+				r.log.Warn("tag worktree link of the ref is already used by other ref", "link", link, "ref", ref, "other", other.Ref)
+				continue
+			}
+			wanted[link] = WorktreeConfig{Link: link, Ref: ref, Pathspec: twc.Pathspec}
+			kept++
+		}
+	}
+	return nil
+}
+
+// tagVersion is the version parsed from the tag name
+type tagVersion struct {
+	core []int    // numeric release parts eg. 1.2.3
+	pre  []string // pre-release identifiers, empty for the release
+}
+
+// parseTagVersion parses semver like version from the tag name, any prefix
+// before the first digit (eg. 'v' or 'release-') and build metadata are
+// ignored. false is returned if tag name is not a version
+func parseTagVersion(tag string) (tagVersion, bool) {
+	i := strings.IndexFunc(tag, unicode.IsDigit)
+	if i < 0 {
+		return tagVersion{}, false
+	}
+	version, _, _ := strings.Cut(tag[i:], "+")
+	core, pre, hasPre := strings.Cut(version, "-")
+
+	var v tagVersion
+	for _, part := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return tagVersion{}, false
+		}
+		v.core = append(v.core, n)
+	}
+	if hasPre {
+		v.pre = strings.Split(pre, ".")
+		if slices.Contains(v.pre, "") {
+			return tagVersion{}, false
+		}
+	}
+	return v, true
+}
+
+// compareTagVersions compares tag names by semver precedence, it returns -1
+// if a is lower than b, 1 if its higher and 0 if both are same. missing parts
+// of the release version are treated as 0 and pre-release is lower than the
+// release. tags which are not a version are lower than all the versions and
+// are compared by name
+func compareTagVersions(a, b string) int {
+	va, okA := parseTagVersion(a)
+	vb, okB := parseTagVersion(b)
+	switch {
+	case okA && !okB:
+		return 1
+	case !okA && okB:
+		return -1
+	case !okA && !okB:
+		return strings.Compare(a, b)
+	}
+
+	for i := range max(len(va.core), len(vb.core)) {
+		var pa, pb int
+		if i < len(va.core) {
+			pa = va.core[i]
+		}
+		if i < len(vb.core) {
+			pb = vb.core[i]
+		}
+		if c := cmp.Compare(pa, pb); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(va.pre) == 0 && len(vb.pre) > 0:
+		return 1
+	case len(va.pre) > 0 && len(vb.pre) == 0:
+		return -1
+	}
+	for i := range min(len(va.pre), len(vb.pre)) {
+		if c := comparePreRelease(va.pre[i], vb.pre[i]); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(len(va.pre), len(vb.pre)); c != 0 {
+		return c
+	}
+	// same precedence (eg. 'v1.0' and '1.0.0'), name keeps the order stable
+	return strings.Compare(a, b)
+}
+
+// comparePreRelease compares pre-release identifiers, numeric identifiers are
+// compared numerically and are lower than alphanumeric ones
+func comparePreRelease(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,63 @@
+package mirror
+
+import "testing"
+
+func TestTagWorktreeConfig_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		twc     TagWorktreeConfig
+		wantErr bool
+	}{
+		{"valid", TagWorktreeConfig{Pattern: "v*", LinkPrefix: "releases/"}, false},
+		{"valid-abs", TagWorktreeConfig{Pattern: "v*", LinkPrefix: "/abs/releases/", Keep: 3, Sort: RefSortCreatorDate}, false},
+		{"no-pattern", TagWorktreeConfig{LinkPrefix: "releases/"}, true},
+		{"full-ref-pattern", TagWorktreeConfig{Pattern: "refs/tags/v*", LinkPrefix: "releases/"}, true},
+		{"space-in-pattern", TagWorktreeConfig{Pattern: "v *", LinkPrefix: "releases/"}, true},
+		{"no-prefix", TagWorktreeConfig{Pattern: "v*"}, true},
+		{"prefix-not-dir", TagWorktreeConfig{Pattern: "v*", LinkPrefix: "releases"}, true},
+		{"placeholder-prefix", TagWorktreeConfig{Pattern: "v*", LinkPrefix: "{short_ref}/"}, true},
+		{"dot-prefix", TagWorktreeConfig{Pattern: "v*", LinkPrefix: "./"}, true},
+		{"negative-keep", TagWorktreeConfig{Pattern: "v*", LinkPrefix: "releases/", Keep: -1}, true},
+		{"invalid-sort", TagWorktreeConfig{Pattern: "v*", LinkPrefix: "releases/", Sort: "random"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.twc.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_compareTagVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.0.0", "v1.0.0", 0},
+		{"v1.0.0", "v2.0.0", -1},
+		{"v1.10.0", "v1.9.0", 1},
+		{"v1.2", "v1.2.1", -1},
+		{"v1.0", "1.0.0", 1},
+		{"release-2.0.0", "v1.0.0", 1},
+		{"v1.0.0-rc.1", "v1.0.0", -1},
+		{"v1.0.0-rc.2", "v1.0.0-rc.10", -1},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+		{"v1.0.0-1", "v1.0.0-alpha", -1},
+		{"v1.0.0-beta", "v1.0.0-alpha", 1},
+		{"v1.0.0+build.2", "v1.0.0+build.1", 1},
+		{"latest", "v0.0.1", -1},
+		{"latest", "stable", -1},
+		{"v1.x", "v0.0.1", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := compareTagVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("compareTagVersions(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := compareTagVersions(tt.b, tt.a); got != -tt.want {
+				t.Errorf("compareTagVersions(%q, %q) = %v, want %v", tt.b, tt.a, got, -tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation name of the tracer used by the repository
+const tracerName = "github.com/utilitywarehouse/git-mirror/pkg/mirror"
+
+// newTracer returns tracer of the given provider, noop tracer is returned
+// if provider is nil
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// SetTracerProvider sets the OpenTelemetry tracer provider used to create
+// spans of the mirror operations, see WithTracerProvider. nil disables
+// tracing.
+func (r *Repository) SetTracerProvider(tp trace.TracerProvider) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.tracer = newTracer(tp)
+}
+
+// SetTracerProvider sets the OpenTelemetry tracer provider of all the
+// repositories of the pool including repositories added later, see
+// WithTracerProvider. nil disables tracing.
+func (rp *RepoPool) SetTracerProvider(tp trace.TracerProvider) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	rp.tracerProvider = tp
+	for _, repo := range rp.repos {
+		repo.SetTracerProvider(tp)
+	}
+}
+
+// startSpan starts span using tracer of the repository as child of the span
+// in the context if any. it must be called with repository lock held.
+func (r *Repository) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return r.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// startGitSpan starts span of the git command as child of the span in the
+// context using parent's tracer provider. commands which are not run as
+// part of the traced operation are not traced. span only includes the sub
+// command name as arguments might contain credentials.
+func startGitSpan(ctx context.Context, args []string) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	return tracer.Start(ctx, "git", trace.WithAttributes(attribute.String("git.subcommand", gitSubcommand(args))))
+}
+
+// endSpan records error if any and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		err = spanError(err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// spanError returns error recorded on the span, if error was caused by git
+// command only its redacted args and exit error are recorded as output of
+// the command might contain credentials
+func spanError(err error) error {
+	var gErr *GitError
+	if errors.As(err, &gErr) {
+		return fmt.Errorf("Run(%s): %w", commandString("git", gErr.Args), gErr.Err)
+	}
+	return err
+}
+
+// gitSubcommand returns sub command of the git args skipping global
+// '-c <name>=<value>' options
+func gitSubcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(args[i], "-") {
+			return args[i]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// VerifyCheck is the name of the check which found the problem
+type VerifyCheck string
+
+const (
+	// VerifyCheckRepo is set if mirrored repository dir failed sanity checks
+	VerifyCheckRepo VerifyCheck = "repo"
+	// VerifyCheckLink is set if published link is missing or doesn't
+	// resolve to the worktree of the repository
+	VerifyCheckLink VerifyCheck = "link"
+	// VerifyCheckWorktree is set if published worktree failed sanity checks
+	VerifyCheckWorktree VerifyCheck = "worktree"
+	// VerifyCheckHashFile is set if hash file published next to the link
+	// doesn't match the published worktree
+	VerifyCheckHashFile VerifyCheck = "hash-file"
+	// VerifyCheckStaleWorktree is set if worktrees root contains worktree
+	// which is not published and is older than the stale timeout
+	VerifyCheckStaleWorktree VerifyCheck = "stale-worktree"
+)
+
+// VerifyReport lists problems found by comparing on-disk state of the
+// repository with its config
+type VerifyReport struct {
+	Remote   string          `json:"remote"`
+	Problems []VerifyProblem `json:"problems"`
+}
+
+// VerifyProblem represents single inconsistency found on disk. Link is only
+// set for problems of the worktree link
+type VerifyProblem struct {
+	Check   VerifyCheck `json:"check"`
+	Link    string      `json:"link,omitempty"`
+	Path    string      `json:"path"`
+	Message string      `json:"message"`
+}
+
+// OK returns true if no problems were found
+func (vr VerifyReport) OK() bool {
+	return len(vr.Problems) == 0
+}
+
+func (vr *VerifyReport) add(check VerifyCheck, link, path, format string, args ...any) {
+	vr.Problems = append(vr.Problems, VerifyProblem{
+		Check:   check,
+		Link:    link,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Verify runs sanity checks of the repository and all its worktree links and
+// returns report of the problems found. Verify is read-only and doesn't fix
+// anything, problems are fixed by the next mirror cycle or clean up.
+// error is only returned if checks couldn't be run.
+func (r *Repository) Verify(ctx context.Context) (VerifyReport, error) {
+	report := VerifyReport{Remote: r.remote, Problems: []VerifyProblem{}}
+
+	if err := r.lock.RLockContext(ctx); err != nil {
+		return report, fmt.Errorf("unable to acquire repository lock err:%w", err)
+	}
+	defer r.lock.RUnlock()
+
+	if _, err := os.Stat(r.dir); err != nil {
+		report.add(VerifyCheckRepo, "", r.dir, "unable to read repo dir err:%s", err)
+	} else if err := r.checkRepo(ctx); err != nil {
+		report.add(VerifyCheckRepo, "", r.dir, "%s", err)
+	}
+
+	links := make([]string, 0, len(r.workTreeLinks))
+	for link := range r.workTreeLinks {
+		links = append(links, link)
+	}
+	slices.Sort(links)
+
+	var currentWTDirs []string
+	for _, link := range links {
+		if wtDir := r.verifyWorktreeLink(ctx, r.workTreeLinks[link], &report); wtDir != "" {
+			currentWTDirs = append(currentWTDirs, wtDir)
+		}
+	}
+
+	entries, err := os.ReadDir(r.worktreesRoot())
+	if err != nil && !os.IsNotExist(err) {
+		report.add(VerifyCheckStaleWorktree, "", r.worktreesRoot(), "unable to read worktrees root err:%s", err)
+	}
+	for _, e := range entries {
+		if e.Name() == layoutVersionFile || slices.Contains(currentWTDirs, e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > staleTimeout {
+			report.add(VerifyCheckStaleWorktree, "", filepath.Join(r.worktreesRoot(), e.Name()),
+				"worktree is not published and is older than %s", staleTimeout)
+		}
+	}
+
+	return report, nil
+}
+
+// verifyWorktreeLink adds problems of the given worktree link to the report
+// and returns dir name of the published worktree if its inside worktrees root
+func (r *Repository) verifyWorktreeLink(ctx context.Context, wl *WorkTreeLink, report *VerifyReport) string {
+	target, err := readAbsLink(wl.link)
+	if err != nil {
+		report.add(VerifyCheckLink, wl.link, wl.link, "unable to read link err:%s", err)
+		return ""
+	}
+	if target == "" {
+		if _, err := os.Stat(wl.hashFile()); err == nil {
+			report.add(VerifyCheckHashFile, wl.link, wl.hashFile(), "hash file exists but link is not published")
+		}
+		report.add(VerifyCheckLink, wl.link, wl.link, "link is not published")
+		return ""
+	}
+	if _, err := os.Stat(target); err != nil {
+		report.add(VerifyCheckLink, wl.link, target, "link target doesn't resolve err:%s", err)
+		return ""
+	}
+
+	wt, err := wl.currentWorktree()
+	if err != nil {
+		report.add(VerifyCheckLink, wl.link, wl.link, "unable to read current worktree err:%s", err)
+		return ""
+	}
+	if !strings.HasPrefix(wt, r.worktreesRoot()+"/") {
+		report.add(VerifyCheckLink, wl.link, target, "link doesn't point to the worktree of the repository")
+		return ""
+	}
+	_, wtDir := splitAbs(wt)
+
+	if err := wl.checkWorktree(ctx, wt); err != nil {
+		report.add(VerifyCheckWorktree, wl.link, wt, "%s", err)
+		return wtDir
+	}
+
+	// git rev-parse HEAD
+	hash, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, wt, "rev-parse", "HEAD")
+	if err != nil {
+		report.add(VerifyCheckWorktree, wl.link, wt, "unable to get worktree hash err:%s", err)
+		return wtDir
+	}
+	published, err := wl.CurrentHash()
+	switch {
+	case err != nil:
+		report.add(VerifyCheckHashFile, wl.link, wl.hashFile(), "unable to read hash file err:%s", err)
+	case published == "":
+		report.add(VerifyCheckHashFile, wl.link, wl.hashFile(), "hash file is missing")
+	case published != hash:
+		report.add(VerifyCheckHashFile, wl.link, wl.hashFile(), "hash file hash:%s doesn't match worktree hash:%s", published, hash)
+	}
+	return wtDir
+}
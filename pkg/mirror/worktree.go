@@ -2,60 +2,405 @@ package mirror
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/utilitywarehouse/git-mirror/pkg/lock"
+)
+
+// hashFileSuffix is added to the link path to get the path of the file
+// which contains details of the published worktree
+const hashFileSuffix = ".hash"
+
+// WorktreeStatus represents the state of the worktree link after the last
+// mirror cycle
+type WorktreeStatus string
+
+const (
+	// WorktreeStatusUnknown worktree link has not been through a mirror cycle yet
+	WorktreeStatusUnknown WorktreeStatus = "unknown"
+	// WorktreeStatusPending ref resolves but no commit touches the pathspec yet,
+	// (eg. dir only exists on other branch) hence nothing is published
+	WorktreeStatusPending WorktreeStatus = "pending"
+	// WorktreeStatusReady worktree is checked out and published on the link
+	WorktreeStatusReady WorktreeStatus = "ready"
+	// WorktreeStatusFailed last attempt to ensure worktree failed
+	WorktreeStatusFailed WorktreeStatus = "failed"
+	// WorktreeStatusRefMissing ref of the worktree doesn't exist in the
+	// mirror (eg. branch is not created on the remote yet)
+	WorktreeStatusRefMissing WorktreeStatus = "ref-missing"
+	// WorktreeStatusBlocked update of the worktree is blocked as new hash is
+	// not a descendant of the published one, old content is still published
+	WorktreeStatusBlocked WorktreeStatus = "blocked"
+	// WorktreeStatusPaused worktree link was rolled back to the previous
+	// worktree and its updates are paused until resumed
+	WorktreeStatusPaused WorktreeStatus = "paused"
+)
+
+// LinkState is the health state of the worktree link used for alerting
+type LinkState string
+
+const (
+	// LinkStateNeverSynced worktree hasn't been published since start
+	// (eg. its ref doesn't exist on the remote yet)
+	LinkStateNeverSynced LinkState = "never-synced"
+	// LinkStateStale worktree was last confirmed up to date longer ago
+	// than the stale threshold
+	LinkStateStale LinkState = "stale"
+	// LinkStateHealthy worktree was confirmed up to date recently
+	LinkStateHealthy LinkState = "healthy"
 )
 
+// SubmoduleMode represents how submodules are checked out in the worktree
+type SubmoduleMode string
+
+const (
+	// SubmodulesOff submodule directories are left empty
+	SubmodulesOff SubmoduleMode = "false"
+	// SubmodulesOn top level submodules are initialised and checked out
+	SubmodulesOn SubmoduleMode = "true"
+	// SubmodulesRecursive submodules are initialised and checked out recursively
+	SubmodulesRecursive SubmoduleMode = "recursive"
+)
+
+func (m SubmoduleMode) validate() error {
+	switch m {
+	case "", SubmodulesOff, SubmodulesOn, SubmodulesRecursive:
+		return nil
+	}
+	return fmt.Errorf("wrong submodules value provided '%s', must be one of %s, %s, %s",
+		m, SubmodulesOff, SubmodulesOn, SubmodulesRecursive)
+}
+
+func (m SubmoduleMode) enabled() bool {
+	return m == SubmodulesOn || m == SubmodulesRecursive
+}
+
+// RefSortMode represents how tags matching ref pattern are sorted to pick
+// the latest one
+type RefSortMode string
+
+const (
+	// RefSortVersion tags are sorted by treating tag names as versions
+	RefSortVersion RefSortMode = "version"
+	// RefSortCreatorDate tags are sorted by the tag (or commit) creation date
+	RefSortCreatorDate RefSortMode = "creatordate"
+)
+
+func (m RefSortMode) validate() error {
+	switch m {
+	case "", RefSortVersion, RefSortCreatorDate:
+		return nil
+	}
+	return fmt.Errorf("wrong ref sort value provided '%s', must be one of %s, %s",
+		m, RefSortVersion, RefSortCreatorDate)
+}
+
+// sortKey returns for-each-ref sort key for descending order
+func (m RefSortMode) sortKey() string {
+	if m == RefSortCreatorDate {
+		return "-creatordate"
+	}
+	return "-v:refname"
+}
+
+// PublishMode represents how the worktree is published on the link
+type PublishMode string
+
+const (
+	// PublishModeSymlink link points directly to the worktree
+	PublishModeSymlink PublishMode = "symlink"
+	// PublishModeCopy worktree content is copied (or hard linked) into a
+	// versioned dir next to the link and link points to the copy. this is
+	// useful if consumers can't follow symlinks outside of the link dir.
+	PublishModeCopy PublishMode = "copy"
+)
+
+func (m PublishMode) validate() error {
+	switch m {
+	case "", PublishModeSymlink, PublishModeCopy:
+		return nil
+	}
+	return fmt.Errorf("wrong publish mode value provided '%s', must be one of %s, %s",
+		m, PublishModeSymlink, PublishModeCopy)
+}
+
 type WorkTreeLink struct {
-	name     string // link file name might not be unique only use it for logging
-	link     string // the path at which to create a symlink to the worktree dir
-	ref      string // the ref of the worktree
-	pathspec string // pathspec of the dirs to checkout
-	log      *slog.Logger
+	name       string         // link file name might not be unique only use it for logging
+	link       string         // the path at which to create a symlink to the worktree dir
+	ref        string         // the ref of the worktree, empty if refPattern is set
+	refPattern string         // glob pattern of the tags to track instead of ref
+	refSort    RefSortMode    // sort order used to pick tag matching refPattern
+	refPrec    RefPrecedence  // precedence used to expand short ref name
+	currentRef string         // ref resolved on last mirror cycle
+	refName    string         // full ref name resolved on last mirror cycle
+	ambiguous  bool           // short ref name matched more than one ref on last mirror cycle
+	pathspec   string         // pathspec of the dirs to checkout
+	sparse     bool           // use sparse-checkout in cone mode for the pathspec
+	submodules SubmoduleMode  // submodules checkout mode
+	strictSpec bool           // fail worktree update if pathspec doesn't match any file
+	emptySpec  bool           // pathspec didn't match any file on last mirror cycle
+	specHash   string         // hash on which pathspec was last checked
+	exportIgn  bool           // remove paths with export-ignore attribute after checkout
+	publish    PublishMode    // how worktree is published on the link
+	protect    bool           // block update if new hash is not a descendant of the published one
+	blocked    string         // hash of the blocked update, empty if not blocked
+	auto       bool           // link is maintained by the auto worktree rule of the repository
+	approved   string         // hash approved to be published even if its not a descendant
+	previous   []string       // abs paths of the previously published worktrees retained for rollback, most recent first
+	paused     bool           // link was rolled back and updates are paused until resumed
+	wtRoot     string         // abs path of the repository worktrees root
+	perms      wtPermissions  // ownership and modes applied to the worktree files
+	runner     GitRunner      // runs git commands of the repository
+	envs       []string       // envs of the repository git commands
+	gitOps     *gitOpsLimiter // limits concurrent git commands of the repository
+	repoLock   *lock.RWMutex  // lock of the repository which protects state of the link
+	status     WorktreeStatus // status of the worktree after last mirror cycle
+	lastSynced time.Time      // time worktree was last published or confirmed up to date
+	lastErr    error          // error of the last attempt to ensure worktree, nil on success
+	restored   *linkState     // state recorded before restart, only used by first mirror cycle
+	pinnedHash string         // hash published for the pinned commit, resolved only once
+	log        *slog.Logger
 }
 
-// worktreeDirName will generate worktree name for specific worktree link
-// two worktree links can be on same ref but with diff pathspecs
-// hence we cant just use tree hash as path
+// State returns health state of the worktree link at the given time. link is
+// stale if it hasn't been confirmed up to date for longer than staleAfter,
+// which includes failed cycles and cycles delayed by failure backoff.
+func (w *WorkTreeLink) State(now time.Time, staleAfter time.Duration) LinkState {
+	w.repoLock.RLock()
+	defer w.repoLock.RUnlock()
+
+	return w.state(now, staleAfter)
+}
+
+// state returns health state of the worktree link, see State.
+// it must be called with repository lock held.
+func (w *WorkTreeLink) state(now time.Time, staleAfter time.Duration) LinkState {
+	switch {
+	case w.lastSynced.IsZero():
+		return LinkStateNeverSynced
+	case now.Sub(w.lastSynced) > staleAfter:
+		return LinkStateStale
+	default:
+		return LinkStateHealthy
+	}
+}
+
+// worktreeDirName will generate worktree name for the given hash.
+// two worktree links can be on same ref but with diff pathspecs hence we
+// cant just use hash as path. name is keyed by the hash and checkout settings
+// of the link instead of link name so that links with same ref and pathspec
+// share the same worktree dir
 func (w *WorkTreeLink) worktreeDirName(hash string) string {
-	parts := strings.Split(strings.Trim(w.link, "/"), "/")
-	return parts[len(parts)-1] + "-" + hash[:7]
+	if w.sparse {
+		return hash + "-sparse-" + w.checkoutKey()
+	}
+	return hash + "-" + w.checkoutKey()
+}
+
+// isWorktreePath returns true if path is the worktree dir of the given
+// worktree path, worktree re-created while its dir was still published has
+// unique suffix after the dir name, see createWorktree
+func isWorktreePath(path, wtPath string) bool {
+	return path == wtPath || strings.HasPrefix(path, wtPath+".")
+}
+
+// checkoutKey returns short digest of the link settings which affect content
+// of the checked out worktree
+func (w *WorkTreeLink) checkoutKey() string {
+	submodules := SubmodulesOff
+	if w.submodules.enabled() {
+		submodules = w.submodules
+	}
+	key := fmt.Sprintf("pathspec=%s\nsparse=%t\nsubmodules=%s\nperms=%+v", w.pathspec, w.sparse, submodules, w.perms)
+	// only added if enabled so that existing worktree dir names don't change
+	if w.exportIgn {
+		key += "\nexport-ignore=true"
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
 }
 
-// currentWorktree reads symlink path of the given worktree link
+// currentWorktree returns path of the worktree published on the link.
+// if link points to a copy, path of the worktree it was copied from is returned
 func (wl *WorkTreeLink) currentWorktree() (string, error) {
-	return readAbsLink(wl.link)
+	target, err := readAbsLink(wl.link)
+	if err != nil || target == "" || filepath.Dir(target) != wl.copiesDir() {
+		return target, err
+	}
+	// copy dir is named '<worktree dir>.<random>'
+	name := filepath.Base(target)
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return filepath.Join(wl.wtRoot, name), nil
 }
 
-// workTreeHash returns the hash of the given revision and for the path if specified.
-func (wl *WorkTreeLink) workTreeHash(ctx context.Context, wt string) (string, error) {
-	// if worktree is not valid then command can return HEAD of the mirrored repo
-	// instead of worktree
-	if !wl.isInsideWorkTree(ctx, wt) {
-		return "", fmt.Errorf("worktree is not a valid git worktree")
+// copiesDir returns abs path of the dir next to the link where worktree
+// copies are published in copy mode
+func (wl *WorkTreeLink) copiesDir() string {
+	linkDir, linkFile := splitAbs(wl.link)
+	return filepath.Join(linkDir, "."+linkFile+".copies")
+}
+
+// isPublished returns true if link points to the given worktree using the
+// configured publish mode
+func (wl *WorkTreeLink) isPublished(wt string) bool {
+	target, err := readAbsLink(wl.link)
+	if err != nil {
+		return false
+	}
+	if wl.publish == PublishModeCopy {
+		return filepath.Dir(target) == wl.copiesDir()
 	}
-	// git rev-parse HEAD
-	return runGitCommand(ctx, wl.log, nil, wt, "rev-parse", "HEAD")
+	return target == wt
 }
 
-// isInsideWorkTree will make sure given worktree dir is inside worktree dir
-// (.git file exists)
-func (wl *WorkTreeLink) isInsideWorkTree(ctx context.Context, wt string) bool {
+// publishWorktree publishes given worktree on the link. in copy mode
+// worktree is first copied into new versioned dir next to the link, so
+// readers following the link either see old or new copy and never a partially
+// copied tree. old copies are removed by clean up after stale timeout.
+func (wl *WorkTreeLink) publishWorktree(wt string) error {
+	target := wt
+	if wl.publish == PublishModeCopy {
+		if err := mkdirAllMode(wl.copiesDir(), wl.linkDirMode()); err != nil {
+			return fmt.Errorf("unable to create copies dir err:%w", err)
+		}
+		target = filepath.Join(wl.copiesDir(), filepath.Base(wt)+"."+nextRandom())
+		if err := copyWorktreeAtomic(wt, target); err != nil {
+			return err
+		}
+	}
+	if err := publishSymlink(wl.link, target, wl.linkDirMode()); err != nil {
+		return fmt.Errorf("unable to publish symlink err:%w", err)
+	}
+	return nil
+}
+
+// removeCopies removes copies dir of the link along with all the copies
+func (wl *WorkTreeLink) removeCopies() error {
+	linkDir, _ := splitAbs(wl.link)
+	return safeRemoveAll(linkDir, wl.copiesDir())
+}
+
+// linkDirMode returns mode of the dirs created for the link, configured dir
+// mode of the worktree is used if set
+func (wl *WorkTreeLink) linkDirMode() fs.FileMode {
+	if wl.perms.dirMode != 0 {
+		return wl.perms.dirMode
+	}
+	return defaultDirMode
+}
+
+// removeStaleCopies removes copies which are not published on the link and
+// are older than stale timeout. copies dir is removed once link is no
+// longer in copy mode and all the copies are removed
+func (wl *WorkTreeLink) removeStaleCopies() error {
+	target, err := readAbsLink(wl.link)
+	if err != nil {
+		return err
+	}
+	linkDir, _ := splitAbs(wl.link)
+	err = removeDirContentsIf(linkDir, wl.copiesDir(), wl.log, func(fi os.FileInfo) (bool, error) {
+		if filepath.Join(wl.copiesDir(), fi.Name()) != target && time.Since(fi.ModTime()) > staleTimeout {
+			wl.log.Info("removing stale worktree copy", "copy", fi.Name())
+			return true, nil
+		}
+		return false, nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if wl.publish != PublishModeCopy {
+		// only removes empty dir
+		os.Remove(wl.copiesDir())
+	}
+	return nil
+}
+
+// CurrentHash returns the commit hash of the currently published worktree
+// by reading the hash file published next to the link.
+// empty hash is returned if worktree is not published yet
+func (wl *WorkTreeLink) CurrentHash() (string, error) {
+	return wl.readHashFile("hash")
+}
+
+// CurrentRef returns the ref of the currently published worktree by reading
+// the hash file published next to the link. for links with ref pattern this
+// is the matched tag. empty ref is returned if worktree is not published yet
+func (wl *WorkTreeLink) CurrentRef() (string, error) {
+	return wl.readHashFile("ref")
+}
+
+// readHashFile returns value of the given key from the hash file
+func (wl *WorkTreeLink) readHashFile(key string) (string, error) {
+	data, err := os.ReadFile(wl.hashFile())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, key+"="); ok {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in the hash file %s", key, wl.hashFile())
+}
+
+// hashFile returns path of the file published next to the link
+func (wl *WorkTreeLink) hashFile() string {
+	return wl.link + hashFileSuffix
+}
+
+// writeHashFile atomically writes checked out commit hash, ref and mirror
+// time to the hash file so consumers without git can read it
+func (wl *WorkTreeLink) writeHashFile(hash, ref string, t time.Time) error {
+	content := fmt.Sprintf("hash=%s\nref=%s\ntime=%s\n", hash, ref, t.UTC().Format(time.RFC3339))
+	return writeFileAtomic(wl.hashFile(), []byte(content))
+}
+
+// removeHashFile removes hash file of the link if exists
+func (wl *WorkTreeLink) removeHashFile() error {
+	if err := os.Remove(wl.hashFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// workTreeHash returns the hash of the given revision and for the path if specified.
+func (wl *WorkTreeLink) workTreeHash(ctx context.Context, wt string) (string, error) {
 	// worktree path should not be empty and must be absolute
 	if !filepath.IsAbs(wt) {
-		return false
+		return "", fmt.Errorf("worktree path must be absolute")
 	}
-	// git rev-parse --is-inside-work-tree
-	if ok, err := runGitCommand(ctx, wl.log, nil, wt, "rev-parse", "--is-inside-work-tree"); err != nil {
-		wl.log.Error("unable to verify if is-inside-work-tree", "path", wt, "err", err)
-		return false
-	} else if ok != "true" {
+	// if worktree is not valid then command can return HEAD of the mirrored repo
+	// instead of worktree, so both are checked in the single command
+	// git rev-parse --is-inside-work-tree HEAD
+	out, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, wt, "rev-parse", "--is-inside-work-tree", "HEAD")
+	if err != nil {
+		wl.log.Error("given path is not inside the worktree", "path", wt, "err", err)
+		return "", fmt.Errorf("worktree is not a valid git worktree")
+	}
+	inside, hash, _ := strings.Cut(out, "\n")
+	if inside != "true" {
 		wl.log.Error("given path is not inside the worktree", "path", wt)
-		return false
+		return "", fmt.Errorf("worktree is not a valid git worktree")
 	}
-	return true
+	return strings.TrimSpace(hash), nil
 }
 
 // sanityCheckWorktree tries to make sure that the dir is a valid worktree repository.
@@ -71,39 +416,65 @@ func (wl *WorkTreeLink) sanityCheckWorktree(ctx context.Context) bool {
 	if wt == "" {
 		return false
 	}
+	if err := wl.checkWorktree(ctx, wt); err != nil {
+		if errors.Is(err, errDirEmpty) {
+			wl.log.Info("worktree directory is empty", "path", wt)
+		} else {
+			wl.log.Error("worktree failed sanity checks", "path", wt, "err", err)
+		}
+		return false
+	}
+	return true
+}
 
+// checkWorktree runs sanity checks on the given worktree dir and returns the
+// first failed check as error
+func (wl *WorkTreeLink) checkWorktree(ctx context.Context, wt string) error {
 	// If it is empty, we are done.
 	if empty, err := dirIsEmpty(wt); err != nil {
-		wl.log.Error("can't list worktree directory", "path", wt, "err", err)
-		return false
+		return fmt.Errorf("can't list worktree directory err:%w", err)
 	} else if empty {
-		wl.log.Info("worktree directory is empty", "path", wt)
-		return false
+		return errDirEmpty
 	}
 
-	// makes sure path is inside the work tree of the repository
-	if !wl.isInsideWorkTree(ctx, wt) {
-		return false
+	// worktree path should not be empty and must be absolute
+	if !filepath.IsAbs(wt) {
+		return fmt.Errorf("worktree path must be absolute")
 	}
 
-	// Check that this is actually the root of the worktree.
-	// git rev-parse --show-toplevel
-	if root, err := runGitCommand(ctx, wl.log, nil, wt, "rev-parse", "--show-toplevel"); err != nil {
-		wl.log.Error("can't get worktree git dir", "path", wt, "err", err)
-		return false
-	} else {
-		if root != wt {
-			wl.log.Error("worktree directory is under another worktree", "path", wt, "parent", root)
-			return false
+	// makes sure path is inside the work tree of the repository and that
+	// this is actually the root of the worktree.
+	// git rev-parse --is-inside-work-tree --show-toplevel
+	out, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, wt, "rev-parse", "--is-inside-work-tree", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("unable to verify if is-inside-work-tree err:%w", err)
+	}
+	if inside, root, _ := strings.Cut(out, "\n"); inside != "true" {
+		return fmt.Errorf("given path is not inside the worktree")
+	} else if root = strings.TrimSpace(root); root != wt {
+		return fmt.Errorf("worktree directory is under another worktree parent:%s", root)
+	}
+
+	// make sure sparse-checkout state matches config so switching between
+	// sparse and non-sparse re-creates the worktree
+	// git config --type=bool --default=false --get core.sparseCheckout
+	if sparse, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, wt, "config", "--type=bool", "--default=false", "--get", "core.sparseCheckout"); err != nil {
+		return fmt.Errorf("can't get worktree sparse-checkout config err:%w", err)
+	} else if sparse != strconv.FormatBool(wl.sparse) {
+		return fmt.Errorf("worktree sparse-checkout doesn't match config sparse:%s", sparse)
+	}
+
+	if wl.exportIgn {
+		if err := wl.checkExportIgnored(ctx, wt); err != nil {
+			return err
 		}
 	}
 
 	// Consistency-check the repo.
 	// git fsck --no-progress --connectivity-only
-	if _, err := runGitCommand(ctx, wl.log, nil, wt, "fsck", "--no-progress", "--connectivity-only"); err != nil {
-		wl.log.Error("repo fsck failed", "path", wt, "err", err)
-		return false
+	if _, err := runGitCommand(ctx, wl.log, wl.gitOps, wl.runner, wl.envs, wt, "fsck", "--no-progress", "--connectivity-only"); err != nil {
+		return fmt.Errorf("worktree fsck failed err:%w", err)
 	}
 
-	return true
+	return nil
 }
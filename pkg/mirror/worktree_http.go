@@ -0,0 +1,117 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// WorktreeHandler returns http.Handler which adds and removes worktree links
+// of the pooled repositories and approves blocked updates of the protected
+// links so that links can be managed on the running instance (eg. by CLI). repository is identified by 'remote' query param
+// which can be remote URL, repo name or existing link (see Lookup).
+//
+//	POST   ?remote=<remote>&link=<link>&ref=<ref>[&pathspec=<pathspec>]
+//	DELETE ?remote=<remote>&link=<link>
+//	PUT    ?remote=<remote>&link=<link>
+//
+// added link and approved update are published by the queued mirror run.
+// 204 is returned on success, 404 if repository or link doesn't exist,
+// 409 if there is no blocked update to approve and 400 for invalid request
+// including absolute links outside of the root unless repository allows
+// them (see RepositoryConfig.AllowLinksOutsideRoot). 500 is returned if link
+// was added but mirror run couldn't be queued, link is then published by the
+// next mirror cycle. adding and removing links requires admin role and
+// approving update requires operator role, see Authorizer.
+func (rp *RepoPool) WorktreeHandler() http.Handler {
+	roles := methodRoles{http.MethodPost: RoleAdmin, http.MethodDelete: RoleAdmin, http.MethodPut: RoleOperator}
+	return rp.authorized(roles, func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		remote, link := query.Get("remote"), query.Get("link")
+		if remote == "" || link == "" {
+			http.Error(w, "remote and link query params are required", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		switch req.Method {
+		case http.MethodPost:
+			if err = rp.AddWorktreeLink(remote, link, query.Get("ref"), query.Get("pathspec")); err != nil {
+				break
+			}
+			// link is already added so failure to queue the run must not
+			// be reported as invalid request
+			if err := rp.QueueMirrorRun(remote); err != nil {
+				rp.log.Error("worktree link added but unable to queue mirror run", "remote", remote, "link", link, "err", err)
+				http.Error(w, fmt.Sprintf("link added but unable to queue mirror run err:%s", err), http.StatusInternalServerError)
+				return
+			}
+		case http.MethodDelete:
+			err = rp.RemoveWorktreeLink(req.Context(), remote, link)
+		case http.MethodPut:
+			err = rp.ApproveWorktreeUpdate(remote, link)
+		}
+
+		switch {
+		case err == nil:
+			rp.log.Info("worktree link updated via http", "method", req.Method, "remote", remote, "link", link)
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, ErrNotExist), errors.Is(err, ErrWorktreeLinkNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrNoBlockedUpdate):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case req.Method == http.MethodPost:
+			// add only fails on invalid link config
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			rp.log.Error("unable to remove worktree link", "remote", remote, "link", link, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// RollbackHandler returns http.Handler which rolls back worktree links of the
+// pooled repositories to the previously published worktree and resumes their
+// updates. repository is identified by 'remote' query param same as
+// WorktreeHandler.
+//
+//	POST   ?remote=<remote>&link=<link>
+//	DELETE ?remote=<remote>&link=<link>
+//
+// updates of the rolled back link are paused until its resumed, resumed link
+// is updated by the queued mirror run. 204 is returned on success, 404 if
+// repository or link doesn't exist, 409 if there is no previous worktree to
+// roll back to or link is not paused and 400 for invalid request. requests
+// require operator role, see Authorizer.
+func (rp *RepoPool) RollbackHandler() http.Handler {
+	roles := methodRoles{http.MethodPost: RoleOperator, http.MethodDelete: RoleOperator}
+	return rp.authorized(roles, func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		remote, link := query.Get("remote"), query.Get("link")
+		if remote == "" || link == "" {
+			http.Error(w, "remote and link query params are required", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		switch req.Method {
+		case http.MethodPost:
+			err = rp.RollbackWorktree(req.Context(), remote, link)
+		case http.MethodDelete:
+			err = rp.ResumeWorktree(remote, link)
+		}
+
+		switch {
+		case err == nil:
+			rp.log.Info("worktree link rollback updated via http", "method", req.Method, "remote", remote, "link", link)
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, ErrNotExist), errors.Is(err, ErrWorktreeLinkNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrNoPreviousWorktree), errors.Is(err, ErrWorktreeNotPaused):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			rp.log.Error("unable to rollback worktree link", "remote", remote, "link", link, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}